@@ -40,6 +40,12 @@ func main() {
 	// Initialize auth service
 	handler.InitAuth(client)
 
+	// Escalate approvals that wait past their company's SLA
+	go handler.WatchApprovalSLAs(context.Background())
+
+	// Open the next period of recurring budgets when one ends
+	go handler.WatchBudgetPeriods(context.Background())
+
 	// Initialize Fiber app
 	app := fiber.New(fiber.Config{
 		AppName: "CT",
@@ -0,0 +1,99 @@
+// Command backfill-ledger posts journal entries for transactions approved before
+// the ledger existed. Transactions that already have an entry are skipped, so the
+// command can be re-run safely.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/minhtranin/ct/internal/db"
+	"github.com/minhtranin/ct/internal/logger"
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/repository"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report how many entries would be posted without writing")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+	if err := logger.InitLogger(); err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+
+	client, err := db.ConnectToMongoDB(os.Getenv("MONGODB_URI"))
+	if err != nil {
+		log.Fatalf("Failed to connect to MongoDB: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	ctx := context.Background()
+	store := repository.NewMongoStore(client)
+	if err := store.EnsureIndexes(ctx); err != nil {
+		log.Fatalf("Failed to create indexes: %v", err)
+	}
+
+	companies, err := store.Directory().Companies(ctx)
+	if err != nil {
+		log.Fatalf("Failed to list companies: %v", err)
+	}
+
+	for _, company := range companies {
+		scope, err := repository.ForCompany(company.ID)
+		if err != nil {
+			continue
+		}
+		posted, err := backfill(ctx, store.Scoped(scope), *dryRun)
+		if err != nil {
+			log.Fatalf("Failed to backfill %s: %v", company.Name, err)
+		}
+		if posted > 0 {
+			log.Printf("%s: %d entries posted", company.Name, posted)
+		}
+	}
+	if *dryRun {
+		log.Println("Dry run, nothing was written")
+	}
+}
+
+// backfill posts an entry for every posted transaction of one company that lacks one
+func backfill(ctx context.Context, repos *repository.Repositories, dryRun bool) (int, error) {
+	transactions, err := repos.Transactions.List(ctx, repository.TransactionFilter{
+		Posted: true,
+	}, repository.Page{})
+	if err != nil {
+		return 0, err
+	}
+
+	posted := 0
+	for i := range transactions {
+		txn := &transactions[i]
+		_, err := repos.Journal.ForTransaction(ctx, txn.ID)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, repository.ErrNotFound) {
+			return posted, err
+		}
+
+		entry, err := models.NewJournalEntry(txn)
+		if err != nil {
+			log.Printf("Skipping transaction %s: %v", txn.ID.Hex(), err)
+			continue
+		}
+		if !dryRun {
+			if err := repos.Journal.Post(ctx, entry); err != nil && !errors.Is(err, repository.ErrAlreadyPosted) {
+				return posted, err
+			}
+		}
+		posted++
+	}
+	return posted, nil
+}
@@ -0,0 +1,179 @@
+// Command migrate-money converts stored amounts from float64 to integer minor units.
+//
+// Documents written before models.Money hold balances and amounts as doubles in
+// major units. Only doubles are converted, so the command can be re-run safely.
+// Transactions and budgets were always saved as "USD"; they take the currency of
+// their account, or the company's base currency, because that is what the
+// amount was entered in.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/minhtranin/ct/internal/db"
+	"github.com/minhtranin/ct/internal/logger"
+	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report how many documents would change without writing")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+	if err := logger.InitLogger(); err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+
+	client, err := db.ConnectToMongoDB(os.Getenv("MONGODB_URI"))
+	if err != nil {
+		log.Fatalf("Failed to connect to MongoDB: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	m := &migration{database: client.Database("ct"), dryRun: *dryRun}
+	ctx := context.Background()
+	if err := m.loadCurrencies(ctx); err != nil {
+		log.Fatalf("Failed to load currencies: %v", err)
+	}
+
+	for _, step := range []struct {
+		name string
+		run  func(context.Context) (int, error)
+	}{
+		{"accounts", m.accounts},
+		{"transactions", m.transactions},
+		{"budgets", m.budgets},
+	} {
+		count, err := step.run(ctx)
+		if err != nil {
+			log.Fatalf("Failed to migrate %s: %v", step.name, err)
+		}
+		log.Printf("%s: %d documents converted", step.name, count)
+	}
+	if m.dryRun {
+		log.Println("Dry run, nothing was written")
+	}
+}
+
+type migration struct {
+	database *mongo.Database
+	dryRun   bool
+
+	companyCurrency map[primitive.ObjectID]string
+	accountCurrency map[primitive.ObjectID]string
+}
+
+// loadCurrencies caches each company's base currency and each account's currency
+func (m *migration) loadCurrencies(ctx context.Context) error {
+	m.companyCurrency = make(map[primitive.ObjectID]string)
+	m.accountCurrency = make(map[primitive.ObjectID]string)
+
+	var companies []models.Company
+	if err := findAll(ctx, m.database.Collection("companies"), bson.M{}, &companies); err != nil {
+		return err
+	}
+	for _, company := range companies {
+		m.companyCurrency[company.ID] = company.Currency
+	}
+
+	var accounts []bson.M
+	if err := findAll(ctx, m.database.Collection("accounts"), bson.M{}, &accounts); err != nil {
+		return err
+	}
+	for _, account := range accounts {
+		id, _ := account["_id"].(primitive.ObjectID)
+		currency, _ := account["currency"].(string)
+		m.accountCurrency[id] = currency
+	}
+	return nil
+}
+
+// baseCurrency returns the company's currency, defaulting to USD like the handlers do
+func (m *migration) baseCurrency(doc bson.M) string {
+	companyID, _ := doc["company_id"].(primitive.ObjectID)
+	if currency := m.companyCurrency[companyID]; currency != "" {
+		return currency
+	}
+	return "USD"
+}
+
+// accounts converts balances using each account's own currency
+func (m *migration) accounts(ctx context.Context) (int, error) {
+	return m.convert(ctx, "accounts", []string{"balance"}, func(doc bson.M) string {
+		if currency, _ := doc["currency"].(string); currency != "" {
+			return currency
+		}
+		return m.baseCurrency(doc)
+	})
+}
+
+// transactions converts amounts using the currency of the account they move money in
+func (m *migration) transactions(ctx context.Context) (int, error) {
+	return m.convert(ctx, "transactions", []string{"amount"}, func(doc bson.M) string {
+		for _, field := range []string{"from_account_id", "to_account_id"} {
+			accountID, _ := doc[field].(primitive.ObjectID)
+			if currency := m.accountCurrency[accountID]; currency != "" {
+				return currency
+			}
+		}
+		return m.baseCurrency(doc)
+	})
+}
+
+// budgets converts limits and spend using the company's base currency
+func (m *migration) budgets(ctx context.Context) (int, error) {
+	return m.convert(ctx, "budgets", []string{"amount", "spent"}, m.baseCurrency)
+}
+
+// convert rewrites every double in fields as minor units of the document's currency
+func (m *migration) convert(ctx context.Context, collection string, fields []string, currencyOf func(bson.M) string) (int, error) {
+	var anyDouble bson.A
+	for _, field := range fields {
+		anyDouble = append(anyDouble, bson.M{field: bson.M{"$type": "double"}})
+	}
+
+	var docs []bson.M
+	if err := findAll(ctx, m.database.Collection(collection), bson.M{"$or": anyDouble}, &docs); err != nil {
+		return 0, err
+	}
+
+	var writes []mongo.WriteModel
+	for _, doc := range docs {
+		currency := currencyOf(doc)
+		set := bson.M{"currency": currency}
+		for _, field := range fields {
+			if amount, ok := doc[field].(float64); ok {
+				set[field] = models.MoneyFromFloat(amount, currency)
+			}
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": doc["_id"], "$or": anyDouble}).
+			SetUpdate(bson.M{"$set": set}))
+	}
+
+	if m.dryRun || len(writes) == 0 {
+		return len(writes), nil
+	}
+	result, err := m.database.Collection(collection).BulkWrite(ctx, writes)
+	if err != nil {
+		return 0, err
+	}
+	return int(result.ModifiedCount), nil
+}
+
+func findAll(ctx context.Context, collection *mongo.Collection, filter bson.M, out interface{}) error {
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, out)
+}
@@ -0,0 +1,98 @@
+// Command reconcile recomputes account balances and budget spend from approved
+// transactions and reports every company whose stored figures disagree.
+// With -apply it writes the recomputed figures and records an audit entry for each.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"slices"
+
+	"github.com/joho/godotenv"
+	"github.com/minhtranin/ct/internal/db"
+	"github.com/minhtranin/ct/internal/logger"
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/reconcile"
+	"github.com/minhtranin/ct/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// actor is recorded as the user behind corrections made from the command line
+var actor = &models.User{Name: "Reconcile command"}
+
+func main() {
+	apply := flag.Bool("apply", false, "write the recomputed figures instead of only reporting them")
+	companyHex := flag.String("company", "", "only reconcile the company with this ID")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+	if err := logger.InitLogger(); err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+
+	client, err := db.ConnectToMongoDB(os.Getenv("MONGODB_URI"))
+	if err != nil {
+		log.Fatalf("Failed to connect to MongoDB: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	var only primitive.ObjectID
+	if *companyHex != "" {
+		only, err = primitive.ObjectIDFromHex(*companyHex)
+		if err != nil {
+			log.Fatalf("Invalid company ID: %v", err)
+		}
+	}
+
+	ctx := context.Background()
+	store := repository.NewMongoStore(client)
+	companies, err := store.Directory().Companies(ctx)
+	if err != nil {
+		log.Fatalf("Failed to list companies: %v", err)
+	}
+	if !only.IsZero() {
+		companies = slices.DeleteFunc(companies, func(company models.Company) bool { return company.ID != only })
+	}
+	total := 0
+	for _, company := range companies {
+		scope, err := repository.ForCompany(company.ID)
+		if err != nil {
+			continue
+		}
+		repos := store.Scoped(scope)
+
+		var discrepancies []reconcile.Discrepancy
+		if *apply {
+			discrepancies, err = reconcile.Repair(ctx, repos, actor)
+		} else {
+			discrepancies, err = reconcile.Check(ctx, repos)
+		}
+		if err != nil {
+			log.Fatalf("Failed to reconcile %s (%s): %v", company.Name, company.ID.Hex(), err)
+		}
+		if len(discrepancies) == 0 {
+			continue
+		}
+
+		log.Printf("%s (%s): %d discrepancies", company.Name, company.ID.Hex(), len(discrepancies))
+		for _, d := range discrepancies {
+			log.Printf("  %s %q %s: recorded %s, expected %s (off by %s)",
+				d.Entity, d.Name, d.Field,
+				d.Recorded.Format(d.Currency), d.Expected.Format(d.Currency), d.Difference().Format(d.Currency))
+		}
+		total += len(discrepancies)
+	}
+
+	switch {
+	case total == 0:
+		log.Println("Everything reconciles")
+	case *apply:
+		log.Printf("Corrected %d figures", total)
+	default:
+		log.Printf("Found %d discrepancies; re-run with -apply to correct them", total)
+	}
+}
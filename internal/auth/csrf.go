@@ -0,0 +1,40 @@
+// Package auth handles CSRF tokens
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+)
+
+const (
+	// CSRFCookieName holds the per-browser token for the double-submit check
+	CSRFCookieName = "csrf_token"
+	// CSRFHeaderName is sent by HTMX requests
+	CSRFHeaderName = "X-CSRF-Token"
+	// CSRFFormField is sent by plain HTML form posts
+	CSRFFormField = "_csrf"
+	// CSRFLocalsKey is where the middleware stores the token for templates
+	CSRFLocalsKey = "csrf_token"
+)
+
+// CSRFToken returns the request's CSRF token from a render context.
+// Fiber locals are exposed through the fasthttp request context passed to templ.
+func CSRFToken(ctx context.Context) string {
+	token, _ := ctx.Value(CSRFLocalsKey).(string)
+	return token
+}
+
+// CSRFHeaders returns the hx-headers JSON carrying the request's CSRF token
+func CSRFHeaders(ctx context.Context) string {
+	headers, _ := json.Marshal(map[string]string{CSRFHeaderName: CSRFToken(ctx)})
+	return string(headers)
+}
+
+// ValidCSRFToken compares the submitted token with the cookie in constant time
+func ValidCSRFToken(cookieToken, submitted string) bool {
+	if cookieToken == "" || submitted == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookieToken), []byte(submitted)) == 1
+}
@@ -3,6 +3,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 
 	"golang.org/x/crypto/bcrypt"
@@ -37,3 +38,9 @@ func GenerateToken() (string, error) {
 	}
 	return hex.EncodeToString(bytes), nil
 }
+
+// HashToken returns the SHA-256 hex digest of a token so it can be stored and looked up safely
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
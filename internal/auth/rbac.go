@@ -78,6 +78,11 @@ func CanGenerateReports(role string) bool {
 	return HasPermission(role, RoleLevel[RoleAccountant])
 }
 
+// CanSettle checks if the role can mark approved transactions as paid
+func CanSettle(role string) bool {
+	return HasPermission(role, RoleLevel[RoleAccountant])
+}
+
 // CanManageTeam checks if the role can manage team members
 func CanManageTeam(role string) bool {
 	return HasPermission(role, RoleLevel[RoleManager])
@@ -103,6 +108,11 @@ func CanAccessSettings(role string) bool {
 	return HasPermission(role, RoleLevel[RoleAdmin])
 }
 
+// CanReconcile checks if the role can recompute and correct stored balances
+func CanReconcile(role string) bool {
+	return HasPermission(role, RoleLevel[RoleAdmin])
+}
+
 // IsDeveloper checks if the role is developer
 func IsDeveloper(role string) bool {
 	return Role(role) == RoleDeveloper
@@ -197,3 +207,12 @@ func IsValidRole(role string) bool {
 	}
 	return false
 }
+
+// CanAssignRole checks if a user may give the target role to someone else, e.g. in an invitation.
+// Nobody can hand out a role above their own, and the developer role is never assignable.
+func CanAssignRole(actorRole, targetRole string) bool {
+	if !IsValidRole(targetRole) || Role(targetRole) == RoleDeveloper {
+		return false
+	}
+	return GetRoleLevel(targetRole) <= GetRoleLevel(actorRole)
+}
@@ -2,63 +2,271 @@
 package auth
 
 import (
+	"context"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// SessionManager handles user sessions
-type SessionManager struct{}
+const (
+	// SessionCookieName is the cookie holding the opaque session token
+	SessionCookieName = "session_token"
+	// SessionTTL is the absolute lifetime of a session
+	SessionTTL = 7 * 24 * time.Hour
+	// SessionIdleTimeout ends sessions that have not been used for this long
+	SessionIdleTimeout = 24 * time.Hour
+	// PendingSessionTTL is how long a user has to enter the second factor after the password
+	PendingSessionTTL = 10 * time.Minute
+	// sessionTouchInterval limits how often last_seen_at is written
+	sessionTouchInterval = time.Minute
+	// legacyCookieName is the old raw user ID cookie, cleared on sign-in and sign-out
+	legacyCookieName = "user_id"
+	// sessionLocalsKey caches the loaded session for the rest of the request
+	sessionLocalsKey = "session"
+)
+
+// SessionManager handles user sessions stored in the sessions collection
+type SessionManager struct {
+	sessions *mongo.Collection
+}
 
 // NewSessionManager creates a new session manager
-func NewSessionManager() *SessionManager {
-	return &SessionManager{}
+func NewSessionManager(client *mongo.Client) *SessionManager {
+	return &SessionManager{
+		sessions: client.Database("ct").Collection("sessions"),
+	}
 }
 
-// SetSession sets the user session cookie
+// EnsureIndexes creates the lookup and TTL indexes for the sessions collection
+func (s *SessionManager) EnsureIndexes(ctx context.Context) error {
+	_, err := s.sessions.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// SetSession creates a new server-side session and sets the session cookie
 func (s *SessionManager) SetSession(c *fiber.Ctx, user *models.User) error {
+	return s.startSession(c, user, false, SessionTTL)
+}
+
+// SetPendingSession starts a short-lived session that only allows completing two-factor sign-in
+func (s *SessionManager) SetPendingSession(c *fiber.Ctx, user *models.User) error {
+	return s.startSession(c, user, true, PendingSessionTTL)
+}
+
+// startSession stores a new session and hands its token to the browser
+func (s *SessionManager) startSession(c *fiber.Ctx, user *models.User, mfaPending bool, ttl time.Duration) error {
+	token, err := GenerateToken()
+	if err != nil {
+		return err
+	}
+
+	session := models.NewSession(HashToken(token), user, c.IP(), c.Get("User-Agent"), ttl)
+	session.MFAPending = mfaPending
+	if _, err := s.sessions.InsertOne(c.Context(), session); err != nil {
+		return err
+	}
+
 	c.Cookie(&fiber.Cookie{
-		Name:     "user_id",
-		Value:    user.ID.Hex(),
+		Name:     SessionCookieName,
+		Value:    token,
 		HTTPOnly: true,
 		Secure:   c.Protocol() == "https", // Only use HTTPS in production
 		SameSite: "lax",
-		MaxAge:   86400 * 7, // 7 days
+		MaxAge:   int(ttl.Seconds()),
 	})
+	s.clearLegacyCookie(c)
+	c.Locals(sessionLocalsKey, session)
 	return nil
 }
 
 // GetSession retrieves the current user from session
 func (s *SessionManager) GetSession(c *fiber.Ctx) (primitive.ObjectID, error) {
-	userID := c.Cookies("user_id")
-	if userID == "" {
-		return primitive.NilObjectID, fiber.NewError(fiber.StatusUnauthorized, "Not authenticated")
+	session, err := s.CurrentSession(c)
+	if err != nil {
+		return primitive.NilObjectID, err
 	}
+	return session.UserID, nil
+}
 
-	objectID, err := primitive.ObjectIDFromHex(userID)
+// CurrentSession loads the active session for the request, rejecting expired, revoked
+// and half-finished two-factor sessions
+func (s *SessionManager) CurrentSession(c *fiber.Ctx) (*models.Session, error) {
+	session, err := s.loadSession(c)
 	if err != nil {
-		return primitive.NilObjectID, fiber.NewError(fiber.StatusUnauthorized, "Invalid session")
+		return nil, err
+	}
+	if session.MFAPending {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Two-factor authentication required")
+	}
+	return session, nil
+}
+
+// PendingSession returns the session waiting for a second factor, if any
+func (s *SessionManager) PendingSession(c *fiber.Ctx) (*models.Session, error) {
+	session, err := s.loadSession(c)
+	if err != nil {
+		return nil, err
+	}
+	if !session.MFAPending {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "No pending sign-in")
+	}
+	return session, nil
+}
+
+// loadSession looks up the session behind the cookie, rejecting expired or revoked ones
+func (s *SessionManager) loadSession(c *fiber.Ctx) (*models.Session, error) {
+	if cached, ok := c.Locals(sessionLocalsKey).(*models.Session); ok {
+		return cached, nil
+	}
+
+	token := c.Cookies(SessionCookieName)
+	if token == "" {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Not authenticated")
+	}
+
+	var session models.Session
+	err := s.sessions.FindOne(c.Context(), bson.M{"token_hash": HashToken(token)}).Decode(&session)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid session")
+	}
+
+	now := time.Now()
+	if session.IsRevoked() {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Session revoked")
+	}
+	if session.IsExpired(now, SessionIdleTimeout) {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Session expired")
 	}
 
-	return objectID, nil
+	// Record activity, but not on every single request
+	if now.Sub(session.LastSeenAt) > sessionTouchInterval {
+		session.LastSeenAt = now
+		session.IPAddress = c.IP()
+		s.sessions.UpdateOne(c.Context(), bson.M{"_id": session.ID}, bson.M{
+			"$set": bson.M{
+				"last_seen_at": now,
+				"ip_address":   session.IPAddress,
+			},
+		})
+	}
+
+	c.Locals(sessionLocalsKey, &session)
+	return &session, nil
 }
 
-// ClearSession removes the user session cookie
+// ClearSession revokes the current session and removes the session cookie
 func (s *SessionManager) ClearSession(c *fiber.Ctx) error {
+	if token := c.Cookies(SessionCookieName); token != "" {
+		s.sessions.UpdateOne(c.Context(), bson.M{
+			"token_hash": HashToken(token),
+			"revoked_at": bson.M{"$exists": false},
+		}, bson.M{
+			"$set": bson.M{"revoked_at": time.Now()},
+		})
+	}
+
 	c.Cookie(&fiber.Cookie{
-		Name:     "user_id",
+		Name:     SessionCookieName,
 		Value:    "",
 		Expires:  time.Now().Add(-24 * time.Hour),
 		HTTPOnly: true,
 		SameSite: "lax",
 	})
+	s.clearLegacyCookie(c)
+	c.Locals(sessionLocalsKey, nil)
 	return nil
 }
 
+// ActiveSessionsForUser lists the sessions of a user that are still usable, most recent first
+func (s *SessionManager) ActiveSessionsForUser(ctx context.Context, userID primitive.ObjectID) ([]models.Session, error) {
+	return s.findActive(ctx, bson.M{"user_id": userID})
+}
+
+// ActiveSessionsForCompany lists all usable sessions of a company, most recent first
+func (s *SessionManager) ActiveSessionsForCompany(ctx context.Context, companyID primitive.ObjectID) ([]models.Session, error) {
+	return s.findActive(ctx, bson.M{"company_id": companyID})
+}
+
+// FindSession loads a session by ID
+func (s *SessionManager) FindSession(ctx context.Context, sessionID primitive.ObjectID) (*models.Session, error) {
+	var session models.Session
+	if err := s.sessions.FindOne(ctx, bson.M{"_id": sessionID}).Decode(&session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// RevokeSession revokes a single session
+func (s *SessionManager) RevokeSession(ctx context.Context, sessionID primitive.ObjectID) error {
+	_, err := s.sessions.UpdateOne(ctx, bson.M{
+		"_id":        sessionID,
+		"revoked_at": bson.M{"$exists": false},
+	}, bson.M{
+		"$set": bson.M{"revoked_at": time.Now()},
+	})
+	return err
+}
+
+// RevokeAllForUser revokes every session of a user and returns how many were revoked
+func (s *SessionManager) RevokeAllForUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	result, err := s.sessions.UpdateMany(ctx, bson.M{
+		"user_id":    userID,
+		"revoked_at": bson.M{"$exists": false},
+	}, bson.M{
+		"$set": bson.M{"revoked_at": time.Now()},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// findActive returns non-revoked, non-expired sessions matching the filter
+func (s *SessionManager) findActive(ctx context.Context, filter bson.M) ([]models.Session, error) {
+	now := time.Now()
+	filter["revoked_at"] = bson.M{"$exists": false}
+	filter["mfa_pending"] = bson.M{"$ne": true}
+	filter["expires_at"] = bson.M{"$gt": now}
+	filter["last_seen_at"] = bson.M{"$gt": now.Add(-SessionIdleTimeout)}
+
+	opts := options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}})
+	cursor, err := s.sessions.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []models.Session
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
 // IsAuthenticated checks if user is authenticated
 func (s *SessionManager) IsAuthenticated(c *fiber.Ctx) bool {
 	_, err := s.GetSession(c)
 	return err == nil
 }
+
+// clearLegacyCookie expires the old user_id cookie so it is not sent anymore
+func (s *SessionManager) clearLegacyCookie(c *fiber.Ctx) {
+	if c.Cookies(legacyCookieName) == "" {
+		return
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     legacyCookieName,
+		Value:    "",
+		Expires:  time.Now().Add(-24 * time.Hour),
+		HTTPOnly: true,
+		SameSite: "lax",
+	})
+}
@@ -0,0 +1,206 @@
+// Package auth handles brute-force protection
+package auth
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Throttle scopes
+const (
+	ThrottleScopeAccount = "account"
+	ThrottleScopeIP      = "ip"
+	// ThrottleScopeRecipient counts emails sent to an address on request, e.g.
+	// password reset links. It never locks the account out of signing in.
+	ThrottleScopeRecipient = "recipient"
+)
+
+// Throttled actions
+const (
+	ThrottleSignIn        = "signin"
+	ThrottleTwoFactor     = "2fa"
+	ThrottleVerifyEmail   = "verify_email"
+	ThrottlePasswordReset = "password_reset"
+	ThrottleResetToken    = "reset_token"
+)
+
+// ThrottlePolicy controls when a counter locks and for how long.
+// After FreeAttempts failures every further failure doubles the lockout, up to MaxLockout.
+type ThrottlePolicy struct {
+	FreeAttempts int
+	BaseLockout  time.Duration
+	MaxLockout   time.Duration
+	Window       time.Duration // Failures older than this are forgotten
+}
+
+var (
+	// AccountPolicy applies to a single email address
+	AccountPolicy = ThrottlePolicy{FreeAttempts: 5, BaseLockout: 30 * time.Second, MaxLockout: time.Hour, Window: 24 * time.Hour}
+	// IPPolicy applies to a single client IP, which may be shared by many users
+	IPPolicy = ThrottlePolicy{FreeAttempts: 20, BaseLockout: 30 * time.Second, MaxLockout: time.Hour, Window: 24 * time.Hour}
+	// RecipientPolicy applies to emails sent to a single address, whether or not it has an account
+	RecipientPolicy = ThrottlePolicy{FreeAttempts: 3, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: 24 * time.Hour}
+)
+
+// Lockout returns how long to lock after the given number of failures
+func (p ThrottlePolicy) Lockout(failures int) time.Duration {
+	if failures < p.FreeAttempts {
+		return 0
+	}
+	lockout := p.BaseLockout
+	for i := p.FreeAttempts; i < failures; i++ {
+		lockout *= 2
+		if lockout >= p.MaxLockout {
+			return p.MaxLockout
+		}
+	}
+	return lockout
+}
+
+// ThrottleKey builds the counter key for a scope, action and subject
+func ThrottleKey(scope, action, subject string) string {
+	return scope + ":" + action + ":" + strings.ToLower(strings.TrimSpace(subject))
+}
+
+// Throttle stores failed attempt counters in MongoDB so limits hold across instances
+type Throttle struct {
+	attempts *mongo.Collection
+}
+
+// NewThrottle creates a throttle backed by the login_attempts collection
+func NewThrottle(client *mongo.Client) *Throttle {
+	return &Throttle{
+		attempts: client.Database("ct").Collection("login_attempts"),
+	}
+}
+
+// EnsureIndexes creates the key lookup and expiry indexes
+func (t *Throttle) EnsureIndexes(ctx context.Context) error {
+	_, err := t.attempts.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "scope", Value: 1}, {Key: "subject", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// LockedFor returns the longest remaining lockout among the given keys, or zero if none is locked
+func (t *Throttle) LockedFor(ctx context.Context, keys ...string) (time.Duration, error) {
+	now := time.Now()
+	cursor, err := t.attempts.Find(ctx, bson.M{
+		"key":          bson.M{"$in": keys},
+		"locked_until": bson.M{"$gt": now},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var attempts []models.LoginAttempt
+	if err := cursor.All(ctx, &attempts); err != nil {
+		return 0, err
+	}
+
+	var longest time.Duration
+	for _, attempt := range attempts {
+		if remaining := attempt.LockedUntil.Sub(now); remaining > longest {
+			longest = remaining
+		}
+	}
+	return longest, nil
+}
+
+// RecordFailure counts a failed attempt and locks the counter once the policy is exceeded
+func (t *Throttle) RecordFailure(ctx context.Context, scope, action, subject string, policy ThrottlePolicy) (*models.LoginAttempt, error) {
+	now := time.Now()
+	key := ThrottleKey(scope, action, subject)
+
+	var attempt models.LoginAttempt
+	err := t.attempts.FindOneAndUpdate(ctx, bson.M{"key": key}, bson.M{
+		"$inc": bson.M{"failures": 1},
+		"$set": bson.M{
+			"last_failure_at": now,
+			"expires_at":      now.Add(policy.Window),
+		},
+		"$setOnInsert": bson.M{
+			"scope":   scope,
+			"action":  action,
+			"subject": strings.ToLower(strings.TrimSpace(subject)),
+		},
+	}, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&attempt)
+	if err != nil {
+		return nil, err
+	}
+
+	if lockout := policy.Lockout(attempt.Failures); lockout > 0 {
+		attempt.LockedUntil = now.Add(lockout)
+		// Keep the record around at least as long as the lock
+		if attempt.LockedUntil.After(attempt.ExpiresAt) {
+			attempt.ExpiresAt = attempt.LockedUntil
+		}
+		_, err = t.attempts.UpdateOne(ctx, bson.M{"_id": attempt.ID}, bson.M{
+			"$set": bson.M{
+				"locked_until": attempt.LockedUntil,
+				"expires_at":   attempt.ExpiresAt,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &attempt, nil
+}
+
+// Reset clears the counters for the given keys, e.g. after a successful sign-in
+func (t *Throttle) Reset(ctx context.Context, keys ...string) error {
+	_, err := t.attempts.DeleteMany(ctx, bson.M{"key": bson.M{"$in": keys}})
+	return err
+}
+
+// LockedAccounts returns the lockout expiry of every locked email among the given ones
+func (t *Throttle) LockedAccounts(ctx context.Context, emails []string) (map[string]time.Time, error) {
+	subjects := make([]string, len(emails))
+	for i, email := range emails {
+		subjects[i] = strings.ToLower(strings.TrimSpace(email))
+	}
+
+	cursor, err := t.attempts.Find(ctx, bson.M{
+		"scope":        ThrottleScopeAccount,
+		"subject":      bson.M{"$in": subjects},
+		"locked_until": bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var attempts []models.LoginAttempt
+	if err := cursor.All(ctx, &attempts); err != nil {
+		return nil, err
+	}
+
+	locked := make(map[string]time.Time)
+	for _, attempt := range attempts {
+		if attempt.LockedUntil.After(locked[attempt.Subject]) {
+			locked[attempt.Subject] = attempt.LockedUntil
+		}
+	}
+	return locked, nil
+}
+
+// UnlockAccount removes every counter of an email address across all actions
+func (t *Throttle) UnlockAccount(ctx context.Context, email string) (int64, error) {
+	result, err := t.attempts.DeleteMany(ctx, bson.M{
+		"scope":   ThrottleScopeAccount,
+		"subject": strings.ToLower(strings.TrimSpace(email)),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
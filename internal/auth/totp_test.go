@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed of the RFC 6238 test vectors, "12345678901234567890", in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	// The RFC's codes are eight digits; ours are their last six
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := TOTPCode(rfcSecret, TOTPStep(time.Unix(tt.unix, 0)))
+		if err != nil || got != tt.want {
+			t.Errorf("TOTPCode at %d = %q, %v; want %q", tt.unix, got, err, tt.want)
+		}
+	}
+}
+
+func TestVerifyTOTPDrift(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := TOTPStep(now)
+	tests := []struct {
+		name   string
+		offset int64 // Steps between the code and now
+		ok     bool
+	}{
+		{"current step", 0, true},
+		{"one step behind", -1, true},
+		{"one step ahead", 1, true},
+		{"two steps behind", -2, false},
+		{"two steps ahead", 2, false},
+		{"a day old", -2880, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := TOTPCode(rfcSecret, current+tt.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			step, ok := VerifyTOTP(rfcSecret, code, now)
+			if ok != tt.ok {
+				t.Fatalf("VerifyTOTP accepted = %v, want %v", ok, tt.ok)
+			}
+			if ok && step != current+tt.offset {
+				t.Errorf("VerifyTOTP matched step %d, want the code's own step %d", step, current+tt.offset)
+			}
+		})
+	}
+}
+
+func TestVerifyTOTPReplay(t *testing.T) {
+	start := time.Unix(1234567890, 0)
+	code, err := TOTPCode(rfcSecret, TOTPStep(start))
+	if err != nil {
+		t.Fatal(err)
+	}
+	used, ok := VerifyTOTP(rfcSecret, code, start)
+	if !ok {
+		t.Fatal("VerifyTOTP rejected a current code")
+	}
+
+	// The same code stays valid while it is within the skew, so callers must
+	// refuse any step at or before the last one used; it must not look newer
+	for _, later := range []time.Duration{0, time.Second, TOTPPeriod} {
+		step, ok := VerifyTOTP(rfcSecret, code, start.Add(later))
+		if ok && step > used {
+			t.Errorf("replayed %v later, the code matched step %d after %d was used", later, step, used)
+		}
+	}
+
+	// The next step's code is newer than the one used and is not a replay
+	next, err := TOTPCode(rfcSecret, used+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if step, ok := VerifyTOTP(rfcSecret, next, start.Add(TOTPPeriod)); !ok || step <= used {
+		t.Errorf("the next code matched step %d (accepted %v), want a step after %d", step, ok, used)
+	}
+}
+
+func TestVerifyTOTPRejectsMalformedInput(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, err := TOTPCode(rfcSecret, TOTPStep(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		ok     bool
+	}{
+		{"padded with spaces", rfcSecret, " " + code + " ", true},
+		{"lower-case secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", code, true},
+		{"too short", rfcSecret, code[:5], false},
+		{"too long", rfcSecret, code + "0", false},
+		{"empty", rfcSecret, "", false},
+		{"secret not base32", "not-base32!", code, false},
+	}
+	for _, tt := range tests {
+		if _, ok := VerifyTOTP(tt.secret, tt.code, now); ok != tt.ok {
+			t.Errorf("%s: VerifyTOTP accepted = %v, want %v", tt.name, ok, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Package auth handles session management
+package auth
+
+import "strings"
+
+// DescribeUserAgent turns a User-Agent header into a short "Browser on OS" label
+func DescribeUserAgent(ua string) string {
+	if ua == "" {
+		return "Unknown device"
+	}
+	browser := detectBrowser(ua)
+	os := detectOS(ua)
+	if browser == "" && os == "" {
+		return "Unknown device"
+	}
+	if browser == "" {
+		return os
+	}
+	if os == "" {
+		return browser
+	}
+	return browser + " on " + os
+}
+
+// detectBrowser finds the browser name; order matters because most UAs also claim to be Safari/Chrome
+func detectBrowser(ua string) string {
+	switch {
+	case strings.Contains(ua, "Edg/"):
+		return "Edge"
+	case strings.Contains(ua, "OPR/") || strings.Contains(ua, "Opera"):
+		return "Opera"
+	case strings.Contains(ua, "Firefox/"):
+		return "Firefox"
+	case strings.Contains(ua, "Chrome/") || strings.Contains(ua, "CriOS/"):
+		return "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		return "Safari"
+	case strings.Contains(ua, "curl/"):
+		return "curl"
+	}
+	return ""
+}
+
+// detectOS finds the operating system name
+func detectOS(ua string) string {
+	switch {
+	case strings.Contains(ua, "iPhone"):
+		return "iPhone"
+	case strings.Contains(ua, "iPad"):
+		return "iPad"
+	case strings.Contains(ua, "Android"):
+		return "Android"
+	case strings.Contains(ua, "Windows"):
+		return "Windows"
+	case strings.Contains(ua, "Mac OS X") || strings.Contains(ua, "Macintosh"):
+		return "macOS"
+	case strings.Contains(ua, "CrOS"):
+		return "ChromeOS"
+	case strings.Contains(ua, "Linux"):
+		return "Linux"
+	}
+	return ""
+}
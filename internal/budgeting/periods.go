@@ -0,0 +1,107 @@
+// Package budgeting keeps budgets' spend in step with the transactions and
+// opens and closes their periods.
+//
+// A budget covers a single monthly, quarterly or yearly period and only counts
+// expenses dated inside it. Its spend is derived from those expenses and stored
+// on the budget as a cache, which Refresh recomputes whenever an expense it
+// tracks is approved, voided or corrected. Once the period is over, RollOver
+// closes it and keeps it as history. A recurring budget then opens its next
+// period as a new budget in the same series, carrying over unused or overspent
+// money if it is set to.
+//
+// A budget's scope decides which expenses it tracks: a set of categories, an
+// account, a department or cost center, a member, or any mix of them. An
+// expense counts toward every budget whose scope it falls in.
+//
+// For reporting, Variances sets what was budgeted for each scope against what
+// it actually spent, month by month or quarter by quarter.
+package budgeting
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/repository"
+)
+
+// RollOver closes every open budget whose period ended before now and opens the
+// next period of each recurring one, catching up on any periods missed in
+// between. It returns the periods it opened and records each close and open in
+// the audit trail as done by actor. Run it inside repos.Atomic so that a period
+// is never closed without its successor.
+func RollOver(ctx context.Context, repos *repository.Repositories, actor *models.User, now time.Time) ([]models.Budget, error) {
+	budgets, err := repos.Budgets.List(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var opened []models.Budget
+	for _, b := range budgets {
+		if now.Before(b.PeriodEnd()) {
+			continue
+		}
+		closed, err := repos.Budgets.Close(ctx, b.ID, now)
+		if errors.Is(err, repository.ErrNotFound) {
+			// Closed by another run since it was listed
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := audit(ctx, repos, actor, models.AuditActionUpdate, closed, map[string]interface{}{
+			"closed": periodDates(closed),
+			"spent":  closed.Spent.Format(closed.Currency),
+			"limit":  closed.Limit().Format(closed.Currency),
+		}); err != nil {
+			return nil, err
+		}
+		if !closed.Recurring {
+			continue
+		}
+
+		// Expenses may already be posted in the new period, before it was opened
+		for prev := closed; ; {
+			next := prev.Next()
+			if next.Spent, err = Spent(ctx, repos, next); err != nil {
+				return nil, err
+			}
+			ended := !now.Before(next.PeriodEnd())
+			if ended {
+				next.IsActive = false
+				next.ClosedAt = now
+			}
+			if err := repos.Budgets.Create(ctx, next); err != nil {
+				return nil, err
+			}
+			if err := audit(ctx, repos, actor, models.AuditActionCreate, next, map[string]interface{}{
+				"opened":       periodDates(next),
+				"amount":       next.Amount.Format(next.Currency),
+				"carried_over": next.CarriedOver.Format(next.Currency),
+			}); err != nil {
+				return nil, err
+			}
+			if !ended {
+				opened = append(opened, *next)
+				break
+			}
+			prev = next
+		}
+	}
+	return opened, nil
+}
+
+// periodDates describes a budget's period for the audit trail
+func periodDates(b *models.Budget) string {
+	first, last := b.PeriodDates()
+	return first.Format("2006-01-02") + " to " + last.Format("2006-01-02")
+}
+
+// audit records a change RollOver made to a budget period
+func audit(ctx context.Context, repos *repository.Repositories, actor *models.User, action models.AuditAction, b *models.Budget, changes map[string]interface{}) error {
+	changes["name"] = b.Name
+	entry := models.NewAuditLog(action, models.AuditEntityBudget, b.ID, actor.ID, repos.Scope.CompanyID(), actor.Name, actor.Email).
+		WithChanges(changes)
+	return repos.AuditLogs.Insert(ctx, entry)
+}
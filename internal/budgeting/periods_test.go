@@ -0,0 +1,217 @@
+package budgeting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	january = time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	system  = &models.User{ID: primitive.NewObjectID(), Name: "System"}
+)
+
+// testRepos is a company in a fresh memory store
+func testRepos(t *testing.T) *repository.Repositories {
+	t.Helper()
+	_, repos := repository.NewTestRepos(t, models.Company{})
+	return repos
+}
+
+// monthly stores a USD budget of 100.00 for category over the month starting at start
+func monthly(t *testing.T, repos *repository.Repositories, category primitive.ObjectID, start time.Time, change func(b *models.Budget)) *models.Budget {
+	t.Helper()
+	b := models.NewBudget("Travel", category, 100_00, "USD", models.BudgetPeriodMonthly, repos.Scope.CompanyID())
+	b.ID = primitive.NewObjectID()
+	b.StartDate, b.EndDate = models.GetBudgetPeriodDates(models.BudgetPeriodMonthly, start)
+	if change != nil {
+		change(b)
+	}
+	if err := repos.Budgets.Create(context.Background(), b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// expense stores a USD expense in category dated at
+func expense(t *testing.T, repos *repository.Repositories, category primitive.ObjectID, amount models.Money, at time.Time, status models.TransactionStatus) *models.Transaction {
+	t.Helper()
+	txn := models.NewTransaction(models.TransactionTypeExpense, amount, "USD", repos.Scope.CompanyID(), system.ID, system.Name)
+	txn.ID = primitive.NewObjectID()
+	txn.CategoryID = category
+	txn.TransactionDate = at
+	txn.Status = status
+	if err := repos.Transactions.Create(context.Background(), txn); err != nil {
+		t.Fatal(err)
+	}
+	return txn
+}
+
+func storedBudget(t *testing.T, repos *repository.Repositories, id primitive.ObjectID) *models.Budget {
+	t.Helper()
+	b, err := repos.Budgets.Get(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestRollOverCarriesOver(t *testing.T) {
+	tests := []struct {
+		name      string
+		carryOver models.BudgetCarryOver
+		spent     models.Money
+		want      models.Money
+	}{
+		{"nothing carried", models.BudgetCarryOverNone, 30_00, 0},
+		{"unused money", models.BudgetCarryOverUnused, 30_00, 70_00},
+		{"unused, but overspent", models.BudgetCarryOverUnused, 130_00, 0},
+		{"overspending", models.BudgetCarryOverOverspent, 130_00, -30_00},
+		{"overspending, but unused", models.BudgetCarryOverOverspent, 30_00, 0},
+		{"both, unused", models.BudgetCarryOverBoth, 30_00, 70_00},
+		{"both, overspent", models.BudgetCarryOverBoth, 130_00, -30_00},
+		{"both, spent exactly", models.BudgetCarryOverBoth, 100_00, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repos := testRepos(t)
+			category := primitive.NewObjectID()
+			jan := monthly(t, repos, category, january, func(b *models.Budget) {
+				b.Recurring = true
+				b.CarryOver = tt.carryOver
+				b.Spent = tt.spent
+			})
+
+			opened, err := RollOver(ctx, repos, system, january.AddDate(0, 1, 4))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(opened) != 1 {
+				t.Fatalf("opened %d periods, want February's", len(opened))
+			}
+			feb := opened[0]
+			if first, last := feb.PeriodDates(); !first.Equal(january.AddDate(0, 1, 0)) || last.Day() != 28 {
+				t.Errorf("opened %s to %s, want February", first, last)
+			}
+			if feb.CarriedOver != tt.want || feb.Limit() != 100_00+tt.want {
+				t.Errorf("carried over %d for a limit of %d, want %d", feb.CarriedOver, feb.Limit(), tt.want)
+			}
+			if feb.Series() != jan.ID || !feb.IsActive || feb.Spent != 0 {
+				t.Errorf("February is in series %s, active %v with %d spent; want January's series, open and unspent", feb.Series().Hex(), feb.IsActive, feb.Spent)
+			}
+			if closed := storedBudget(t, repos, jan.ID); closed.IsActive || !closed.IsClosed() || closed.Spent != tt.spent {
+				t.Errorf("January is active %v, closed %v with %d spent; want it closed as history", closed.IsActive, closed.IsClosed(), closed.Spent)
+			}
+		})
+	}
+}
+
+func TestRollOverClosesOneOffBudgets(t *testing.T) {
+	ctx := context.Background()
+	repos := testRepos(t)
+	jan := monthly(t, repos, primitive.NewObjectID(), january, nil)
+
+	opened, err := RollOver(ctx, repos, system, january.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opened) != 0 {
+		t.Errorf("opened %d periods for a budget that does not recur", len(opened))
+	}
+	if closed := storedBudget(t, repos, jan.ID); !closed.IsClosed() {
+		t.Error("the budget is still open after its period ended")
+	}
+	if budgets, _ := repos.Budgets.List(ctx, false); len(budgets) != 1 {
+		t.Errorf("there are %d budgets, want only the closed one", len(budgets))
+	}
+}
+
+func TestRollOverCatchesUpOnMissedPeriods(t *testing.T) {
+	ctx := context.Background()
+	repos := testRepos(t)
+	category := primitive.NewObjectID()
+	monthly(t, repos, category, january, func(b *models.Budget) {
+		b.Recurring = true
+		b.CarryOver = models.BudgetCarryOverUnused
+	})
+	// Posted in February and April before either was opened
+	expense(t, repos, category, 25_00, january.AddDate(0, 1, 10), models.TransactionStatusApproved)
+	expense(t, repos, category, 5_00, january.AddDate(0, 3, 1), models.TransactionStatusApproved)
+
+	opened, err := RollOver(ctx, repos, system, january.AddDate(0, 3, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opened) != 1 || opened[0].StartDate.Month() != time.April {
+		t.Fatalf("opened %v, want only April", opened)
+	}
+	if opened[0].Spent != 5_00 {
+		t.Errorf("April opened with %d spent, want the 5.00 already posted in it", opened[0].Spent)
+	}
+	// January leaves all of 100.00, February 175.00 of 200.00 and March all of 275.00
+	if want := models.Money(275_00); opened[0].CarriedOver != want {
+		t.Errorf("April carried over %d, want %d", opened[0].CarriedOver, want)
+	}
+
+	budgets, err := repos.Budgets.List(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := 0
+	for _, b := range budgets {
+		if b.IsClosed() {
+			closed++
+		}
+	}
+	if len(budgets) != 4 || closed != 3 {
+		t.Errorf("there are %d periods with %d closed, want January to March closed and April open", len(budgets), closed)
+	}
+
+	// Nothing is left to roll over until April ends
+	if again, err := RollOver(ctx, repos, system, january.AddDate(0, 3, 4)); err != nil || len(again) != 0 {
+		t.Errorf("rolling over again opened %d periods (%v), want none", len(again), err)
+	}
+}
+
+func TestRollOverFollowsTheBudgetTimezone(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Ho_Chi_Minh") // UTC+7
+	if err != nil {
+		t.Skip("no timezone database:", err)
+	}
+	tests := []struct {
+		name  string
+		now   time.Time
+		ended bool
+	}{
+		{"last evening of January there", time.Date(2026, time.January, 31, 16, 59, 0, 0, time.UTC), false},
+		{"first minute of February there", time.Date(2026, time.January, 31, 17, 0, 0, 0, time.UTC), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repos := testRepos(t)
+			jan := monthly(t, repos, primitive.NewObjectID(), time.Date(2026, time.January, 1, 0, 0, 0, 0, loc), func(b *models.Budget) {
+				b.Timezone = loc.String()
+				b.Recurring = true
+			})
+
+			opened, err := RollOver(context.Background(), repos, system, tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := storedBudget(t, repos, jan.ID).IsClosed(); got != tt.ended {
+				t.Fatalf("January closed = %v, want %v", got, tt.ended)
+			}
+			if tt.ended {
+				first, _ := opened[0].PeriodDates()
+				if want := time.Date(2026, time.February, 1, 0, 0, 0, 0, loc); !first.Equal(want) || opened[0].Timezone != loc.String() {
+					t.Errorf("February starts %s in %q, want %s", first, opened[0].Timezone, want)
+				}
+			}
+		})
+	}
+}
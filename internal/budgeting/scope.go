@@ -0,0 +1,72 @@
+package budgeting
+
+import (
+	"context"
+	"strings"
+
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ScopeNames are the names of the categories and accounts budgets are scoped to
+type ScopeNames struct {
+	Categories map[primitive.ObjectID]string
+	Accounts   map[primitive.ObjectID]string
+}
+
+// LoadScopeNames looks up the names of the company's categories and accounts,
+// including deleted ones that old budgets may still be scoped to
+func LoadScopeNames(ctx context.Context, repos *repository.Repositories) (ScopeNames, error) {
+	names := ScopeNames{
+		Categories: make(map[primitive.ObjectID]string),
+		Accounts:   make(map[primitive.ObjectID]string),
+	}
+	categories, err := repos.Categories.List(ctx, false)
+	if err != nil {
+		return names, err
+	}
+	for _, cat := range categories {
+		names.Categories[cat.ID] = cat.Name
+	}
+	accounts, err := repos.Accounts.List(ctx, false)
+	if err != nil {
+		return names, err
+	}
+	for _, acc := range accounts {
+		names.Accounts[acc.ID] = acc.Name
+	}
+	return names, nil
+}
+
+// Describe names the expenses scope covers, e.g. "Marketing · Travel + Meals"
+func (n ScopeNames) Describe(scope models.BudgetScope) string {
+	var parts []string
+	if scope.Department != "" {
+		parts = append(parts, scope.Department)
+	}
+	if !scope.EmployeeID.IsZero() {
+		parts = append(parts, scope.EmployeeName)
+	}
+	if len(scope.CategoryIDs) > 0 {
+		categories := make([]string, len(scope.CategoryIDs))
+		for i, id := range scope.CategoryIDs {
+			categories[i] = n.Categories[id]
+			if categories[i] == "" {
+				categories[i] = "Unknown category"
+			}
+		}
+		parts = append(parts, strings.Join(categories, " + "))
+	}
+	if !scope.AccountID.IsZero() {
+		account := n.Accounts[scope.AccountID]
+		if account == "" {
+			account = "an unknown account"
+		}
+		parts = append(parts, "from "+account)
+	}
+	if len(parts) == 0 {
+		return "All expenses"
+	}
+	return strings.Join(parts, " · ")
+}
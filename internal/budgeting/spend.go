@@ -0,0 +1,72 @@
+package budgeting
+
+import (
+	"context"
+
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/repository"
+)
+
+// Spent adds up the expenses that count toward the budget
+func Spent(ctx context.Context, repos *repository.Repositories, budget *models.Budget) (models.Money, error) {
+	transactions, err := repos.Transactions.List(ctx, repository.TransactionFilter{
+		Type:   models.TransactionTypeExpense,
+		Posted: true,
+		From:   budget.StartDate,
+		Until:  budget.PeriodEnd(),
+	}, repository.Page{})
+	if err != nil {
+		return 0, err
+	}
+	return SpentFrom(budget, transactions), nil
+}
+
+// SpentFrom adds up the expenses among transactions that count toward the budget
+func SpentFrom(budget *models.Budget, transactions []models.Transaction) models.Money {
+	var spent models.Money
+	for i := range transactions {
+		if budget.Counts(&transactions[i]) {
+			spent += transactions[i].Amount
+		}
+	}
+	return spent
+}
+
+// Refresh recomputes the stored spend of every budget, open or closed, that
+// tracks any of the given expenses. Pass a transaction as it was before a
+// change as well as after, so that the budgets it moved out of are updated too.
+// Run it in the same atomic write as the change.
+func Refresh(ctx context.Context, repos *repository.Repositories, transactions ...*models.Transaction) error {
+	budgets, err := repos.Budgets.List(ctx, false)
+	if err != nil {
+		return err
+	}
+	for i := range budgets {
+		budget := &budgets[i]
+		// Deleted budgets keep the spend they were deleted with
+		if !budget.IsActive && !budget.IsClosed() {
+			continue
+		}
+		tracked := false
+		for _, txn := range transactions {
+			if budget.Applies(txn) {
+				tracked = true
+				break
+			}
+		}
+		if !tracked {
+			continue
+		}
+		spent, err := Spent(ctx, repos, budget)
+		if err != nil {
+			return err
+		}
+		if spent == budget.Spent {
+			continue
+		}
+		if err := repos.Budgets.SetSpent(ctx, budget.ID, spent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package budgeting
+
+import (
+	"context"
+	"testing"
+
+	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSpentFrom(t *testing.T) {
+	category := primitive.NewObjectID()
+	budget := models.NewBudget("Travel", category, 100_00, "USD", models.BudgetPeriodMonthly, primitive.NewObjectID())
+	budget.StartDate, budget.EndDate = models.GetBudgetPeriodDates(models.BudgetPeriodMonthly, january)
+	inJanuary := january.AddDate(0, 0, 14)
+
+	tests := []struct {
+		name   string
+		change func(txn *models.Transaction)
+		counts bool
+	}{
+		{"approved", nil, true},
+		{"paid", func(txn *models.Transaction) { txn.Status = models.TransactionStatusPaid }, true},
+		{"on the last day", func(txn *models.Transaction) { txn.TransactionDate = january.AddDate(0, 1, 0).Add(-1) }, true},
+		{"on the first day", func(txn *models.Transaction) { txn.TransactionDate = january }, true},
+		{"pending", func(txn *models.Transaction) { txn.Status = models.TransactionStatusPending }, false},
+		{"rejected", func(txn *models.Transaction) { txn.Status = models.TransactionStatusRejected }, false},
+		{"the day after", func(txn *models.Transaction) { txn.TransactionDate = january.AddDate(0, 1, 0) }, false},
+		{"the day before", func(txn *models.Transaction) { txn.TransactionDate = january.Add(-1) }, false},
+		{"another category", func(txn *models.Transaction) { txn.CategoryID = primitive.NewObjectID() }, false},
+		{"another currency", func(txn *models.Transaction) { txn.Currency = "EUR" }, false},
+		{"income", func(txn *models.Transaction) { txn.Type = models.TransactionTypeIncome }, false},
+		{"voided", func(txn *models.Transaction) {
+			txn.Status = models.TransactionStatusVoided
+			txn.ReversedByID = primitive.NewObjectID()
+		}, false},
+		{"a reversal", func(txn *models.Transaction) { txn.ReversesID = primitive.NewObjectID() }, false},
+	}
+	var transactions []models.Transaction
+	var want models.Money
+	for i, tt := range tests {
+		// Amounts are distinct powers of two, so the total shows which ones counted
+		amount := models.Money(1) << i
+		txn := models.NewTransaction(models.TransactionTypeExpense, amount, "USD", budget.CompanyID, system.ID, system.Name)
+		txn.CategoryID = category
+		txn.TransactionDate = inJanuary
+		txn.Status = models.TransactionStatusApproved
+		if tt.change != nil {
+			tt.change(txn)
+		}
+		if got := budget.Counts(txn); got != tt.counts {
+			t.Errorf("%s: counts = %v, want %v", tt.name, got, tt.counts)
+		}
+		if tt.counts {
+			want += amount
+		}
+		transactions = append(transactions, *txn)
+	}
+	if got := SpentFrom(budget, transactions); got != want {
+		t.Errorf("SpentFrom = %d, want %d", got, want)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+	repos := testRepos(t)
+	travel, meals := primitive.NewObjectID(), primitive.NewObjectID()
+	travelBudget := monthly(t, repos, travel, january, nil)
+	mealsBudget := monthly(t, repos, meals, january, nil)
+	february := monthly(t, repos, meals, january.AddDate(0, 1, 0), nil)
+	closed := monthly(t, repos, meals, january, func(b *models.Budget) {
+		b.IsActive = false
+		b.ClosedAt = january.AddDate(0, 1, 0)
+	})
+	deleted := monthly(t, repos, meals, january, func(b *models.Budget) {
+		b.IsActive = false
+		b.Spent = 99_00
+	})
+
+	// A travel expense was re-categorized as meals; the travel budget still counts it
+	if err := repos.Budgets.SetSpent(ctx, travelBudget.ID, 12_00); err != nil {
+		t.Fatal(err)
+	}
+	after := expense(t, repos, meals, 12_00, january.AddDate(0, 0, 9), models.TransactionStatusApproved)
+	before := *after
+	before.CategoryID = travel
+
+	if err := Refresh(ctx, repos, &before, after); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		budget *models.Budget
+		want   models.Money
+	}{
+		{"the category it left", travelBudget, 0},
+		{"the category it joined", mealsBudget, 12_00},
+		{"another period", february, 0},
+		{"a closed period", closed, 12_00},
+		{"a deleted budget", deleted, 99_00},
+	}
+	for _, tt := range tests {
+		if got := storedBudget(t, repos, tt.budget.ID).Spent; got != tt.want {
+			t.Errorf("%s: spent %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
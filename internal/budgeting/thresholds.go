@@ -0,0 +1,82 @@
+package budgeting
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/repository"
+)
+
+// Impacts returns where txn would leave each of the open budgets it applies to.
+// A correction replaces its original, so the original's amount no longer counts
+// toward a budget the correction is assessed against.
+func Impacts(budgets []models.Budget, txn, original *models.Transaction) []models.BudgetImpact {
+	var impacts []models.BudgetImpact
+	for i := range budgets {
+		budget := budgets[i]
+		if !budget.IsActive || !budget.Applies(txn) {
+			continue
+		}
+		if original != nil && budget.Counts(original) {
+			budget.Spent -= original.Amount
+		}
+		impacts = append(impacts, budget.Impact(txn.Amount))
+	}
+	return impacts
+}
+
+// Assess returns where submitting txn would leave each of the open budgets it applies to
+func Assess(ctx context.Context, repos *repository.Repositories, txn *models.Transaction) ([]models.BudgetImpact, error) {
+	if txn.Type != models.TransactionTypeExpense {
+		return nil, nil
+	}
+	budgets, err := repos.Budgets.List(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	var original *models.Transaction
+	if !txn.ReplacesID.IsZero() {
+		if original, err = repos.Transactions.Get(ctx, txn.ReplacesID); err != nil {
+			return nil, err
+		}
+	}
+	return Impacts(budgets, txn, original), nil
+}
+
+// Enforce applies the budgets' enforcement to an expense with impacts. It
+// returns models.ErrBudgetExceeded when a budget blocks it, and otherwise
+// whether one needs an extra sign-off for it.
+func Enforce(impacts []models.BudgetImpact) (override bool, err error) {
+	for _, impact := range impacts {
+		if impact.Blocks() {
+			return false, fmt.Errorf("%w: %s", models.ErrBudgetExceeded, impact.Budget.Name)
+		}
+		override = override || impact.NeedsOverride()
+	}
+	return override, nil
+}
+
+// Crossed returns the budgets that the approval of txn took to a new level, as
+// impacts at the level they reached. Call it once txn is approved and counted.
+func Crossed(ctx context.Context, repos *repository.Repositories, txn *models.Transaction) ([]models.BudgetImpact, error) {
+	if txn.Type != models.TransactionTypeExpense {
+		return nil, nil
+	}
+	budgets, err := repos.Budgets.List(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	var crossed []models.BudgetImpact
+	for i := range budgets {
+		budget := &budgets[i]
+		if !budget.Counts(txn) || (!budget.IsActive && !budget.IsClosed()) {
+			continue
+		}
+		level := budget.Level()
+		if level > budget.LevelAt(budget.Spent-txn.Amount) {
+			crossed = append(crossed, models.BudgetImpact{Budget: *budget, After: budget.Spent, Level: level})
+		}
+	}
+	return crossed, nil
+}
@@ -0,0 +1,160 @@
+package budgeting
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// withThresholds returns a January budget of 100.00 for category with spent
+// already counted, warning at warnPercent
+func withThresholds(category primitive.ObjectID, spent models.Money, warnPercent int, enforcement models.BudgetEnforcement) models.Budget {
+	b := models.NewBudget("Travel", category, 100_00, "USD", models.BudgetPeriodMonthly, primitive.NewObjectID())
+	b.ID = primitive.NewObjectID()
+	b.StartDate, b.EndDate = models.GetBudgetPeriodDates(models.BudgetPeriodMonthly, january)
+	b.Spent = spent
+	b.WarnPercent = warnPercent
+	b.Enforcement = enforcement
+	return *b
+}
+
+// januaryExpense returns an expense in category dated mid-January
+func januaryExpense(category primitive.ObjectID, amount models.Money, status models.TransactionStatus) *models.Transaction {
+	txn := models.NewTransaction(models.TransactionTypeExpense, amount, "USD", primitive.NewObjectID(), system.ID, system.Name)
+	txn.ID = primitive.NewObjectID()
+	txn.CategoryID = category
+	txn.TransactionDate = january.AddDate(0, 0, 14)
+	txn.Status = status
+	return txn
+}
+
+func TestImpactsAtTheThresholds(t *testing.T) {
+	category := primitive.NewObjectID()
+	tests := []struct {
+		name        string
+		warnPercent int
+		amount      models.Money
+		want        models.BudgetLevel
+	}{
+		{"just under the warning", 80, 29_99, models.BudgetLevelOK},
+		{"exactly the warning", 80, 30_00, models.BudgetLevelWarning},
+		{"exactly the limit", 80, 50_00, models.BudgetLevelWarning},
+		{"one cent over the limit", 80, 50_01, models.BudgetLevelExceeded},
+		{"no warning, up to the limit", 0, 50_00, models.BudgetLevelOK},
+		{"no warning, over the limit", 0, 50_01, models.BudgetLevelExceeded},
+	}
+	for _, tt := range tests {
+		budget := withThresholds(category, 50_00, tt.warnPercent, models.BudgetEnforcementWarn)
+		impacts := Impacts([]models.Budget{budget}, januaryExpense(category, tt.amount, models.TransactionStatusPending), nil)
+		if len(impacts) != 1 {
+			t.Errorf("%s: %d impacts, want one", tt.name, len(impacts))
+			continue
+		}
+		if impacts[0].Level != tt.want || impacts[0].After != 50_00+tt.amount {
+			t.Errorf("%s: level %d with %d spent, want level %d with %d", tt.name, impacts[0].Level, impacts[0].After, tt.want, 50_00+tt.amount)
+		}
+	}
+}
+
+func TestImpactsSkipsBudgetsThatDoNotApply(t *testing.T) {
+	category := primitive.NewObjectID()
+	other := withThresholds(primitive.NewObjectID(), 0, 80, models.BudgetEnforcementBlock)
+	closed := withThresholds(category, 0, 80, models.BudgetEnforcementBlock)
+	closed.IsActive = false
+	february := withThresholds(category, 0, 80, models.BudgetEnforcementBlock)
+	february.StartDate, february.EndDate = models.GetBudgetPeriodDates(models.BudgetPeriodMonthly, january.AddDate(0, 1, 0))
+
+	txn := januaryExpense(category, 200_00, models.TransactionStatusPending)
+	if impacts := Impacts([]models.Budget{other, closed, february}, txn, nil); len(impacts) != 0 {
+		t.Errorf("Impacts returned %+v, want none", impacts)
+	}
+}
+
+func TestImpactsOfACorrection(t *testing.T) {
+	category := primitive.NewObjectID()
+	// The original 40.00 is part of the 90.00 spent; its 45.00 correction replaces it
+	budget := withThresholds(category, 90_00, 80, models.BudgetEnforcementBlock)
+	original := januaryExpense(category, 40_00, models.TransactionStatusApproved)
+	correction := januaryExpense(category, 45_00, models.TransactionStatusPending)
+
+	impacts := Impacts([]models.Budget{budget}, correction, original)
+	if len(impacts) != 1 || impacts[0].After != 95_00 || impacts[0].Level != models.BudgetLevelWarning {
+		t.Errorf("Impacts returned %+v, want 95.00 spent at the warning level", impacts)
+	}
+}
+
+func TestEnforce(t *testing.T) {
+	impact := func(level models.BudgetLevel, enforcement models.BudgetEnforcement) models.BudgetImpact {
+		return models.BudgetImpact{Budget: withThresholds(primitive.NewObjectID(), 0, 80, enforcement), Level: level}
+	}
+	tests := []struct {
+		name     string
+		impacts  []models.BudgetImpact
+		override bool
+		err      error
+	}{
+		{"no budgets", nil, false, nil},
+		{"warn, exceeded", []models.BudgetImpact{impact(models.BudgetLevelExceeded, models.BudgetEnforcementWarn)}, false, nil},
+		{"approval, at the warning", []models.BudgetImpact{impact(models.BudgetLevelWarning, models.BudgetEnforcementApproval)}, false, nil},
+		{"approval, exceeded", []models.BudgetImpact{impact(models.BudgetLevelExceeded, models.BudgetEnforcementApproval)}, true, nil},
+		{"block, at the warning", []models.BudgetImpact{impact(models.BudgetLevelWarning, models.BudgetEnforcementBlock)}, false, nil},
+		{"block, exceeded", []models.BudgetImpact{impact(models.BudgetLevelExceeded, models.BudgetEnforcementBlock)}, false, models.ErrBudgetExceeded},
+		{"approval and block, both exceeded", []models.BudgetImpact{
+			impact(models.BudgetLevelExceeded, models.BudgetEnforcementApproval),
+			impact(models.BudgetLevelExceeded, models.BudgetEnforcementBlock),
+		}, false, models.ErrBudgetExceeded},
+	}
+	for _, tt := range tests {
+		override, err := Enforce(tt.impacts)
+		if override != tt.override || !errors.Is(err, tt.err) {
+			t.Errorf("%s: Enforce = %v, %v; want %v, %v", tt.name, override, err, tt.override, tt.err)
+		}
+	}
+}
+
+func TestCrossed(t *testing.T) {
+	tests := []struct {
+		name    string
+		before  models.Money // Spent before the approval
+		amount  models.Money
+		crossed bool
+		level   models.BudgetLevel
+	}{
+		{"stays under the warning", 0, 79_99, false, models.BudgetLevelOK},
+		{"reaches the warning", 79_99, 1, true, models.BudgetLevelWarning},
+		{"already warned, reaches the limit", 80_00, 20_00, false, models.BudgetLevelWarning},
+		{"goes over the limit", 100_00, 1, true, models.BudgetLevelExceeded},
+		{"skips the warning", 50_00, 50_01, true, models.BudgetLevelExceeded},
+		{"already over", 100_01, 10_00, false, models.BudgetLevelExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repos := testRepos(t)
+			category := primitive.NewObjectID()
+			// The approved expense is already counted in the stored spend
+			budget := monthly(t, repos, category, january, func(b *models.Budget) {
+				b.Spent = tt.before + tt.amount
+				b.WarnPercent = 80
+			})
+			txn := expense(t, repos, category, tt.amount, january.AddDate(0, 0, 14), models.TransactionStatusApproved)
+
+			crossed, err := Crossed(ctx, repos, txn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.crossed {
+				if len(crossed) != 0 {
+					t.Errorf("Crossed returned %+v, want none", crossed)
+				}
+				return
+			}
+			if len(crossed) != 1 || crossed[0].Budget.ID != budget.ID || crossed[0].Level != tt.level || crossed[0].After != tt.before+tt.amount {
+				t.Errorf("Crossed returned %+v, want the budget at level %d", crossed, tt.level)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package budgeting
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/minhtranin/ct/internal/models"
+)
+
+// Granularity is how long each period of a variance report is
+type Granularity string
+
+const (
+	GranularityMonth   Granularity = "month"
+	GranularityQuarter Granularity = "quarter"
+)
+
+// IsValidGranularity checks if the granularity is valid
+func IsValidGranularity(g string) bool {
+	switch Granularity(g) {
+	case GranularityMonth, GranularityQuarter:
+		return true
+	}
+	return false
+}
+
+// Period is one month or quarter of a variance report, from Start up to End
+type Period struct {
+	Start time.Time
+	End   time.Time // The start of the next period
+}
+
+// Contains checks if t falls inside the period
+func (p Period) Contains(t time.Time) bool {
+	return !t.Before(p.Start) && t.Before(p.End)
+}
+
+// Label names the period, e.g. "Jan 2026" or "Q1 2026"
+func (p Period) Label() string {
+	if p.End.Sub(p.Start) > 31*24*time.Hour {
+		return fmt.Sprintf("Q%d %d", (int(p.Start.Month())-1)/3+1, p.Start.Year())
+	}
+	return p.Start.Format("Jan 2006")
+}
+
+// Periods returns count periods of g, oldest first, ending with the one that
+// contains through
+func Periods(g Granularity, through time.Time, count int) []Period {
+	months := 1
+	if g == GranularityQuarter {
+		months = 3
+	}
+	year, month, _ := through.Date()
+	month = time.Month((int(month)-1)/months*months + 1)
+	last := time.Date(year, month, 1, 0, 0, 0, 0, through.Location())
+
+	periods := make([]Period, count)
+	for i := range periods {
+		start := last.AddDate(0, -months*(count-1-i), 0)
+		periods[i] = Period{Start: start, End: start.AddDate(0, months, 0)}
+	}
+	return periods
+}
+
+// Variance is what was budgeted for a scope against what it actually spent, in
+// one currency over one period
+type Variance struct {
+	Period Period
+	// The planned amounts of the scope's budgets, each prorated by how much
+	// of its own period falls inside this one. Carried-over money is left out,
+	// so that every period is measured against its own plan.
+	Budgeted models.Money
+	Actual   models.Money
+}
+
+// Amount is how far the actual spend came in under budget; negative when over
+func (v Variance) Amount() models.Money {
+	return v.Budgeted - v.Actual
+}
+
+// Percent returns the variance as a percentage of the budgeted amount, and
+// false when nothing was budgeted
+func (v Variance) Percent() (float64, bool) {
+	if v.Budgeted <= 0 {
+		return 0, false
+	}
+	return float64(v.Amount()) / float64(v.Budgeted) * 100, true
+}
+
+// Utilization returns the actual spend as a percentage of the budgeted amount,
+// and false when nothing was budgeted
+func (v Variance) Utilization() (float64, bool) {
+	if v.Budgeted <= 0 {
+		return 0, false
+	}
+	return float64(v.Actual) / float64(v.Budgeted) * 100, true
+}
+
+// VarianceLine is the variance of the budgets with one scope in one currency
+// over every period of a report, oldest first
+type VarianceLine struct {
+	Scope    models.BudgetScope
+	Currency string
+	Periods  []Variance
+}
+
+// Latest is the variance over the line's last period
+func (l VarianceLine) Latest() Variance {
+	return l.Periods[len(l.Periods)-1]
+}
+
+// Key identifies the line among those of a report
+func (l VarianceLine) Key() string {
+	return l.Scope.Key() + "|" + l.Currency
+}
+
+// Variances compares budgets with the expenses among transactions over
+// periods. There is a line for every scope and currency that open or closed
+// budgets covered at some point in the periods; deleted budgets are left out.
+// An expense counts toward every line whose scope it falls in. Transactions
+// should include every posted expense dated in the periods.
+func Variances(budgets []models.Budget, transactions []models.Transaction, periods []Period) []VarianceLine {
+	lines := make(map[string]*VarianceLine)
+	var order []string
+	for i := range budgets {
+		budget := &budgets[i]
+		if !budget.IsActive && !budget.IsClosed() {
+			continue
+		}
+		for j, p := range periods {
+			share := prorate(budget, p)
+			if share <= 0 {
+				continue
+			}
+			key := VarianceLine{Scope: budget.Scope(), Currency: budget.Currency}.Key()
+			l, ok := lines[key]
+			if !ok {
+				l = newVarianceLine(budget.Scope(), budget.Currency, periods)
+				lines[key] = l
+				order = append(order, key)
+			}
+			l.Periods[j].Budgeted += share
+		}
+	}
+
+	result := make([]VarianceLine, len(order))
+	for i, key := range order {
+		l := lines[key]
+		addActuals(l, transactions, func(txn *models.Transaction) bool {
+			return l.Scope.Matches(txn)
+		})
+		result[i] = *l
+	}
+	return result
+}
+
+// VarianceTotals adds lines up by currency. As lines' scopes may overlap, the
+// actual spend of each total counts every expense in any of them once.
+func VarianceTotals(lines []VarianceLine, transactions []models.Transaction) []VarianceLine {
+	totals := make(map[string]*VarianceLine)
+	var currencies []string
+	for _, line := range lines {
+		total, ok := totals[line.Currency]
+		if !ok {
+			periods := make([]Period, len(line.Periods))
+			for i, v := range line.Periods {
+				periods[i] = v.Period
+			}
+			total = newVarianceLine(models.BudgetScope{}, line.Currency, periods)
+			totals[line.Currency] = total
+			currencies = append(currencies, line.Currency)
+		}
+		for i, v := range line.Periods {
+			total.Periods[i].Budgeted += v.Budgeted
+		}
+	}
+
+	slices.Sort(currencies)
+	result := make([]VarianceLine, len(currencies))
+	for i, currency := range currencies {
+		total := totals[currency]
+		addActuals(total, transactions, func(txn *models.Transaction) bool {
+			return slices.ContainsFunc(lines, func(l VarianceLine) bool {
+				return l.Currency == currency && l.Scope.Matches(txn)
+			})
+		})
+		result[i] = *total
+	}
+	return result
+}
+
+// Contributing returns the expenses among transactions that make up a line's
+// actual spend over period
+func Contributing(transactions []models.Transaction, line VarianceLine, period Period) []models.Transaction {
+	var contributing []models.Transaction
+	for i := range transactions {
+		txn := &transactions[i]
+		if txn.Currency == line.Currency && IsSpend(txn) && line.Scope.Matches(txn) && period.Contains(txn.TransactionDate) {
+			contributing = append(contributing, *txn)
+		}
+	}
+	return contributing
+}
+
+// newVarianceLine starts an empty line over periods
+func newVarianceLine(scope models.BudgetScope, currency string, periods []Period) *VarianceLine {
+	l := &VarianceLine{Scope: scope, Currency: currency, Periods: make([]Variance, len(periods))}
+	for i, p := range periods {
+		l.Periods[i].Period = p
+	}
+	return l
+}
+
+// addActuals adds the spend among transactions in the line's currency that
+// counts toward it to the period each falls in
+func addActuals(l *VarianceLine, transactions []models.Transaction, counts func(*models.Transaction) bool) {
+	for i := range transactions {
+		txn := &transactions[i]
+		if txn.Currency != l.Currency || !IsSpend(txn) || !counts(txn) {
+			continue
+		}
+		for j, v := range l.Periods {
+			if v.Period.Contains(txn.TransactionDate) {
+				l.Periods[j].Actual += txn.Amount
+				break
+			}
+		}
+	}
+}
+
+// IsSpend checks if txn is money actually spent: an approved expense that has
+// not been voided or corrected, the kind of transaction budgets count
+func IsSpend(txn *models.Transaction) bool {
+	return txn.Type == models.TransactionTypeExpense && txn.IsPosted() && !txn.IsReversal() && !txn.IsReversed()
+}
+
+// prorate returns the part of the budget's planned amount that falls in period,
+// by the share of the budget's days inside it
+func prorate(budget *models.Budget, period Period) models.Money {
+	start, end := budget.StartDate, budget.PeriodEnd()
+	total := end.Sub(start)
+	if total <= 0 {
+		return 0
+	}
+	if period.Start.After(start) {
+		start = period.Start
+	}
+	if period.End.Before(end) {
+		end = period.End
+	}
+	if !end.After(start) {
+		return 0
+	}
+	if end.Sub(start) == total {
+		return budget.Amount
+	}
+	return models.Money(math.Round(float64(budget.Amount) * float64(end.Sub(start)) / float64(total)))
+}
@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minhtranin/ct/internal/auth"
+	"github.com/minhtranin/ct/internal/logger"
+	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UpdateApprovalPolicy handles POST /api/settings/approvals
+func UpdateApprovalPolicy(c *fiber.Ctx) error {
+	user, repos, err := scopedUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	if !auth.CanAccessSettings(user.Role) {
+		return c.Redirect("/settings?error=Permission+denied")
+	}
+
+	company, err := repos.Company.Get(c.Context())
+	if err != nil {
+		return c.Redirect("/settings?error=No+company+found")
+	}
+
+	// Limits are entered in the company currency; a blank field means no limit.
+	// Workflows are kept as they are.
+	currency := CompanyCurrency(c, repos)
+	policy := company.Approvals
+	policy.AllowSelfApproval = c.FormValue("allow_self_approval") == "on" || c.FormValue("allow_self_approval") == "true"
+	policy.RoleLimits = map[string]models.Money{}
+	policy.UserLimits = map[string]models.Money{}
+	changes := map[string]interface{}{
+		"allow_self_approval": policy.AllowSelfApproval,
+	}
+	policy.SLAHours = 0
+	if s := strings.TrimSpace(c.FormValue("sla_hours")); s != "" {
+		hours, err := strconv.Atoi(s)
+		if err != nil || hours < 0 {
+			return c.Redirect("/settings?error=Invalid+approval+SLA")
+		}
+		policy.SLAHours = hours
+	}
+	changes["sla_hours"] = policy.SLAHours
+	for _, role := range auth.ValidRoles() {
+		if !auth.CanApprove(string(role)) {
+			continue
+		}
+		limit, ok, err := approvalLimitValue(c.FormValue("role_limit_"+string(role)), currency)
+		if err != nil {
+			return c.Redirect("/settings?error=Invalid+limit+for+" + strings.ReplaceAll(auth.RoleDisplayName(string(role)), " ", "+"))
+		}
+		if ok {
+			policy.RoleLimits[string(role)] = limit
+			changes["limit_"+string(role)] = limit.Format(currency)
+		}
+	}
+
+	users, err := repos.Users.List(c.Context())
+	if err != nil {
+		return c.Redirect("/settings?error=Failed+to+load+users")
+	}
+	for _, u := range users {
+		if !auth.CanApprove(u.Role) {
+			continue
+		}
+		limit, ok, err := approvalLimitValue(c.FormValue("user_limit_"+u.ID.Hex()), currency)
+		if err != nil {
+			return c.Redirect("/settings?error=Invalid+limit+for+" + strings.ReplaceAll(u.Name, " ", "+"))
+		}
+		if ok {
+			policy.UserLimits[u.ID.Hex()] = limit
+			changes["limit_"+u.Email] = limit.Format(currency)
+		}
+	}
+
+	if err := repos.Company.SetApprovalPolicy(c.Context(), policy); err != nil {
+		logger.Error("Finance", "Failed to update approval policy: "+err.Error())
+		return c.Redirect("/settings?error=Failed+to+update+settings")
+	}
+
+	logAudit(c, models.AuditActionUpdate, models.AuditEntityCompany, repos.Scope.CompanyID(), user, changes)
+
+	return c.Redirect("/settings?success=Approval+policy+updated")
+}
+
+// approvalLimitValue parses a limit field, reporting false when it was left blank
+func approvalLimitValue(s, currency string) (models.Money, bool, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, false, nil
+	}
+	limit, err := models.ParseMoney(s, currency)
+	if err != nil {
+		return 0, false, err
+	}
+	if limit < 0 {
+		return 0, false, models.ErrInvalidAmount
+	}
+	return limit, true, nil
+}
+
+// maxWorkflowSteps is how many step rows the workflow form offers
+const maxWorkflowSteps = 4
+
+// CreateApprovalWorkflow handles POST /api/settings/workflows
+func CreateApprovalWorkflow(c *fiber.Ctx) error {
+	user, repos, err := scopedUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	if !auth.CanAccessSettings(user.Role) {
+		return c.Redirect("/settings?error=Permission+denied")
+	}
+
+	company, err := repos.Company.Get(c.Context())
+	if err != nil {
+		return c.Redirect("/settings?error=No+company+found")
+	}
+
+	name := strings.TrimSpace(c.FormValue("name"))
+	if name == "" {
+		return c.Redirect("/settings?error=Workflow+name+is+required")
+	}
+
+	// The amount band is in the company currency; blank bounds are open
+	currency := CompanyCurrency(c, repos)
+	minAmount, _, err := approvalLimitValue(c.FormValue("min_amount"), currency)
+	if err != nil {
+		return c.Redirect("/settings?error=Invalid+minimum+amount")
+	}
+	maxAmount, _, err := approvalLimitValue(c.FormValue("max_amount"), currency)
+	if err != nil || (maxAmount != 0 && maxAmount < minAmount) {
+		return c.Redirect("/settings?error=Invalid+maximum+amount")
+	}
+
+	workflow := models.ApprovalWorkflow{
+		ID:        primitive.NewObjectID(),
+		Name:      name,
+		MinAmount: minAmount,
+		MaxAmount: maxAmount,
+	}
+	if id := c.FormValue("category_id"); id != "" {
+		if workflow.CategoryID, err = primitive.ObjectIDFromHex(id); err != nil {
+			return c.Redirect("/settings?error=Invalid+category")
+		}
+		if _, err := repos.Categories.Get(c.Context(), workflow.CategoryID); err != nil {
+			return c.Redirect("/settings?error=Category+not+found")
+		}
+	}
+	if id := c.FormValue("account_id"); id != "" {
+		if workflow.AccountID, err = primitive.ObjectIDFromHex(id); err != nil {
+			return c.Redirect("/settings?error=Invalid+account")
+		}
+		if _, err := repos.Accounts.Get(c.Context(), workflow.AccountID); err != nil {
+			return c.Redirect("/settings?error=Account+not+found")
+		}
+	}
+
+	// Steps are signed off in the order given; rows without a role are skipped
+	for i := 1; i <= maxWorkflowSteps; i++ {
+		role := c.FormValue("step_role_" + strconv.Itoa(i))
+		if role == "" {
+			continue
+		}
+		if !auth.CanApprove(role) {
+			return c.Redirect("/settings?error=Invalid+role+for+step+" + strconv.Itoa(i))
+		}
+		stepName := strings.TrimSpace(c.FormValue("step_name_" + strconv.Itoa(i)))
+		if stepName == "" {
+			stepName = auth.RoleDisplayName(role) + " approval"
+		}
+		workflow.Steps = append(workflow.Steps, models.ApprovalStep{Name: stepName, Role: role})
+	}
+	if len(workflow.Steps) == 0 {
+		return c.Redirect("/settings?error=A+workflow+needs+at+least+one+step")
+	}
+
+	policy := company.Approvals
+	policy.Workflows = append(slices.Clip(policy.Workflows), workflow)
+	if err := repos.Company.SetApprovalPolicy(c.Context(), policy); err != nil {
+		logger.Error("Finance", "Failed to add approval workflow: "+err.Error())
+		return c.Redirect("/settings?error=Failed+to+update+settings")
+	}
+
+	steps := make([]string, len(workflow.Steps))
+	for i, step := range workflow.Steps {
+		steps[i] = step.Name + " (" + step.Role + ")"
+	}
+	logAudit(c, models.AuditActionUpdate, models.AuditEntityCompany, repos.Scope.CompanyID(), user, map[string]interface{}{
+		"workflow": name,
+		"steps":    strings.Join(steps, ", "),
+	})
+
+	return c.Redirect("/settings?success=Approval+workflow+added")
+}
+
+// DeleteApprovalWorkflow handles POST /api/settings/workflows/:id/delete.
+// Pending transactions it applied to fall back to the next matching workflow.
+func DeleteApprovalWorkflow(c *fiber.Ctx) error {
+	user, repos, err := scopedUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	if !auth.CanAccessSettings(user.Role) {
+		return c.Redirect("/settings?error=Permission+denied")
+	}
+
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Redirect("/settings?error=Invalid+workflow")
+	}
+
+	company, err := repos.Company.Get(c.Context())
+	if err != nil {
+		return c.Redirect("/settings?error=No+company+found")
+	}
+
+	policy := company.Approvals
+	i := slices.IndexFunc(policy.Workflows, func(w models.ApprovalWorkflow) bool { return w.ID == id })
+	if i < 0 {
+		return c.Redirect("/settings?error=Workflow+not+found")
+	}
+	name := policy.Workflows[i].Name
+	policy.Workflows = slices.Delete(slices.Clone(policy.Workflows), i, i+1)
+	if err := repos.Company.SetApprovalPolicy(c.Context(), policy); err != nil {
+		logger.Error("Finance", "Failed to delete approval workflow: "+err.Error())
+		return c.Redirect("/settings?error=Failed+to+update+settings")
+	}
+
+	logAudit(c, models.AuditActionUpdate, models.AuditEntityCompany, repos.Scope.CompanyID(), user, map[string]interface{}{
+		"workflow": name,
+		"removed":  true,
+	})
+
+	return c.Redirect("/settings?success=Approval+workflow+removed")
+}
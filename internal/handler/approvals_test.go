@@ -0,0 +1,356 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minhtranin/ct/internal/auth"
+	"github.com/minhtranin/ct/internal/handler"
+	"github.com/minhtranin/ct/internal/middleware"
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// openingBalance is what the fixture's account holds before anything is approved
+const openingBalance models.Money = 1_000_00
+
+// fixture is a company in the memory store with a member of each approving
+// role, an account, an expense category with a budget, and a second company
+// whose manager must not reach any of it. Holders may approve up to 100.00.
+type fixture struct {
+	store    *repository.MemoryStore
+	repos    *repository.Repositories
+	app      *fiber.App
+	employee *models.User
+	holder   *models.User
+	manager  *models.User
+	outsider *models.User // A manager of the other company
+	account  *models.Account
+	category *models.Category
+	budget   *models.Budget
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	ctx := context.Background()
+	f := &fixture{}
+	f.store, f.repos = repository.NewTestRepos(t, models.Company{Approvals: models.ApprovalPolicy{
+		RoleLimits: map[string]models.Money{string(auth.RoleHolder): 100_00},
+	}})
+	handler.SetStore(f.store)
+	t.Cleanup(func() { handler.SetStore(nil) })
+	companyID := f.repos.Scope.CompanyID()
+
+	f.employee = f.addUser(t, companyID, auth.RoleEmployee)
+	f.holder = f.addUser(t, companyID, auth.RoleHolder)
+	f.manager = f.addUser(t, companyID, auth.RoleManager)
+	other := repository.AddTestCompany(t, f.store, models.Company{Name: "Globex"})
+	f.outsider = f.addUser(t, other.Scope.CompanyID(), auth.RoleManager)
+
+	f.account = &models.Account{ID: primitive.NewObjectID(), Name: "Operating", Type: models.AccountTypeBank, Currency: "USD", Balance: openingBalance, IsActive: true}
+	if err := f.repos.Accounts.Create(ctx, f.account); err != nil {
+		t.Fatal(err)
+	}
+	f.category = models.NewCategory("Travel", models.CategoryTypeExpense, companyID)
+	f.category.ID = primitive.NewObjectID()
+	if err := f.repos.Categories.Create(ctx, f.category); err != nil {
+		t.Fatal(err)
+	}
+	f.budget = models.NewBudget("Travel", f.category.ID, 500_00, "USD", models.BudgetPeriodMonthly, companyID)
+	f.budget.ID = primitive.NewObjectID()
+	f.budget.StartDate, f.budget.EndDate = models.GetBudgetPeriodDates(models.BudgetPeriodMonthly, time.Now().UTC())
+	if err := f.repos.Budgets.Create(ctx, f.budget); err != nil {
+		t.Fatal(err)
+	}
+
+	// The routes as the router wires them, behind a stand-in for RequireAuth
+	f.app = fiber.New()
+	roles := middleware.RequireRole(auth.RoleLevel[auth.RoleEmployee])
+	f.app.Post("/api/transactions/:id/approve", signedIn, roles, handler.ApproveTransaction)
+	f.app.Post("/api/transactions/:id/reject", signedIn, roles, handler.RejectTransaction)
+	f.app.Post("/api/approvals/bulk", signedIn, roles, handler.DecideTransactions)
+	return f
+}
+
+// signedIn does what RequireAuth does once the session is checked, for the
+// user whose ID is in the X-User-ID header
+func signedIn(c *fiber.Ctx) error {
+	id, err := primitive.ObjectIDFromHex(c.Get("X-User-ID"))
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+	user, err := handler.Identities().FindByID(c.Context(), id)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+	c.Locals("userID", user.ID.Hex())
+	c.Locals("userRole", user.Role)
+	c.Locals("userEmail", user.Email)
+	repository.Bind(c, user.CompanyID)
+	return c.Next()
+}
+
+func (f *fixture) addUser(t *testing.T, companyID primitive.ObjectID, role auth.Role) *models.User {
+	t.Helper()
+	user := &models.User{
+		ID:        primitive.NewObjectID(),
+		Email:     string(role) + "-" + companyID.Hex() + "@example.com",
+		Name:      auth.RoleDisplayName(string(role)),
+		Role:      string(role),
+		CompanyID: companyID,
+	}
+	if err := f.store.Identities().Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// submit stores a pending expense from the fixture's account in its category
+func (f *fixture) submit(t *testing.T, creator *models.User, amount models.Money) *models.Transaction {
+	t.Helper()
+	txn := models.NewTransaction(models.TransactionTypeExpense, amount, "USD", creator.CompanyID, creator.ID, creator.Name)
+	txn.ID = primitive.NewObjectID()
+	txn.Description = "Flight"
+	txn.FromAccountID = f.account.ID
+	txn.CategoryID = f.category.ID
+	if err := f.repos.Transactions.Create(context.Background(), txn); err != nil {
+		t.Fatal(err)
+	}
+	return txn
+}
+
+// post sends a form as user and returns the response
+func (f *fixture) post(t *testing.T, user *models.User, path string, form url.Values) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", fiber.MIMEApplicationForm)
+	req.Header.Set("X-User-ID", user.ID.Hex())
+	resp, err := f.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// state returns the transaction, the account balance and the budget's spend as stored
+func (f *fixture) state(t *testing.T, txnID primitive.ObjectID) (*models.Transaction, models.Money, models.Money) {
+	t.Helper()
+	ctx := context.Background()
+	txn, err := f.repos.Transactions.Get(ctx, txnID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, err := f.repos.Accounts.Get(ctx, f.account.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	budget, err := f.repos.Budgets.Get(ctx, f.budget.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return txn, account.Balance, budget.Spent
+}
+
+func assertRedirect(t *testing.T, resp *http.Response, want string) {
+	t.Helper()
+	if resp.StatusCode != fiber.StatusFound {
+		t.Fatalf("status %d, want a redirect to %s", resp.StatusCode, want)
+	}
+	if got := resp.Header.Get("Location"); got != want {
+		t.Fatalf("redirected to %s, want %s", got, want)
+	}
+}
+
+func TestApproveTransaction(t *testing.T) {
+	f := newFixture(t)
+	txn := f.submit(t, f.employee, 120_00)
+
+	resp := f.post(t, f.manager, "/api/transactions/"+txn.ID.Hex()+"/approve", nil)
+	assertRedirect(t, resp, "/approvals?success=Transaction+approved")
+
+	got, balance, spent := f.state(t, txn.ID)
+	if got.Status != models.TransactionStatusApproved || got.ApprovedByID != f.manager.ID {
+		t.Errorf("status %s by %s, want approved by the manager", got.Status, got.ApprovedByID.Hex())
+	}
+	if want := openingBalance - 120_00; balance != want {
+		t.Errorf("balance %d, want %d", balance, want)
+	}
+	if spent != 120_00 {
+		t.Errorf("budget spent %d, want %d", spent, 120_00)
+	}
+	if _, err := f.repos.Journal.ForTransaction(context.Background(), txn.ID); err != nil {
+		t.Errorf("no journal entry for the approved transaction: %v", err)
+	}
+}
+
+func TestRejectTransaction(t *testing.T) {
+	f := newFixture(t)
+	txn := f.submit(t, f.employee, 120_00)
+
+	resp := f.post(t, f.manager, "/api/transactions/"+txn.ID.Hex()+"/reject", url.Values{"reason": {"No receipt"}})
+	assertRedirect(t, resp, "/approvals?success=Transaction+rejected")
+
+	got, balance, spent := f.state(t, txn.ID)
+	if got.Status != models.TransactionStatusRejected || got.RejectionReason != "No receipt" {
+		t.Errorf("status %s with reason %q, want rejected with the reason given", got.Status, got.RejectionReason)
+	}
+	if balance != openingBalance {
+		t.Errorf("balance %d, want it untouched at %d", balance, openingBalance)
+	}
+	if spent != 0 {
+		t.Errorf("budget spent %d, want 0", spent)
+	}
+}
+
+func TestApprovalDenied(t *testing.T) {
+	tests := []struct {
+		name     string
+		approver func(f *fixture) *models.User
+		creator  func(f *fixture) *models.User
+		amount   models.Money
+		path     string
+		want     string
+	}{
+		{
+			name:     "employee may not approve",
+			approver: func(f *fixture) *models.User { return f.employee },
+			creator:  func(f *fixture) *models.User { return f.manager },
+			amount:   50_00,
+			path:     "approve",
+			want:     "/approvals?error=You+are+not+allowed+to+approve+this+transaction",
+		},
+		{
+			name:     "employee may not reject",
+			approver: func(f *fixture) *models.User { return f.employee },
+			creator:  func(f *fixture) *models.User { return f.manager },
+			amount:   50_00,
+			path:     "reject",
+			want:     "/approvals?error=You+are+not+allowed+to+reject+this+transaction",
+		},
+		{
+			name:     "creator may not approve their own",
+			approver: func(f *fixture) *models.User { return f.manager },
+			creator:  func(f *fixture) *models.User { return f.manager },
+			amount:   50_00,
+			path:     "approve",
+			want:     "/approvals?error=You+cannot+approve+your+own+transaction",
+		},
+		{
+			name:     "holder over their limit",
+			approver: func(f *fixture) *models.User { return f.holder },
+			creator:  func(f *fixture) *models.User { return f.employee },
+			amount:   100_01,
+			path:     "approve",
+			want:     "/approvals?error=Amount+exceeds+your+approval+limit",
+		},
+		{
+			name:     "another company's manager",
+			approver: func(f *fixture) *models.User { return f.outsider },
+			creator:  func(f *fixture) *models.User { return f.employee },
+			amount:   50_00,
+			path:     "approve",
+			want:     "/approvals?error=Transaction+not+found",
+		},
+		{
+			name:     "another company's manager rejecting",
+			approver: func(f *fixture) *models.User { return f.outsider },
+			creator:  func(f *fixture) *models.User { return f.employee },
+			amount:   50_00,
+			path:     "reject",
+			want:     "/approvals?error=Transaction+not+found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			txn := f.submit(t, tt.creator(f), tt.amount)
+
+			resp := f.post(t, tt.approver(f), "/api/transactions/"+txn.ID.Hex()+"/"+tt.path, url.Values{"reason": {"No"}})
+			assertRedirect(t, resp, tt.want)
+
+			got, balance, spent := f.state(t, txn.ID)
+			if got.Status != models.TransactionStatusPending || len(got.ApprovalHistory) != 0 {
+				t.Errorf("status %s with %d sign-offs, want it still pending with none", got.Status, len(got.ApprovalHistory))
+			}
+			if balance != openingBalance || spent != 0 {
+				t.Errorf("balance %d and budget spent %d, want both untouched", balance, spent)
+			}
+		})
+	}
+}
+
+func TestApprovalWithinLimit(t *testing.T) {
+	f := newFixture(t)
+	txn := f.submit(t, f.employee, 100_00)
+
+	resp := f.post(t, f.holder, "/api/transactions/"+txn.ID.Hex()+"/approve", nil)
+	assertRedirect(t, resp, "/approvals?success=Transaction+approved")
+
+	if got, _, _ := f.state(t, txn.ID); got.Status != models.TransactionStatusApproved {
+		t.Errorf("status %s, want approved at exactly the holder's limit", got.Status)
+	}
+}
+
+func TestApprovalRoutesRequireARole(t *testing.T) {
+	f := newFixture(t)
+	txn := f.submit(t, f.employee, 50_00)
+	stranger := f.addUser(t, f.employee.CompanyID, auth.Role("guest"))
+
+	resp := f.post(t, stranger, "/api/transactions/"+txn.ID.Hex()+"/approve", nil)
+	assertRedirect(t, resp, "/access-denied")
+
+	if got, _, _ := f.state(t, txn.ID); got.Status != models.TransactionStatusPending {
+		t.Errorf("status %s, want it still pending", got.Status)
+	}
+}
+
+func TestDecideTransactions(t *testing.T) {
+	f := newFixture(t)
+	first := f.submit(t, f.employee, 40_00)
+	second := f.submit(t, f.employee, 60_00)
+	own := f.submit(t, f.manager, 10_00)
+
+	form := url.Values{"decision": {"approve"}, "ids": {first.ID.Hex(), second.ID.Hex(), own.ID.Hex()}}
+	resp := f.post(t, f.manager, "/api/approvals/bulk", form)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status %d, want the results page", resp.StatusCode)
+	}
+
+	for _, txn := range []*models.Transaction{first, second} {
+		if got, _, _ := f.state(t, txn.ID); got.Status != models.TransactionStatusApproved {
+			t.Errorf("%s: status %s, want approved", txn.ID.Hex(), got.Status)
+		}
+	}
+	got, balance, spent := f.state(t, own.ID)
+	if got.Status != models.TransactionStatusPending {
+		t.Errorf("the manager's own transaction is %s, want it refused and still pending", got.Status)
+	}
+	if want := openingBalance - 100_00; balance != want {
+		t.Errorf("balance %d, want %d", balance, want)
+	}
+	if spent != 100_00 {
+		t.Errorf("budget spent %d, want %d", spent, 100_00)
+	}
+}
+
+func TestDecideTransactionsStaysInCompany(t *testing.T) {
+	f := newFixture(t)
+	txn := f.submit(t, f.employee, 40_00)
+
+	form := url.Values{"decision": {"reject"}, "note": {"No"}, "ids": {txn.ID.Hex()}}
+	resp := f.post(t, f.outsider, "/api/approvals/bulk", form)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status %d, want the results page", resp.StatusCode)
+	}
+
+	if got, _, _ := f.state(t, txn.ID); got.Status != models.TransactionStatusPending {
+		t.Errorf("status %s, want another company's transaction left pending", got.Status)
+	}
+}
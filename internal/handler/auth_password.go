@@ -2,6 +2,7 @@
 package handler
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"os"
@@ -13,26 +14,59 @@ import (
 	"github.com/minhtranin/ct/internal/email"
 	"github.com/minhtranin/ct/internal/logger"
 	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/repository"
 	"github.com/minhtranin/ct/internal/view/shared/toast"
-	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 var (
-	db             *mongo.Client
 	sesClient      *email.SESClient
 	sessionManager *auth.SessionManager
+	throttle       *auth.Throttle
+	store          repository.Store
 )
 
 // InitAuth initializes the auth handlers
 func InitAuth(database *mongo.Client) {
-	db = database
 	var err error
 	sesClient, err = email.NewSESClient()
 	if err != nil {
 		logger.Error("Auth", "Failed to create SES client: "+err.Error())
 	}
-	sessionManager = auth.NewSessionManager()
+	sessionManager = auth.NewSessionManager(database)
+	throttle = auth.NewThrottle(database)
+	mongoStore := repository.NewMongoStore(database)
+	store = mongoStore
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := mongoStore.EnsureIndexes(ctx); err != nil {
+		logger.Error("Auth", "Failed to create repository indexes: "+err.Error())
+	}
+	if err := mongoStore.DetectTopology(ctx); err != nil {
+		logger.Error("Auth", "Failed to detect MongoDB topology, will retry on the next atomic write: "+err.Error())
+	}
+	if err := sessionManager.EnsureIndexes(ctx); err != nil {
+		logger.Error("Auth", "Failed to create session indexes: "+err.Error())
+	}
+	if err := throttle.EnsureIndexes(ctx); err != nil {
+		logger.Error("Auth", "Failed to create login attempt indexes: "+err.Error())
+	}
+}
+
+// errorToast renders an error toast for HTMX forms
+func errorToast(c *fiber.Ctx, title string) error {
+	c.Set("Content-Type", "text/html")
+	return toast.Toast(toast.Props{
+		Title:         title,
+		Variant:       toast.VariantError,
+		Position:      toast.PositionTopLeft,
+		Duration:      5000,
+		Dismissible:   true,
+		ShowIndicator: true,
+		Icon:          true,
+	}).Render(c.Context(), c.Response().BodyWriter())
 }
 
 // generateVerificationCode generates a 6-digit verification code
@@ -43,92 +77,73 @@ func generateVerificationCode() string {
 
 // SignUp handles POST /api/auth/signup
 func SignUp(c *fiber.Ctx) error {
+	name := strings.TrimSpace(c.FormValue("name"))
 	email := strings.TrimSpace(c.FormValue("email"))
 	password := c.FormValue("password")
 	confirmPassword := c.FormValue("confirm-password")
+	companyName := strings.TrimSpace(c.FormValue("company_name"))
+	currency := c.FormValue("currency")
+	timezone := c.FormValue("timezone")
 
 	// Validate input
 	if email == "" || password == "" {
-		c.Set("Content-Type", "text/html")
-		return toast.Toast(toast.Props{
-			Title:         "Email and password are required",
-			Variant:       toast.VariantError,
-			Position:      toast.PositionTopLeft,
-			Duration:      5000,
-			Dismissible:   true,
-			ShowIndicator: true,
-			Icon:          true,
-		}).Render(c.Context(), c.Response().BodyWriter())
+		return errorToast(c, "Email and password are required")
 	}
 
 	if password != confirmPassword {
-		c.Set("Content-Type", "text/html")
-		return toast.Toast(toast.Props{
-			Title:         "Passwords do not match",
-			Variant:       toast.VariantError,
-			Position:      toast.PositionTopLeft,
-			Duration:      5000,
-			Dismissible:   true,
-			ShowIndicator: true,
-			Icon:          true,
-		}).Render(c.Context(), c.Response().BodyWriter())
+		return errorToast(c, "Passwords do not match")
 	}
 
 	if len(password) < 8 {
-		c.Set("Content-Type", "text/html")
-		return toast.Toast(toast.Props{
-			Title:         "Password must be at least 8 characters",
-			Variant:       toast.VariantError,
-			Position:      toast.PositionTopLeft,
-			Duration:      5000,
-			Dismissible:   true,
-			ShowIndicator: true,
-			Icon:          true,
-		}).Render(c.Context(), c.Response().BodyWriter())
+		return errorToast(c, "Password must be at least 8 characters")
 	}
 
-	usersCollection := db.Database("ct").Collection("users")
+	if name == "" || companyName == "" {
+		return errorToast(c, "Your name and company name are required")
+	}
+
+	if !models.IsSupportedCurrency(currency) {
+		return errorToast(c, "Please choose a supported currency")
+	}
+
+	if _, err := time.LoadLocation(timezone); err != nil || timezone == "" {
+		return errorToast(c, "Please choose a valid timezone")
+	}
+
+	identities := store.Identities()
 
 	// Check if user already exists
-	var existingUser models.User
-	err := usersCollection.FindOne(c.Context(), bson.M{"email": email}).Decode(&existingUser)
+	_, err := identities.FindByEmail(c.Context(), email)
 	if err == nil {
-		c.Set("Content-Type", "text/html")
-		return toast.Toast(toast.Props{
-			Title:         "Email already registered",
-			Variant:       toast.VariantError,
-			Position:      toast.PositionTopLeft,
-			Duration:      5000,
-			Dismissible:   true,
-			ShowIndicator: true,
-			Icon:          true,
-		}).Render(c.Context(), c.Response().BodyWriter())
+		return errorToast(c, "Email already registered")
 	}
 
 	// Hash password
 	hashedPassword, err := auth.HashPassword(password)
 	if err != nil {
 		logger.Error("Auth", "Failed to hash password: "+err.Error())
-		c.Set("Content-Type", "text/html")
-		return toast.Toast(toast.Props{
-			Title:         "Failed to create account",
-			Variant:       toast.VariantError,
-			Position:      toast.PositionTopLeft,
-			Duration:      5000,
-			Dismissible:   true,
-			ShowIndicator: true,
-			Icon:          true,
-		}).Render(c.Context(), c.Response().BodyWriter())
+		return errorToast(c, "Failed to create account")
 	}
 
 	// Generate 6-digit verification code
 	verifyCode := generateVerificationCode()
 	expiresAt := time.Now().Add(15 * time.Minute) // Code expires in 15 minutes
 
-	// Create user (unverified)
+	// Create the company with its default categories
+	company, err := createCompany(c.Context(), companyName, email, currency, timezone)
+	if err != nil {
+		logger.Error("Auth", "Failed to create company: "+err.Error())
+		return errorToast(c, "Failed to create account")
+	}
+
+	// Create user (unverified); the person who creates the company owns it
 	now := time.Now()
 	user := models.User{
+		ID:              primitive.NewObjectID(),
 		Email:           email,
+		Name:            name,
+		Role:            string(auth.RoleSuperAdmin),
+		CompanyID:       company.ID,
 		PasswordHash:    hashedPassword,
 		CreatedAt:       now,
 		UpdatedAt:       now,
@@ -139,22 +154,20 @@ func SignUp(c *fiber.Ctx) error {
 		LastEmailSentAt: now,
 	}
 
-	_, err = usersCollection.InsertOne(c.Context(), user)
+	err = identities.Create(c.Context(), &user)
 	if err != nil {
 		logger.Error("Auth", "Failed to create user: "+err.Error())
-		c.Set("Content-Type", "text/html")
-		return toast.Toast(toast.Props{
-			Title:         "Failed to create account",
-			Variant:       toast.VariantError,
-			Position:      toast.PositionTopLeft,
-			Duration:      5000,
-			Dismissible:   true,
-			ShowIndicator: true,
-			Icon:          true,
-		}).Render(c.Context(), c.Response().BodyWriter())
+		deleteCompany(c.Context(), company.ID)
+		return errorToast(c, "Failed to create account")
 	}
 
-	logger.Info("Auth", "User created: "+email)
+	logAudit(c, models.AuditActionCreate, models.AuditEntityCompany, company.ID, &user, map[string]interface{}{
+		"name":     companyName,
+		"currency": currency,
+		"timezone": timezone,
+	})
+
+	logger.Info("Auth", "User created: "+email+" with company: "+companyName)
 
 	// Send verification email
 	if sesClient != nil {
@@ -173,47 +186,25 @@ func SignIn(c *fiber.Ctx) error {
 
 	// Validate input
 	if email == "" || password == "" {
-		c.Set("Content-Type", "text/html")
-		return toast.Toast(toast.Props{
-			Title:         "Email and password are required",
-			Variant:       toast.VariantError,
-			Position:      toast.PositionTopLeft,
-			Duration:      5000,
-			Dismissible:   true,
-			ShowIndicator: true,
-			Icon:          true,
-		}).Render(c.Context(), c.Response().BodyWriter())
+		return errorToast(c, "Email and password are required")
+	}
+
+	// Refuse early while the account or IP is locked out
+	if wait := lockedOut(c, auth.ThrottleSignIn, email); wait > 0 {
+		return lockedOutToast(c, wait)
 	}
 
-	usersCollection := db.Database("ct").Collection("users")
+	identities := store.Identities()
 
 	// Find user
-	var user models.User
-	err := usersCollection.FindOne(c.Context(), bson.M{"email": email}).Decode(&user)
-	if err == mongo.ErrNoDocuments {
-		c.Set("Content-Type", "text/html")
-		return toast.Toast(toast.Props{
-			Title:         "Invalid email or password",
-			Variant:       toast.VariantError,
-			Position:      toast.PositionTopLeft,
-			Duration:      5000,
-			Dismissible:   true,
-			ShowIndicator: true,
-			Icon:          true,
-		}).Render(c.Context(), c.Response().BodyWriter())
+	user, err := identities.FindByEmail(c.Context(), email)
+	if err == repository.ErrNotFound {
+		recordFailure(c, auth.ThrottleSignIn, email, nil)
+		return errorToast(c, "Invalid email or password")
 	}
 	if err != nil {
 		logger.Error("Auth", "Database error: "+err.Error())
-		c.Set("Content-Type", "text/html")
-		return toast.Toast(toast.Props{
-			Title:         "Login failed",
-			Variant:       toast.VariantError,
-			Position:      toast.PositionTopLeft,
-			Duration:      5000,
-			Dismissible:   true,
-			ShowIndicator: true,
-			Icon:          true,
-		}).Render(c.Context(), c.Response().BodyWriter())
+		return errorToast(c, "Login failed")
 	}
 
 	// Check if email is verified
@@ -225,30 +216,36 @@ func SignIn(c *fiber.Ctx) error {
 
 	// Verify password
 	if !auth.VerifyPassword(user.PasswordHash, password) {
-		c.Set("Content-Type", "text/html")
-		return toast.Toast(toast.Props{
-			Title:         "Invalid email or password",
-			Variant:       toast.VariantError,
-			Position:      toast.PositionTopLeft,
-			Duration:      5000,
-			Dismissible:   true,
-			ShowIndicator: true,
-			Icon:          true,
-		}).Render(c.Context(), c.Response().BodyWriter())
+		recordFailure(c, auth.ThrottleSignIn, email, user)
+		return errorToast(c, "Invalid email or password")
 	}
 
-	// Update last login
-	usersCollection.UpdateOne(c.Context(), bson.M{"_id": user.ID}, bson.M{
-		"$set": bson.M{"last_login_at": time.Now()},
-	})
+	resetFailures(c, auth.ThrottleSignIn, email)
 
-	logger.Info("Auth", "User signed in: "+email)
+	// Two-factor users get a pending session until the second factor is checked
+	if user.TOTPEnabled {
+		if err := sessionManager.SetPendingSession(c, user); err != nil {
+			logger.Error("Auth", "Failed to create pending session: "+err.Error())
+			return errorToast(c, "Login failed")
+		}
+
+		c.Set("HX-Redirect", "/signin/2fa")
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	// Update last login
+	identities.RecordLogin(c.Context(), user.ID, time.Now())
 
 	// Set session
-	sessionManager.SetSession(c, &user)
+	if err := sessionManager.SetSession(c, user); err != nil {
+		logger.Error("Auth", "Failed to create session: "+err.Error())
+		return errorToast(c, "Login failed")
+	}
+
+	logger.Info("Auth", "User signed in: "+email)
 
 	// Set HTMX redirect header for client-side redirect
-	c.Set("HX-Redirect", "/dashboard")
+	c.Set("HX-Redirect", postLoginRedirect(c, user))
 	return c.SendStatus(fiber.StatusOK)
 }
 
@@ -258,68 +255,42 @@ func VerifyCode(c *fiber.Ctx) error {
 	code := strings.TrimSpace(c.FormValue("code"))
 
 	if email == "" || code == "" {
-		c.Set("Content-Type", "text/html")
-		return toast.Toast(toast.Props{
-			Title:         "Email and code are required",
-			Variant:       toast.VariantError,
-			Position:      toast.PositionTopLeft,
-			Duration:      5000,
-			Dismissible:   true,
-			ShowIndicator: true,
-			Icon:          true,
-		}).Render(c.Context(), c.Response().BodyWriter())
+		return errorToast(c, "Email and code are required")
+	}
+
+	if wait := lockedOut(c, auth.ThrottleVerifyEmail, email); wait > 0 {
+		return lockedOutToast(c, wait)
 	}
 
-	usersCollection := db.Database("ct").Collection("users")
+	identities := store.Identities()
 
 	// Find user with valid verification code
-	var user models.User
-	err := usersCollection.FindOne(c.Context(), bson.M{
-		"email":             email,
-		"verify_token":      code,
-		"verify_expires_at": bson.M{"$gt": time.Now()},
-	}).Decode(&user)
-
-	if err == mongo.ErrNoDocuments {
-		c.Set("Content-Type", "text/html")
-		return toast.Toast(toast.Props{
-			Title:         "Invalid or expired verification code",
-			Variant:       toast.VariantError,
-			Position:      toast.PositionTopLeft,
-			Duration:      5000,
-			Dismissible:   true,
-			ShowIndicator: true,
-			Icon:          true,
-		}).Render(c.Context(), c.Response().BodyWriter())
+	user, err := identities.FindByVerifyCode(c.Context(), email, code, time.Now())
+
+	if err == repository.ErrNotFound {
+		// Count the wrong guess so the 6-digit code cannot be enumerated
+		target, _ := identities.FindByEmail(c.Context(), email)
+		recordFailure(c, auth.ThrottleVerifyEmail, email, target)
+
+		return errorToast(c, "Invalid or expired verification code")
 	}
 	if err != nil {
 		logger.Error("Auth", "Database error: "+err.Error())
-		c.Set("Content-Type", "text/html")
-		return toast.Toast(toast.Props{
-			Title:         "Failed to verify email",
-			Variant:       toast.VariantError,
-			Position:      toast.PositionTopLeft,
-			Duration:      5000,
-			Dismissible:   true,
-			ShowIndicator: true,
-			Icon:          true,
-		}).Render(c.Context(), c.Response().BodyWriter())
+		return errorToast(c, "Failed to verify email")
 	}
 
 	// Update user as verified and clear token
-	usersCollection.UpdateOne(c.Context(), bson.M{"_id": user.ID}, bson.M{
-		"$set": bson.M{
-			"email_verified":    true,
-			"verify_token":      "",
-			"verify_expires_at": time.Time{},
-			"updated_at":        time.Now(),
-		},
-	})
+	identities.MarkEmailVerified(c.Context(), user.ID)
 
 	logger.Info("Auth", "Email verified with code: "+email)
+	resetFailures(c, auth.ThrottleVerifyEmail, email)
 
 	// Set session and redirect to dashboard
-	sessionManager.SetSession(c, &user)
+	if err := sessionManager.SetSession(c, user); err != nil {
+		logger.Error("Auth", "Failed to create session: "+err.Error())
+		c.Set("HX-Redirect", "/signin")
+		return c.SendStatus(fiber.StatusOK)
+	}
 
 	// Set HTMX redirect header for client-side redirect
 	c.Set("HX-Redirect", "/dashboard")
@@ -337,12 +308,11 @@ func ResendVerification(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).SendString("Email is required")
 	}
 
-	usersCollection := db.Database("ct").Collection("users")
+	identities := store.Identities()
 
 	// Find user
-	var user models.User
-	err := usersCollection.FindOne(c.Context(), bson.M{"email": email}).Decode(&user)
-	if err == mongo.ErrNoDocuments {
+	user, err := identities.FindByEmail(c.Context(), email)
+	if err == repository.ErrNotFound {
 		return c.Status(fiber.StatusNotFound).SendString("User not found")
 	}
 	if err != nil {
@@ -373,13 +343,7 @@ func ResendVerification(c *fiber.Ctx) error {
 	expiresAt := time.Now().Add(15 * time.Minute)
 
 	// Update verification code and LastEmailSentAt
-	usersCollection.UpdateOne(c.Context(), bson.M{"_id": user.ID}, bson.M{
-		"$set": bson.M{
-			"verify_token":       newCode,
-			"verify_expires_at":  expiresAt,
-			"last_email_sent_at": time.Now(),
-		},
-	})
+	identities.SetVerifyCode(c.Context(), user.ID, newCode, expiresAt, time.Now())
 
 	logger.Info("Auth", "Verification code resent for: "+email)
 
@@ -403,12 +367,16 @@ func ForgotPassword(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).SendString("Email is required")
 	}
 
-	usersCollection := db.Database("ct").Collection("users")
+	// Every request counts, so reset emails cannot be used to flood an inbox
+	if wait := limitResetRequests(c, email); wait > 0 {
+		return lockedOutToast(c, wait)
+	}
+
+	identities := store.Identities()
 
 	// Find user
-	var user models.User
-	err := usersCollection.FindOne(c.Context(), bson.M{"email": email}).Decode(&user)
-	if err == mongo.ErrNoDocuments {
+	user, err := identities.FindByEmail(c.Context(), email)
+	if err == repository.ErrNotFound {
 		// Don't reveal if email exists or not
 		return c.Redirect("/signin")
 	}
@@ -425,12 +393,7 @@ func ForgotPassword(c *fiber.Ctx) error {
 	}
 
 	// Update user with reset token
-	usersCollection.UpdateOne(c.Context(), bson.M{"_id": user.ID}, bson.M{
-		"$set": bson.M{
-			"reset_token":      resetToken,
-			"reset_expires_at": time.Now().Add(1 * time.Hour),
-		},
-	})
+	identities.SetResetToken(c.Context(), user.ID, resetToken, time.Now().Add(1*time.Hour))
 
 	logger.Info("Auth", "Password reset requested for: "+email)
 
@@ -462,16 +425,19 @@ func ResetPassword(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).SendString("Password must be at least 8 characters")
 	}
 
-	usersCollection := db.Database("ct").Collection("users")
+	// Reset tokens are not tied to an account until matched, so only the client IP is limited
+	ipKey := auth.ThrottleKey(auth.ThrottleScopeIP, auth.ThrottleResetToken, c.IP())
+	if wait, _ := throttle.LockedFor(c.Context(), ipKey); wait > 0 {
+		return c.Status(fiber.StatusTooManyRequests).SendString("Too many attempts. Try again in " + formatWait(wait))
+	}
+
+	identities := store.Identities()
 
 	// Find user with valid reset token
-	var user models.User
-	err := usersCollection.FindOne(c.Context(), bson.M{
-		"reset_token":      token,
-		"reset_expires_at": bson.M{"$gt": time.Now()},
-	}).Decode(&user)
+	user, err := identities.FindByResetToken(c.Context(), token, time.Now())
 
-	if err == mongo.ErrNoDocuments {
+	if err == repository.ErrNotFound {
+		throttle.RecordFailure(c.Context(), auth.ThrottleScopeIP, auth.ThrottleResetToken, c.IP(), auth.IPPolicy)
 		return c.Status(fiber.StatusBadRequest).SendString("Invalid or expired reset token")
 	}
 	if err != nil {
@@ -487,17 +453,22 @@ func ResetPassword(c *fiber.Ctx) error {
 	}
 
 	// Update password and clear reset token
-	usersCollection.UpdateOne(c.Context(), bson.M{"_id": user.ID}, bson.M{
-		"$set": bson.M{
-			"password_hash":    hashedPassword,
-			"reset_token":      "",
-			"reset_expires_at": time.Time{},
-			"updated_at":       time.Now(),
-		},
-	})
+	identities.SetPassword(c.Context(), user.ID, hashedPassword)
 
 	logger.Info("Auth", "Password reset for: "+user.Email)
 
+	// A password reset invalidates every existing session
+	count, err := sessionManager.RevokeAllForUser(c.Context(), user.ID)
+	if err != nil {
+		logger.Error("Auth", "Failed to revoke sessions after password reset: "+err.Error())
+	} else {
+		logAudit(c, models.AuditActionRevoke, models.AuditEntityUser, user.ID, user, map[string]interface{}{
+			"revoked_sessions": count,
+			"reason":           "password_reset",
+		})
+	}
+	sessionManager.ClearSession(c)
+
 	// Set HTMX redirect header for client-side redirect
 	c.Set("HX-Redirect", "/signin")
 	return c.SendStatus(fiber.StatusOK)
@@ -511,16 +482,12 @@ func VerifyEmail(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).SendString("Token is required")
 	}
 
-	usersCollection := db.Database("ct").Collection("users")
+	identities := store.Identities()
 
 	// Find user with valid verification token
-	var user models.User
-	err := usersCollection.FindOne(c.Context(), bson.M{
-		"verify_token":      token,
-		"verify_expires_at": bson.M{"$gt": time.Now()},
-	}).Decode(&user)
+	user, err := identities.FindByVerifyToken(c.Context(), token, time.Now())
 
-	if err == mongo.ErrNoDocuments {
+	if err == repository.ErrNotFound {
 		return c.Status(fiber.StatusBadRequest).SendString("Invalid or expired verification token")
 	}
 	if err != nil {
@@ -529,14 +496,7 @@ func VerifyEmail(c *fiber.Ctx) error {
 	}
 
 	// Update user as verified and clear token
-	usersCollection.UpdateOne(c.Context(), bson.M{"_id": user.ID}, bson.M{
-		"$set": bson.M{
-			"email_verified":    true,
-			"verify_token":      "",
-			"verify_expires_at": time.Time{},
-			"updated_at":        time.Now(),
-		},
-	})
+	identities.MarkEmailVerified(c.Context(), user.ID)
 
 	logger.Info("Auth", "Email verified: "+user.Email)
 
@@ -701,14 +661,35 @@ func GetSession(c *fiber.Ctx) (string, error) {
 	return userID.Hex(), nil
 }
 
+// CurrentSession returns the active server-side session for the request
+func CurrentSession(c *fiber.Ctx) (*models.Session, error) {
+	return sessionManager.CurrentSession(c)
+}
+
+// HasPendingSignIn checks if the request is halfway through a two-factor sign-in
+func HasPendingSignIn(c *fiber.Ctx) bool {
+	_, err := sessionManager.PendingSession(c)
+	return err == nil
+}
+
 // ClearSession clears the user session (for use in middleware)
 func ClearSession(c *fiber.Ctx) error {
 	return sessionManager.ClearSession(c)
 }
 
-// GetDB returns the database instance (for use in page handlers)
-func GetDB() *mongo.Client {
-	return db
+// Repos returns the repositories scoped to the signed-in user's company (for use in page handlers)
+func Repos(c *fiber.Ctx) (*repository.Repositories, error) {
+	return repository.ForRequest(store, c)
+}
+
+// Identities returns the unscoped user lookups (for use in page handlers)
+func Identities() repository.IdentityStore {
+	return store.Identities()
+}
+
+// SetStore swaps the data store, e.g. for repository.NewMemoryStore in tests
+func SetStore(s repository.Store) {
+	store = s
 }
 
 // SendVerificationEmail sends a verification email (exported for use in page handlers)
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"fmt"
+	"html"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minhtranin/ct/internal/budgeting"
+	"github.com/minhtranin/ct/internal/email"
+	"github.com/minhtranin/ct/internal/logger"
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/repository"
+)
+
+// alertBudgetOwners tells the owner of every budget that approving txn took past
+// its warning threshold or its limit, in the app and by email
+func alertBudgetOwners(c *fiber.Ctx, repos *repository.Repositories, txn *models.Transaction) {
+	crossed, err := budgeting.Crossed(c.Context(), repos, txn)
+	if err != nil {
+		logger.Error("Finance", "Failed to check budget thresholds for transaction "+txn.ID.Hex()+": "+err.Error())
+		return
+	}
+	for _, impact := range crossed {
+		budget := impact.Budget
+		if budget.OwnerID.IsZero() {
+			continue
+		}
+		title, message := budgetAlert(impact, txn)
+		notification := models.NewNotification(budget.OwnerID, title, message, "/budgets")
+		if err := repos.Notifications.Create(c.Context(), notification); err != nil {
+			logger.Error("Finance", "Failed to notify owner of budget "+budget.ID.Hex()+": "+err.Error())
+		}
+		if sesClient == nil {
+			continue
+		}
+		owner, err := repos.Users.Get(c.Context(), budget.OwnerID)
+		if err != nil {
+			continue
+		}
+		go sendBudgetAlertEmail(owner.Email, title, message)
+	}
+}
+
+// budgetAlert describes the threshold a budget crossed and the expense that took it there
+func budgetAlert(impact models.BudgetImpact, txn *models.Transaction) (title, message string) {
+	budget := impact.Budget
+	title = fmt.Sprintf("%s has reached %.0f%% of its limit", budget.Name, impact.Utilization())
+	if impact.Level == models.BudgetLevelExceeded {
+		title = budget.Name + " is over its limit"
+	}
+	message = fmt.Sprintf("%s has spent %s of %s after %s for %s was approved.",
+		budget.Name, budget.Spent.Format(budget.Currency), budget.Limit().Format(budget.Currency),
+		txn.Description, txn.Amount.Format(txn.Currency))
+	return title, message
+}
+
+// sendBudgetAlertEmail sends a budget alert to its owner at toEmail
+func sendBudgetAlertEmail(toEmail, title, message string) {
+	appName := os.Getenv("APP_NAME")
+	if appName == "" {
+		appName = "CT"
+	}
+
+	// Check if SENDGRID_TO_EMAIL is set for testing
+	testEmail := os.Getenv("SENDGRID_TO_EMAIL")
+	if testEmail != "" {
+		toEmail = testEmail
+	}
+
+	baseURL := sesClient.GetBaseURL()
+	budgetsLink := baseURL + "/budgets"
+
+	// HTML email
+	htmlBody := fmt.Sprintf(`
+		<div style="font-family: Arial, sans-serif; max-width: 600px; margin: 0 auto;">
+			<h2 style="color: #5D5CFF;">%s</h2>
+			<p>%s</p>
+			<div style="margin: 30px 0;">
+				<a href="%s" style="background-color: #5D5CFF; color: white; padding: 12px 30px; text-decoration: none; border-radius: 8px; display: inline-block; font-weight: bold;">View Budgets</a>
+			</div>
+			<p style="color: #999; font-size: 12px; margin-top: 30px;">If the button doesn't work, copy and paste this link into your browser:<br>%s</p>
+		</div>
+	`, html.EscapeString(title), html.EscapeString(message), budgetsLink, budgetsLink)
+
+	// Plain text email
+	textBody := fmt.Sprintf("%s\n\n%s\n\nView your budgets on %s:\n\n%s", title, message, appName, budgetsLink)
+
+	// Create the email input
+	input := &email.SendEmailInput{
+		ToEmailAddress:   toEmail,
+		FromEmailAddress: sesClient.FormatFromAddress(),
+		Content: &email.EmailContent{
+			Simple: &email.Message{
+				Subject: &email.Content{
+					Data:    title,
+					Charset: "UTF-8",
+				},
+				Body: &email.Body{
+					Html: &email.Content{
+						Data:    htmlBody,
+						Charset: "UTF-8",
+					},
+					Text: &email.Content{
+						Data:    textBody,
+						Charset: "UTF-8",
+					},
+				},
+			},
+		},
+	}
+
+	// Send the email
+	logger.Info("Email", "Sending budget alert email to: "+toEmail)
+	result, err := sesClient.SendEmail(input)
+	if err != nil {
+		logger.Error("Email", "Failed to send budget alert email via SES: "+err.Error())
+		return
+	}
+
+	logger.Info("Email", "Budget alert email sent successfully to: "+toEmail+", MessageID: "+*result.MessageId)
+}
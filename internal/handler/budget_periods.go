@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/minhtranin/ct/internal/budgeting"
+	"github.com/minhtranin/ct/internal/logger"
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/repository"
+)
+
+// budgetPeriodInterval is how often WatchBudgetPeriods looks for ended periods
+const budgetPeriodInterval = time.Hour
+
+// budgetPeriodActor is recorded as the user behind automatic budget rollovers
+var budgetPeriodActor = &models.User{Name: "Budget periods"}
+
+// WatchBudgetPeriods closes ended budget periods and opens the next period of
+// recurring budgets in every company, now and then every hour until ctx is
+// done. Call it after InitAuth.
+func WatchBudgetPeriods(ctx context.Context) {
+	ticker := time.NewTicker(budgetPeriodInterval)
+	defer ticker.Stop()
+	for {
+		rollOverBudgets(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// rollOverBudgets runs one round of budget rollovers
+func rollOverBudgets(ctx context.Context) {
+	companies, err := store.Directory().Companies(ctx)
+	if err != nil {
+		logger.Error("Finance", "Failed to list companies for budget rollover: "+err.Error())
+		return
+	}
+
+	now := time.Now()
+	for _, company := range companies {
+		scope, err := repository.ForCompany(company.ID)
+		if err != nil {
+			continue
+		}
+		repos := store.Scoped(scope)
+		err = repos.Atomic(ctx, func(ctx context.Context) error {
+			_, err := budgeting.RollOver(ctx, repos, budgetPeriodActor, now)
+			return err
+		})
+		if err != nil {
+			logger.Error("Finance", "Failed to roll over budgets for company "+company.ID.Hex()+": "+err.Error())
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minhtranin/ct/internal/lifecycle"
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/render"
+	"github.com/minhtranin/ct/internal/repository"
+	view "github.com/minhtranin/ct/internal/view/components"
+	"github.com/minhtranin/ct/internal/view/layouts"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxBulkDecisions caps how many transactions one bulk decision may cover
+const maxBulkDecisions = 200
+
+// DecideTransactions handles POST /api/approvals/bulk. It approves or rejects
+// every selected transaction with a shared comment or reason and shows what
+// happened to each.
+func DecideTransactions(c *fiber.Ctx) error {
+	user, repos, err := scopedUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	event := lifecycle.Event(c.FormValue("decision"))
+	action := models.AuditActionApprove
+	switch event {
+	case lifecycle.EventApprove:
+	case lifecycle.EventReject:
+		action = models.AuditActionReject
+	default:
+		return c.Redirect("/approvals?error=Invalid+decision")
+	}
+
+	// The shared text is the reason on a rejection and the comment on an approval
+	note := strings.TrimSpace(c.FormValue("note"))
+	if event == lifecycle.EventReject && note == "" {
+		return c.Redirect("/approvals?error=A+reason+is+required+to+reject")
+	}
+	in := lifecycle.Input{Comment: note}
+	if event == lifecycle.EventReject {
+		in = lifecycle.Input{Reason: note}
+	}
+
+	var ids []primitive.ObjectID
+	seen := make(map[primitive.ObjectID]bool)
+	for _, value := range c.Request().PostArgs().PeekMulti("ids") {
+		id, err := primitive.ObjectIDFromHex(string(value))
+		if err != nil || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return c.Redirect("/approvals?error=Select+at+least+one+transaction")
+	}
+	if len(ids) > maxBulkDecisions {
+		return c.Redirect("/approvals?error=Select+at+most+" + strconv.Itoa(maxBulkDecisions) + "+transactions+at+a+time")
+	}
+
+	// Each transaction is decided on its own, so its status change and the money
+	// it moves commit together and a failure leaves the others decided
+	data := view.BulkDecisionData{Event: string(event), Note: note}
+	for _, id := range ids {
+		result := view.BulkDecisionResult{ID: id}
+		txn, err := repos.Transactions.Get(c.Context(), id)
+		if err != nil {
+			result.Outcome = view.BulkOutcomeSkipped
+			result.Message = "Transaction not found"
+			data.Add(result)
+			continue
+		}
+		result.Transaction = *txn
+
+		changed, err := lifecycle.Fire(c.Context(), repos, user, txn, event, in)
+		result.Outcome = bulkOutcome(err)
+		if err != nil {
+			result.Message = strings.ReplaceAll(transitionFailed(txn, event, err), "+", " ")
+			data.Add(result)
+			continue
+		}
+
+		result.Transaction = *changed
+		if changed.IsPending() {
+			result.Message = "Step signed off; the next step is still to come"
+		} else if event == lifecycle.EventApprove {
+			alertBudgetOwners(c, repos, changed)
+		}
+		changes := map[string]interface{}{"bulk": true}
+		if event == lifecycle.EventReject {
+			changes["reason"] = note
+		} else {
+			changes["comment"] = note
+		}
+		auditDecision(c, user, changed, action, changes)
+		data.Add(result)
+	}
+
+	return render.HTML(c, layouts.Dashboard("Bulk Decision", view.BulkDecisionPage(data), false, user.Email, user.Role, "/approvals"))
+}
+
+// bulkOutcome classifies the result of deciding one transaction of a bulk decision
+func bulkOutcome(err error) view.BulkOutcome {
+	switch {
+	case err == nil:
+		return view.BulkOutcomeDecided
+	case errors.Is(err, lifecycle.ErrInvalidTransition),
+		errors.Is(err, repository.ErrStatusChanged),
+		errors.Is(err, repository.ErrNotFound):
+		// Decided by someone else, before the list was loaded or since
+		return view.BulkOutcomeSkipped
+	case errors.Is(err, lifecycle.ErrNotPermitted),
+		errors.Is(err, models.ErrSelfApproval),
+		errors.Is(err, models.ErrApprovalLimit),
+		errors.Is(err, models.ErrApprovalStep),
+		errors.Is(err, models.ErrAlreadySignedOff):
+		return view.BulkOutcomeRefused
+	default:
+		return view.BulkOutcomeFailed
+	}
+}
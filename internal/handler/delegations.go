@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minhtranin/ct/internal/auth"
+	"github.com/minhtranin/ct/internal/logger"
+	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreateDelegation handles POST /api/delegations
+func CreateDelegation(c *fiber.Ctx) error {
+	user, repos, err := scopedUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	if !auth.CanApprove(user.Role) {
+		return c.Redirect("/approvals?error=Permission+denied")
+	}
+
+	delegateID, err := primitive.ObjectIDFromHex(c.FormValue("delegate_id"))
+	if err != nil || delegateID == user.ID {
+		return c.Redirect("/approvals?error=Choose+someone+else+to+delegate+to")
+	}
+	delegate, err := repos.Users.Get(c.Context(), delegateID)
+	if err != nil {
+		return c.Redirect("/approvals?error=User+not+found")
+	}
+
+	// Whole days: from the start of the first until the end of the last
+	startsAt, err := time.Parse("2006-01-02", c.FormValue("starts_on"))
+	if err != nil {
+		return c.Redirect("/approvals?error=Invalid+start+date")
+	}
+	lastDay, err := time.Parse("2006-01-02", c.FormValue("ends_on"))
+	if err != nil || lastDay.Before(startsAt) {
+		return c.Redirect("/approvals?error=Invalid+end+date")
+	}
+	endsAt := lastDay.AddDate(0, 0, 1)
+	if !endsAt.After(time.Now()) {
+		return c.Redirect("/approvals?error=The+delegation+would+already+have+ended")
+	}
+
+	delegation := models.Delegation{
+		ID:           primitive.NewObjectID(),
+		FromUserID:   user.ID,
+		FromUserName: user.Name,
+		ToUserID:     delegate.ID,
+		ToUserName:   delegate.Name,
+		StartsAt:     startsAt,
+		EndsAt:       endsAt,
+		CreatedAt:    time.Now(),
+	}
+	if err := repos.Delegations.Create(c.Context(), &delegation); err != nil {
+		logger.Error("Finance", "Failed to create delegation: "+err.Error())
+		return c.Redirect("/approvals?error=Failed+to+delegate")
+	}
+
+	logAudit(c, models.AuditActionCreate, models.AuditEntityDelegation, delegation.ID, user, map[string]interface{}{
+		"to":    delegate.Name,
+		"from":  startsAt.Format("Jan 02, 2006"),
+		"until": lastDay.Format("Jan 02, 2006"),
+	})
+
+	return c.Redirect("/approvals?success=Approvals+delegated")
+}
+
+// RevokeDelegation handles POST /api/delegations/:id/revoke. Only the user who
+// delegated may end it early.
+func RevokeDelegation(c *fiber.Ctx) error {
+	user, repos, err := scopedUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Redirect("/approvals?error=Invalid+delegation")
+	}
+
+	delegations, err := repos.Delegations.List(c.Context(), user.ID)
+	if err != nil {
+		return c.Redirect("/approvals?error=Failed+to+load+delegations")
+	}
+	var delegateName string
+	for _, d := range delegations {
+		if d.ID == id {
+			delegateName = d.ToUserName
+		}
+	}
+
+	if err := repos.Delegations.Revoke(c.Context(), id, user.ID, time.Now()); err != nil {
+		return c.Redirect("/approvals?error=Delegation+not+found")
+	}
+
+	logAudit(c, models.AuditActionRevoke, models.AuditEntityDelegation, id, user, map[string]interface{}{
+		"to": delegateName,
+	})
+
+	return c.Redirect("/approvals?success=Delegation+revoked")
+}
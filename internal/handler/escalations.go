@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"os"
+	"time"
+
+	"github.com/minhtranin/ct/internal/auth"
+	"github.com/minhtranin/ct/internal/email"
+	"github.com/minhtranin/ct/internal/lifecycle"
+	"github.com/minhtranin/ct/internal/logger"
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/repository"
+)
+
+// escalationInterval is how often WatchApprovalSLAs looks for overdue approvals
+const escalationInterval = 15 * time.Minute
+
+// escalationActor is recorded as the user behind automatic escalations
+var escalationActor = &models.User{Name: "Approval SLA"}
+
+// WatchApprovalSLAs escalates overdue approvals in every company with an SLA,
+// now and then every few minutes until ctx is done. Call it after InitAuth.
+func WatchApprovalSLAs(ctx context.Context) {
+	ticker := time.NewTicker(escalationInterval)
+	defer ticker.Stop()
+	for {
+		escalateOverdueApprovals(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// escalateOverdueApprovals runs one round of escalations and, on top of the
+// in-app notifications, emails each one's recipients
+func escalateOverdueApprovals(ctx context.Context) {
+	companies, err := store.Directory().Companies(ctx)
+	if err != nil {
+		logger.Error("Finance", "Failed to list companies for escalation: "+err.Error())
+		return
+	}
+
+	now := time.Now()
+	for _, company := range companies {
+		if company.Approvals.SLAHours <= 0 {
+			continue
+		}
+		scope, err := repository.ForCompany(company.ID)
+		if err != nil {
+			continue
+		}
+		// Levels raised before a failure come back too, and are still emailed
+		escalations, err := lifecycle.Escalate(ctx, store.Scoped(scope), escalationActor, now)
+		if err != nil {
+			logger.Error("Finance", "Failed to escalate approvals for company "+company.ID.Hex()+": "+err.Error())
+		}
+		if sesClient == nil {
+			continue
+		}
+		for _, e := range escalations {
+			for _, recipient := range e.Recipients {
+				sendEscalationEmail(recipient.Email, company.Name, e)
+			}
+		}
+	}
+}
+
+// sendEscalationEmail tells toEmail that an approval waited past the SLA and now needs their role
+func sendEscalationEmail(toEmail, companyName string, e lifecycle.Escalation) {
+	appName := os.Getenv("APP_NAME")
+	if appName == "" {
+		appName = "CT"
+	}
+
+	// Check if SENDGRID_TO_EMAIL is set for testing
+	testEmail := os.Getenv("SENDGRID_TO_EMAIL")
+	if testEmail != "" {
+		toEmail = testEmail
+	}
+
+	txn := e.Transaction
+	description := html.EscapeString(txn.Description)
+	baseURL := sesClient.GetBaseURL()
+	approvalsLink := baseURL + "/approvals"
+	waiting := fmt.Sprintf("%.0f hours", e.Waiting.Hours())
+	roleName := auth.RoleDisplayName(string(e.Role))
+	subject := fmt.Sprintf("Overdue approval: %s (%s)", txn.Description, txn.Amount.Format(txn.Currency))
+
+	// HTML email
+	htmlBody := fmt.Sprintf(`
+		<div style="font-family: Arial, sans-serif; max-width: 600px; margin: 0 auto;">
+			<h2 style="color: #5D5CFF;">An approval is overdue at %s</h2>
+			<p><strong>%s</strong> for <strong>%s</strong>, submitted by %s, has waited %s at the <strong>%s</strong> step.</p>
+			<p>It has been escalated to %s approvers so that someone can decide it.</p>
+			<div style="margin: 30px 0;">
+				<a href="%s" style="background-color: #5D5CFF; color: white; padding: 12px 30px; text-decoration: none; border-radius: 8px; display: inline-block; font-weight: bold;">Review Approvals</a>
+			</div>
+			<p style="color: #999; font-size: 12px; margin-top: 30px;">If the button doesn't work, copy and paste this link into your browser:<br>%s</p>
+		</div>
+	`, html.EscapeString(companyName), description, txn.Amount.Format(txn.Currency), html.EscapeString(txn.CreatedByName), waiting, html.EscapeString(e.Step.Name), roleName, approvalsLink, approvalsLink)
+
+	// Plain text email
+	textBody := fmt.Sprintf(
+		"%s for %s, submitted by %s, has waited %s at the %s step at %s on %s.\n\nIt has been escalated to %s approvers so that someone can decide it:\n\n%s",
+		txn.Description, txn.Amount.Format(txn.Currency), txn.CreatedByName, waiting, e.Step.Name, companyName, appName, roleName, approvalsLink,
+	)
+
+	// Create the email input
+	input := &email.SendEmailInput{
+		ToEmailAddress:   toEmail,
+		FromEmailAddress: sesClient.FormatFromAddress(),
+		Content: &email.EmailContent{
+			Simple: &email.Message{
+				Subject: &email.Content{
+					Data:    subject,
+					Charset: "UTF-8",
+				},
+				Body: &email.Body{
+					Html: &email.Content{
+						Data:    htmlBody,
+						Charset: "UTF-8",
+					},
+					Text: &email.Content{
+						Data:    textBody,
+						Charset: "UTF-8",
+					},
+				},
+			},
+		},
+	}
+
+	// Send the email
+	logger.Info("Email", "Sending escalation email to: "+toEmail)
+	result, err := sesClient.SendEmail(input)
+	if err != nil {
+		logger.Error("Email", "Failed to send escalation email via SES: "+err.Error())
+		return
+	}
+
+	logger.Info("Email", "Escalation email sent successfully to: "+toEmail+", MessageID: "+*result.MessageId)
+}
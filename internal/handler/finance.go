@@ -1,45 +1,66 @@
 package handler
 
 import (
+	"errors"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/minhtranin/ct/internal/budgeting"
+	"github.com/minhtranin/ct/internal/lifecycle"
+	"github.com/minhtranin/ct/internal/logger"
 	"github.com/minhtranin/ct/internal/models"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/minhtranin/ct/internal/repository"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // logAudit creates an audit log entry
 func logAudit(c *fiber.Ctx, action models.AuditAction, entity models.AuditEntity, entityID primitive.ObjectID, user *models.User, changes map[string]interface{}) {
-	db := GetDB()
-	auditCollection := db.Database("ct").Collection("audit_logs")
+	logAuditOnBehalfOf(c, action, entity, entityID, user, primitive.NilObjectID, "", changes)
+}
+
+// logAuditOnBehalfOf records an action user took with the delegated authority of
+// another user; a zero onBehalfOfID means their own
+func logAuditOnBehalfOf(c *fiber.Ctx, action models.AuditAction, entity models.AuditEntity, entityID primitive.ObjectID, user *models.User, onBehalfOfID primitive.ObjectID, onBehalfOfName string, changes map[string]interface{}) {
+	// The entry belongs to the acting user's company, which may not be bound yet during sign-in
+	scope, err := repository.ForCompany(user.CompanyID)
+	if err != nil {
+		return
+	}
 
 	log := models.NewAuditLog(action, entity, entityID, user.ID, user.CompanyID, user.Name, user.Email)
 	log.WithIPAddress(c.IP())
 	log.WithUserAgent(c.Get("User-Agent"))
+	if !onBehalfOfID.IsZero() {
+		log.WithOnBehalfOf(onBehalfOfID, onBehalfOfName)
+	}
 	if changes != nil {
 		log.WithChanges(changes)
 	}
 
-	auditCollection.InsertOne(c.Context(), log)
+	store.Scoped(scope).AuditLogs.Insert(c.Context(), log)
 }
 
-// CreateAccount handles POST /api/accounts
-func CreateAccount(c *fiber.Ctx) error {
-	userID, err := GetSession(c)
+// scopedUser loads the signed-in user and the repositories for their company
+func scopedUser(c *fiber.Ctx) (*models.User, *repository.Repositories, error) {
+	user, err := CurrentUser(c)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		return nil, nil, err
 	}
+	repos, err := Repos(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, repos, nil
+}
 
-	db := GetDB()
-	usersCollection := db.Database("ct").Collection("users")
-
-	var user models.User
-	objectID, _ := primitive.ObjectIDFromHex(userID)
-	err = usersCollection.FindOne(c.Context(), bson.M{"_id": objectID}).Decode(&user)
+// CreateAccount handles POST /api/accounts
+func CreateAccount(c *fiber.Ctx) error {
+	user, repos, err := scopedUser(c)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User not found"})
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
 	}
 
 	// Parse form data
@@ -69,14 +90,13 @@ func CreateAccount(c *fiber.Ctx) error {
 		UpdatedAt:     now,
 	}
 
-	accountsCollection := db.Database("ct").Collection("accounts")
-	_, err = accountsCollection.InsertOne(c.Context(), account)
+	err = repos.Accounts.Create(c.Context(), &account)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create account"})
 	}
 
 	// Audit log
-	logAudit(c, models.AuditActionCreate, models.AuditEntityAccount, account.ID, &user, map[string]interface{}{
+	logAudit(c, models.AuditActionCreate, models.AuditEntityAccount, account.ID, user, map[string]interface{}{
 		"name":     name,
 		"type":     accountType,
 		"currency": currency,
@@ -88,21 +108,11 @@ func CreateAccount(c *fiber.Ctx) error {
 
 // CreateCategory handles POST /api/categories
 func CreateCategory(c *fiber.Ctx) error {
-	userID, err := GetSession(c)
+	user, repos, err := scopedUser(c)
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
 	}
 
-	db := GetDB()
-	usersCollection := db.Database("ct").Collection("users")
-
-	var user models.User
-	objectID, _ := primitive.ObjectIDFromHex(userID)
-	err = usersCollection.FindOne(c.Context(), bson.M{"_id": objectID}).Decode(&user)
-	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User not found"})
-	}
-
 	// Parse form data
 	name := c.FormValue("name")
 	categoryType := c.FormValue("type")
@@ -129,14 +139,13 @@ func CreateCategory(c *fiber.Ctx) error {
 		UpdatedAt: now,
 	}
 
-	categoriesCollection := db.Database("ct").Collection("categories")
-	_, err = categoriesCollection.InsertOne(c.Context(), category)
+	err = repos.Categories.Create(c.Context(), &category)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create category"})
 	}
 
 	// Audit log
-	logAudit(c, models.AuditActionCreate, models.AuditEntityCategory, category.ID, &user, map[string]interface{}{
+	logAudit(c, models.AuditActionCreate, models.AuditEntityCategory, category.ID, user, map[string]interface{}{
 		"name":  name,
 		"type":  categoryType,
 		"color": color,
@@ -148,96 +157,210 @@ func CreateCategory(c *fiber.Ctx) error {
 
 // CreateBudget handles POST /api/budgets
 func CreateBudget(c *fiber.Ctx) error {
-	userID, err := GetSession(c)
+	user, repos, err := scopedUser(c)
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
 	}
 
-	db := GetDB()
-	usersCollection := db.Database("ct").Collection("users")
-
-	var user models.User
-	objectID, _ := primitive.ObjectIDFromHex(userID)
-	err = usersCollection.FindOne(c.Context(), bson.M{"_id": objectID}).Decode(&user)
-	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User not found"})
-	}
-
 	// Parse form data
 	name := c.FormValue("name")
-	categoryID := c.FormValue("category_id")
 	amountStr := c.FormValue("amount")
 	period := c.FormValue("period")
 
-	if name == "" || categoryID == "" || amountStr == "" || period == "" {
+	if name == "" || amountStr == "" || period == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "All fields are required"})
 	}
 
-	catObjID, err := primitive.ObjectIDFromHex(categoryID)
+	// Budgets are kept in the company's base currency
+	currency := CompanyCurrency(c, repos)
+	amount, err := parseAmount(amountStr, currency)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid category ID"})
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid amount"})
 	}
 
-	var amount float64
-	_, err = parseFloat(amountStr, &amount)
-	if err != nil || amount <= 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid amount"})
+	scope, msg := parseBudgetScope(c, repos, currency)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": strings.ReplaceAll(msg, "+", " ")})
+	}
+
+	// A recurring budget opens a new period each time one ends, taking over
+	// what carry_over asks for
+	recurring := c.FormValue("recurring") == "on" || c.FormValue("recurring") == "true"
+	carryOver := c.FormValue("carry_over")
+	if !models.IsValidBudgetCarryOver(carryOver) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid carry-over"})
+	}
+	if !recurring {
+		carryOver = ""
 	}
 
-	// Get period dates
+	thresholds, msg := parseBudgetThresholds(c, repos)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": strings.ReplaceAll(msg, "+", " ")})
+	}
+
+	// Periods follow the calendar of the company's timezone
+	loc := CompanyLocation(c, repos)
 	now := time.Now()
-	startDate, endDate := models.GetBudgetPeriodDates(models.BudgetPeriod(period), now)
+	startDate, endDate := models.GetBudgetPeriodDates(models.BudgetPeriod(period), now.In(loc))
 
 	// Create budget
 	budget := models.Budget{
-		ID:         primitive.NewObjectID(),
-		Name:       name,
-		CategoryID: catObjID,
-		Amount:     amount,
-		Spent:      0,
-		Currency:   "USD",
-		Period:     models.BudgetPeriod(period),
-		StartDate:  startDate,
-		EndDate:    endDate,
-		CompanyID:  user.CompanyID,
-		IsActive:   true,
-		CreatedAt:  now,
-		UpdatedAt:  now,
-	}
-
-	budgetsCollection := db.Database("ct").Collection("budgets")
-	_, err = budgetsCollection.InsertOne(c.Context(), budget)
+		ID:        primitive.NewObjectID(),
+		Name:      name,
+		Amount:    amount,
+		Spent:     0,
+		Currency:  currency,
+		Period:    models.BudgetPeriod(period),
+		StartDate: startDate,
+		EndDate:   endDate,
+		Timezone:  loc.String(),
+		CompanyID: user.CompanyID,
+		IsActive:  true,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Recurring: recurring,
+		CarryOver: models.BudgetCarryOver(carryOver),
+
+		BudgetScope:      scope,
+		BudgetThresholds: thresholds,
+	}
+	budget.SeriesID = budget.ID
+
+	// Expenses already posted earlier in the period count from the start
+	budget.Spent, err = budgeting.Spent(c.Context(), repos, &budget)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create budget"})
+	}
+
+	err = repos.Budgets.Create(c.Context(), &budget)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create budget"})
 	}
 
 	// Audit log
-	logAudit(c, models.AuditActionCreate, models.AuditEntityBudget, budget.ID, &user, map[string]interface{}{
-		"name":        name,
-		"category_id": categoryID,
-		"amount":      amount,
-		"period":      period,
-	})
+	changes := map[string]interface{}{
+		"name":       name,
+		"categories": len(scope.CategoryIDs),
+		"department": scope.Department,
+		"employee":   scope.EmployeeName,
+		"amount":     amount.Format(currency),
+		"period":     period,
+		"recurring":  recurring,
+		"carry_over": carryOver,
+		"warn_at":    thresholds.WarnPercent,
+		"over_limit": string(thresholds.Enforcement),
+		"owner":      thresholds.OwnerName,
+	}
+	if !scope.AccountID.IsZero() {
+		changes["account_id"] = scope.AccountID.Hex()
+	}
+	logAudit(c, models.AuditActionCreate, models.AuditEntityBudget, budget.ID, user, changes)
 
 	// Redirect back to budgets page with success toast
 	return c.Redirect("/budgets?success=Budget+created")
 }
 
-// CreateTransaction handles POST /api/transactions
-func CreateTransaction(c *fiber.Ctx) error {
-	userID, err := GetSession(c)
-	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+// parseBudgetScope reads which expenses a new budget in currency tracks from
+// the budget form: any of category_ids, paid from account_id, charged to
+// department and submitted by employee_id, each left out to not narrow it. A
+// single category_id is taken as well. It returns a plus-encoded message
+// instead when one does not check out.
+func parseBudgetScope(c *fiber.Ctx, repos *repository.Repositories, currency string) (models.BudgetScope, string) {
+	var scope models.BudgetScope
+	values := c.Request().PostArgs().PeekMulti("category_ids")
+	if single := c.FormValue("category_id"); single != "" {
+		values = append(values, []byte(single))
+	}
+	for _, value := range values {
+		id, err := primitive.ObjectIDFromHex(string(value))
+		if err != nil {
+			return scope, "Invalid+category+ID"
+		}
+		if slices.Contains(scope.CategoryIDs, id) {
+			continue
+		}
+		if _, err := repos.Categories.Get(c.Context(), id); err != nil {
+			return scope, "Category+not+found"
+		}
+		scope.CategoryIDs = append(scope.CategoryIDs, id)
+	}
+
+	if hex := c.FormValue("account_id"); hex != "" {
+		id, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			return scope, "Invalid+account+ID"
+		}
+		account, err := repos.Accounts.Get(c.Context(), id)
+		if err != nil {
+			return scope, "Account+not+found"
+		}
+		// Expenses are in their account's currency, so no other would ever count
+		if account.Currency != currency {
+			return scope, "The+account+must+use+the+budget's+currency"
+		}
+		scope.AccountID = account.ID
+	}
+
+	scope.Department = strings.TrimSpace(c.FormValue("department"))
+	if len(scope.Department) > maxDepartmentLength {
+		return scope, "Department+name+is+too+long"
+	}
+
+	if hex := c.FormValue("employee_id"); hex != "" {
+		id, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			return scope, "Invalid+employee"
+		}
+		employee, err := repos.Users.Get(c.Context(), id)
+		if err != nil {
+			return scope, "Employee+not+found"
+		}
+		scope.EmployeeID = employee.ID
+		scope.EmployeeName = employee.Name
+	}
+	return scope, ""
+}
+
+// parseBudgetThresholds reads when a budget warns its owner, what it does with
+// expenses over its limit and who owns it from the budget form. It returns a
+// URL-encoded message for the first invalid field.
+func parseBudgetThresholds(c *fiber.Ctx, repos *repository.Repositories) (models.BudgetThresholds, string) {
+	var thresholds models.BudgetThresholds
+	if warn := c.FormValue("warn_percent"); warn != "" {
+		percent, err := strconv.Atoi(warn)
+		if err != nil || percent < 0 || percent > 100 {
+			return thresholds, "Warning+threshold+must+be+a+percentage+from+0+to+100"
+		}
+		thresholds.WarnPercent = percent
 	}
 
-	db := GetDB()
-	usersCollection := db.Database("ct").Collection("users")
+	enforcement := c.FormValue("enforcement")
+	if !models.IsValidBudgetEnforcement(enforcement) {
+		return thresholds, "Invalid+over-limit+option"
+	}
+	thresholds.Enforcement = models.BudgetEnforcement(enforcement)
 
-	var user models.User
-	objectID, _ := primitive.ObjectIDFromHex(userID)
-	err = usersCollection.FindOne(c.Context(), bson.M{"_id": objectID}).Decode(&user)
+	if hex := c.FormValue("owner_id"); hex != "" {
+		id, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			return thresholds, "Invalid+owner"
+		}
+		owner, err := repos.Users.Get(c.Context(), id)
+		if err != nil {
+			return thresholds, "Owner+not+found"
+		}
+		thresholds.OwnerID = owner.ID
+		thresholds.OwnerName = owner.Name
+	}
+	return thresholds, ""
+}
+
+// CreateTransaction handles POST /api/transactions
+func CreateTransaction(c *fiber.Ctx) error {
+	user, repos, err := scopedUser(c)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User not found"})
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
 	}
 
 	// Parse form data
@@ -251,11 +374,14 @@ func CreateTransaction(c *fiber.Ctx) error {
 	if txnType == "" || amountStr == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Type and amount are required"})
 	}
+	if !models.IsValidTransactionType(txnType) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid transaction type"})
+	}
 
-	var amount float64
-	_, err = parseFloat(amountStr, &amount)
-	if err != nil || amount <= 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid amount"})
+	// Drafts stay with their creator until submitted
+	status := models.TransactionStatusPending
+	if c.FormValue("draft") == "true" {
+		status = models.TransactionStatusDraft
 	}
 
 	// Create transaction
@@ -263,12 +389,12 @@ func CreateTransaction(c *fiber.Ctx) error {
 	txn := models.Transaction{
 		ID:              primitive.NewObjectID(),
 		Type:            models.TransactionType(txnType),
-		Amount:          amount,
-		Currency:        "USD",
 		Description:     description,
-		Status:          models.TransactionStatusPending,
+		Status:          status,
 		CreatedByID:     user.ID,
 		CreatedByName:   user.Name,
+		EmployeeID:      user.ID,
+		Department:      user.Department,
 		CompanyID:       user.CompanyID,
 		TransactionDate: now,
 		CreatedAt:       now,
@@ -277,179 +403,181 @@ func CreateTransaction(c *fiber.Ctx) error {
 
 	// Set account IDs based on type
 	if fromAccountID != "" {
-		fromID, _ := primitive.ObjectIDFromHex(fromAccountID)
-		txn.FromAccountID = fromID
+		if txn.FromAccountID, err = primitive.ObjectIDFromHex(fromAccountID); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid account"})
+		}
 	}
 	if toAccountID != "" {
-		toID, _ := primitive.ObjectIDFromHex(toAccountID)
-		txn.ToAccountID = toID
+		if txn.ToAccountID, err = primitive.ObjectIDFromHex(toAccountID); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid account"})
+		}
 	}
-	if categoryID != "" {
-		catID, _ := primitive.ObjectIDFromHex(categoryID)
-		txn.CategoryID = catID
+	// Transfers have no category
+	if categoryID != "" && txn.Type != models.TransactionTypeTransfer {
+		if txn.CategoryID, err = primitive.ObjectIDFromHex(categoryID); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid category"})
+		}
+	}
+
+	// Referenced accounts and category must belong to the same company.
+	// The amount is in the accounts' currency, so a transfer cannot mix currencies.
+	for _, accountID := range []primitive.ObjectID{txn.FromAccountID, txn.ToAccountID} {
+		if accountID.IsZero() {
+			continue
+		}
+		account, err := repos.Accounts.Get(c.Context(), accountID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Account not found"})
+		}
+		if txn.Currency != "" && txn.Currency != account.Currency {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Accounts must use the same currency"})
+		}
+		txn.Currency = account.Currency
+	}
+	if txn.Currency == "" {
+		txn.Currency = CompanyCurrency(c, repos)
+	}
+	if !txn.CategoryID.IsZero() && !isTransactionCategory(c, repos, txn.CategoryID, txn.Type) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Category not found"})
+	}
+
+	txn.Amount, err = parseAmount(amountStr, txn.Currency)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid amount"})
+	}
+
+	// A budget may refuse the expense outright or ask for an extra sign-off
+	if status == models.TransactionStatusPending {
+		impacts, err := budgeting.Assess(c.Context(), repos, &txn)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check budgets"})
+		}
+		if txn.BudgetOverride, err = budgeting.Enforce(impacts); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "This would take a budget over its limit"})
+		}
 	}
 
-	transactionsCollection := db.Database("ct").Collection("transactions")
-	_, err = transactionsCollection.InsertOne(c.Context(), txn)
+	err = repos.Transactions.Create(c.Context(), &txn)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create transaction"})
 	}
 
 	// Audit log
-	logAudit(c, models.AuditActionCreate, models.AuditEntityTransaction, txn.ID, &user, map[string]interface{}{
+	logAudit(c, models.AuditActionCreate, models.AuditEntityTransaction, txn.ID, user, map[string]interface{}{
 		"type":        txnType,
-		"amount":      amount,
+		"amount":      txn.Amount.Format(txn.Currency),
 		"description": description,
 	})
 
 	// Redirect back to transactions page with success toast
+	if status == models.TransactionStatusDraft {
+		return c.Redirect("/transactions?success=Draft+saved")
+	}
 	return c.Redirect("/transactions?success=Transaction+created")
 }
 
-// Helper function to parse float
-func parseFloat(s string, f *float64) (bool, error) {
-	v, err := strconv.ParseFloat(s, 64)
+// parseAmount parses a positive amount with no more decimals than the currency allows
+func parseAmount(s, currency string) (models.Money, error) {
+	amount, err := models.ParseMoney(s, currency)
 	if err != nil {
-		return false, err
+		return 0, err
 	}
-	*f = v
-	return true, nil
-}
-
-// ApproveTransaction handles POST /api/transactions/:id/approve
-func ApproveTransaction(c *fiber.Ctx) error {
-	userID, err := GetSession(c)
-	if err != nil {
-		return c.Redirect("/signin")
+	if amount <= 0 {
+		return 0, models.ErrInvalidAmount
 	}
+	return amount, nil
+}
 
-	db := GetDB()
-	usersCollection := db.Database("ct").Collection("users")
-
-	var user models.User
-	objectID, _ := primitive.ObjectIDFromHex(userID)
-	err = usersCollection.FindOne(c.Context(), bson.M{"_id": objectID}).Decode(&user)
-	if err != nil {
-		return c.Redirect("/approvals?error=User+not+found")
-	}
+// isTransactionCategory checks that the category exists and is of the transaction's type
+func isTransactionCategory(c *fiber.Ctx, repos *repository.Repositories, id primitive.ObjectID, txnType models.TransactionType) bool {
+	category, err := repos.Categories.Get(c.Context(), id)
+	return err == nil && string(category.Type) == string(txnType)
+}
 
-	txnID, err := primitive.ObjectIDFromHex(c.Params("id"))
-	if err != nil {
-		return c.Redirect("/approvals?error=Invalid+transaction+ID")
+// CompanyCurrency returns the company's base currency, defaulting to USD
+func CompanyCurrency(c *fiber.Ctx, repos *repository.Repositories) string {
+	company, err := repos.Company.Get(c.Context())
+	if err != nil || company.Currency == "" {
+		return "USD"
 	}
+	return company.Currency
+}
 
-	// Get transaction
-	var txn models.Transaction
-	txnCollection := db.Database("ct").Collection("transactions")
-	err = txnCollection.FindOne(c.Context(), bson.M{"_id": txnID}).Decode(&txn)
+// CompanyLocation returns the company's timezone, whose calendar budgets and reports follow
+func CompanyLocation(c *fiber.Ctx, repos *repository.Repositories) *time.Location {
+	company, err := repos.Company.Get(c.Context())
 	if err != nil {
-		return c.Redirect("/approvals?error=Transaction+not+found")
+		return time.UTC
 	}
+	return company.Location()
+}
 
-	// Update status
-	now := time.Now()
-	_, err = txnCollection.UpdateOne(c.Context(), bson.M{"_id": txnID}, bson.M{
-		"$set": bson.M{
-			"status":      models.TransactionStatusApproved,
-			"approved_by": user.ID,
-			"approved_at": now,
-			"updated_at":  now,
-		},
-	})
+// ApproveTransaction handles POST /api/transactions/:id/approve
+func ApproveTransaction(c *fiber.Ctx) error {
+	user, repos, err := scopedUser(c)
 	if err != nil {
-		return c.Redirect("/approvals?error=Failed+to+approve")
+		return c.Redirect("/signin")
 	}
 
-	// Update account balances
-	updateAccountBalance(c, &txn)
-
-	// Update budget spent if this is an expense with a category
-	if txn.Type == models.TransactionTypeExpense && !txn.CategoryID.IsZero() {
-		updateBudgetSpent(c, txn.CategoryID, txn.Amount)
+	// The status change and the money it moves commit together, and only the
+	// first of two racing approvers gets through. The company's approval policy
+	// is checked here too, whatever the approvals page showed.
+	comment := c.FormValue("comment")
+	txn, msg := transitionTransaction(c, repos, user, lifecycle.EventApprove, lifecycle.Input{Comment: comment})
+	if msg != "" {
+		return c.Redirect("/approvals?error=" + msg)
 	}
 
-	// Audit log
-	logAudit(c, models.AuditActionApprove, models.AuditEntityTransaction, txnID, &user, map[string]interface{}{
-		"amount": txn.Amount,
-		"type":   string(txn.Type),
+	auditDecision(c, user, txn, models.AuditActionApprove, map[string]interface{}{
+		"comment": comment,
 	})
 
+	// Earlier steps of an approval chain leave the transaction pending
+	if txn.IsPending() {
+		return c.Redirect("/approvals?success=Step+signed+off")
+	}
+	alertBudgetOwners(c, repos, txn)
 	return c.Redirect("/approvals?success=Transaction+approved")
 }
 
 // RejectTransaction handles POST /api/transactions/:id/reject
 func RejectTransaction(c *fiber.Ctx) error {
-	userID, err := GetSession(c)
+	user, repos, err := scopedUser(c)
 	if err != nil {
 		return c.Redirect("/signin")
 	}
 
-	db := GetDB()
-	usersCollection := db.Database("ct").Collection("users")
-
-	var user models.User
-	objectID, _ := primitive.ObjectIDFromHex(userID)
-	err = usersCollection.FindOne(c.Context(), bson.M{"_id": objectID}).Decode(&user)
-	if err != nil {
-		return c.Redirect("/approvals?error=User+not+found")
-	}
-
-	txnID, err := primitive.ObjectIDFromHex(c.Params("id"))
-	if err != nil {
-		return c.Redirect("/approvals?error=Invalid+transaction+ID")
-	}
-
 	reason := c.FormValue("reason")
 
-	// Get transaction
-	var txn models.Transaction
-	txnCollection := db.Database("ct").Collection("transactions")
-	err = txnCollection.FindOne(c.Context(), bson.M{"_id": txnID}).Decode(&txn)
-	if err != nil {
-		return c.Redirect("/approvals?error=Transaction+not+found")
+	txn, msg := transitionTransaction(c, repos, user, lifecycle.EventReject, lifecycle.Input{Reason: reason})
+	if msg != "" {
+		return c.Redirect("/approvals?error=" + msg)
 	}
 
-	// Update status
-	now := time.Now()
-	_, err = txnCollection.UpdateOne(c.Context(), bson.M{"_id": txnID}, bson.M{
-		"$set": bson.M{
-			"status":           models.TransactionStatusRejected,
-			"rejection_reason": reason,
-			"approved_by":      user.ID,
-			"approved_at":      now,
-			"updated_at":       now,
-		},
-	})
-	if err != nil {
-		return c.Redirect("/approvals?error=Failed+to+reject")
-	}
-
-	// Audit log
-	logAudit(c, models.AuditActionReject, models.AuditEntityTransaction, txnID, &user, map[string]interface{}{
-		"amount": txn.Amount,
+	auditDecision(c, user, txn, models.AuditActionReject, map[string]interface{}{
 		"reason": reason,
 	})
 
 	return c.Redirect("/approvals?success=Transaction+rejected")
 }
 
+// auditDecision logs an approval decision on txn, as just changed, with its
+// amount and step, noting whose delegated authority was used if any
+func auditDecision(c *fiber.Ctx, user *models.User, txn *models.Transaction, action models.AuditAction, changes map[string]interface{}) {
+	record := txn.ApprovalHistory[len(txn.ApprovalHistory)-1]
+	changes["amount"] = txn.Amount.Format(txn.Currency)
+	changes["type"] = string(txn.Type)
+	changes["step"] = record.StepName
+	logAuditOnBehalfOf(c, action, models.AuditEntityTransaction, txn.ID, user, record.OnBehalfOfID, record.OnBehalfOfName, changes)
+}
+
 // UpdateUserRole handles POST /api/users/:id/role
 func UpdateUserRole(c *fiber.Ctx) error {
-	userID, err := GetSession(c)
+	currentUser, repos, err := scopedUser(c)
 	if err != nil {
 		return c.Redirect("/signin")
 	}
 
-	db := GetDB()
-	usersCollection := db.Database("ct").Collection("users")
-
-	var currentUser models.User
-	objectID, _ := primitive.ObjectIDFromHex(userID)
-	err = usersCollection.FindOne(c.Context(), bson.M{"_id": objectID}).Decode(&currentUser)
-	if err != nil {
-		return c.Redirect("/team?error=User+not+found")
-	}
-
 	// Only super_admin can change roles
 	if currentUser.Role != "super_admin" {
 		return c.Redirect("/team?error=Permission+denied")
@@ -465,40 +593,66 @@ func UpdateUserRole(c *fiber.Ctx) error {
 		return c.Redirect("/team?error=Role+is+required")
 	}
 
-	// Update role
-	_, err = usersCollection.UpdateOne(c.Context(), bson.M{"_id": targetUserID}, bson.M{
-		"$set": bson.M{
-			"role":       newRole,
-			"updated_at": time.Now(),
-		},
-	})
+	// Update role; members of other companies are not found
+	err = repos.Users.UpdateRole(c.Context(), targetUserID, newRole)
+	if err == repository.ErrNotFound {
+		return c.Redirect("/team?error=User+not+found")
+	}
 	if err != nil {
 		return c.Redirect("/team?error=Failed+to+update+role")
 	}
 
 	// Audit log
-	logAudit(c, models.AuditActionUpdate, models.AuditEntityUser, targetUserID, &currentUser, map[string]interface{}{
+	logAudit(c, models.AuditActionUpdate, models.AuditEntityUser, targetUserID, currentUser, map[string]interface{}{
 		"new_role": newRole,
 	})
 
 	return c.Redirect("/team?success=Role+updated")
 }
 
-// UpdateAccount handles PUT /api/accounts/:id
-func UpdateAccount(c *fiber.Ctx) error {
-	userID, err := GetSession(c)
+// maxDepartmentLength caps the name of a department or cost center
+const maxDepartmentLength = 100
+
+// UpdateUserDepartment handles POST /api/users/:id/department. Expenses a
+// member submits from then on are charged to the new department; earlier
+// ones stay with the department they were charged to.
+func UpdateUserDepartment(c *fiber.Ctx) error {
+	currentUser, repos, err := scopedUser(c)
 	if err != nil {
 		return c.Redirect("/signin")
 	}
 
-	db := GetDB()
-	usersCollection := db.Database("ct").Collection("users")
+	targetUserID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Redirect("/team?error=Invalid+user+ID")
+	}
+
+	department := strings.TrimSpace(c.FormValue("department"))
+	if len(department) > maxDepartmentLength {
+		return c.Redirect("/team?error=Department+name+is+too+long")
+	}
 
-	var user models.User
-	objectID, _ := primitive.ObjectIDFromHex(userID)
-	err = usersCollection.FindOne(c.Context(), bson.M{"_id": objectID}).Decode(&user)
+	// Members of other companies are not found
+	err = repos.Users.UpdateDepartment(c.Context(), targetUserID, department)
+	if err == repository.ErrNotFound {
+		return c.Redirect("/team?error=User+not+found")
+	}
 	if err != nil {
-		return c.Redirect("/accounts?error=User+not+found")
+		return c.Redirect("/team?error=Failed+to+update+department")
+	}
+
+	logAudit(c, models.AuditActionUpdate, models.AuditEntityUser, targetUserID, currentUser, map[string]interface{}{
+		"department": department,
+	})
+
+	return c.Redirect("/team?success=Department+updated")
+}
+
+// UpdateAccount handles PUT /api/accounts/:id
+func UpdateAccount(c *fiber.Ctx) error {
+	user, repos, err := scopedUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
 	}
 
 	accountID, err := primitive.ObjectIDFromHex(c.Params("id"))
@@ -510,20 +664,21 @@ func UpdateAccount(c *fiber.Ctx) error {
 	accountType := c.FormValue("type")
 	currency := c.FormValue("currency")
 
-	accountsCollection := db.Database("ct").Collection("accounts")
-	_, err = accountsCollection.UpdateOne(c.Context(), bson.M{"_id": accountID, "company_id": user.CompanyID}, bson.M{
-		"$set": bson.M{
-			"name":       name,
-			"type":       accountType,
-			"currency":   currency,
-			"updated_at": time.Now(),
-		},
-	})
+	// The balance is held in minor units of the current currency, so it cannot be relabelled
+	account, err := repos.Accounts.Get(c.Context(), accountID)
+	if err != nil {
+		return c.Redirect("/accounts?error=Account+not+found")
+	}
+	if currency != account.Currency && account.Balance != 0 {
+		return c.Redirect("/accounts?error=Currency+can+only+change+while+the+balance+is+zero")
+	}
+
+	err = repos.Accounts.Update(c.Context(), accountID, name, accountType, currency)
 	if err != nil {
 		return c.Redirect("/accounts?error=Failed+to+update+account")
 	}
 
-	logAudit(c, models.AuditActionUpdate, models.AuditEntityAccount, accountID, &user, map[string]interface{}{
+	logAudit(c, models.AuditActionUpdate, models.AuditEntityAccount, accountID, user, map[string]interface{}{
 		"name": name,
 	})
 
@@ -532,59 +687,33 @@ func UpdateAccount(c *fiber.Ctx) error {
 
 // DeleteAccount handles DELETE /api/accounts/:id
 func DeleteAccount(c *fiber.Ctx) error {
-	userID, err := GetSession(c)
+	user, repos, err := scopedUser(c)
 	if err != nil {
 		return c.Redirect("/signin")
 	}
 
-	db := GetDB()
-	usersCollection := db.Database("ct").Collection("users")
-
-	var user models.User
-	objectID, _ := primitive.ObjectIDFromHex(userID)
-	err = usersCollection.FindOne(c.Context(), bson.M{"_id": objectID}).Decode(&user)
-	if err != nil {
-		return c.Redirect("/accounts?error=User+not+found")
-	}
-
 	accountID, err := primitive.ObjectIDFromHex(c.Params("id"))
 	if err != nil {
 		return c.Redirect("/accounts?error=Invalid+account+ID")
 	}
 
-	accountsCollection := db.Database("ct").Collection("accounts")
-	_, err = accountsCollection.UpdateOne(c.Context(), bson.M{"_id": accountID, "company_id": user.CompanyID}, bson.M{
-		"$set": bson.M{
-			"is_active":  false,
-			"updated_at": time.Now(),
-		},
-	})
+	err = repos.Accounts.Deactivate(c.Context(), accountID)
 	if err != nil {
 		return c.Redirect("/accounts?error=Failed+to+delete+account")
 	}
 
-	logAudit(c, models.AuditActionDelete, models.AuditEntityAccount, accountID, &user, nil)
+	logAudit(c, models.AuditActionDelete, models.AuditEntityAccount, accountID, user, nil)
 
 	return c.Redirect("/accounts?success=Account+deleted")
 }
 
 // UpdateCategory handles PUT /api/categories/:id
 func UpdateCategory(c *fiber.Ctx) error {
-	userID, err := GetSession(c)
+	user, repos, err := scopedUser(c)
 	if err != nil {
 		return c.Redirect("/signin")
 	}
 
-	db := GetDB()
-	usersCollection := db.Database("ct").Collection("users")
-
-	var user models.User
-	objectID, _ := primitive.ObjectIDFromHex(userID)
-	err = usersCollection.FindOne(c.Context(), bson.M{"_id": objectID}).Decode(&user)
-	if err != nil {
-		return c.Redirect("/categories?error=User+not+found")
-	}
-
 	categoryID, err := primitive.ObjectIDFromHex(c.Params("id"))
 	if err != nil {
 		return c.Redirect("/categories?error=Invalid+category+ID")
@@ -594,20 +723,12 @@ func UpdateCategory(c *fiber.Ctx) error {
 	catType := c.FormValue("type")
 	color := c.FormValue("color")
 
-	categoriesCollection := db.Database("ct").Collection("categories")
-	_, err = categoriesCollection.UpdateOne(c.Context(), bson.M{"_id": categoryID, "company_id": user.CompanyID}, bson.M{
-		"$set": bson.M{
-			"name":       name,
-			"type":       catType,
-			"color":      color,
-			"updated_at": time.Now(),
-		},
-	})
+	err = repos.Categories.Update(c.Context(), categoryID, name, catType, color)
 	if err != nil {
 		return c.Redirect("/categories?error=Failed+to+update+category")
 	}
 
-	logAudit(c, models.AuditActionUpdate, models.AuditEntityCategory, categoryID, &user, map[string]interface{}{
+	logAudit(c, models.AuditActionUpdate, models.AuditEntityCategory, categoryID, user, map[string]interface{}{
 		"name": name,
 	})
 
@@ -616,83 +737,68 @@ func UpdateCategory(c *fiber.Ctx) error {
 
 // DeleteCategory handles DELETE /api/categories/:id
 func DeleteCategory(c *fiber.Ctx) error {
-	userID, err := GetSession(c)
+	user, repos, err := scopedUser(c)
 	if err != nil {
 		return c.Redirect("/signin")
 	}
 
-	db := GetDB()
-	usersCollection := db.Database("ct").Collection("users")
-
-	var user models.User
-	objectID, _ := primitive.ObjectIDFromHex(userID)
-	err = usersCollection.FindOne(c.Context(), bson.M{"_id": objectID}).Decode(&user)
-	if err != nil {
-		return c.Redirect("/categories?error=User+not+found")
-	}
-
 	categoryID, err := primitive.ObjectIDFromHex(c.Params("id"))
 	if err != nil {
 		return c.Redirect("/categories?error=Invalid+category+ID")
 	}
 
-	categoriesCollection := db.Database("ct").Collection("categories")
-	_, err = categoriesCollection.UpdateOne(c.Context(), bson.M{"_id": categoryID, "company_id": user.CompanyID}, bson.M{
-		"$set": bson.M{
-			"is_active":  false,
-			"updated_at": time.Now(),
-		},
-	})
+	err = repos.Categories.Deactivate(c.Context(), categoryID)
 	if err != nil {
 		return c.Redirect("/categories?error=Failed+to+delete+category")
 	}
 
-	logAudit(c, models.AuditActionDelete, models.AuditEntityCategory, categoryID, &user, nil)
+	logAudit(c, models.AuditActionDelete, models.AuditEntityCategory, categoryID, user, nil)
 
 	return c.Redirect("/categories?success=Category+deleted")
 }
 
 // UpdateBudget handles PUT /api/budgets/:id
 func UpdateBudget(c *fiber.Ctx) error {
-	userID, err := GetSession(c)
+	user, repos, err := scopedUser(c)
 	if err != nil {
 		return c.Redirect("/signin")
 	}
 
-	db := GetDB()
-	usersCollection := db.Database("ct").Collection("users")
-
-	var user models.User
-	objectID, _ := primitive.ObjectIDFromHex(userID)
-	err = usersCollection.FindOne(c.Context(), bson.M{"_id": objectID}).Decode(&user)
+	budgetID, err := primitive.ObjectIDFromHex(c.Params("id"))
 	if err != nil {
-		return c.Redirect("/budgets?error=User+not+found")
+		return c.Redirect("/budgets?error=Invalid+budget+ID")
 	}
 
-	budgetID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	budget, err := repos.Budgets.Get(c.Context(), budgetID)
 	if err != nil {
-		return c.Redirect("/budgets?error=Invalid+budget+ID")
+		return c.Redirect("/budgets?error=Budget+not+found")
 	}
 
 	name := c.FormValue("name")
-	var amount float64
-	parseFloat(c.FormValue("amount"), &amount)
-
-	budgetsCollection := db.Database("ct").Collection("budgets")
-	_, err = budgetsCollection.UpdateOne(c.Context(), bson.M{"_id": budgetID, "company_id": user.CompanyID}, bson.M{
-		"$set": bson.M{
-			"name":       name,
-			"amount":     amount,
-			"updated_at": time.Now(),
-		},
-	})
+	amount, err := parseAmount(c.FormValue("amount"), budget.Currency)
+	if err != nil {
+		return c.Redirect("/budgets?error=Invalid+amount")
+	}
+
+	thresholds, msg := parseBudgetThresholds(c, repos)
+	if msg != "" {
+		return c.Redirect("/budgets?error=" + msg)
+	}
+
+	err = repos.Budgets.Update(c.Context(), budgetID, name, amount)
+	if err == nil {
+		err = repos.Budgets.SetThresholds(c.Context(), budgetID, thresholds)
+	}
 	if err != nil {
 		return c.Redirect("/budgets?error=Failed+to+update+budget")
 	}
 
-	logAudit(c, models.AuditActionUpdate, models.AuditEntityBudget, budgetID, &user, map[string]interface{}{
-		"name":   name,
-		"amount": amount,
+	logAudit(c, models.AuditActionUpdate, models.AuditEntityBudget, budgetID, user, map[string]interface{}{
+		"name":       name,
+		"amount":     amount.Format(budget.Currency),
+		"warn_at":    thresholds.WarnPercent,
+		"over_limit": string(thresholds.Enforcement),
+		"owner":      thresholds.OwnerName,
 	})
 
 	return c.Redirect("/budgets?success=Budget+updated")
@@ -700,116 +806,157 @@ func UpdateBudget(c *fiber.Ctx) error {
 
 // DeleteBudget handles DELETE /api/budgets/:id
 func DeleteBudget(c *fiber.Ctx) error {
-	userID, err := GetSession(c)
+	user, repos, err := scopedUser(c)
 	if err != nil {
 		return c.Redirect("/signin")
 	}
 
-	db := GetDB()
-	usersCollection := db.Database("ct").Collection("users")
-
-	var user models.User
-	objectID, _ := primitive.ObjectIDFromHex(userID)
-	err = usersCollection.FindOne(c.Context(), bson.M{"_id": objectID}).Decode(&user)
-	if err != nil {
-		return c.Redirect("/budgets?error=User+not+found")
-	}
-
 	budgetID, err := primitive.ObjectIDFromHex(c.Params("id"))
 	if err != nil {
 		return c.Redirect("/budgets?error=Invalid+budget+ID")
 	}
 
-	budgetsCollection := db.Database("ct").Collection("budgets")
-	_, err = budgetsCollection.UpdateOne(c.Context(), bson.M{"_id": budgetID, "company_id": user.CompanyID}, bson.M{
-		"$set": bson.M{
-			"is_active":  false,
-			"updated_at": time.Now(),
-		},
-	})
+	err = repos.Budgets.Deactivate(c.Context(), budgetID)
 	if err != nil {
 		return c.Redirect("/budgets?error=Failed+to+delete+budget")
 	}
 
-	logAudit(c, models.AuditActionDelete, models.AuditEntityBudget, budgetID, &user, nil)
+	logAudit(c, models.AuditActionDelete, models.AuditEntityBudget, budgetID, user, nil)
 
 	return c.Redirect("/budgets?success=Budget+deleted")
 }
 
 // UpdateTransaction handles PUT /api/transactions/:id
 func UpdateTransaction(c *fiber.Ctx) error {
-	userID, err := GetSession(c)
+	user, repos, err := scopedUser(c)
 	if err != nil {
 		return c.Redirect("/signin")
 	}
 
-	db := GetDB()
-	usersCollection := db.Database("ct").Collection("users")
-
-	var user models.User
-	objectID, _ := primitive.ObjectIDFromHex(userID)
-	err = usersCollection.FindOne(c.Context(), bson.M{"_id": objectID}).Decode(&user)
+	txnID, err := primitive.ObjectIDFromHex(c.Params("id"))
 	if err != nil {
-		return c.Redirect("/transactions?error=User+not+found")
+		return c.Redirect("/transactions?error=Invalid+transaction+ID")
 	}
 
-	txnID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	txn, err := repos.Transactions.Get(c.Context(), txnID)
 	if err != nil {
-		return c.Redirect("/transactions?error=Invalid+transaction+ID")
+		return c.Redirect("/transactions?error=Transaction+not+found")
 	}
 
 	description := c.FormValue("description")
-	var amount float64
-	parseFloat(c.FormValue("amount"), &amount)
+	amount, err := parseAmount(c.FormValue("amount"), txn.Currency)
+	if err != nil {
+		return c.Redirect("/transactions?error=Invalid+amount")
+	}
 
-	// Parse transaction date
+	// Parse transaction date, as a day in the company's timezone like budget periods
 	var txnDate time.Time
 	if dateStr := c.FormValue("transaction_date"); dateStr != "" {
-		if parsed, err := time.Parse("2006-01-02", dateStr); err == nil {
+		if parsed, err := time.ParseInLocation("2006-01-02", dateStr, CompanyLocation(c, repos)); err == nil {
 			txnDate = parsed
 		}
 	}
 
-	updateFields := bson.M{
-		"description": description,
-		"amount":      amount,
-		"updated_at":  time.Now(),
+	// Moving an expense to another category moves it to that category's budgets
+	var categoryID primitive.ObjectID
+	if hex := c.FormValue("category_id"); hex != "" && txn.Type != models.TransactionTypeTransfer {
+		id, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			return c.Redirect("/transactions?error=Invalid+category")
+		}
+		if !isTransactionCategory(c, repos, id, txn.Type) {
+			return c.Redirect("/transactions?error=Category+not+found")
+		}
+		categoryID = id
+	}
+
+	if txn.IsPosted() {
+		return correctTransaction(c, repos, user, txn, description, amount, categoryID, txnDate)
 	}
-	if !txnDate.IsZero() {
-		updateFields["transaction_date"] = txnDate
+	if !lifecycle.CanEdit(user, txn) {
+		return c.Redirect("/transactions?error=Only+the+creator+can+edit+this+transaction")
 	}
 
-	txnCollection := db.Database("ct").Collection("transactions")
-	_, err = txnCollection.UpdateOne(c.Context(), bson.M{"_id": txnID, "company_id": user.CompanyID}, bson.M{
-		"$set": updateFields,
-	})
+	err = repos.Transactions.Update(c.Context(), txnID, description, amount, categoryID, txnDate)
+	if errors.Is(err, repository.ErrPosted) {
+		return c.Redirect("/transactions?error=Transaction+was+approved+meanwhile;+edit+it+again+to+correct+it")
+	}
 	if err != nil {
 		return c.Redirect("/transactions?error=Failed+to+update+transaction")
 	}
 
-	logAudit(c, models.AuditActionUpdate, models.AuditEntityTransaction, txnID, &user, map[string]interface{}{
+	changes := map[string]interface{}{
 		"description": description,
-		"amount":      amount,
-	})
+		"amount":      amount.Format(txn.Currency),
+	}
+	if !categoryID.IsZero() && categoryID != txn.CategoryID {
+		changes["category_id"] = categoryID.Hex()
+	}
+	logAudit(c, models.AuditActionUpdate, models.AuditEntityTransaction, txnID, user, changes)
 
 	return c.Redirect("/transactions?success=Transaction+updated")
 }
 
-// DeleteTransaction handles DELETE /api/transactions/:id
-func DeleteTransaction(c *fiber.Ctx) error {
-	userID, err := GetSession(c)
+// correctTransaction voids a posted transaction and submits the edited copy for approval
+func correctTransaction(c *fiber.Ctx, repos *repository.Repositories, user *models.User, txn *models.Transaction, description string, amount models.Money, categoryID primitive.ObjectID, txnDate time.Time) error {
+	now := time.Now()
+	if txnDate.IsZero() {
+		txnDate = txn.TransactionDate
+	}
+	if categoryID.IsZero() {
+		categoryID = txn.CategoryID
+	}
+	replacement := &models.Transaction{
+		ID:              primitive.NewObjectID(),
+		Type:            txn.Type,
+		Amount:          amount,
+		Currency:        txn.Currency,
+		Description:     description,
+		FromAccountID:   txn.FromAccountID,
+		ToAccountID:     txn.ToAccountID,
+		CategoryID:      categoryID,
+		Status:          models.TransactionStatusPending,
+		CreatedByID:     user.ID,
+		CreatedByName:   user.Name,
+		TransactionDate: txnDate,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		ReplacesID:      txn.ID,
+		EmployeeID:      txn.Employee(),
+		Department:      txn.Department,
+	}
+
+	// The correction is submitted in the original's place, so only the difference
+	// counts against the budgets
+	impacts, err := budgeting.Assess(c.Context(), repos, replacement)
 	if err != nil {
-		return c.Redirect("/signin")
+		logger.Error("Finance", "Failed to check budgets for correction of "+txn.ID.Hex()+": "+err.Error())
+		return c.Redirect("/transactions?error=Failed+to+check+budgets")
+	}
+	if replacement.BudgetOverride, err = budgeting.Enforce(impacts); err != nil {
+		return c.Redirect("/transactions?error=" + transitionFailed(txn, lifecycle.EventVoid, err))
+	}
+
+	voided, err := lifecycle.Fire(c.Context(), repos, user, txn, lifecycle.EventVoid, lifecycle.Input{Replacement: replacement})
+	if msg := transitionFailed(txn, lifecycle.EventVoid, err); msg != "" {
+		return c.Redirect("/transactions?error=" + msg)
 	}
 
-	db := GetDB()
-	usersCollection := db.Database("ct").Collection("users")
+	logAudit(c, models.AuditActionReverse, models.AuditEntityTransaction, txn.ID, user, map[string]interface{}{
+		"amount":         txn.Amount.Format(txn.Currency),
+		"reversal_id":    voided.ReversedByID.Hex(),
+		"replacement_id": replacement.ID.Hex(),
+		"new_amount":     amount.Format(txn.Currency),
+	})
+
+	return c.Redirect("/transactions?success=Transaction+reversed;+the+correction+is+awaiting+approval")
+}
 
-	var user models.User
-	objectID, _ := primitive.ObjectIDFromHex(userID)
-	err = usersCollection.FindOne(c.Context(), bson.M{"_id": objectID}).Decode(&user)
+// DeleteTransaction handles DELETE /api/transactions/:id
+func DeleteTransaction(c *fiber.Ctx) error {
+	user, repos, err := scopedUser(c)
 	if err != nil {
-		return c.Redirect("/transactions?error=User+not+found")
+		return c.Redirect("/signin")
 	}
 
 	txnID, err := primitive.ObjectIDFromHex(c.Params("id"))
@@ -817,62 +964,43 @@ func DeleteTransaction(c *fiber.Ctx) error {
 		return c.Redirect("/transactions?error=Invalid+transaction+ID")
 	}
 
-	txnCollection := db.Database("ct").Collection("transactions")
-	_, err = txnCollection.DeleteOne(c.Context(), bson.M{"_id": txnID, "company_id": user.CompanyID})
+	txn, err := repos.Transactions.Get(c.Context(), txnID)
+	if err != nil {
+		return c.Redirect("/transactions?error=Transaction+not+found")
+	}
+
+	// Posted transactions are voided by a reversal so the history keeps both
+	if txn.IsPosted() {
+		return voidTransaction(c, repos, user, txn)
+	}
+	if !lifecycle.CanDelete(user, txn) {
+		return c.Redirect("/transactions?error=Only+the+creator+can+delete+this+transaction")
+	}
+
+	err = repos.Transactions.Delete(c.Context(), txnID)
+	if errors.Is(err, repository.ErrPosted) {
+		return c.Redirect("/transactions?error=Transaction+was+approved+meanwhile;+delete+it+again+to+void+it")
+	}
 	if err != nil {
 		return c.Redirect("/transactions?error=Failed+to+delete+transaction")
 	}
 
-	logAudit(c, models.AuditActionDelete, models.AuditEntityTransaction, txnID, &user, nil)
+	logAudit(c, models.AuditActionDelete, models.AuditEntityTransaction, txnID, user, nil)
 
 	return c.Redirect("/transactions?success=Transaction+deleted")
 }
 
-// updateAccountBalance updates account balance based on transaction
-func updateAccountBalance(c *fiber.Ctx, txn *models.Transaction) {
-	db := GetDB()
-	accountsCollection := db.Database("ct").Collection("accounts")
-
-	switch txn.Type {
-	case models.TransactionTypeIncome:
-		// Add to destination account
-		if !txn.ToAccountID.IsZero() {
-			accountsCollection.UpdateOne(c.Context(), bson.M{"_id": txn.ToAccountID}, bson.M{
-				"$inc": bson.M{"balance": txn.Amount},
-			})
-		}
-	case models.TransactionTypeExpense:
-		// Subtract from source account
-		if !txn.FromAccountID.IsZero() {
-			accountsCollection.UpdateOne(c.Context(), bson.M{"_id": txn.FromAccountID}, bson.M{
-				"$inc": bson.M{"balance": -txn.Amount},
-			})
-		}
-	case models.TransactionTypeTransfer:
-		// Subtract from source, add to destination
-		if !txn.FromAccountID.IsZero() {
-			accountsCollection.UpdateOne(c.Context(), bson.M{"_id": txn.FromAccountID}, bson.M{
-				"$inc": bson.M{"balance": -txn.Amount},
-			})
-		}
-		if !txn.ToAccountID.IsZero() {
-			accountsCollection.UpdateOne(c.Context(), bson.M{"_id": txn.ToAccountID}, bson.M{
-				"$inc": bson.M{"balance": txn.Amount},
-			})
-		}
+// voidTransaction undoes a posted transaction with a reversal
+func voidTransaction(c *fiber.Ctx, repos *repository.Repositories, user *models.User, txn *models.Transaction) error {
+	voided, err := lifecycle.Fire(c.Context(), repos, user, txn, lifecycle.EventVoid, lifecycle.Input{})
+	if msg := transitionFailed(txn, lifecycle.EventVoid, err); msg != "" {
+		return c.Redirect("/transactions?error=" + msg)
 	}
-}
 
-// updateBudgetSpent updates the spent amount for budgets linked to this category
-func updateBudgetSpent(c *fiber.Ctx, categoryID primitive.ObjectID, amount float64) {
-	db := GetDB()
-	budgetsCollection := db.Database("ct").Collection("budgets")
-
-	// Find all active budgets for this category and increment spent
-	budgetsCollection.UpdateMany(c.Context(), bson.M{
-		"category_id": categoryID,
-		"is_active":   true,
-	}, bson.M{
-		"$inc": bson.M{"spent": amount},
+	logAudit(c, models.AuditActionVoid, models.AuditEntityTransaction, txn.ID, user, map[string]interface{}{
+		"amount":      txn.Amount.Format(txn.Currency),
+		"reversal_id": voided.ReversedByID.Hex(),
 	})
+
+	return c.Redirect("/transactions?success=Transaction+voided")
 }
@@ -0,0 +1,505 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minhtranin/ct/internal/auth"
+	"github.com/minhtranin/ct/internal/email"
+	"github.com/minhtranin/ct/internal/logger"
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// invitationResendCooldown limits how often the same invitation email can be sent
+const invitationResendCooldown = time.Minute
+
+// InvitationDetails is what the accept page needs to know about an invitation
+type InvitationDetails struct {
+	Invitation      *models.Invitation
+	CompanyName     string
+	ExistingAccount bool
+}
+
+// FindInvitation looks up an acceptable invitation by its token (for use in page handlers)
+func FindInvitation(c *fiber.Ctx, token string) (*InvitationDetails, error) {
+	if token == "" {
+		return nil, repository.ErrNotFound
+	}
+
+	invitation, err := store.Directory().InvitationByToken(c.Context(), auth.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if !invitation.CanBeAccepted(time.Now()) {
+		return nil, repository.ErrNotFound
+	}
+
+	repos, err := invitationRepos(invitation)
+	if err != nil {
+		return nil, err
+	}
+
+	details := &InvitationDetails{Invitation: invitation}
+	if company, err := repos.Company.Get(c.Context()); err == nil {
+		details.CompanyName = company.Name
+	}
+
+	_, err = store.Identities().FindByEmail(c.Context(), invitation.Email)
+	switch {
+	case err == nil:
+		details.ExistingAccount = true
+	case !errors.Is(err, repository.ErrNotFound):
+		return nil, err
+	}
+
+	return details, nil
+}
+
+// CreateInvitation handles POST /api/invitations
+func CreateInvitation(c *fiber.Ctx) error {
+	user, repos, err := scopedUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	if !auth.CanManageTeam(user.Role) {
+		return c.Redirect("/team?error=Permission+denied")
+	}
+
+	inviteEmail := strings.TrimSpace(c.FormValue("email"))
+	role := c.FormValue("role")
+	if inviteEmail == "" || !strings.Contains(inviteEmail, "@") {
+		return c.Redirect("/team?error=A+valid+email+is+required")
+	}
+	if !auth.CanAssignRole(user.Role, role) {
+		return c.Redirect("/team?error=You+cannot+invite+someone+with+that+role")
+	}
+
+	// Already a member of this company
+	if _, err := repos.Users.FindByEmail(c.Context(), inviteEmail); err == nil {
+		return c.Redirect("/team?error=This+person+is+already+a+team+member")
+	}
+
+	// One open invitation per email; resend it instead
+	_, err = repos.Invitations.FindPending(c.Context(), inviteEmail)
+	if err == nil {
+		return c.Redirect("/team?error=An+invitation+is+already+pending+for+this+email")
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		logger.Error("Invite", "Failed to look up pending invitations: "+err.Error())
+		return c.Redirect("/team?error=Failed+to+create+invitation")
+	}
+
+	token, err := auth.GenerateToken()
+	if err != nil {
+		logger.Error("Invite", "Failed to generate invitation token: "+err.Error())
+		return c.Redirect("/team?error=Failed+to+create+invitation")
+	}
+
+	invitation := models.NewInvitation(user.CompanyID, inviteEmail, role, auth.HashToken(token), user)
+	if err := repos.Invitations.Create(c.Context(), invitation); err != nil {
+		logger.Error("Invite", "Failed to create invitation: "+err.Error())
+		return c.Redirect("/team?error=Failed+to+create+invitation")
+	}
+
+	sendInvitation(c, invitation, token, user)
+
+	logAudit(c, models.AuditActionInvite, models.AuditEntityInvitation, invitation.ID, user, map[string]interface{}{
+		"email": inviteEmail,
+		"role":  role,
+	})
+
+	logger.Info("Invite", user.Email+" invited "+inviteEmail+" as "+role)
+
+	return c.Redirect("/team?success=Invitation+sent")
+}
+
+// findCompanyInvitation loads an invitation belonging to the user's company
+func findCompanyInvitation(c *fiber.Ctx, repos *repository.Repositories) (*models.Invitation, error) {
+	invitationID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return nil, err
+	}
+	return repos.Invitations.Get(c.Context(), invitationID)
+}
+
+// invitationRepos returns the repositories of the company that sent the invitation
+func invitationRepos(invitation *models.Invitation) (*repository.Repositories, error) {
+	scope, err := repository.ForCompany(invitation.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+	return store.Scoped(scope), nil
+}
+
+// ResendInvitation handles POST /api/invitations/:id/resend
+func ResendInvitation(c *fiber.Ctx) error {
+	user, repos, err := scopedUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	if !auth.CanManageTeam(user.Role) {
+		return c.Redirect("/team?error=Permission+denied")
+	}
+
+	invitation, err := findCompanyInvitation(c, repos)
+	if err != nil {
+		return c.Redirect("/team?error=Invitation+not+found")
+	}
+	if invitation.Status != models.InvitationStatusPending {
+		return c.Redirect("/team?error=Invitation+is+no+longer+pending")
+	}
+	if time.Since(invitation.LastSentAt) < invitationResendCooldown {
+		return c.Redirect("/team?error=Please+wait+a+minute+before+resending")
+	}
+
+	// A fresh token invalidates the previous link and restarts the expiry
+	token, err := auth.GenerateToken()
+	if err != nil {
+		logger.Error("Invite", "Failed to generate invitation token: "+err.Error())
+		return c.Redirect("/team?error=Failed+to+resend+invitation")
+	}
+
+	now := time.Now()
+	invitation.TokenHash = auth.HashToken(token)
+	invitation.LastSentAt = now
+	invitation.ExpiresAt = now.Add(models.InvitationTTL)
+	invitation.SendCount++
+
+	err = repos.Invitations.Resend(c.Context(), invitation.ID, invitation.TokenHash, invitation.LastSentAt, invitation.ExpiresAt)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Redirect("/team?error=Invitation+is+no+longer+pending")
+	}
+	if err != nil {
+		logger.Error("Invite", "Failed to resend invitation: "+err.Error())
+		return c.Redirect("/team?error=Failed+to+resend+invitation")
+	}
+
+	sendInvitation(c, invitation, token, user)
+
+	logAudit(c, models.AuditActionInvite, models.AuditEntityInvitation, invitation.ID, user, map[string]interface{}{
+		"email":  invitation.Email,
+		"role":   invitation.Role,
+		"resent": true,
+	})
+
+	return c.Redirect("/team?success=Invitation+resent")
+}
+
+// RevokeInvitation handles POST /api/invitations/:id/revoke
+func RevokeInvitation(c *fiber.Ctx) error {
+	user, repos, err := scopedUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	if !auth.CanManageTeam(user.Role) {
+		return c.Redirect("/team?error=Permission+denied")
+	}
+
+	invitation, err := findCompanyInvitation(c, repos)
+	if err != nil {
+		return c.Redirect("/team?error=Invitation+not+found")
+	}
+
+	err = repos.Invitations.Revoke(c.Context(), invitation.ID, time.Now())
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Redirect("/team?error=Invitation+is+no+longer+pending")
+	}
+	if err != nil {
+		logger.Error("Invite", "Failed to revoke invitation: "+err.Error())
+		return c.Redirect("/team?error=Failed+to+revoke+invitation")
+	}
+
+	logAudit(c, models.AuditActionRevoke, models.AuditEntityInvitation, invitation.ID, user, map[string]interface{}{
+		"email": invitation.Email,
+		"role":  invitation.Role,
+	})
+
+	return c.Redirect("/team?success=Invitation+revoked")
+}
+
+// claimInvitation marks a pending invitation as accepted so the token cannot be used twice
+func claimInvitation(ctx context.Context, invitation *models.Invitation, userID primitive.ObjectID) bool {
+	repos, err := invitationRepos(invitation)
+	if err != nil {
+		return false
+	}
+	err = repos.Invitations.Claim(ctx, invitation.ID, invitation.TokenHash, userID, time.Now())
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		logger.Error("Invite", "Failed to claim invitation: "+err.Error())
+	}
+	return err == nil
+}
+
+// releaseInvitation puts a claimed invitation back to pending when joining failed
+func releaseInvitation(ctx context.Context, invitation *models.Invitation) {
+	repos, err := invitationRepos(invitation)
+	if err == nil {
+		err = repos.Invitations.Release(ctx, invitation.ID)
+	}
+	if err != nil {
+		logger.Error("Invite", "Failed to release invitation "+invitation.ID.Hex()+": "+err.Error())
+	}
+}
+
+// AcceptInvitation handles POST /api/invitations/accept
+func AcceptInvitation(c *fiber.Ctx) error {
+	details, err := FindInvitation(c, c.FormValue("token"))
+	if err != nil {
+		return errorToast(c, "This invitation is invalid or has expired")
+	}
+	invitation := details.Invitation
+
+	existing, err := store.Identities().FindByEmail(c.Context(), invitation.Email)
+	if err == nil {
+		return acceptAsExistingUser(c, invitation, existing)
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		logger.Error("Invite", "Database error: "+err.Error())
+		return errorToast(c, "Failed to accept invitation")
+	}
+	return acceptAsNewUser(c, invitation)
+}
+
+// acceptAsNewUser creates the invited account; the email is verified by the invitation link itself
+func acceptAsNewUser(c *fiber.Ctx, invitation *models.Invitation) error {
+	name := strings.TrimSpace(c.FormValue("name"))
+	password := c.FormValue("password")
+
+	if name == "" || password == "" {
+		return errorToast(c, "Name and password are required")
+	}
+	if password != c.FormValue("confirm-password") {
+		return errorToast(c, "Passwords do not match")
+	}
+	if len(password) < 8 {
+		return errorToast(c, "Password must be at least 8 characters")
+	}
+
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		logger.Error("Invite", "Failed to hash password: "+err.Error())
+		return errorToast(c, "Failed to accept invitation")
+	}
+
+	now := time.Now()
+	user := models.User{
+		ID:            primitive.NewObjectID(),
+		Email:         invitation.Email,
+		Name:          name,
+		Role:          invitation.Role,
+		CompanyID:     invitation.CompanyID,
+		PasswordHash:  hashedPassword,
+		EmailVerified: true,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		LastLoginAt:   now,
+	}
+
+	if !claimInvitation(c.Context(), invitation, user.ID) {
+		return errorToast(c, "This invitation is invalid or has expired")
+	}
+
+	if err := store.Identities().Create(c.Context(), &user); err != nil {
+		logger.Error("Invite", "Failed to create user: "+err.Error())
+		releaseInvitation(c.Context(), invitation)
+		return errorToast(c, "Failed to accept invitation")
+	}
+
+	logAudit(c, models.AuditActionAccept, models.AuditEntityInvitation, invitation.ID, &user, map[string]interface{}{
+		"email":       invitation.Email,
+		"role":        invitation.Role,
+		"new_account": true,
+	})
+
+	logger.Info("Invite", "Invitation accepted with new account: "+user.Email)
+
+	if err := sessionManager.SetSession(c, &user); err != nil {
+		c.Set("HX-Redirect", "/signin")
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	c.Set("HX-Redirect", postLoginRedirect(c, &user))
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// acceptAsExistingUser moves an existing account into the inviting company after checking its password
+func acceptAsExistingUser(c *fiber.Ctx, invitation *models.Invitation, user *models.User) error {
+	if wait := lockedOut(c, auth.ThrottleSignIn, user.Email); wait > 0 {
+		return lockedOutToast(c, wait)
+	}
+	if !auth.VerifyPassword(user.PasswordHash, c.FormValue("password")) {
+		recordFailure(c, auth.ThrottleSignIn, user.Email, user)
+		return errorToast(c, "Invalid password")
+	}
+	resetFailures(c, auth.ThrottleSignIn, user.Email)
+
+	// Don't leave a company with members but nobody to run it
+	if user.CompanyID != invitation.CompanyID && user.Role == string(auth.RoleSuperAdmin) {
+		if scope, err := repository.ForCompany(user.CompanyID); err == nil {
+			members, err := store.Scoped(scope).Users.List(c.Context())
+			if err != nil {
+				logger.Error("Invite", "Failed to list members of the current company: "+err.Error())
+				return errorToast(c, "Failed to accept invitation")
+			}
+			others, otherOwners := 0, 0
+			for _, member := range members {
+				if member.ID == user.ID {
+					continue
+				}
+				others++
+				if member.Role == string(auth.RoleSuperAdmin) {
+					otherOwners++
+				}
+			}
+			if others > 0 && otherOwners == 0 {
+				return errorToast(c, "Make someone else a Super Admin of your current company first")
+			}
+		}
+	}
+
+	if !claimInvitation(c.Context(), invitation, user.ID) {
+		return errorToast(c, "This invitation is invalid or has expired")
+	}
+
+	previousCompanyID := user.CompanyID
+	err := store.Identities().JoinCompany(c.Context(), user.ID, invitation.CompanyID, invitation.Role)
+	if err != nil {
+		logger.Error("Invite", "Failed to attach user to company: "+err.Error())
+		releaseInvitation(c.Context(), invitation)
+		return errorToast(c, "Failed to accept invitation")
+	}
+
+	// Sessions carry the old company, so start over
+	sessionManager.RevokeAllForUser(c.Context(), user.ID)
+
+	user.CompanyID = invitation.CompanyID
+	user.Role = invitation.Role
+	logAudit(c, models.AuditActionAccept, models.AuditEntityInvitation, invitation.ID, user, map[string]interface{}{
+		"email":            invitation.Email,
+		"role":             invitation.Role,
+		"previous_company": previousCompanyID.Hex(),
+	})
+
+	logger.Info("Invite", "Invitation accepted by existing account: "+user.Email)
+
+	// Same rules as a normal sign-in
+	if user.TOTPEnabled {
+		if err := sessionManager.SetPendingSession(c, user); err != nil {
+			c.Set("HX-Redirect", "/signin")
+			return c.SendStatus(fiber.StatusOK)
+		}
+		c.Set("HX-Redirect", "/signin/2fa")
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	if err := sessionManager.SetSession(c, user); err != nil {
+		c.Set("HX-Redirect", "/signin")
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	c.Set("HX-Redirect", postLoginRedirect(c, user))
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// sendInvitation emails the invitation link in the background
+func sendInvitation(c *fiber.Ctx, invitation *models.Invitation, token string, inviter *models.User) {
+	if sesClient == nil {
+		logger.Info("Invite", "SES not configured, invitation email not sent to: "+invitation.Email)
+		return
+	}
+
+	companyName := "your team"
+	if repos, err := invitationRepos(invitation); err == nil {
+		if company, err := repos.Company.Get(c.Context()); err == nil {
+			companyName = company.Name
+		}
+	}
+
+	inviterName := inviter.Name
+	if inviterName == "" {
+		inviterName = inviter.Email
+	}
+
+	go sendInvitationEmail(invitation.Email, token, companyName, inviterName, auth.RoleDisplayName(invitation.Role))
+}
+
+func sendInvitationEmail(toEmail, token, companyName, inviterName, roleName string) {
+	appName := os.Getenv("APP_NAME")
+	if appName == "" {
+		appName = "CT"
+	}
+
+	// Check if SENDGRID_TO_EMAIL is set for testing
+	testEmail := os.Getenv("SENDGRID_TO_EMAIL")
+	if testEmail != "" {
+		toEmail = testEmail
+	}
+
+	baseURL := sesClient.GetBaseURL()
+	acceptLink := fmt.Sprintf("%s/invitations/accept?token=%s", baseURL, token)
+	subject := fmt.Sprintf("%s invited you to join %s on %s", inviterName, companyName, appName)
+
+	// HTML email
+	htmlBody := fmt.Sprintf(`
+		<div style="font-family: Arial, sans-serif; max-width: 600px; margin: 0 auto;">
+			<h2 style="color: #5D5CFF;">You're invited to join %s</h2>
+			<p>%s invited you to join <strong>%s</strong> on %s as <strong>%s</strong>.</p>
+			<div style="margin: 30px 0;">
+				<a href="%s" style="background-color: #5D5CFF; color: white; padding: 12px 30px; text-decoration: none; border-radius: 8px; display: inline-block; font-weight: bold;">Accept Invitation</a>
+			</div>
+			<p style="color: #666; font-size: 14px;">This invitation expires in 7 days and can only be used once.</p>
+			<p style="color: #666; font-size: 14px;">If you weren't expecting this, you can ignore this email.</p>
+			<p style="color: #999; font-size: 12px; margin-top: 30px;">If the button doesn't work, copy and paste this link into your browser:<br>%s</p>
+		</div>
+	`, companyName, inviterName, companyName, appName, roleName, acceptLink, acceptLink)
+
+	// Plain text email
+	textBody := fmt.Sprintf(
+		"%s invited you to join %s on %s as %s.\n\nAccept the invitation here:\n\n%s\n\nThis invitation expires in 7 days and can only be used once.\n\nIf you weren't expecting this, you can ignore this email.",
+		inviterName, companyName, appName, roleName, acceptLink,
+	)
+
+	// Create the email input
+	input := &email.SendEmailInput{
+		ToEmailAddress:   toEmail,
+		FromEmailAddress: sesClient.FormatFromAddress(),
+		Content: &email.EmailContent{
+			Simple: &email.Message{
+				Subject: &email.Content{
+					Data:    subject,
+					Charset: "UTF-8",
+				},
+				Body: &email.Body{
+					Html: &email.Content{
+						Data:    htmlBody,
+						Charset: "UTF-8",
+					},
+					Text: &email.Content{
+						Data:    textBody,
+						Charset: "UTF-8",
+					},
+				},
+			},
+		},
+	}
+
+	// Send the email
+	logger.Info("Email", "Sending invitation email to: "+toEmail)
+	result, err := sesClient.SendEmail(input)
+	if err != nil {
+		logger.Error("Email", "Failed to send invitation email via SES: "+err.Error())
+		return
+	}
+
+	logger.Info("Email", "Invitation email sent successfully to: "+toEmail+", MessageID: "+*result.MessageId)
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minhtranin/ct/internal/lifecycle"
+	"github.com/minhtranin/ct/internal/logger"
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SubmitTransaction handles POST /api/transactions/:id/submit
+func SubmitTransaction(c *fiber.Ctx) error {
+	return creatorTransition(c, lifecycle.EventSubmit, models.AuditActionSubmit, "Transaction+submitted+for+approval")
+}
+
+// WithdrawTransaction handles POST /api/transactions/:id/withdraw
+func WithdrawTransaction(c *fiber.Ctx) error {
+	return creatorTransition(c, lifecycle.EventWithdraw, models.AuditActionWithdraw, "Transaction+moved+back+to+drafts")
+}
+
+// ResubmitTransaction handles POST /api/transactions/:id/resubmit
+func ResubmitTransaction(c *fiber.Ctx) error {
+	return creatorTransition(c, lifecycle.EventResubmit, models.AuditActionSubmit, "Transaction+resubmitted+for+approval")
+}
+
+// PayTransaction handles POST /api/transactions/:id/pay
+func PayTransaction(c *fiber.Ctx) error {
+	user, repos, err := scopedUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	txn, msg := transitionTransaction(c, repos, user, lifecycle.EventPay, lifecycle.Input{})
+	if msg != "" {
+		return c.Redirect("/transactions?error=" + msg)
+	}
+
+	logAudit(c, models.AuditActionPay, models.AuditEntityTransaction, txn.ID, user, map[string]interface{}{
+		"amount": txn.Amount.Format(txn.Currency),
+	})
+
+	return c.Redirect("/transactions?success=Transaction+marked+as+paid")
+}
+
+// creatorTransition performs one of the events a creator uses to move their own
+// transaction between drafts and the approval queue
+func creatorTransition(c *fiber.Ctx, event lifecycle.Event, action models.AuditAction, success string) error {
+	user, repos, err := scopedUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	txn, msg := transitionTransaction(c, repos, user, event, lifecycle.Input{})
+	if msg != "" {
+		return c.Redirect("/transactions?error=" + msg)
+	}
+
+	logAudit(c, action, models.AuditEntityTransaction, txn.ID, user, map[string]interface{}{
+		"amount": txn.Amount.Format(txn.Currency),
+		"event":  string(event),
+	})
+
+	return c.Redirect("/transactions?success=" + success)
+}
+
+// transitionTransaction performs event on the transaction named in the URL and
+// returns it as changed, or the error message to redirect with
+func transitionTransaction(c *fiber.Ctx, repos *repository.Repositories, user *models.User, event lifecycle.Event, in lifecycle.Input) (*models.Transaction, string) {
+	txnID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return nil, "Invalid+transaction+ID"
+	}
+
+	// Other companies' transactions are simply not found
+	txn, err := repos.Transactions.Get(c.Context(), txnID)
+	if err != nil {
+		return nil, "Transaction+not+found"
+	}
+
+	changed, err := lifecycle.Fire(c.Context(), repos, user, txn, event, in)
+	if msg := transitionFailed(txn, event, err); msg != "" {
+		return nil, msg
+	}
+	return changed, ""
+}
+
+// transitionFailed returns the error message for a failed event on txn, or "" on success
+func transitionFailed(txn *models.Transaction, event lifecycle.Event, err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, repository.ErrNotFound):
+		return "Transaction+not+found"
+	case errors.Is(err, lifecycle.ErrNotPermitted):
+		return "You+are+not+allowed+to+" + string(event) + "+this+transaction"
+	case errors.Is(err, lifecycle.ErrInvalidTransition):
+		return "Cannot+" + string(event) + "+a+" + string(txn.Status) + "+transaction"
+	case errors.Is(err, models.ErrSelfApproval):
+		return "You+cannot+" + string(event) + "+your+own+transaction"
+	case errors.Is(err, models.ErrApprovalLimit):
+		return "Amount+exceeds+your+approval+limit"
+	case errors.Is(err, models.ErrApprovalStep):
+		return "Your+role+cannot+sign+off+this+approval+step"
+	case errors.Is(err, models.ErrAlreadySignedOff):
+		return "You+already+signed+off+an+earlier+step+of+this+transaction"
+	case errors.Is(err, models.ErrBudgetExceeded):
+		return "This+would+take+a+budget+over+its+limit,+which+the+budget+does+not+allow"
+	case errors.Is(err, repository.ErrStatusChanged), errors.Is(err, repository.ErrAlreadyReversed):
+		return "Transaction+was+changed+by+someone+else;+reload+and+try+again"
+	}
+	logger.Error("Finance", "Failed to "+string(event)+" transaction "+txn.ID.Hex()+": "+err.Error())
+	return "Failed+to+" + string(event) + "+transaction"
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DismissNotification handles POST /api/notifications/:id/read
+func DismissNotification(c *fiber.Ctx) error {
+	user, repos, err := scopedUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Redirect("/dashboard?error=Invalid+notification+ID")
+	}
+
+	// Only ever their own; anyone else's is not found
+	if err := repos.Notifications.MarkRead(c.Context(), id, user.ID, time.Now()); err != nil {
+		return c.Redirect("/dashboard?error=Notification+not+found")
+	}
+
+	return c.Redirect("/dashboard")
+}
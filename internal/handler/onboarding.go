@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/minhtranin/ct/internal/logger"
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// createCompany creates a company for a new sign-up and seeds its default categories
+func createCompany(ctx context.Context, name, email, currency, timezone string) (*models.Company, error) {
+	company := models.NewCompany(name)
+	company.Email = email
+	company.Currency = currency
+	company.Timezone = timezone
+
+	scope, err := repository.ForCompany(primitive.NewObjectID())
+	if err != nil {
+		return nil, err
+	}
+	repos := store.Scoped(scope)
+	if err := repos.Company.Create(ctx, company); err != nil {
+		return nil, err
+	}
+
+	for _, category := range models.GetDefaultCategories(company.ID) {
+		category.ID = primitive.NewObjectID()
+		if err := repos.Categories.Create(ctx, category); err != nil {
+			deleteCompany(ctx, company.ID)
+			return nil, err
+		}
+	}
+
+	return company, nil
+}
+
+// deleteCompany removes a half-created company and its seeded categories
+func deleteCompany(ctx context.Context, companyID primitive.ObjectID) {
+	scope, err := repository.ForCompany(companyID)
+	if err != nil {
+		return
+	}
+	repos := store.Scoped(scope)
+	if err := repos.Categories.DeleteAll(ctx); err != nil {
+		logger.Error("Auth", "Failed to delete the categories of company "+companyID.Hex()+": "+err.Error())
+	}
+	if err := repos.Company.Delete(ctx); err != nil {
+		logger.Error("Auth", "Failed to delete company "+companyID.Hex()+": "+err.Error())
+	}
+}
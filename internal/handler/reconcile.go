@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minhtranin/ct/internal/logger"
+	"github.com/minhtranin/ct/internal/reconcile"
+)
+
+// Reconcile handles POST /api/reconcile
+func Reconcile(c *fiber.Ctx) error {
+	user, repos, err := scopedUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	// Repair records its own audit entry for each correction
+	fixed, err := reconcile.Repair(c.Context(), repos, user)
+	if err != nil {
+		logger.Error("Finance", "Failed to reconcile company "+repos.Scope.CompanyID().Hex()+": "+err.Error())
+		return c.Redirect("/reconcile?error=Failed+to+correct+balances")
+	}
+	if len(fixed) == 0 {
+		return c.Redirect("/reconcile?success=Nothing+to+correct")
+	}
+
+	return c.Redirect("/reconcile?success=Corrected+" + strconv.Itoa(len(fixed)) + "+figures")
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/minhtranin/ct/internal/auth"
+	"github.com/minhtranin/ct/internal/logger"
+	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CurrentUser loads the signed-in user, reusing the ID RequireAuth already resolved
+func CurrentUser(c *fiber.Ctx) (*models.User, error) {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		var err error
+		if userID, err = GetSession(c); err != nil {
+			return nil, err
+		}
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+	return store.Identities().FindByID(c.Context(), objectID)
+}
+
+// RevokeSession handles POST /api/sessions/:id/revoke
+func RevokeSession(c *fiber.Ctx) error {
+	user, err := CurrentUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	sessionID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Redirect("/sessions?error=Invalid+session+ID")
+	}
+
+	session, err := sessionManager.FindSession(c.Context(), sessionID)
+	if err != nil {
+		return c.Redirect("/sessions?error=Session+not+found")
+	}
+
+	// Users can revoke their own sessions; managers can revoke sessions within their company
+	isOwner := session.UserID == user.ID
+	isTeamManager := auth.CanManageTeam(user.Role) && !user.CompanyID.IsZero() && session.CompanyID == user.CompanyID
+	if !isOwner && !isTeamManager {
+		return c.Redirect("/sessions?error=Permission+denied")
+	}
+
+	if err := sessionManager.RevokeSession(c.Context(), sessionID); err != nil {
+		logger.Error("Auth", "Failed to revoke session: "+err.Error())
+		return c.Redirect("/sessions?error=Failed+to+revoke+session")
+	}
+
+	logAudit(c, models.AuditActionRevoke, models.AuditEntitySession, sessionID, user, map[string]interface{}{
+		"user_id": session.UserID.Hex(),
+		"device":  auth.DescribeUserAgent(session.UserAgent),
+		"ip":      session.IPAddress,
+	})
+
+	// Revoking the session in use is the same as signing out
+	if current, err := sessionManager.CurrentSession(c); err == nil && current.ID == sessionID {
+		sessionManager.ClearSession(c)
+		return c.Redirect("/signin")
+	}
+
+	return c.Redirect("/sessions?success=Session+revoked")
+}
+
+// SignOutEverywhere handles POST /api/sessions/revoke-all
+func SignOutEverywhere(c *fiber.Ctx) error {
+	user, err := CurrentUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	count, err := sessionManager.RevokeAllForUser(c.Context(), user.ID)
+	if err != nil {
+		logger.Error("Auth", "Failed to revoke sessions: "+err.Error())
+		return c.Redirect("/sessions?error=Failed+to+sign+out+everywhere")
+	}
+
+	logAudit(c, models.AuditActionRevoke, models.AuditEntityUser, user.ID, user, map[string]interface{}{
+		"revoked_sessions": count,
+		"reason":           "sign_out_everywhere",
+	})
+
+	logger.Info("Auth", "Signed out everywhere: "+user.Email)
+
+	sessionManager.ClearSession(c)
+	return c.Redirect("/signin")
+}
+
+// RevokeUserSessions handles POST /api/users/:id/sessions/revoke
+func RevokeUserSessions(c *fiber.Ctx) error {
+	user, repos, err := scopedUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	if !auth.CanManageTeam(user.Role) {
+		return c.Redirect("/team?error=Permission+denied")
+	}
+
+	targetUserID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Redirect("/team?error=Invalid+user+ID")
+	}
+
+	// Only members of the same company can be signed out
+	target, err := repos.Users.Get(c.Context(), targetUserID)
+	if err != nil {
+		return c.Redirect("/team?error=User+not+found")
+	}
+
+	count, err := sessionManager.RevokeAllForUser(c.Context(), target.ID)
+	if err != nil {
+		logger.Error("Auth", "Failed to revoke sessions: "+err.Error())
+		return c.Redirect("/team?error=Failed+to+sign+out+user")
+	}
+
+	logAudit(c, models.AuditActionRevoke, models.AuditEntityUser, target.ID, user, map[string]interface{}{
+		"revoked_sessions": count,
+		"email":            target.Email,
+		"reason":           "forced_sign_out",
+	})
+
+	if target.ID == user.ID {
+		sessionManager.ClearSession(c)
+		return c.Redirect("/signin")
+	}
+
+	return c.Redirect("/team?success=User+signed+out")
+}
+
+// ActiveSessionsForUser lists a user's active sessions (for use in page handlers)
+func ActiveSessionsForUser(c *fiber.Ctx, userID primitive.ObjectID) ([]models.Session, error) {
+	return sessionManager.ActiveSessionsForUser(c.Context(), userID)
+}
+
+// ActiveSessionsForCompany lists a company's active sessions (for use in page handlers)
+func ActiveSessionsForCompany(c *fiber.Ctx, companyID primitive.ObjectID) ([]models.Session, error) {
+	return sessionManager.ActiveSessionsForCompany(c.Context(), companyID)
+}
@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minhtranin/ct/internal/auth"
+	"github.com/minhtranin/ct/internal/logger"
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/view/shared/toast"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// lockedOut returns how long the account and the client IP must wait before trying the action again
+func lockedOut(c *fiber.Ctx, action, email string) time.Duration {
+	wait, err := throttle.LockedFor(c.Context(),
+		auth.ThrottleKey(auth.ThrottleScopeAccount, action, email),
+		auth.ThrottleKey(auth.ThrottleScopeIP, action, c.IP()),
+	)
+	if err != nil {
+		logger.Error("Auth", "Failed to check attempt limits: "+err.Error())
+		return 0
+	}
+	return wait
+}
+
+// recordFailure counts a failed attempt against the account and the client IP.
+// Known users get a login_failed audit entry, and an account_locked entry when the lock kicks in.
+func recordFailure(c *fiber.Ctx, action, email string, user *models.User) {
+	if _, err := throttle.RecordFailure(c.Context(), auth.ThrottleScopeIP, action, c.IP(), auth.IPPolicy); err != nil {
+		logger.Error("Auth", "Failed to record attempt: "+err.Error())
+	}
+
+	attempt, err := throttle.RecordFailure(c.Context(), auth.ThrottleScopeAccount, action, email, auth.AccountPolicy)
+	if err != nil {
+		logger.Error("Auth", "Failed to record attempt: "+err.Error())
+		return
+	}
+
+	if user == nil {
+		return
+	}
+
+	logAudit(c, models.AuditActionLoginFailed, models.AuditEntityUser, user.ID, user, map[string]interface{}{
+		"step":     action,
+		"failures": attempt.Failures,
+	})
+
+	if attempt.IsLocked(time.Now()) {
+		lockedFor := formatWait(time.Until(attempt.LockedUntil))
+		logAudit(c, models.AuditActionAccountLocked, models.AuditEntityUser, user.ID, user, map[string]interface{}{
+			"step":         action,
+			"failures":     attempt.Failures,
+			"locked_for":   lockedFor,
+			"locked_until": attempt.LockedUntil,
+		})
+		logger.Info("Auth", "Account locked after "+fmt.Sprintf("%d", attempt.Failures)+" failed attempts: "+email)
+	}
+}
+
+// resetFailures clears the account counter after a successful attempt
+func resetFailures(c *fiber.Ctx, action, email string) {
+	throttle.Reset(c.Context(), auth.ThrottleKey(auth.ThrottleScopeAccount, action, email))
+}
+
+// limitResetRequests counts a password reset request against the address it
+// would email and the client IP, and returns how long to wait when either is
+// over its limit. The counters are kept apart from the sign-in lockout, so
+// that requesting reset links, for any address, cannot lock an account.
+func limitResetRequests(c *fiber.Ctx, email string) time.Duration {
+	wait, err := throttle.LockedFor(c.Context(),
+		auth.ThrottleKey(auth.ThrottleScopeRecipient, auth.ThrottlePasswordReset, email),
+		auth.ThrottleKey(auth.ThrottleScopeIP, auth.ThrottlePasswordReset, c.IP()),
+	)
+	if err != nil {
+		logger.Error("Auth", "Failed to check attempt limits: "+err.Error())
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	if _, err := throttle.RecordFailure(c.Context(), auth.ThrottleScopeIP, auth.ThrottlePasswordReset, c.IP(), auth.IPPolicy); err != nil {
+		logger.Error("Auth", "Failed to record attempt: "+err.Error())
+	}
+	if _, err := throttle.RecordFailure(c.Context(), auth.ThrottleScopeRecipient, auth.ThrottlePasswordReset, email, auth.RecipientPolicy); err != nil {
+		logger.Error("Auth", "Failed to record attempt: "+err.Error())
+	}
+	return 0
+}
+
+// lockedOutToast tells the client to wait before trying again
+func lockedOutToast(c *fiber.Ctx, wait time.Duration) error {
+	c.Set("Content-Type", "text/html")
+	return toast.Toast(toast.Props{
+		Title:         "Too many attempts",
+		Description:   "Try again in " + formatWait(wait),
+		Variant:       toast.VariantError,
+		Position:      toast.PositionTopLeft,
+		Duration:      5000,
+		Dismissible:   true,
+		ShowIndicator: true,
+		Icon:          true,
+	}).Render(c.Context(), c.Response().BodyWriter())
+}
+
+// formatWait renders a lockout duration rounded up to whole seconds or minutes
+func formatWait(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%d seconds", int((d+time.Second-1)/time.Second))
+	}
+	minutes := int((d + time.Minute - 1) / time.Minute)
+	if minutes == 1 {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", minutes)
+}
+
+// LockedAccounts returns the lockout expiry of locked emails (for use in page handlers)
+func LockedAccounts(c *fiber.Ctx, emails []string) map[string]time.Time {
+	locked, err := throttle.LockedAccounts(c.Context(), emails)
+	if err != nil {
+		logger.Error("Auth", "Failed to load locked accounts: "+err.Error())
+		return map[string]time.Time{}
+	}
+	return locked
+}
+
+// UnlockUser handles POST /api/users/:id/unlock
+func UnlockUser(c *fiber.Ctx) error {
+	user, repos, err := scopedUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	if !auth.CanManageAccounts(user.Role) {
+		return c.Redirect("/team?error=Permission+denied")
+	}
+
+	targetUserID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Redirect("/team?error=Invalid+user+ID")
+	}
+
+	// Only members of the same company can be unlocked
+	target, err := repos.Users.Get(c.Context(), targetUserID)
+	if err != nil {
+		return c.Redirect("/team?error=User+not+found")
+	}
+
+	cleared, err := throttle.UnlockAccount(c.Context(), target.Email)
+	if err != nil {
+		logger.Error("Auth", "Failed to unlock account: "+err.Error())
+		return c.Redirect("/team?error=Failed+to+unlock+account")
+	}
+
+	logAudit(c, models.AuditActionUnlock, models.AuditEntityUser, target.ID, user, map[string]interface{}{
+		"email":            target.Email,
+		"cleared_counters": cleared,
+	})
+
+	logger.Info("Auth", "Account unlocked by "+user.Email+": "+target.Email)
+
+	return c.Redirect("/team?success=Account+unlocked")
+}
@@ -0,0 +1,270 @@
+package handler
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minhtranin/ct/internal/auth"
+	"github.com/minhtranin/ct/internal/logger"
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/render"
+	"github.com/minhtranin/ct/internal/repository"
+	view "github.com/minhtranin/ct/internal/view/components"
+	"github.com/minhtranin/ct/internal/view/layouts"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CompanyRequiresTwoFactor checks the company's two-factor enforcement setting
+func CompanyRequiresTwoFactor(c *fiber.Ctx, companyID primitive.ObjectID) bool {
+	scope, err := repository.ForCompany(companyID)
+	if err != nil {
+		return false
+	}
+
+	company, err := store.Scoped(scope).Company.Get(c.Context())
+	if err != nil {
+		return false
+	}
+	return company.Require2FA
+}
+
+// TwoFactorRequired checks if the company forces the user to enroll in two-factor authentication
+func TwoFactorRequired(c *fiber.Ctx, user *models.User) bool {
+	if user.TOTPEnabled || !auth.RequiresTwoFactor(user.Role) {
+		return false
+	}
+	return CompanyRequiresTwoFactor(c, user.CompanyID)
+}
+
+// postLoginRedirect picks where to send a user once fully signed in
+func postLoginRedirect(c *fiber.Ctx, user *models.User) string {
+	if TwoFactorRequired(c, user) {
+		return "/account/2fa?error=Your+company+requires+two-factor+authentication"
+	}
+	return "/dashboard"
+}
+
+// verifySecondFactor checks a TOTP code or a recovery code and consumes it so it cannot be reused
+func verifySecondFactor(c *fiber.Ctx, user *models.User, code, recoveryCode string) bool {
+	var err error
+	if recoveryCode != "" {
+		err = store.Identities().UseRecoveryCode(c.Context(), user.ID, auth.HashRecoveryCode(recoveryCode))
+	} else {
+		step, ok := auth.VerifyTOTP(user.TOTPSecret, code, time.Now())
+		if !ok || step <= user.TOTPLastStep {
+			return false
+		}
+		// Conditional update so two requests cannot both use the same code
+		err = store.Identities().UseTOTPStep(c.Context(), user.ID, step)
+	}
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		logger.Error("Auth", "Failed to consume second factor: "+err.Error())
+	}
+	return err == nil
+}
+
+// VerifyTwoFactor handles POST /api/auth/2fa
+func VerifyTwoFactor(c *fiber.Ctx) error {
+	pending, err := sessionManager.PendingSession(c)
+	if err != nil {
+		c.Set("HX-Redirect", "/signin")
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	code := strings.TrimSpace(c.FormValue("code"))
+	recoveryCode := strings.TrimSpace(c.FormValue("recovery_code"))
+	if code == "" && recoveryCode == "" {
+		return errorToast(c, "Enter your authentication code")
+	}
+
+	user, err := store.Identities().FindByID(c.Context(), pending.UserID)
+	if err != nil || !user.TOTPEnabled {
+		c.Set("HX-Redirect", "/signin")
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	if wait := lockedOut(c, auth.ThrottleTwoFactor, user.Email); wait > 0 {
+		return lockedOutToast(c, wait)
+	}
+
+	if !verifySecondFactor(c, user, code, recoveryCode) {
+		recordFailure(c, auth.ThrottleTwoFactor, user.Email, user)
+		return errorToast(c, "Invalid authentication code")
+	}
+	resetFailures(c, auth.ThrottleTwoFactor, user.Email)
+
+	// Swap the pending session for a full one
+	sessionManager.RevokeSession(c.Context(), pending.ID)
+	if err := sessionManager.SetSession(c, user); err != nil {
+		logger.Error("Auth", "Failed to create session: "+err.Error())
+		return errorToast(c, "Login failed")
+	}
+
+	if err := store.Identities().RecordLogin(c.Context(), user.ID, time.Now()); err != nil {
+		logger.Error("Auth", "Failed to record login: "+err.Error())
+	}
+
+	changes := map[string]interface{}{"method": "totp"}
+	if recoveryCode != "" {
+		changes["method"] = "recovery_code"
+	}
+	logAudit(c, models.AuditActionLogin, models.AuditEntityUser, user.ID, user, changes)
+
+	logger.Info("Auth", "User signed in with two-factor: "+user.Email)
+
+	c.Set("HX-Redirect", postLoginRedirect(c, user))
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// renderRecoveryCodes shows freshly generated recovery codes once
+func renderRecoveryCodes(c *fiber.Ctx, user *models.User, codes []string) error {
+	return render.HTML(c, layouts.Dashboard("Recovery Codes", view.RecoveryCodesPage(codes), false, user.Email, user.Role, "/account/2fa"))
+}
+
+// hashRecoveryCodes hashes recovery codes for storage
+func hashRecoveryCodes(codes []string) []string {
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+	return hashes
+}
+
+// EnableTwoFactor handles POST /api/account/2fa/enable
+func EnableTwoFactor(c *fiber.Ctx) error {
+	user, err := CurrentUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	if user.TOTPEnabled {
+		return c.Redirect("/account/2fa?error=Two-factor+authentication+is+already+enabled")
+	}
+	if user.TOTPPendingSecret == "" {
+		return c.Redirect("/account/2fa?error=Start+the+setup+again")
+	}
+
+	step, ok := auth.VerifyTOTP(user.TOTPPendingSecret, c.FormValue("code"), time.Now())
+	if !ok {
+		return c.Redirect("/account/2fa?error=Invalid+authentication+code")
+	}
+
+	codes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		logger.Error("Auth", "Failed to generate recovery codes: "+err.Error())
+		return c.Redirect("/account/2fa?error=Failed+to+enable+two-factor+authentication")
+	}
+
+	err = store.Identities().EnableTOTP(c.Context(), user.ID, user.TOTPPendingSecret, step, hashRecoveryCodes(codes), time.Now())
+	if err != nil {
+		logger.Error("Auth", "Failed to enable two-factor: "+err.Error())
+		return c.Redirect("/account/2fa?error=Failed+to+enable+two-factor+authentication")
+	}
+
+	logAudit(c, models.AuditActionUpdate, models.AuditEntityUser, user.ID, user, map[string]interface{}{
+		"two_factor": "enabled",
+	})
+
+	logger.Info("Auth", "Two-factor enabled for: "+user.Email)
+
+	return renderRecoveryCodes(c, user, codes)
+}
+
+// RegenerateRecoveryCodes handles POST /api/account/2fa/recovery-codes
+func RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	user, err := CurrentUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	if !user.TOTPEnabled {
+		return c.Redirect("/account/2fa?error=Two-factor+authentication+is+not+enabled")
+	}
+	if !verifySecondFactor(c, user, strings.TrimSpace(c.FormValue("code")), "") {
+		return c.Redirect("/account/2fa?error=Invalid+authentication+code")
+	}
+
+	codes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		logger.Error("Auth", "Failed to generate recovery codes: "+err.Error())
+		return c.Redirect("/account/2fa?error=Failed+to+generate+recovery+codes")
+	}
+
+	if err := store.Identities().SetRecoveryCodes(c.Context(), user.ID, hashRecoveryCodes(codes)); err != nil {
+		logger.Error("Auth", "Failed to store recovery codes: "+err.Error())
+		return c.Redirect("/account/2fa?error=Failed+to+generate+recovery+codes")
+	}
+
+	logAudit(c, models.AuditActionUpdate, models.AuditEntityUser, user.ID, user, map[string]interface{}{
+		"two_factor": "recovery_codes_regenerated",
+	})
+
+	return renderRecoveryCodes(c, user, codes)
+}
+
+// DisableTwoFactor handles POST /api/account/2fa/disable
+func DisableTwoFactor(c *fiber.Ctx) error {
+	user, err := CurrentUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	if !user.TOTPEnabled {
+		return c.Redirect("/account/2fa")
+	}
+
+	// Check enforcement as if 2FA were already off
+	withoutTOTP := *user
+	withoutTOTP.TOTPEnabled = false
+	if TwoFactorRequired(c, &withoutTOTP) {
+		return c.Redirect("/account/2fa?error=Your+company+requires+two-factor+authentication")
+	}
+
+	if !verifySecondFactor(c, user, strings.TrimSpace(c.FormValue("code")), "") {
+		return c.Redirect("/account/2fa?error=Invalid+authentication+code")
+	}
+
+	if err := store.Identities().DisableTOTP(c.Context(), user.ID); err != nil {
+		logger.Error("Auth", "Failed to disable two-factor: "+err.Error())
+		return c.Redirect("/account/2fa?error=Failed+to+disable+two-factor+authentication")
+	}
+
+	logAudit(c, models.AuditActionUpdate, models.AuditEntityUser, user.ID, user, map[string]interface{}{
+		"two_factor": "disabled",
+	})
+
+	logger.Info("Auth", "Two-factor disabled for: "+user.Email)
+
+	return c.Redirect("/account/2fa?success=Two-factor+authentication+disabled")
+}
+
+// UpdateSecuritySettings handles POST /api/settings/security
+func UpdateSecuritySettings(c *fiber.Ctx) error {
+	user, err := CurrentUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	if !auth.CanAccessSettings(user.Role) {
+		return c.Redirect("/settings?error=Permission+denied")
+	}
+	repos, err := Repos(c)
+	if err != nil {
+		return c.Redirect("/settings?error=No+company+found")
+	}
+
+	require2FA := c.FormValue("require_2fa") == "on" || c.FormValue("require_2fa") == "true"
+
+	if err := repos.Company.SetRequire2FA(c.Context(), require2FA); err != nil {
+		logger.Error("Auth", "Failed to update security settings: "+err.Error())
+		return c.Redirect("/settings?error=Failed+to+update+settings")
+	}
+
+	logAudit(c, models.AuditActionUpdate, models.AuditEntityCompany, user.CompanyID, user, map[string]interface{}{
+		"require_2fa": require2FA,
+	})
+
+	return c.Redirect("/settings?success=Security+settings+updated")
+}
@@ -0,0 +1,92 @@
+package lifecycle
+
+import (
+	"github.com/minhtranin/ct/internal/auth"
+	"github.com/minhtranin/ct/internal/models"
+)
+
+// Step is where a pending transaction is in its approval chain
+type Step struct {
+	Number int    // The step awaiting sign-off, from 1
+	Of     int    // Steps in the chain; 1 without a workflow
+	Name   string // The workflow step's name, or "Approval"
+	// Lowest role that may sign it off, or "" when no role's approval limit covers it
+	Role auth.Role
+	// The extra sign-off a transaction needs for going over a budget
+	BudgetOverride bool
+}
+
+// budgetOverrideRole is the lowest role that may let a transaction go over a budget
+const budgetOverrideRole = auth.RoleManager
+
+// approverRoles are the roles that may approve, lowest first
+var approverRoles = []auth.Role{auth.RoleHolder, auth.RoleAccountant, auth.RoleManager, auth.RoleAdmin, auth.RoleSuperAdmin, auth.RoleDeveloper}
+
+// CurrentStep returns the approval step txn is waiting on under company's policy.
+// Without a workflow a single approval is needed from the lowest role whose
+// limit covers the amount. A transaction submitted over a budget that asks for
+// it then needs one more sign-off, from a manager or above.
+func CurrentStep(company *models.Company, txn *models.Transaction) Step {
+	step := policyStep(company, txn)
+	if !txn.BudgetOverride {
+		return step
+	}
+	if txn.ApprovalStep >= step.Of {
+		return Step{Number: step.Of + 1, Of: step.Of + 1, Name: "Budget override", Role: budgetOverrideRole, BudgetOverride: true}
+	}
+	step.Of++
+	return step
+}
+
+// policyStep returns the step txn is waiting on in the chain the policy gives it
+func policyStep(company *models.Company, txn *models.Transaction) Step {
+	policy, currency := approvals(company)
+	workflow := policy.Workflow(txn, currency)
+	if workflow == nil {
+		step := Step{Number: 1, Of: 1, Name: "Approval"}
+		for _, role := range approverRoles {
+			if policy.WithinLimit(&models.User{Role: string(role)}, txn, currency) {
+				step.Role = role
+				break
+			}
+		}
+		return step
+	}
+
+	// A workflow shortened while the transaction was pending ends at its last step
+	i := min(txn.ApprovalStep, len(workflow.Steps)-1)
+	return Step{
+		Number: i + 1,
+		Of:     len(workflow.Steps),
+		Name:   workflow.Steps[i].Name,
+		Role:   auth.Role(workflow.Steps[i].Role),
+	}
+}
+
+// decisionPolicy applies the company's segregation of duties, and either its
+// approval limits or the role the current workflow or budget override step needs
+func decisionPolicy(company *models.Company, actor *models.User, txn *models.Transaction) error {
+	policy, currency := approvals(company)
+	if policy.Workflow(txn, currency) == nil && !CurrentStep(company, txn).BudgetOverride {
+		return policy.Check(actor, txn, currency)
+	}
+	if err := policy.CheckSignOff(actor, txn); err != nil {
+		return err
+	}
+	if auth.GetRoleLevel(actor.Role) < auth.RoleLevel[CurrentStep(company, txn).Role] {
+		return models.ErrApprovalStep
+	}
+	return nil
+}
+
+// approvals returns company's approval policy and the currency its limits are in.
+// Without a company the default policy applies: no self-approval and no limits.
+func approvals(company *models.Company) (models.ApprovalPolicy, string) {
+	if company == nil {
+		return models.ApprovalPolicy{}, "USD"
+	}
+	if company.Currency == "" {
+		return company.Approvals, "USD"
+	}
+	return company.Approvals, company.Currency
+}
@@ -0,0 +1,71 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/repository"
+)
+
+// Delegators returns the users whose approval authority actor holds now through
+// an active delegation. Delegations lapse at their end date without any cleanup.
+func Delegators(ctx context.Context, repos *repository.Repositories, actor *models.User) ([]models.User, error) {
+	delegations, err := repos.Delegations.ActiveFor(ctx, actor.ID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	var delegators []models.User
+	for _, d := range delegations {
+		// The delegator's current role applies, not the one they had when delegating
+		user, err := repos.Users.Get(ctx, d.FromUserID)
+		if errors.Is(err, repository.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		delegators = append(delegators, *user)
+	}
+	return delegators, nil
+}
+
+// Authority returns whose authority actor may perform event on txn with: their
+// own when that is enough, otherwise that of one of delegators. It returns the
+// reason actor may not when neither allows it. Only approving and rejecting can
+// be delegated.
+func Authority(company *models.Company, actor *models.User, delegators []models.User, txn *models.Transaction, event Event) (*models.User, error) {
+	err := check(company, actor, txn, event)
+	if err == nil {
+		return actor, nil
+	}
+	if errors.Is(err, ErrInvalidTransition) || !transitions[event].signOff {
+		return nil, err
+	}
+
+	// Segregation of duties still applies to the delegate themselves
+	policy, _ := approvals(company)
+	if policy.CheckSignOff(actor, txn) != nil {
+		return nil, err
+	}
+	for i := range delegators {
+		if delegators[i].ID != actor.ID && check(company, &delegators[i], txn, event) == nil {
+			return &delegators[i], nil
+		}
+	}
+	return nil, err
+}
+
+// authority is Authority with the actor's delegators loaded, which only happens
+// when their own authority is not enough
+func authority(ctx context.Context, repos *repository.Repositories, company *models.Company, actor *models.User, txn *models.Transaction, event Event) (*models.User, error) {
+	if err := check(company, actor, txn, event); err == nil {
+		return actor, nil
+	}
+	delegators, err := Delegators(ctx, repos, actor)
+	if err != nil {
+		return nil, err
+	}
+	return Authority(company, actor, delegators, txn, event)
+}
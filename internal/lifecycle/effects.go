@@ -0,0 +1,69 @@
+package lifecycle
+
+import (
+	"context"
+
+	"github.com/minhtranin/ct/internal/budgeting"
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// postApproved moves the money of an approved transaction and counts an
+// expense toward its budgets
+func postApproved(ctx context.Context, repos *repository.Repositories, actor *models.User, txn *models.Transaction, in Input) error {
+	if err := post(ctx, repos, txn); err != nil {
+		return err
+	}
+	return budgeting.Refresh(ctx, repos, txn)
+}
+
+// postReversal undoes a voided transaction with an approved reversal and, for a
+// correction, submits the replacement in its place
+func postReversal(ctx context.Context, repos *repository.Repositories, actor *models.User, txn *models.Transaction, in Input) error {
+	reversal := models.NewReversal(txn, actor.ID, actor.Name)
+	var replacementID primitive.ObjectID
+	if in.Replacement != nil {
+		replacementID = in.Replacement.ID
+	} else {
+		reversal.Description = "Void of " + txn.Description
+	}
+
+	// Only matches an unreversed original, so a transaction cannot be reversed twice
+	if _, err := repos.Transactions.MarkReversed(ctx, txn.ID, reversal.ID, replacementID); err != nil {
+		return err
+	}
+	if err := repos.Transactions.Create(ctx, reversal); err != nil {
+		return err
+	}
+	if err := post(ctx, repos, reversal); err != nil {
+		return err
+	}
+	// The original no longer counts toward the budgets of the period it was dated in
+	if err := budgeting.Refresh(ctx, repos, txn); err != nil {
+		return err
+	}
+	if in.Replacement != nil {
+		in.Replacement.ReplacesID = txn.ID
+		return repos.Transactions.Create(ctx, in.Replacement)
+	}
+	return nil
+}
+
+// post records a transaction that moves money: it posts the journal entry and
+// updates account balances
+func post(ctx context.Context, repos *repository.Repositories, txn *models.Transaction) error {
+	entry, err := models.NewJournalEntry(txn)
+	if err != nil {
+		return err
+	}
+	if err := repos.Journal.Post(ctx, entry); err != nil {
+		return err
+	}
+	for _, change := range txn.BalanceChanges() {
+		if err := repos.Accounts.AdjustBalance(ctx, change.AccountID, change.Delta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/minhtranin/ct/internal/auth"
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/repository"
+)
+
+// escalationRoles are the roles an overdue step can be escalated to, lowest first
+var escalationRoles = []auth.Role{auth.RoleHolder, auth.RoleAccountant, auth.RoleManager, auth.RoleAdmin, auth.RoleSuperAdmin}
+
+// Escalation is a pending transaction whose approval step waited past the SLA
+type Escalation struct {
+	Transaction models.Transaction
+	Step        Step
+	Level       int       // 1 after one SLA period, 2 after two, and so on
+	Role        auth.Role // The role it is escalated to
+	Waiting     time.Duration
+	// Who to notify: members at the lowest role from Role up that has any,
+	// other than the transaction's creator
+	Recipients []models.User
+}
+
+// Overdue returns how many whole SLA periods txn's current approval step has
+// waited at now under company's policy; zero when it is within the SLA or the
+// company has none
+func Overdue(company *models.Company, txn *models.Transaction, now time.Time) int {
+	policy, _ := approvals(company)
+	sla := policy.SLA()
+	if sla <= 0 || !txn.IsPending() {
+		return 0
+	}
+	return int(now.Sub(txn.WaitingSince()) / sla)
+}
+
+// EscalationRole returns the role a step escalated level times goes to: level
+// roles above the one that may sign it off, up to a super admin
+func EscalationRole(step Step, level int) auth.Role {
+	return escalationRoles[escalationIndex(step)+min(level, maxEscalation(step))]
+}
+
+// maxEscalation is how many levels step can rise before it reaches the top role
+func maxEscalation(step Step) int {
+	return max(1, len(escalationRoles)-1-escalationIndex(step))
+}
+
+// escalationIndex is where step's role sits among escalationRoles; a step no
+// role's limit covers starts just below the top
+func escalationIndex(step Step) int {
+	if i := slices.Index(escalationRoles, step.Role); i >= 0 && i < len(escalationRoles)-1 {
+		return i
+	}
+	return len(escalationRoles) - 2
+}
+
+// Escalate raises every pending transaction whose current approval step has
+// waited past the company's SLA and returns the ones it raised. Each level is
+// raised once, even across concurrent runs, notified in-app to its recipients
+// and recorded in the audit trail as done by actor. Steps stop rising once they
+// reach a super admin.
+//
+// A level that was raised is always returned, so that callers can still email
+// its recipients; failing to notify or audit it doesn't stop the others, and
+// comes back joined in the error.
+func Escalate(ctx context.Context, repos *repository.Repositories, actor *models.User, now time.Time) ([]Escalation, error) {
+	company, err := repos.Company.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if company.Approvals.SLAHours <= 0 {
+		return nil, nil
+	}
+	pending, err := repos.Transactions.List(ctx, repository.TransactionFilter{
+		Status: models.TransactionStatusPending,
+	}, repository.Page{})
+	if err != nil {
+		return nil, err
+	}
+
+	var users []models.User
+	var escalations []Escalation
+	var errs []error
+	for i := range pending {
+		txn := &pending[i]
+		periods := Overdue(company, txn, now)
+		if periods == 0 {
+			continue
+		}
+		step := CurrentStep(company, txn)
+		level := min(periods, maxEscalation(step))
+		if level <= txn.EscalationLevel {
+			continue
+		}
+
+		escalated, err := repos.Transactions.Escalate(ctx, txn.ID, txn.ApprovalStep, level, now)
+		if errors.Is(err, repository.ErrStatusChanged) {
+			// Decided, or escalated by another run, since it was listed
+			continue
+		}
+		if err != nil {
+			return escalations, errors.Join(append(errs, err)...)
+		}
+
+		if users == nil {
+			if users, err = repos.Users.List(ctx); err != nil {
+				return escalations, errors.Join(append(errs, err)...)
+			}
+		}
+		role := EscalationRole(step, level)
+		escalation := Escalation{
+			Transaction: *escalated,
+			Step:        step,
+			Level:       level,
+			Role:        role,
+			Waiting:     now.Sub(txn.WaitingSince()),
+			Recipients:  escalationRecipients(users, role, txn),
+		}
+		escalations = append(escalations, escalation)
+
+		notified := 0
+		title, message := escalationNotice(escalation)
+		for _, recipient := range escalation.Recipients {
+			notification := models.NewNotification(recipient.ID, title, message, "/approvals")
+			if err := repos.Notifications.Create(ctx, notification); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			notified++
+		}
+
+		entry := models.NewAuditLog(models.AuditActionEscalate, models.AuditEntityTransaction, txn.ID, actor.ID, repos.Scope.CompanyID(), actor.Name, actor.Email).
+			WithChanges(map[string]interface{}{
+				"step":          step.Name,
+				"level":         level,
+				"role":          string(role),
+				"waiting_hours": int(escalation.Waiting.Hours()),
+				"notified":      notified,
+			})
+		if err := repos.AuditLogs.Insert(ctx, entry); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return escalations, errors.Join(errs...)
+}
+
+// escalationNotice is the in-app notification of an escalation for each of its recipients
+func escalationNotice(e Escalation) (title, message string) {
+	txn := e.Transaction
+	title = fmt.Sprintf("Overdue approval: %s (%s)", txn.Description, txn.Amount.Format(txn.Currency))
+	message = fmt.Sprintf("%s, submitted by %s, has waited %.0f hours at the %s step and was escalated to %s approvers.",
+		txn.Description, txn.CreatedByName, e.Waiting.Hours(), e.Step.Name, auth.RoleDisplayName(string(e.Role)))
+	return title, message
+}
+
+// escalationRecipients returns the members at the lowest role from role up to a
+// super admin that has any, leaving out txn's creator
+func escalationRecipients(users []models.User, role auth.Role, txn *models.Transaction) []models.User {
+	for _, r := range escalationRoles[slices.Index(escalationRoles, role):] {
+		var recipients []models.User
+		for _, u := range users {
+			if auth.Role(u.Role) == r && u.ID != txn.CreatedByID {
+				recipients = append(recipients, u)
+			}
+		}
+		if len(recipients) > 0 {
+			return recipients
+		}
+	}
+	return nil
+}
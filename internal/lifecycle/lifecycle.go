@@ -0,0 +1,299 @@
+// Package lifecycle is the transaction state machine.
+//
+// Every status change goes through Fire, which checks that the event is allowed
+// from the transaction's current status and by the acting user, moves the status
+// with a compare-and-set, and runs the event's side effects in the same atomic
+// write:
+//
+//	draft    --submit-->   pending
+//	pending  --withdraw--> draft
+//	pending  --approve-->  pending    signs off one step when more of its approval chain remain
+//	pending  --approve-->  approved   posts the journal entry, balances and budget spend
+//	pending  --reject-->   rejected
+//	rejected --resubmit--> pending
+//	approved --pay-->      paid
+//	approved --void-->     voided     posts a reversal, and a replacement for a correction
+//	paid     --void-->     voided
+//
+// Drafts, pending and rejected transactions can be edited or deleted by their
+// creator. Posted ones never change; they are voided instead.
+//
+// Approving and rejecting also follow the company's approval policy: creators
+// may not decide their own transactions unless the policy allows it, and nobody
+// may decide or void more than their approval limit. Transactions matching one
+// of the policy's workflows need a sign-off for each of its steps instead, in
+// order; CurrentStep says which one is next. Every decision is kept in the
+// transaction's approval history.
+//
+// An approver may delegate their authority to approve and reject while they are
+// away. A delegate who cannot decide a transaction themselves may decide it with
+// a delegator's authority, and the decision records on whose behalf it was made.
+//
+// A company may set an SLA for approval steps. Escalate raises steps that have
+// waited longer to the next role up, one more level for every further SLA period.
+//
+// Submitting an expense checks the open budgets it falls in. A budget set to
+// block refuses one that would take it over its limit with
+// models.ErrBudgetExceeded, and one set to ask for approval adds a final
+// "Budget override" step to its approval chain.
+package lifecycle
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/minhtranin/ct/internal/auth"
+	"github.com/minhtranin/ct/internal/budgeting"
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/repository"
+)
+
+// Event is something a user does to a transaction that changes its status
+type Event string
+
+const (
+	EventSubmit   Event = "submit"
+	EventWithdraw Event = "withdraw"
+	EventApprove  Event = "approve"
+	EventReject   Event = "reject"
+	EventResubmit Event = "resubmit"
+	EventPay      Event = "pay"
+	EventVoid     Event = "void"
+)
+
+var (
+	// ErrInvalidTransition is returned when the event does not apply to the transaction's status
+	ErrInvalidTransition = errors.New("lifecycle: not allowed from the current status")
+	// ErrNotPermitted is returned when the acting user may not perform the event
+	ErrNotPermitted = errors.New("lifecycle: not permitted")
+)
+
+// Input carries what some events need besides the transaction and the acting user
+type Input struct {
+	Reason      string              // Reject: why it is returned to its creator
+	Comment     string              // Approve: a note kept with the sign-off
+	Replacement *models.Transaction // Void: a corrected copy to submit in its place
+}
+
+// Hook is a side effect of an event. It runs after the status change and inside
+// the same atomic write, so returning an error undoes the whole event.
+type Hook func(ctx context.Context, repos *repository.Repositories, actor *models.User, txn *models.Transaction, in Input) error
+
+// transition is one edge of the state machine
+type transition struct {
+	from    []models.TransactionStatus
+	to      models.TransactionStatus
+	allowed func(actor *models.User, txn *models.Transaction) bool
+	// Company rules on top of allowed
+	policy func(company *models.Company, actor *models.User, txn *models.Transaction) error
+	// Decides the current approval step, and is kept in the approval history
+	signOff bool
+	// Sends it for approval, so the budgets it would go over have their say
+	submit  bool
+	effects []Hook
+}
+
+var transitions = map[Event]transition{
+	EventSubmit: {
+		from:    []models.TransactionStatus{models.TransactionStatusDraft},
+		to:      models.TransactionStatusPending,
+		allowed: isCreator,
+		submit:  true,
+	},
+	EventWithdraw: {
+		from:    []models.TransactionStatus{models.TransactionStatusPending},
+		to:      models.TransactionStatusDraft,
+		allowed: isCreator,
+	},
+	EventApprove: {
+		from:    []models.TransactionStatus{models.TransactionStatusPending},
+		to:      models.TransactionStatusApproved,
+		allowed: isApprover,
+		policy:  decisionPolicy,
+		signOff: true,
+		effects: []Hook{postApproved},
+	},
+	EventReject: {
+		from:    []models.TransactionStatus{models.TransactionStatusPending},
+		to:      models.TransactionStatusRejected,
+		allowed: isApprover,
+		policy:  decisionPolicy,
+		signOff: true,
+	},
+	EventResubmit: {
+		from:    []models.TransactionStatus{models.TransactionStatusRejected},
+		to:      models.TransactionStatusPending,
+		allowed: isCreator,
+		submit:  true,
+	},
+	EventPay: {
+		from: []models.TransactionStatus{models.TransactionStatusApproved},
+		to:   models.TransactionStatusPaid,
+		allowed: func(actor *models.User, txn *models.Transaction) bool {
+			return auth.CanSettle(actor.Role) && !txn.IsReversal()
+		},
+	},
+	EventVoid: {
+		from: []models.TransactionStatus{models.TransactionStatusApproved, models.TransactionStatusPaid},
+		to:   models.TransactionStatusVoided,
+		// A reversal is final; voiding it would re-apply the original
+		allowed: func(actor *models.User, txn *models.Transaction) bool {
+			return isApprover(actor, txn) && !txn.IsReversal()
+		},
+		// Undoing a transaction moves as much money as approving it
+		policy: func(company *models.Company, actor *models.User, txn *models.Transaction) error {
+			policy, currency := approvals(company)
+			if !policy.WithinLimit(actor, txn, currency) {
+				return models.ErrApprovalLimit
+			}
+			return nil
+		},
+		effects: []Hook{postReversal},
+	},
+}
+
+// hooks are the side effects registered with OnTransition
+var hooks = map[Event][]Hook{}
+
+// OnTransition adds a side effect to run after every successful event. Register
+// hooks during start-up; they run after the built-in effects.
+func OnTransition(event Event, hook Hook) {
+	hooks[event] = append(hooks[event], hook)
+}
+
+// isCreator allows only the user who created the transaction
+func isCreator(actor *models.User, txn *models.Transaction) bool {
+	return actor.ID == txn.CreatedByID
+}
+
+// isApprover allows users who may approve transactions
+func isApprover(actor *models.User, txn *models.Transaction) bool {
+	return auth.CanApprove(actor.Role)
+}
+
+// Can reports whether actor may perform event on txn as it is now under company's
+// approval policy; a nil company means the default policy
+func Can(company *models.Company, actor *models.User, txn *models.Transaction, event Event) bool {
+	return check(company, actor, txn, event) == nil
+}
+
+// check returns why actor may not perform event on txn, or nil
+func check(company *models.Company, actor *models.User, txn *models.Transaction, event Event) error {
+	t, ok := transitions[event]
+	if !ok || !slices.Contains(t.from, txn.Status) {
+		return ErrInvalidTransition
+	}
+	if !t.allowed(actor, txn) {
+		return ErrNotPermitted
+	}
+	if t.policy != nil {
+		return t.policy(company, actor, txn)
+	}
+	return nil
+}
+
+// CanEdit reports whether actor may change txn in place
+func CanEdit(actor *models.User, txn *models.Transaction) bool {
+	return !txn.IsPosted() && isCreator(actor, txn)
+}
+
+// CanDelete reports whether actor may delete txn outright
+func CanDelete(actor *models.User, txn *models.Transaction) bool {
+	return CanEdit(actor, txn)
+}
+
+// Fire performs event on txn, as the caller loaded it, and returns the transaction as changed.
+// A company policy violation is returned as one of the models approval errors, such
+// as models.ErrSelfApproval.
+func Fire(ctx context.Context, repos *repository.Repositories, actor *models.User, txn *models.Transaction, event Event, in Input) (*models.Transaction, error) {
+	t, ok := transitions[event]
+	var company *models.Company
+	var err error
+	if ok && t.policy != nil {
+		if company, err = repos.Company.Get(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	// Approving and rejecting may use authority delegated to the actor
+	principal := actor
+	if t.signOff {
+		principal, err = authority(ctx, repos, company, actor, txn, event)
+	} else {
+		err = check(company, actor, txn, event)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// A budget may refuse the expense outright or ask for an extra sign-off
+	var override bool
+	if t.submit {
+		impacts, err := budgeting.Assess(ctx, repos, txn)
+		if err != nil {
+			return nil, err
+		}
+		if override, err = budgeting.Enforce(impacts); err != nil {
+			return nil, err
+		}
+	}
+
+	var record *models.ApprovalRecord
+	final := true
+	if t.signOff {
+		step := CurrentStep(company, txn)
+		final = t.to != models.TransactionStatusApproved || step.Number >= step.Of
+		record = &models.ApprovalRecord{
+			Step:         step.Number,
+			StepName:     step.Name,
+			Status:       t.to,
+			ApproverID:   actor.ID,
+			ApproverName: actor.Name,
+			Comment:      cmp.Or(in.Comment, in.Reason),
+			WaitingSince: txn.WaitingSince(),
+			At:           time.Now(),
+		}
+		if principal.ID != actor.ID {
+			record.OnBehalfOfID = principal.ID
+			record.OnBehalfOfName = principal.Name
+		}
+	}
+
+	var changed *models.Transaction
+	err = repos.Atomic(ctx, func(ctx context.Context) error {
+		var err error
+		if !final {
+			// More steps remain, so the transaction stays pending for the next approver
+			changed, err = repos.Transactions.SignOff(ctx, txn.ID, txn.ApprovalStep, *record)
+			return err
+		}
+
+		// Expecting the status the checks above saw means a concurrent change
+		// makes this one fail with repository.ErrStatusChanged
+		changed, err = repos.Transactions.ChangeStatus(ctx, txn.ID, repository.StatusChange{
+			From:   txn.Status,
+			To:     t.to,
+			Actor:  actor,
+			Reason: in.Reason,
+			Record: record,
+
+			BudgetOverride: override,
+		})
+		if err != nil {
+			return err
+		}
+		for _, hook := range slices.Concat(t.effects, hooks[event]) {
+			if err := hook(ctx, repos, actor, changed, in); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
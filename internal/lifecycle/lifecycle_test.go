@@ -0,0 +1,348 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/minhtranin/ct/internal/auth"
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var statuses = []models.TransactionStatus{
+	models.TransactionStatusDraft,
+	models.TransactionStatusPending,
+	models.TransactionStatusApproved,
+	models.TransactionStatusRejected,
+	models.TransactionStatusPaid,
+	models.TransactionStatusVoided,
+}
+
+// testRepos is a company in a fresh memory store
+func testRepos(t *testing.T) *repository.Repositories {
+	t.Helper()
+	_, repos := repository.NewTestRepos(t, models.Company{})
+	return repos
+}
+
+func member(repos *repository.Repositories, role auth.Role) *models.User {
+	return &models.User{ID: primitive.NewObjectID(), Name: string(role), Role: string(role), CompanyID: repos.Scope.CompanyID()}
+}
+
+// stored saves an expense by creator in status
+func stored(t *testing.T, repos *repository.Repositories, creator *models.User, status models.TransactionStatus) *models.Transaction {
+	t.Helper()
+	txn := models.NewTransaction(models.TransactionTypeExpense, 10_00, "USD", repos.Scope.CompanyID(), creator.ID, creator.Name)
+	txn.ID = primitive.NewObjectID()
+	txn.Status = status
+	if err := repos.Transactions.Create(context.Background(), txn); err != nil {
+		t.Fatal(err)
+	}
+	return txn
+}
+
+func assertStatus(t *testing.T, repos *repository.Repositories, txn *models.Transaction, want models.TransactionStatus) {
+	t.Helper()
+	got, err := repos.Transactions.Get(context.Background(), txn.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != want || len(got.ApprovalHistory) != 0 {
+		t.Errorf("stored as %s with %d sign-offs, want it left %s", got.Status, len(got.ApprovalHistory), want)
+	}
+}
+
+func TestFireRejectsIllegalTransitions(t *testing.T) {
+	for event, edge := range transitions {
+		for _, status := range statuses {
+			if slices.Contains(edge.from, status) {
+				continue
+			}
+			t.Run(string(event)+" from "+string(status), func(t *testing.T) {
+				repos := testRepos(t)
+				// An admin who created it may do everything else, so only the status is wrong
+				admin := member(repos, auth.RoleAdmin)
+				txn := stored(t, repos, admin, status)
+
+				if _, err := Fire(context.Background(), repos, admin, txn, event, Input{Reason: "No"}); !errors.Is(err, ErrInvalidTransition) {
+					t.Fatalf("Fire returned %v, want ErrInvalidTransition", err)
+				}
+				assertStatus(t, repos, txn, status)
+			})
+		}
+	}
+}
+
+func TestFireRejectsUnknownEvents(t *testing.T) {
+	repos := testRepos(t)
+	admin := member(repos, auth.RoleAdmin)
+	txn := stored(t, repos, admin, models.TransactionStatusPending)
+
+	if _, err := Fire(context.Background(), repos, admin, txn, Event("archive"), Input{}); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("Fire returned %v, want ErrInvalidTransition", err)
+	}
+	assertStatus(t, repos, txn, models.TransactionStatusPending)
+}
+
+func TestFireRefusesActorsNotPermitted(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    Event
+		from     models.TransactionStatus
+		actor    auth.Role
+		reversal bool
+	}{
+		{"submit someone else's draft", EventSubmit, models.TransactionStatusDraft, auth.RoleAdmin, false},
+		{"withdraw someone else's", EventWithdraw, models.TransactionStatusPending, auth.RoleAdmin, false},
+		{"resubmit someone else's", EventResubmit, models.TransactionStatusRejected, auth.RoleAdmin, false},
+		{"employee approves", EventApprove, models.TransactionStatusPending, auth.RoleEmployee, false},
+		{"employee rejects", EventReject, models.TransactionStatusPending, auth.RoleEmployee, false},
+		{"holder pays", EventPay, models.TransactionStatusApproved, auth.RoleHolder, false},
+		{"employee voids", EventVoid, models.TransactionStatusApproved, auth.RoleEmployee, false},
+		{"paying a reversal", EventPay, models.TransactionStatusApproved, auth.RoleAdmin, true},
+		{"voiding a reversal", EventVoid, models.TransactionStatusApproved, auth.RoleAdmin, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repos := testRepos(t)
+			actor := member(repos, tt.actor)
+			creator := member(repos, auth.RoleEmployee)
+			txn := models.NewTransaction(models.TransactionTypeExpense, 10_00, "USD", repos.Scope.CompanyID(), creator.ID, creator.Name)
+			txn.ID = primitive.NewObjectID()
+			txn.Status = tt.from
+			if tt.reversal {
+				txn.ReversesID = primitive.NewObjectID()
+			}
+			if err := repos.Transactions.Create(context.Background(), txn); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := Fire(context.Background(), repos, actor, txn, tt.event, Input{Reason: "No"}); !errors.Is(err, ErrNotPermitted) {
+				t.Fatalf("Fire returned %v, want ErrNotPermitted", err)
+			}
+			assertStatus(t, repos, txn, tt.from)
+		})
+	}
+}
+
+func TestFireSeesConcurrentChanges(t *testing.T) {
+	repos := testRepos(t)
+	creator := member(repos, auth.RoleEmployee)
+	txn := stored(t, repos, creator, models.TransactionStatusPending)
+
+	// The caller's copy is still pending, but it was withdrawn in the meantime
+	if _, err := Fire(context.Background(), repos, creator, txn, EventWithdraw, Input{}); err != nil {
+		t.Fatal(err)
+	}
+	manager := member(repos, auth.RoleManager)
+	if _, err := Fire(context.Background(), repos, manager, txn, EventApprove, Input{}); !errors.Is(err, repository.ErrStatusChanged) {
+		t.Fatalf("approving a stale copy returned %v, want repository.ErrStatusChanged", err)
+	}
+	assertStatus(t, repos, txn, models.TransactionStatusDraft)
+}
+
+// moneyFixture stores a cash account holding 100.00 and a budget, and a pending
+// 30.00 expense by creator paid from the account in the budget's category
+func moneyFixture(t *testing.T, repos *repository.Repositories, creator *models.User) (*models.Account, *models.Budget, *models.Transaction) {
+	t.Helper()
+	ctx := context.Background()
+	account := models.NewAccount("Cash", models.AccountTypeCash, "USD", repos.Scope.CompanyID())
+	account.ID = primitive.NewObjectID()
+	account.Balance = 100_00
+	if err := repos.Accounts.Create(ctx, account); err != nil {
+		t.Fatal(err)
+	}
+	category := primitive.NewObjectID()
+	budget := models.NewBudget("Travel", category, 500_00, "USD", models.BudgetPeriodMonthly, repos.Scope.CompanyID())
+	budget.ID = primitive.NewObjectID()
+	if err := repos.Budgets.Create(ctx, budget); err != nil {
+		t.Fatal(err)
+	}
+	txn := models.NewTransaction(models.TransactionTypeExpense, 30_00, "USD", repos.Scope.CompanyID(), creator.ID, creator.Name)
+	txn.ID = primitive.NewObjectID()
+	txn.FromAccountID = account.ID
+	txn.CategoryID = category
+	if err := repos.Transactions.Create(ctx, txn); err != nil {
+		t.Fatal(err)
+	}
+	return account, budget, txn
+}
+
+func TestFireApprovePostsAndVoidReverses(t *testing.T) {
+	ctx := context.Background()
+	repos := testRepos(t)
+	account, budget, txn := moneyFixture(t, repos, member(repos, auth.RoleEmployee))
+	manager := member(repos, auth.RoleManager)
+
+	approved, err := Fire(ctx, repos, manager, txn, EventApprove, Input{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := repos.Accounts.Get(ctx, account.ID); got.Balance != 70_00 {
+		t.Errorf("balance after approval = %d, want %d", got.Balance, 70_00)
+	}
+	if got, _ := repos.Budgets.Get(ctx, budget.ID); got.Spent != 30_00 {
+		t.Errorf("budget spend after approval = %d, want %d", got.Spent, 30_00)
+	}
+	if _, err := repos.Journal.ForTransaction(ctx, txn.ID); err != nil {
+		t.Errorf("no journal entry for the approved transaction: %v", err)
+	}
+
+	if _, err := Fire(ctx, repos, manager, approved, EventVoid, Input{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := repos.Accounts.Get(ctx, account.ID); got.Balance != 100_00 {
+		t.Errorf("balance after void = %d, want %d", got.Balance, 100_00)
+	}
+	if got, _ := repos.Budgets.Get(ctx, budget.ID); got.Spent != 0 {
+		t.Errorf("budget spend after void = %d, want 0", got.Spent)
+	}
+	voided, err := repos.Transactions.Get(ctx, txn.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if voided.Status != models.TransactionStatusVoided || !voided.IsReversed() {
+		t.Fatalf("stored as %s without a reversal, want it voided and reversed", voided.Status)
+	}
+	if _, err := repos.Journal.ForTransaction(ctx, voided.ReversedByID); err != nil {
+		t.Errorf("no journal entry for the reversal: %v", err)
+	}
+}
+
+func TestFireApproveRollsBackOnFailure(t *testing.T) {
+	ctx := context.Background()
+	repos := testRepos(t)
+	account, _, _ := moneyFixture(t, repos, member(repos, auth.RoleEmployee))
+
+	// A transfer to an account that does not exist fails on the second balance
+	// update, after the journal entry and the source balance were written
+	creator := member(repos, auth.RoleEmployee)
+	txn := models.NewTransaction(models.TransactionTypeTransfer, 30_00, "USD", repos.Scope.CompanyID(), creator.ID, creator.Name)
+	txn.ID = primitive.NewObjectID()
+	txn.FromAccountID = account.ID
+	txn.ToAccountID = primitive.NewObjectID()
+	if err := repos.Transactions.Create(ctx, txn); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Fire(ctx, repos, member(repos, auth.RoleManager), txn, EventApprove, Input{}); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("Fire returned %v, want repository.ErrNotFound", err)
+	}
+	assertStatus(t, repos, txn, models.TransactionStatusPending)
+	if got, _ := repos.Accounts.Get(ctx, account.ID); got.Balance != 100_00 {
+		t.Errorf("balance after a failed approval = %d, want %d", got.Balance, 100_00)
+	}
+	if entry, err := repos.Journal.ForTransaction(ctx, txn.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("after a failed approval the ledger has %+v (%v), want no entry", entry, err)
+	}
+}
+
+func TestFireAppliesTheApprovalPolicy(t *testing.T) {
+	policy := models.ApprovalPolicy{RoleLimits: map[string]models.Money{"manager": 5_00}}
+	tests := []struct {
+		name  string
+		event Event
+		from  models.TransactionStatus
+		own   bool // Whether the actor created the transaction
+		want  error
+	}{
+		{"approving their own", EventApprove, models.TransactionStatusPending, true, models.ErrSelfApproval},
+		{"rejecting their own", EventReject, models.TransactionStatusPending, true, models.ErrSelfApproval},
+		{"approving over the limit", EventApprove, models.TransactionStatusPending, false, models.ErrApprovalLimit},
+		{"voiding over the limit", EventVoid, models.TransactionStatusApproved, false, models.ErrApprovalLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, repos := repository.NewTestRepos(t, models.Company{Approvals: policy})
+			manager := member(repos, auth.RoleManager)
+			creator := member(repos, auth.RoleEmployee)
+			if tt.own {
+				creator = manager
+			}
+			// 10.00 is over the manager's limit, but self-approval is checked first
+			txn := stored(t, repos, creator, tt.from)
+
+			if _, err := Fire(context.Background(), repos, manager, txn, tt.event, Input{Reason: "No"}); !errors.Is(err, tt.want) {
+				t.Fatalf("Fire returned %v, want %v", err, tt.want)
+			}
+			assertStatus(t, repos, txn, tt.from)
+		})
+	}
+}
+
+func TestCurrentStep(t *testing.T) {
+	company := &models.Company{Currency: "USD", Approvals: models.ApprovalPolicy{
+		RoleLimits: map[string]models.Money{"holder": 100_00, "accountant": 1_000_00, "manager": 10_000_00, "admin": 100_000_00, "super_admin": 100_000_00, "developer": 100_000_00},
+	}}
+	tests := []struct {
+		amount models.Money
+		want   auth.Role
+	}{
+		{100_00, auth.RoleHolder},
+		{100_01, auth.RoleAccountant},
+		{10_000_00, auth.RoleManager},
+		{100_000_00, auth.RoleAdmin},
+		{100_000_01, ""},
+	}
+	for _, tt := range tests {
+		txn := models.NewTransaction(models.TransactionTypeExpense, tt.amount, "USD", primitive.NewObjectID(), primitive.NewObjectID(), "Alice")
+		want := Step{Number: 1, Of: 1, Name: "Approval", Role: tt.want}
+		if got := CurrentStep(company, txn); got != want {
+			t.Errorf("CurrentStep for %d = %+v, want %+v", tt.amount, got, want)
+		}
+	}
+
+	// A workflow replaces the limits, and a shortened one ends at its last step
+	company.Approvals.Workflows = []models.ApprovalWorkflow{{Name: "Large", MinAmount: 1_000_00, Steps: twoSteps}}
+	txn := models.NewTransaction(models.TransactionTypeExpense, 100_000_01, "USD", primitive.NewObjectID(), primitive.NewObjectID(), "Alice")
+	for approvalStep, want := range []Step{
+		{Number: 1, Of: 2, Name: "Manager", Role: auth.RoleManager},
+		{Number: 2, Of: 2, Name: "Finance", Role: auth.RoleAdmin},
+		{Number: 2, Of: 2, Name: "Finance", Role: auth.RoleAdmin},
+	} {
+		txn.ApprovalStep = approvalStep
+		if got := CurrentStep(company, txn); got != want {
+			t.Errorf("CurrentStep after %d sign-offs = %+v, want %+v", approvalStep, got, want)
+		}
+	}
+}
+
+var twoSteps = []models.ApprovalStep{{Name: "Manager", Role: string(auth.RoleManager)}, {Name: "Finance", Role: string(auth.RoleAdmin)}}
+
+func TestFireWalksTheWorkflow(t *testing.T) {
+	ctx := context.Background()
+	_, repos := repository.NewTestRepos(t, models.Company{Approvals: models.ApprovalPolicy{
+		Workflows: []models.ApprovalWorkflow{{Name: "Everything", Steps: twoSteps}},
+	}})
+	manager := member(repos, auth.RoleManager)
+	txn := stored(t, repos, member(repos, auth.RoleEmployee), models.TransactionStatusPending)
+
+	first, err := Fire(ctx, repos, manager, txn, EventApprove, Input{Comment: "Fine"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Status != models.TransactionStatusPending || first.ApprovalStep != 1 || len(first.ApprovalHistory) != 1 {
+		t.Fatalf("after the first step: %s at step %d with %d sign-offs, want pending at step 1 with one", first.Status, first.ApprovalStep, len(first.ApprovalHistory))
+	}
+	if record := first.ApprovalHistory[0]; record.Step != 1 || record.StepName != "Manager" || record.ApproverID != manager.ID || record.Comment != "Fine" {
+		t.Errorf("first sign-off recorded as %+v", record)
+	}
+
+	if _, err := Fire(ctx, repos, manager, first, EventApprove, Input{}); !errors.Is(err, models.ErrAlreadySignedOff) {
+		t.Errorf("signing off a second step returned %v, want models.ErrAlreadySignedOff", err)
+	}
+	if _, err := Fire(ctx, repos, member(repos, auth.RoleManager), first, EventApprove, Input{}); !errors.Is(err, models.ErrApprovalStep) {
+		t.Errorf("a manager signing off the admin step returned %v, want models.ErrApprovalStep", err)
+	}
+
+	final, err := Fire(ctx, repos, member(repos, auth.RoleAdmin), first, EventApprove, Input{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if final.Status != models.TransactionStatusApproved || len(final.ApprovalHistory) != 2 {
+		t.Errorf("after the last step: %s with %d sign-offs, want approved with two", final.Status, len(final.ApprovalHistory))
+	}
+}
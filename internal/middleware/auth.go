@@ -7,19 +7,29 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/minhtranin/ct/internal/auth"
 	"github.com/minhtranin/ct/internal/handler"
+	"github.com/minhtranin/ct/internal/repository"
 	"github.com/minhtranin/ct/internal/view/shared/toast"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// twoFactorExempt lists the paths a user can still reach before enrolling in required 2FA
+var twoFactorExempt = map[string]bool{
+	"/account/2fa":            true,
+	"/api/account/2fa/enable": true,
+}
+
 // RequireAuth checks if the user is authenticated and loads user info into context
 func RequireAuth() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Log for debugging
 		fmt.Println("[DEBUG] RequireAuth called for path:", c.Path())
 
+		// Look up the server-side session; expired or revoked sessions are rejected here
 		userID, err := handler.GetSession(c)
 		if err != nil || userID == "" {
+			if c.Cookies(auth.SessionCookieName) != "" {
+				handler.ClearSession(c)
+			}
 			// Return toast for HTMX requests, redirect for regular requests
 			if c.Get("HX-Requested-With") == "true" || c.Get("HX-Request") == "true" {
 				c.Set("Content-Type", "text/html")
@@ -38,21 +48,12 @@ func RequireAuth() fiber.Handler {
 		}
 
 		// Fetch user from database and store in context
-		db := handler.GetDB()
-		usersCollection := db.Database("ct").Collection("users")
-		var user struct {
-			ID    string `bson:"_id"`
-			Role  string `bson:"role"`
-			Email string `bson:"email"`
-		}
-
-		// Convert hex string to ObjectID for MongoDB query
 		objectID, err := primitive.ObjectIDFromHex(userID)
 		if err != nil {
 			return c.Redirect("/signin")
 		}
 
-		err = usersCollection.FindOne(c.Context(), bson.M{"_id": objectID}).Decode(&user)
+		user, err := handler.Identities().FindByID(c.Context(), objectID)
 		if err != nil {
 			// User not found in database - return toast
 			if c.Get("HX-Requested-With") == "true" || c.Get("HX-Request") == "true" {
@@ -71,11 +72,27 @@ func RequireAuth() fiber.Handler {
 			return c.Redirect("/signin")
 		}
 
+		// Approvers must enroll in 2FA before doing anything else when the company enforces it
+		if !user.TOTPEnabled && auth.RequiresTwoFactor(user.Role) && !twoFactorExempt[c.Path()] &&
+			handler.CompanyRequiresTwoFactor(c, user.CompanyID) {
+			if c.Get("HX-Requested-With") == "true" || c.Get("HX-Request") == "true" {
+				c.Set("HX-Redirect", "/account/2fa")
+				return c.SendStatus(fiber.StatusOK)
+			}
+			return c.Redirect("/account/2fa?error=Your+company+requires+two-factor+authentication")
+		}
+
 		// Store user info in context for middleware to use
+		if session, err := handler.CurrentSession(c); err == nil {
+			c.Locals("sessionID", session.ID.Hex())
+		}
 		c.Locals("userID", userID)
 		c.Locals("userRole", user.Role)
 		c.Locals("userEmail", user.Email)
 
+		// Every repository used by the handler is pinned to this user's company
+		repository.Bind(c, user.CompanyID)
+
 		return c.Next()
 	}
 }
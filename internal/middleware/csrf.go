@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minhtranin/ct/internal/auth"
+	"github.com/minhtranin/ct/internal/logger"
+	"github.com/minhtranin/ct/internal/view/shared/toast"
+)
+
+// csrfCookieTTL keeps the token stable across sessions on the same browser
+const csrfCookieTTL = 30 * 24 * time.Hour
+
+// CSRF protects state-changing requests with a double-submit token.
+// Every response carries the token in a cookie and in the rendered page; POST, PUT, PATCH
+// and DELETE requests must echo it back in the X-CSRF-Token header or the _csrf form field.
+func CSRF() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := c.Cookies(auth.CSRFCookieName)
+		if token == "" {
+			var err error
+			token, err = auth.GenerateToken()
+			if err != nil {
+				logger.Error("CSRF", "Failed to generate token: "+err.Error())
+				return c.Status(fiber.StatusInternalServerError).SendString("Internal server error")
+			}
+			c.Cookie(&fiber.Cookie{
+				Name:     auth.CSRFCookieName,
+				Value:    token,
+				HTTPOnly: true,
+				Secure:   c.Protocol() == "https",
+				SameSite: "lax",
+				MaxAge:   int(csrfCookieTTL.Seconds()),
+			})
+		}
+		c.Locals(auth.CSRFLocalsKey, token)
+
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions, fiber.MethodTrace:
+			return c.Next()
+		}
+
+		submitted := c.Get(auth.CSRFHeaderName)
+		if submitted == "" {
+			submitted = c.FormValue(auth.CSRFFormField)
+		}
+		if auth.ValidCSRFToken(c.Cookies(auth.CSRFCookieName), submitted) {
+			return c.Next()
+		}
+
+		logger.Info("CSRF", "Rejected "+c.Method()+" "+c.Path()+" from "+c.IP())
+
+		// Return toast for HTMX requests
+		if c.Get("HX-Requested-With") == "true" || c.Get("HX-Request") == "true" {
+			c.Set("Content-Type", "text/html")
+			return toast.Toast(toast.Props{
+				Title:         "Security check failed",
+				Description:   "Please refresh the page and try again",
+				Variant:       toast.VariantError,
+				Position:      toast.PositionTopLeft,
+				Duration:      5000,
+				Dismissible:   true,
+				ShowIndicator: true,
+				Icon:          true,
+			}).Render(c.Context(), c.Response().BodyWriter())
+		}
+		return c.Status(fiber.StatusForbidden).SendString("Invalid or missing CSRF token. Please refresh the page and try again.")
+	}
+}
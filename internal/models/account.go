@@ -23,7 +23,7 @@ type Account struct {
 	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	Name          string             `json:"name" bson:"name"`
 	Type          AccountType        `json:"type" bson:"type"`
-	Balance       float64            `json:"balance" bson:"balance"`
+	Balance       Money              `json:"balance" bson:"balance"` // In minor units of Currency
 	Currency      string             `json:"currency" bson:"currency"`
 	Description   string             `json:"description" bson:"description"`
 	AccountNumber string             `json:"account_number" bson:"account_number"`
@@ -49,13 +49,13 @@ func NewAccount(name string, accountType AccountType, currency string, companyID
 }
 
 // Credit adds money to the account
-func (a *Account) Credit(amount float64) {
+func (a *Account) Credit(amount Money) {
 	a.Balance += amount
 	a.UpdatedAt = time.Now()
 }
 
 // Debit removes money from the account
-func (a *Account) Debit(amount float64) error {
+func (a *Account) Debit(amount Money) error {
 	if a.Balance < amount {
 		return ErrInsufficientBalance
 	}
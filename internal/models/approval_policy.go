@@ -0,0 +1,114 @@
+// Package models defines MongoDB models for the application
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ApprovalPolicy is a company's rules for who may approve which transactions
+type ApprovalPolicy struct {
+	AllowSelfApproval bool `json:"allow_self_approval" bson:"allow_self_approval"` // Let creators approve their own transactions
+	// Largest amount each role may approve, in the company currency; roles without one are unlimited
+	RoleLimits map[string]Money `json:"role_limits,omitempty" bson:"role_limits,omitempty"`
+	// Per-user limits keyed by user ID hex; they replace the user's role limit
+	UserLimits map[string]Money `json:"user_limits,omitempty" bson:"user_limits,omitempty"`
+	// Chains of sign-offs, tried in order; the first that matches a transaction applies
+	// instead of the limits. Transactions matching none need a single approval.
+	Workflows []ApprovalWorkflow `json:"workflows,omitempty" bson:"workflows,omitempty"`
+	// Hours an approval step may wait before it is escalated to the next role up; zero never escalates
+	SLAHours int `json:"sla_hours,omitempty" bson:"sla_hours,omitempty"`
+}
+
+// ApprovalWorkflow sends the transactions it matches through ordered sign-off steps.
+// Zero criteria match everything.
+type ApprovalWorkflow struct {
+	ID         primitive.ObjectID `json:"id" bson:"id"`
+	Name       string             `json:"name" bson:"name"`
+	MinAmount  Money              `json:"min_amount,omitempty" bson:"min_amount,omitempty"`   // Inclusive, in the company currency
+	MaxAmount  Money              `json:"max_amount,omitempty" bson:"max_amount,omitempty"`   // Inclusive; zero for no upper bound
+	CategoryID primitive.ObjectID `json:"category_id,omitempty" bson:"category_id,omitempty"` // Only transactions in this category
+	AccountID  primitive.ObjectID `json:"account_id,omitempty" bson:"account_id,omitempty"`   // Only transactions from or to this account
+	Steps      []ApprovalStep     `json:"steps" bson:"steps"`
+}
+
+// ApprovalStep is one sign-off in a workflow
+type ApprovalStep struct {
+	Name string `json:"name" bson:"name"`
+	Role string `json:"role" bson:"role"` // Lowest role that may sign it off
+}
+
+// Matches checks if the workflow applies to txn. An amount band cannot be compared
+// with a transaction in another currency, so such transactions always fall in it.
+func (w ApprovalWorkflow) Matches(txn *Transaction, currency string) bool {
+	if !w.CategoryID.IsZero() && txn.CategoryID != w.CategoryID {
+		return false
+	}
+	if !w.AccountID.IsZero() && txn.FromAccountID != w.AccountID && txn.ToAccountID != w.AccountID {
+		return false
+	}
+	if txn.Currency != currency {
+		return true
+	}
+	return txn.Amount >= w.MinAmount && (w.MaxAmount == 0 || txn.Amount <= w.MaxAmount)
+}
+
+// SLA is how long an approval step may wait before it is escalated, or zero for never
+func (p ApprovalPolicy) SLA() time.Duration {
+	return time.Duration(p.SLAHours) * time.Hour
+}
+
+// Workflow returns the workflow txn goes through, or nil when it needs a single approval
+func (p ApprovalPolicy) Workflow(txn *Transaction, currency string) *ApprovalWorkflow {
+	for i := range p.Workflows {
+		if len(p.Workflows[i].Steps) > 0 && p.Workflows[i].Matches(txn, currency) {
+			return &p.Workflows[i]
+		}
+	}
+	return nil
+}
+
+// Limit returns the largest amount user may approve, or false when they have no limit
+func (p ApprovalPolicy) Limit(user *User) (Money, bool) {
+	if limit, ok := p.UserLimits[user.ID.Hex()]; ok {
+		return limit, true
+	}
+	limit, ok := p.RoleLimits[user.Role]
+	return limit, ok
+}
+
+// WithinLimit checks if txn is within the most user may approve. Limits are in
+// currency, the company's; a transaction in another currency cannot be compared
+// without a rate, so only approvers without a limit may decide it.
+func (p ApprovalPolicy) WithinLimit(user *User, txn *Transaction, currency string) bool {
+	limit, limited := p.Limit(user)
+	return !limited || (txn.Currency == currency && txn.Amount <= limit)
+}
+
+// CheckSignOff returns why user may not sign off txn's current step, or nil.
+// Creators may not sign off their own transactions unless the policy allows it,
+// and nobody signs off two steps of the same chain, whether themselves or
+// through a delegate.
+func (p ApprovalPolicy) CheckSignOff(user *User, txn *Transaction) error {
+	if !p.AllowSelfApproval && txn.CreatedByID == user.ID {
+		return ErrSelfApproval
+	}
+	for _, record := range txn.SignOffs() {
+		if record.ApproverID == user.ID || record.OnBehalfOfID == user.ID {
+			return ErrAlreadySignedOff
+		}
+	}
+	return nil
+}
+
+// Check returns why user may not decide txn with a single approval, or nil when they may
+func (p ApprovalPolicy) Check(user *User, txn *Transaction, currency string) error {
+	if err := p.CheckSignOff(user, txn); err != nil {
+		return err
+	}
+	if !p.WithinLimit(user, txn, currency) {
+		return ErrApprovalLimit
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestApprovalPolicyCheck(t *testing.T) {
+	creator := &User{ID: primitive.NewObjectID(), Name: "Alice", Role: "employee"}
+	holder := &User{ID: primitive.NewObjectID(), Name: "Bob", Role: "holder"}
+	manager := &User{ID: primitive.NewObjectID(), Name: "Carol", Role: "manager"}
+	trusted := &User{ID: primitive.NewObjectID(), Name: "Dan", Role: "holder"}
+
+	limits := ApprovalPolicy{
+		RoleLimits: map[string]Money{"holder": 500_00, "manager": 0},
+		UserLimits: map[string]Money{trusted.ID.Hex(): 2_000_00},
+	}
+	expense := func(amount Money, currency string) *Transaction {
+		return NewTransaction(TransactionTypeExpense, amount, currency, primitive.NewObjectID(), creator.ID, creator.Name)
+	}
+	// signedOff is in the second step of a chain whose first step holder signed off,
+	// on behalf of manager when onBehalf is set
+	signedOff := func(onBehalf bool) *Transaction {
+		txn := expense(10_00, "USD")
+		record := ApprovalRecord{Step: 1, Status: TransactionStatusApproved, ApproverID: holder.ID}
+		if onBehalf {
+			record.OnBehalfOfID = manager.ID
+		}
+		txn.ApprovalHistory = []ApprovalRecord{record}
+		txn.ApprovalStep = 1
+		return txn
+	}
+
+	tests := []struct {
+		name   string
+		policy ApprovalPolicy
+		user   *User
+		txn    *Transaction
+		want   error
+	}{
+		{"creator approves their own", ApprovalPolicy{}, creator, expense(10_00, "USD"), ErrSelfApproval},
+		{"creator approves their own when allowed", ApprovalPolicy{AllowSelfApproval: true}, creator, expense(10_00, "USD"), nil},
+		{"self-approval still respects the limit", ApprovalPolicy{AllowSelfApproval: true, RoleLimits: map[string]Money{"employee": 5_00}}, creator, expense(10_00, "USD"), ErrApprovalLimit},
+		{"someone else with no limit", ApprovalPolicy{}, holder, expense(1_000_000_00, "USD"), nil},
+		{"under the role limit", limits, holder, expense(499_99, "USD"), nil},
+		{"exactly the role limit", limits, holder, expense(500_00, "USD"), nil},
+		{"one cent over the role limit", limits, holder, expense(500_01, "USD"), ErrApprovalLimit},
+		{"a zero limit allows nothing", limits, manager, expense(1, "USD"), ErrApprovalLimit},
+		{"a user limit replaces the role's", limits, trusted, expense(2_000_00, "USD"), nil},
+		{"over the user limit", limits, trusted, expense(2_000_01, "USD"), ErrApprovalLimit},
+		{"another currency with a limit", limits, holder, expense(1, "EUR"), ErrApprovalLimit},
+		{"another currency without a limit", ApprovalPolicy{}, holder, expense(1_000_00, "EUR"), nil},
+		{"signed off an earlier step", ApprovalPolicy{}, holder, signedOff(false), ErrAlreadySignedOff},
+		{"an earlier step was signed off for them", ApprovalPolicy{}, manager, signedOff(true), ErrAlreadySignedOff},
+		{"someone else signed off an earlier step", ApprovalPolicy{}, trusted, signedOff(true), nil},
+	}
+	for _, tt := range tests {
+		if err := tt.policy.Check(tt.user, tt.txn, "USD"); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Check returned %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestApprovalPolicyCheckSignOffIgnoresEarlierChains(t *testing.T) {
+	approver := &User{ID: primitive.NewObjectID(), Role: "manager"}
+	txn := NewTransaction(TransactionTypeExpense, 10_00, "USD", primitive.NewObjectID(), primitive.NewObjectID(), "Alice")
+	// Rejected once and resubmitted, so a fresh chain has begun
+	txn.ApprovalHistory = []ApprovalRecord{
+		{Step: 1, Status: TransactionStatusRejected, ApproverID: approver.ID},
+	}
+	txn.ApprovalStep = 0
+
+	if err := (ApprovalPolicy{}).CheckSignOff(approver, txn); err != nil {
+		t.Errorf("CheckSignOff returned %v for a decision in an earlier chain, want nil", err)
+	}
+}
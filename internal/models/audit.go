@@ -18,6 +18,20 @@ const (
 	AuditActionReject  AuditAction = "reject"
 	AuditActionLogin   AuditAction = "login"
 	AuditActionLogout  AuditAction = "logout"
+	AuditActionRevoke  AuditAction = "revoke"
+
+	AuditActionLoginFailed   AuditAction = "login_failed"
+	AuditActionAccountLocked AuditAction = "account_locked"
+	AuditActionUnlock        AuditAction = "unlock"
+	AuditActionInvite        AuditAction = "invite"
+	AuditActionAccept        AuditAction = "accept"
+	AuditActionReconcile     AuditAction = "reconcile"
+	AuditActionReverse       AuditAction = "reverse"
+	AuditActionVoid          AuditAction = "void"
+	AuditActionSubmit        AuditAction = "submit"
+	AuditActionWithdraw      AuditAction = "withdraw"
+	AuditActionPay           AuditAction = "pay"
+	AuditActionEscalate      AuditAction = "escalate"
 )
 
 // AuditEntity represents the entity being audited
@@ -30,22 +44,28 @@ const (
 	AuditEntityCategory    AuditEntity = "category"
 	AuditEntityBudget      AuditEntity = "budget"
 	AuditEntityCompany     AuditEntity = "company"
+	AuditEntitySession     AuditEntity = "session"
+	AuditEntityInvitation  AuditEntity = "invitation"
+	AuditEntityDelegation  AuditEntity = "delegation"
 )
 
 // AuditLog represents an audit trail entry
 type AuditLog struct {
-	ID        primitive.ObjectID     `json:"id" bson:"_id,omitempty"`
-	Action    AuditAction            `json:"action" bson:"action"`
-	Entity    AuditEntity            `json:"entity" bson:"entity"`
-	EntityID  primitive.ObjectID     `json:"entity_id,omitempty" bson:"entity_id,omitempty"`
-	UserID    primitive.ObjectID     `json:"user_id" bson:"user_id"`
-	UserName  string                 `json:"user_name" bson:"user_name"`
-	UserEmail string                 `json:"user_email" bson:"user_email"`
-	CompanyID primitive.ObjectID     `json:"company_id" bson:"company_id"`
-	Changes   map[string]interface{} `json:"changes,omitempty" bson:"changes,omitempty"`
-	IPAddress string                 `json:"ip_address" bson:"ip_address"`
-	UserAgent string                 `json:"user_agent" bson:"user_agent"`
-	CreatedAt time.Time              `json:"created_at" bson:"created_at"`
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Action    AuditAction        `json:"action" bson:"action"`
+	Entity    AuditEntity        `json:"entity" bson:"entity"`
+	EntityID  primitive.ObjectID `json:"entity_id,omitempty" bson:"entity_id,omitempty"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	UserName  string             `json:"user_name" bson:"user_name"`
+	UserEmail string             `json:"user_email" bson:"user_email"`
+	// Set when the user acted with another user's delegated authority
+	OnBehalfOfID   primitive.ObjectID     `json:"on_behalf_of_id,omitempty" bson:"on_behalf_of_id,omitempty"`
+	OnBehalfOfName string                 `json:"on_behalf_of_name,omitempty" bson:"on_behalf_of_name,omitempty"`
+	CompanyID      primitive.ObjectID     `json:"company_id" bson:"company_id"`
+	Changes        map[string]interface{} `json:"changes,omitempty" bson:"changes,omitempty"`
+	IPAddress      string                 `json:"ip_address" bson:"ip_address"`
+	UserAgent      string                 `json:"user_agent" bson:"user_agent"`
+	CreatedAt      time.Time              `json:"created_at" bson:"created_at"`
 }
 
 // NewAuditLog creates a new audit log entry
@@ -68,6 +88,13 @@ func (a *AuditLog) WithChanges(changes map[string]interface{}) *AuditLog {
 	return a
 }
 
+// WithOnBehalfOf records whose delegated authority the user acted with
+func (a *AuditLog) WithOnBehalfOf(id primitive.ObjectID, name string) *AuditLog {
+	a.OnBehalfOfID = id
+	a.OnBehalfOfName = name
+	return a
+}
+
 // WithIPAddress sets the IP address
 func (a *AuditLog) WithIPAddress(ip string) *AuditLog {
 	a.IPAddress = ip
@@ -97,6 +124,32 @@ func AuditActionDisplayName(a AuditAction) string {
 		return "Logged In"
 	case AuditActionLogout:
 		return "Logged Out"
+	case AuditActionRevoke:
+		return "Revoked"
+	case AuditActionLoginFailed:
+		return "Login Failed"
+	case AuditActionAccountLocked:
+		return "Account Locked"
+	case AuditActionUnlock:
+		return "Unlocked"
+	case AuditActionInvite:
+		return "Invited"
+	case AuditActionAccept:
+		return "Accepted"
+	case AuditActionReconcile:
+		return "Reconciled"
+	case AuditActionReverse:
+		return "Reversed"
+	case AuditActionVoid:
+		return "Voided"
+	case AuditActionSubmit:
+		return "Submitted"
+	case AuditActionWithdraw:
+		return "Withdrawn"
+	case AuditActionPay:
+		return "Paid"
+	case AuditActionEscalate:
+		return "Escalated"
 	default:
 		return string(a)
 	}
@@ -117,6 +170,12 @@ func AuditEntityDisplayName(e AuditEntity) string {
 		return "Budget"
 	case AuditEntityCompany:
 		return "Company"
+	case AuditEntitySession:
+		return "Session"
+	case AuditEntityInvitation:
+		return "Invitation"
+	case AuditEntityDelegation:
+		return "Delegation"
 	default:
 		return string(e)
 	}
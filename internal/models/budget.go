@@ -2,6 +2,8 @@
 package models
 
 import (
+	"slices"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -16,48 +18,157 @@ const (
 	BudgetPeriodYearly    BudgetPeriod = "yearly"
 )
 
-// Budget represents a spending limit for a category
+// BudgetCarryOver is what a recurring budget takes from one period into the next
+type BudgetCarryOver string
+
+const (
+	BudgetCarryOverNone      BudgetCarryOver = ""          // Every period starts at Amount
+	BudgetCarryOverUnused    BudgetCarryOver = "unused"    // Money left over raises the next period's limit
+	BudgetCarryOverOverspent BudgetCarryOver = "overspent" // Overspending lowers the next period's limit
+	BudgetCarryOverBoth      BudgetCarryOver = "both"
+)
+
+// BudgetEnforcement is what happens to an expense that would take a budget over its limit
+type BudgetEnforcement string
+
+const (
+	BudgetEnforcementWarn     BudgetEnforcement = ""         // It goes through, with a warning
+	BudgetEnforcementApproval BudgetEnforcement = "approval" // It needs an extra sign-off
+	BudgetEnforcementBlock    BudgetEnforcement = "block"    // It cannot be submitted
+)
+
+// BudgetLevel is how close a budget's spend is to its limit
+type BudgetLevel int
+
+const (
+	BudgetLevelOK       BudgetLevel = iota
+	BudgetLevelWarning              // At or past WarnPercent of the limit
+	BudgetLevelExceeded             // Over the limit
+)
+
+// DefaultBudgetWarnPercent is the share of its limit a new budget warns at
+const DefaultBudgetWarnPercent = 80
+
+// BudgetThresholds are when a budget alerts its owner and what it does with
+// expenses that would take it over its limit
+type BudgetThresholds struct {
+	// Percent of the limit at which the owner is warned; zero never warns before the limit
+	WarnPercent int               `json:"warn_percent,omitempty" bson:"warn_percent,omitempty"`
+	Enforcement BudgetEnforcement `json:"enforcement,omitempty" bson:"enforcement,omitempty"`
+	// Who is alerted when spend reaches a threshold
+	OwnerID   primitive.ObjectID `json:"owner_id,omitempty" bson:"owner_id,omitempty"`
+	OwnerName string             `json:"owner_name,omitempty" bson:"owner_name,omitempty"`
+}
+
+// BudgetScope is which expenses a budget tracks. Each dimension that is set
+// narrows it, so an expense must match all of them; a scope with none set
+// tracks every expense in the company.
+type BudgetScope struct {
+	CategoryIDs  []primitive.ObjectID `json:"category_ids,omitempty" bson:"category_ids,omitempty"` // In any of these categories
+	AccountID    primitive.ObjectID   `json:"account_id,omitempty" bson:"account_id,omitempty"`     // Paid from this account
+	Department   string               `json:"department,omitempty" bson:"department,omitempty"`     // Charged to this department or cost center
+	EmployeeID   primitive.ObjectID   `json:"employee_id,omitempty" bson:"employee_id,omitempty"`   // Charged to this member
+	EmployeeName string               `json:"employee_name,omitempty" bson:"employee_name,omitempty"`
+}
+
+// Matches checks if txn falls inside the scope
+func (s BudgetScope) Matches(txn *Transaction) bool {
+	return (len(s.CategoryIDs) == 0 || slices.Contains(s.CategoryIDs, txn.CategoryID)) &&
+		(s.AccountID.IsZero() || txn.FromAccountID == s.AccountID) &&
+		(s.Department == "" || strings.EqualFold(txn.Department, s.Department)) &&
+		(s.EmployeeID.IsZero() || txn.Employee() == s.EmployeeID)
+}
+
+// Key identifies the scope, so that budgets with the same scope can be grouped
+func (s BudgetScope) Key() string {
+	categories := make([]string, len(s.CategoryIDs))
+	for i, id := range s.CategoryIDs {
+		categories[i] = id.Hex()
+	}
+	slices.Sort(categories)
+	var employee, account string
+	if !s.EmployeeID.IsZero() {
+		employee = s.EmployeeID.Hex()
+	}
+	if !s.AccountID.IsZero() {
+		account = s.AccountID.Hex()
+	}
+	return strings.Join([]string{strings.Join(categories, ","), account, strings.ToLower(s.Department), employee}, "|")
+}
+
+// Budget is a spending limit for the expenses in its scope over one period,
+// such as a department's travel and meals or one member's spending from an
+// account. A recurring budget is a series of them: when a period ends it is
+// closed and kept as history, and the next period opens as a new budget with
+// the same SeriesID.
 type Budget struct {
-	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	CategoryID primitive.ObjectID `json:"category_id" bson:"category_id"`
+	ID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	// The one category of budgets from before scopes; use Scope
+	CategoryID primitive.ObjectID `json:"category_id,omitempty" bson:"category_id,omitempty"`
 	Name       string             `json:"name" bson:"name"`
-	Amount     float64            `json:"amount" bson:"amount"` // Budget limit
-	Spent      float64            `json:"spent" bson:"spent"`   // Amount spent
+	Amount     Money              `json:"amount" bson:"amount"` // Budget limit
+	Spent      Money              `json:"spent" bson:"spent"`   // Cached total of the expenses it counts
 	Currency   string             `json:"currency" bson:"currency"`
 	Period     BudgetPeriod       `json:"period" bson:"period"`
 	StartDate  time.Time          `json:"start_date" bson:"start_date"`
 	EndDate    time.Time          `json:"end_date" bson:"end_date"`
+	Timezone   string             `json:"timezone,omitempty" bson:"timezone,omitempty"` // Whose calendar days the period follows; UTC when empty
 	CompanyID  primitive.ObjectID `json:"company_id" bson:"company_id"`
 	IsActive   bool               `json:"is_active" bson:"is_active"`
 	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt  time.Time          `json:"updated_at" bson:"updated_at"`
+	Recurring  bool               `json:"recurring,omitempty" bson:"recurring,omitempty"`
+	CarryOver  BudgetCarryOver    `json:"carry_over,omitempty" bson:"carry_over,omitempty"`
+	// Taken over from the previous period: positive for unused money, negative for overspending
+	CarriedOver Money              `json:"carried_over,omitempty" bson:"carried_over,omitempty"`
+	SeriesID    primitive.ObjectID `json:"series_id,omitempty" bson:"series_id,omitempty"` // The first period's ID
+	ClosedAt    time.Time          `json:"closed_at,omitempty" bson:"closed_at,omitempty"` // Set once the period has ended
+
+	BudgetScope      `bson:",inline"`
+	BudgetThresholds `bson:",inline"`
 	// Populated fields
-	CategoryName string `json:"category_name,omitempty" bson:"-"`
+	ScopeName string `json:"scope_name,omitempty" bson:"-"`
 }
 
 // NewBudget creates a new budget
-func NewBudget(name string, categoryID primitive.ObjectID, amount float64, currency string, period BudgetPeriod, companyID primitive.ObjectID) *Budget {
+func NewBudget(name string, categoryID primitive.ObjectID, amount Money, currency string, period BudgetPeriod, companyID primitive.ObjectID) *Budget {
 	now := time.Now()
 	startDate, endDate := GetBudgetPeriodDates(period, now)
 	return &Budget{
-		CategoryID: categoryID,
-		Name:       name,
-		Amount:     amount,
-		Spent:      0,
-		Currency:   currency,
-		Period:     period,
-		StartDate:  startDate,
-		EndDate:    endDate,
-		CompanyID:  companyID,
-		IsActive:   true,
-		CreatedAt:  now,
-		UpdatedAt:  now,
+		Name:      name,
+		Amount:    amount,
+		Spent:     0,
+		Currency:  currency,
+		Period:    period,
+		StartDate: startDate,
+		EndDate:   endDate,
+		CompanyID: companyID,
+		IsActive:  true,
+		CreatedAt: now,
+		UpdatedAt: now,
+
+		BudgetScope: BudgetScope{CategoryIDs: []primitive.ObjectID{categoryID}},
 	}
 }
 
+// Scope is which expenses the budget tracks, counting the category of budgets
+// from before scopes
+func (b *Budget) Scope() BudgetScope {
+	scope := b.BudgetScope
+	if len(scope.CategoryIDs) == 0 && !b.CategoryID.IsZero() {
+		scope.CategoryIDs = []primitive.ObjectID{b.CategoryID}
+	}
+	return scope
+}
+
+// Limit is how much may be spent this period: the amount plus anything carried over
+func (b *Budget) Limit() Money {
+	return b.Amount + b.CarriedOver
+}
+
 // Remaining returns the remaining budget amount
-func (b *Budget) Remaining() float64 {
-	remaining := b.Amount - b.Spent
+func (b *Budget) Remaining() Money {
+	remaining := b.Limit() - b.Spent
 	if remaining < 0 {
 		return 0
 	}
@@ -66,29 +177,133 @@ func (b *Budget) Remaining() float64 {
 
 // Utilization returns the budget utilization percentage
 func (b *Budget) Utilization() float64 {
-	if b.Amount == 0 {
+	if b.Limit() <= 0 {
 		return 0
 	}
-	return (b.Spent / b.Amount) * 100
+	return float64(b.Spent) / float64(b.Limit()) * 100
+}
+
+// LevelAt returns how close spending spent would take the budget to its limit
+func (b *Budget) LevelAt(spent Money) BudgetLevel {
+	limit := b.Limit()
+	switch {
+	case spent > limit:
+		return BudgetLevelExceeded
+	case b.WarnPercent > 0 && int64(spent)*100 >= int64(limit)*int64(b.WarnPercent):
+		return BudgetLevelWarning
+	default:
+		return BudgetLevelOK
+	}
+}
+
+// Level returns how close the budget's spend is to its limit
+func (b *Budget) Level() BudgetLevel {
+	return b.LevelAt(b.Spent)
 }
 
 // IsOverBudget checks if spending exceeds the budget
 func (b *Budget) IsOverBudget() bool {
-	return b.Spent > b.Amount
+	return b.Spent > b.Limit()
 }
 
 // CanSpend checks if the amount can be spent within budget
-func (b *Budget) CanSpend(amount float64) bool {
-	return (b.Spent + amount) <= b.Amount
+func (b *Budget) CanSpend(amount Money) bool {
+	return (b.Spent + amount) <= b.Limit()
+}
+
+// Location is the timezone whose calendar days the budget's period follows
+func (b *Budget) Location() *time.Location {
+	return loadLocation(b.Timezone)
+}
+
+// PeriodDates returns the first and last day of the budget's period in its timezone
+func (b *Budget) PeriodDates() (first, last time.Time) {
+	return b.StartDate.In(b.Location()), b.EndDate.In(b.Location())
+}
+
+// PeriodEnd is when the budget's period ends: the start of the day after EndDate
+// in the budget's timezone
+func (b *Budget) PeriodEnd() time.Time {
+	loc := b.Location()
+	year, month, day := b.EndDate.In(loc).Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, loc)
+}
+
+// Covers checks if t falls inside the budget's period
+func (b *Budget) Covers(t time.Time) bool {
+	return !t.Before(b.StartDate) && t.Before(b.PeriodEnd())
+}
+
+// Applies checks if txn is an expense the budget would track: one in its scope
+// and currency, dated inside its period
+func (b *Budget) Applies(txn *Transaction) bool {
+	return txn.Type == TransactionTypeExpense && txn.Currency == b.Currency &&
+		b.Covers(txn.TransactionDate) && b.Scope().Matches(txn)
+}
+
+// Counts checks if txn's amount is part of the budget's spend: an approved
+// expense it applies to that has not been voided or corrected. Reversals never
+// count; undoing an expense takes it out of the period it was dated in.
+func (b *Budget) Counts(txn *Transaction) bool {
+	return b.Applies(txn) && txn.IsPosted() && !txn.IsReversal() && !txn.IsReversed()
+}
+
+// IsClosed checks if the budget is a period that has ended
+func (b *Budget) IsClosed() bool {
+	return !b.ClosedAt.IsZero()
+}
+
+// Series is the ID shared by every period of the budget
+func (b *Budget) Series() primitive.ObjectID {
+	if b.SeriesID.IsZero() {
+		return b.ID
+	}
+	return b.SeriesID
+}
+
+// Next returns the period following this one, open and with nothing spent yet,
+// taking over whatever CarryOver asks for
+func (b *Budget) Next() *Budget {
+	now := time.Now()
+	startDate, endDate := GetBudgetPeriodDates(b.Period, b.PeriodEnd())
+	next := &Budget{
+		ID:        primitive.NewObjectID(),
+		Name:      b.Name,
+		Amount:    b.Amount,
+		Currency:  b.Currency,
+		Period:    b.Period,
+		StartDate: startDate,
+		EndDate:   endDate,
+		Timezone:  b.Timezone,
+		CompanyID: b.CompanyID,
+		IsActive:  true,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Recurring: b.Recurring,
+		CarryOver: b.CarryOver,
+		SeriesID:  b.Series(),
+
+		BudgetScope:      b.Scope(),
+		BudgetThresholds: b.BudgetThresholds,
+	}
+	left := b.Limit() - b.Spent
+	switch {
+	case left > 0 && (b.CarryOver == BudgetCarryOverUnused || b.CarryOver == BudgetCarryOverBoth):
+		next.CarriedOver = left
+	case left < 0 && (b.CarryOver == BudgetCarryOverOverspent || b.CarryOver == BudgetCarryOverBoth):
+		next.CarriedOver = left
+	}
+	return next
 }
 
 // AddSpending adds to the spent amount
-func (b *Budget) AddSpending(amount float64) {
+func (b *Budget) AddSpending(amount Money) {
 	b.Spent += amount
 	b.UpdatedAt = time.Now()
 }
 
-// GetBudgetPeriodDates returns start and end dates for a budget period
+// GetBudgetPeriodDates returns start and end dates for a budget period, in the
+// calendar of referenceDate's location
 func GetBudgetPeriodDates(period BudgetPeriod, referenceDate time.Time) (time.Time, time.Time) {
 	year, month, _ := referenceDate.Date()
 	loc := referenceDate.Location()
@@ -113,6 +328,58 @@ func GetBudgetPeriodDates(period BudgetPeriod, referenceDate time.Time) (time.Ti
 	}
 }
 
+// IsValidBudgetCarryOver checks if the carry-over option is valid
+func IsValidBudgetCarryOver(c string) bool {
+	switch BudgetCarryOver(c) {
+	case BudgetCarryOverNone, BudgetCarryOverUnused, BudgetCarryOverOverspent, BudgetCarryOverBoth:
+		return true
+	}
+	return false
+}
+
+// IsValidBudgetEnforcement checks if the enforcement option is valid
+func IsValidBudgetEnforcement(e string) bool {
+	switch BudgetEnforcement(e) {
+	case BudgetEnforcementWarn, BudgetEnforcementApproval, BudgetEnforcementBlock:
+		return true
+	}
+	return false
+}
+
+// BudgetImpact is where an expense would leave one of the budgets it applies to
+type BudgetImpact struct {
+	Budget Budget
+	After  Money       // Spent once the expense counts
+	Level  BudgetLevel // Of After
+}
+
+// Impact returns where spending amount more would leave the budget
+func (b *Budget) Impact(amount Money) BudgetImpact {
+	level := BudgetLevelExceeded
+	if b.CanSpend(amount) {
+		level = b.LevelAt(b.Spent + amount)
+	}
+	return BudgetImpact{Budget: *b, After: b.Spent + amount, Level: level}
+}
+
+// Blocks checks if the expense may not be submitted at all
+func (i BudgetImpact) Blocks() bool {
+	return i.Level == BudgetLevelExceeded && i.Budget.Enforcement == BudgetEnforcementBlock
+}
+
+// NeedsOverride checks if the expense needs an extra sign-off for going over the budget
+func (i BudgetImpact) NeedsOverride() bool {
+	return i.Level == BudgetLevelExceeded && i.Budget.Enforcement == BudgetEnforcementApproval
+}
+
+// Utilization returns the budget's utilization percentage once the expense counts
+func (i BudgetImpact) Utilization() float64 {
+	if i.Budget.Limit() <= 0 {
+		return 0
+	}
+	return float64(i.After) / float64(i.Budget.Limit()) * 100
+}
+
 // IsValidBudgetPeriod checks if the period is valid
 func IsValidBudgetPeriod(p string) bool {
 	switch BudgetPeriod(p) {
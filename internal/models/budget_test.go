@@ -0,0 +1,97 @@
+package models
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestBudgetScopeMatches(t *testing.T) {
+	travel, meals, supplies := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	card, cash := primitive.NewObjectID(), primitive.NewObjectID()
+	alice, bob := primitive.NewObjectID(), primitive.NewObjectID()
+
+	// expense is a travel expense from the card, charged to Sales, created by alice
+	expense := func(change func(txn *Transaction)) *Transaction {
+		txn := NewTransaction(TransactionTypeExpense, 10_00, "USD", primitive.NewObjectID(), alice, "Alice")
+		txn.CategoryID = travel
+		txn.FromAccountID = card
+		txn.Department = "Sales"
+		if change != nil {
+			change(txn)
+		}
+		return txn
+	}
+
+	tests := []struct {
+		name  string
+		scope BudgetScope
+		txn   *Transaction
+		want  bool
+	}{
+		{"an empty scope", BudgetScope{}, expense(nil), true},
+		{"one of the categories", BudgetScope{CategoryIDs: []primitive.ObjectID{meals, travel}}, expense(nil), true},
+		{"none of the categories", BudgetScope{CategoryIDs: []primitive.ObjectID{meals, supplies}}, expense(nil), false},
+		{"categories, uncategorized expense", BudgetScope{CategoryIDs: []primitive.ObjectID{travel}}, expense(func(txn *Transaction) { txn.CategoryID = primitive.NilObjectID }), false},
+		{"the account", BudgetScope{AccountID: card}, expense(nil), true},
+		{"another account", BudgetScope{AccountID: cash}, expense(nil), false},
+		{"the account as destination only", BudgetScope{AccountID: card}, expense(func(txn *Transaction) {
+			txn.FromAccountID = cash
+			txn.ToAccountID = card
+		}), false},
+		{"the department", BudgetScope{Department: "Sales"}, expense(nil), true},
+		{"the department in another case", BudgetScope{Department: "sALES"}, expense(nil), true},
+		{"another department", BudgetScope{Department: "Marketing"}, expense(nil), false},
+		{"department, none recorded", BudgetScope{Department: "Sales"}, expense(func(txn *Transaction) { txn.Department = "" }), false},
+		{"the employee, by creator", BudgetScope{EmployeeID: alice}, expense(nil), true},
+		{"the employee, charged to them", BudgetScope{EmployeeID: bob}, expense(func(txn *Transaction) { txn.EmployeeID = bob }), true},
+		{"the creator, charged to another", BudgetScope{EmployeeID: alice}, expense(func(txn *Transaction) { txn.EmployeeID = bob }), false},
+		{"every dimension", BudgetScope{CategoryIDs: []primitive.ObjectID{travel}, AccountID: card, Department: "sales", EmployeeID: alice}, expense(nil), true},
+		{"every dimension but one", BudgetScope{CategoryIDs: []primitive.ObjectID{travel}, AccountID: card, Department: "sales", EmployeeID: bob}, expense(nil), false},
+	}
+	for _, tt := range tests {
+		if got := tt.scope.Matches(tt.txn); got != tt.want {
+			t.Errorf("%s: Matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBudgetScopeKey(t *testing.T) {
+	travel, meals := primitive.NewObjectID(), primitive.NewObjectID()
+	card, alice := primitive.NewObjectID(), primitive.NewObjectID()
+
+	same := []struct {
+		name string
+		a, b BudgetScope
+	}{
+		{"categories in any order", BudgetScope{CategoryIDs: []primitive.ObjectID{travel, meals}}, BudgetScope{CategoryIDs: []primitive.ObjectID{meals, travel}}},
+		{"department in any case", BudgetScope{Department: "Sales"}, BudgetScope{Department: "SALES"}},
+		{"empty", BudgetScope{}, BudgetScope{CategoryIDs: []primitive.ObjectID{}}},
+		{"employee name ignored", BudgetScope{EmployeeID: alice, EmployeeName: "Alice"}, BudgetScope{EmployeeID: alice}},
+	}
+	for _, tt := range same {
+		if a, b := tt.a.Key(), tt.b.Key(); a != b {
+			t.Errorf("%s: keys %q and %q differ, want them equal", tt.name, a, b)
+		}
+	}
+
+	// Each dimension, including the same ID in a different one, makes a distinct key
+	distinct := []BudgetScope{
+		{},
+		{CategoryIDs: []primitive.ObjectID{travel}},
+		{CategoryIDs: []primitive.ObjectID{travel, meals}},
+		{AccountID: card},
+		{Department: "Sales"},
+		{EmployeeID: alice},
+		{EmployeeID: card},
+		{CategoryIDs: []primitive.ObjectID{travel}, Department: "Sales"},
+	}
+	seen := make(map[string]int)
+	for i, scope := range distinct {
+		key := scope.Key()
+		if j, ok := seen[key]; ok {
+			t.Errorf("scopes %+v and %+v share the key %q", distinct[j], scope, key)
+		}
+		seen[key] = i
+	}
+}
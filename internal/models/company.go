@@ -9,16 +9,62 @@ import (
 
 // Company represents a company in the system
 type Company struct {
-	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	Name      string             `json:"name" bson:"name"`
-	Email     string             `json:"email" bson:"email"`
-	Phone     string             `json:"phone" bson:"phone"`
-	Address   string             `json:"address" bson:"address"`
-	Currency  string             `json:"currency" bson:"currency"` // Default currency (USD, VND, etc.)
-	Timezone  string             `json:"timezone" bson:"timezone"`
-	IsActive  bool               `json:"is_active" bson:"is_active"`
-	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name       string             `json:"name" bson:"name"`
+	Email      string             `json:"email" bson:"email"`
+	Phone      string             `json:"phone" bson:"phone"`
+	Address    string             `json:"address" bson:"address"`
+	Currency   string             `json:"currency" bson:"currency"` // Default currency (USD, VND, etc.)
+	Timezone   string             `json:"timezone" bson:"timezone"`
+	Require2FA bool               `json:"require_2fa" bson:"require_2fa"` // Mandatory 2FA for approvers and admins
+	Approvals  ApprovalPolicy     `json:"approvals" bson:"approvals"`
+	IsActive   bool               `json:"is_active" bson:"is_active"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// SupportedCurrencies lists the base currencies a company can pick
+var SupportedCurrencies = []string{"USD", "VND", "EUR"}
+
+// CommonTimezones lists the timezones offered during onboarding
+var CommonTimezones = []string{
+	"UTC",
+	"Asia/Ho_Chi_Minh",
+	"Asia/Singapore",
+	"Asia/Tokyo",
+	"Australia/Sydney",
+	"Europe/London",
+	"Europe/Berlin",
+	"America/New_York",
+	"America/Chicago",
+	"America/Los_Angeles",
+}
+
+// IsSupportedCurrency checks if a currency code can be used as a base currency
+func IsSupportedCurrency(currency string) bool {
+	for _, c := range SupportedCurrencies {
+		if c == currency {
+			return true
+		}
+	}
+	return false
+}
+
+// Location is the company's timezone, UTC when it is unset or unknown
+func (c *Company) Location() *time.Location {
+	return loadLocation(c.Timezone)
+}
+
+// loadLocation loads a timezone by name, falling back to UTC
+func loadLocation(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
 }
 
 // NewCompany creates a new company with defaults
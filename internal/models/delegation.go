@@ -0,0 +1,42 @@
+// Package models defines MongoDB models for the application
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Delegation lets ToUser approve with FromUser's authority while FromUser is away.
+// It applies from StartsAt until EndsAt, after which it lapses by itself.
+type Delegation struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CompanyID    primitive.ObjectID `json:"company_id" bson:"company_id"`
+	FromUserID   primitive.ObjectID `json:"from_user_id" bson:"from_user_id"`
+	FromUserName string             `json:"from_user_name" bson:"from_user_name"`
+	ToUserID     primitive.ObjectID `json:"to_user_id" bson:"to_user_id"`
+	ToUserName   string             `json:"to_user_name" bson:"to_user_name"`
+	StartsAt     time.Time          `json:"starts_at" bson:"starts_at"`
+	EndsAt       time.Time          `json:"ends_at" bson:"ends_at"` // Exclusive
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+	RevokedAt    time.Time          `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"` // Ended early by FromUser
+}
+
+// IsActive checks if the delegation applies at t
+func (d *Delegation) IsActive(t time.Time) bool {
+	return d.RevokedAt.IsZero() && !t.Before(d.StartsAt) && t.Before(d.EndsAt)
+}
+
+// DelegationStatus describes the delegation at t: Scheduled, Active, Expired or Revoked
+func (d *Delegation) DelegationStatus(t time.Time) string {
+	switch {
+	case !d.RevokedAt.IsZero():
+		return "Revoked"
+	case t.Before(d.StartsAt):
+		return "Scheduled"
+	case t.Before(d.EndsAt):
+		return "Active"
+	default:
+		return "Expired"
+	}
+}
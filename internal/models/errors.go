@@ -10,4 +10,10 @@ var (
 	ErrNotFound            = errors.New("not found")
 	ErrUnauthorized        = errors.New("unauthorized")
 	ErrBudgetExceeded      = errors.New("budget limit exceeded")
+	ErrInvalidAmount       = errors.New("invalid amount")
+	ErrUnbalancedEntry     = errors.New("journal entry does not balance")
+	ErrSelfApproval        = errors.New("cannot approve own transaction")
+	ErrApprovalLimit       = errors.New("amount exceeds approval limit")
+	ErrApprovalStep        = errors.New("approval step needs a higher role")
+	ErrAlreadySignedOff    = errors.New("already signed off an earlier approval step")
 )
@@ -0,0 +1,70 @@
+// Package models defines MongoDB models for the application
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// InvitationStatus represents the lifecycle of an invitation
+type InvitationStatus string
+
+const (
+	InvitationStatusPending  InvitationStatus = "pending"
+	InvitationStatusAccepted InvitationStatus = "accepted"
+	InvitationStatusRevoked  InvitationStatus = "revoked"
+)
+
+// InvitationTTL is how long an invitation link stays valid
+const InvitationTTL = 7 * 24 * time.Hour
+
+// Invitation invites someone by email to join a company with a pre-assigned role.
+// Only the SHA-256 hash of the single-use token is stored.
+type Invitation struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CompanyID     primitive.ObjectID `json:"company_id" bson:"company_id"`
+	Email         string             `json:"email" bson:"email"`
+	Role          string             `json:"role" bson:"role"`
+	TokenHash     string             `json:"-" bson:"token_hash"`
+	Status        InvitationStatus   `json:"status" bson:"status"`
+	InvitedBy     primitive.ObjectID `json:"invited_by" bson:"invited_by"`
+	InvitedByName string             `json:"invited_by_name" bson:"invited_by_name"`
+	SendCount     int                `json:"send_count" bson:"send_count"`
+	LastSentAt    time.Time          `json:"last_sent_at" bson:"last_sent_at"`
+	ExpiresAt     time.Time          `json:"expires_at" bson:"expires_at"`
+	AcceptedAt    time.Time          `json:"accepted_at,omitempty" bson:"accepted_at,omitempty"`
+	AcceptedBy    primitive.ObjectID `json:"accepted_by,omitempty" bson:"accepted_by,omitempty"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// NewInvitation creates a pending invitation
+func NewInvitation(companyID primitive.ObjectID, email, role, tokenHash string, inviter *User) *Invitation {
+	now := time.Now()
+	return &Invitation{
+		ID:            primitive.NewObjectID(),
+		CompanyID:     companyID,
+		Email:         email,
+		Role:          role,
+		TokenHash:     tokenHash,
+		Status:        InvitationStatusPending,
+		InvitedBy:     inviter.ID,
+		InvitedByName: inviter.Name,
+		SendCount:     1,
+		LastSentAt:    now,
+		ExpiresAt:     now.Add(InvitationTTL),
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+}
+
+// IsExpired checks if the invitation link has expired
+func (i *Invitation) IsExpired(now time.Time) bool {
+	return now.After(i.ExpiresAt)
+}
+
+// CanBeAccepted checks if the invitation is still pending and unexpired
+func (i *Invitation) CanBeAccepted(now time.Time) bool {
+	return i.Status == InvitationStatusPending && !i.IsExpired(now)
+}
@@ -0,0 +1,117 @@
+// Package models defines MongoDB models for the application
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LedgerKind says what a journal line posts against
+type LedgerKind string
+
+const (
+	LedgerKindAccount  LedgerKind = "account"  // A financial account (asset side)
+	LedgerKindCategory LedgerKind = "category" // An income or expense category
+	LedgerKindSuspense LedgerKind = "suspense" // Holds the other side when a transaction has no account or category
+)
+
+// JournalLine debits or credits one ledger account; exactly one of Debit and Credit is set
+type JournalLine struct {
+	Kind   LedgerKind         `json:"kind" bson:"kind"`
+	RefID  primitive.ObjectID `json:"ref_id,omitempty" bson:"ref_id,omitempty"` // Account or category ID; zero for suspense
+	Debit  Money              `json:"debit" bson:"debit"`
+	Credit Money              `json:"credit" bson:"credit"`
+}
+
+// JournalEntry is the balanced double-entry record of an approved transaction
+type JournalEntry struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TransactionID primitive.ObjectID `json:"transaction_id" bson:"transaction_id"`
+	Date          time.Time          `json:"date" bson:"date"` // The transaction date, used for as-of reports
+	Description   string             `json:"description" bson:"description"`
+	Currency      string             `json:"currency" bson:"currency"`
+	Lines         []JournalLine      `json:"lines" bson:"lines"`
+	CompanyID     primitive.ObjectID `json:"company_id" bson:"company_id"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// NewJournalEntry posts an approved transaction:
+//   - income debits the receiving account and credits the income category
+//   - expense debits the expense category and credits the paying account
+//   - transfer debits the receiving account and credits the paying account
+//
+// A missing account or category is posted to suspense so the entry still balances.
+// A reversal swaps the sides, undoing the entry of the transaction it reverses.
+func NewJournalEntry(txn *Transaction) (*JournalEntry, error) {
+	var debit, credit JournalLine
+	switch txn.Type {
+	case TransactionTypeIncome:
+		debit = ledgerLine(LedgerKindAccount, txn.ToAccountID)
+		credit = ledgerLine(LedgerKindCategory, txn.CategoryID)
+	case TransactionTypeExpense:
+		debit = ledgerLine(LedgerKindCategory, txn.CategoryID)
+		credit = ledgerLine(LedgerKindAccount, txn.FromAccountID)
+	case TransactionTypeTransfer:
+		debit = ledgerLine(LedgerKindAccount, txn.ToAccountID)
+		credit = ledgerLine(LedgerKindAccount, txn.FromAccountID)
+	default:
+		return nil, ErrInvalidTransaction
+	}
+	if txn.Amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if txn.IsReversal() {
+		debit, credit = credit, debit
+	}
+	debit.Debit = txn.Amount
+	credit.Credit = txn.Amount
+
+	return &JournalEntry{
+		TransactionID: txn.ID,
+		Date:          txn.TransactionDate,
+		Description:   txn.Description,
+		Currency:      txn.Currency,
+		Lines:         []JournalLine{debit, credit},
+		CompanyID:     txn.CompanyID,
+		CreatedAt:     time.Now(),
+	}, nil
+}
+
+// ledgerLine targets an account or category, or suspense when the ID is unset
+func ledgerLine(kind LedgerKind, id primitive.ObjectID) JournalLine {
+	if id.IsZero() {
+		return JournalLine{Kind: LedgerKindSuspense}
+	}
+	return JournalLine{Kind: kind, RefID: id}
+}
+
+// IsBalanced checks that the entry has lines, none of them empty or mixed, and that debits equal credits
+func (e *JournalEntry) IsBalanced() bool {
+	if len(e.Lines) < 2 {
+		return false
+	}
+	var debits, credits Money
+	for _, line := range e.Lines {
+		if line.Debit < 0 || line.Credit < 0 || (line.Debit == 0) == (line.Credit == 0) {
+			return false
+		}
+		debits += line.Debit
+		credits += line.Credit
+	}
+	return debits == credits
+}
+
+// LedgerBalance totals the lines posted to one ledger account in one currency
+type LedgerBalance struct {
+	Kind     LedgerKind         `json:"kind" bson:"kind"`
+	RefID    primitive.ObjectID `json:"ref_id" bson:"ref_id"`
+	Currency string             `json:"currency" bson:"currency"`
+	Debit    Money              `json:"debit" bson:"debit"`
+	Credit   Money              `json:"credit" bson:"credit"`
+}
+
+// Balance returns debits minus credits; positive for accounts holding money and for expenses
+func (b LedgerBalance) Balance() Money {
+	return b.Debit - b.Credit
+}
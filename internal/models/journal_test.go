@@ -0,0 +1,145 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNewJournalEntry(t *testing.T) {
+	cash, bank, category := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	account := func(id primitive.ObjectID) JournalLine { return JournalLine{Kind: LedgerKindAccount, RefID: id} }
+	suspense := JournalLine{Kind: LedgerKindSuspense}
+
+	tests := []struct {
+		name          string
+		txnType       TransactionType
+		from, to      primitive.ObjectID
+		category      primitive.ObjectID
+		debit, credit JournalLine
+	}{
+		{"income", TransactionTypeIncome, primitive.NilObjectID, bank, category, account(bank), JournalLine{Kind: LedgerKindCategory, RefID: category}},
+		{"expense", TransactionTypeExpense, cash, primitive.NilObjectID, category, JournalLine{Kind: LedgerKindCategory, RefID: category}, account(cash)},
+		{"transfer", TransactionTypeTransfer, cash, bank, primitive.NilObjectID, account(bank), account(cash)},
+		{"income without an account", TransactionTypeIncome, primitive.NilObjectID, primitive.NilObjectID, category, suspense, JournalLine{Kind: LedgerKindCategory, RefID: category}},
+		{"income without a category", TransactionTypeIncome, primitive.NilObjectID, bank, primitive.NilObjectID, account(bank), suspense},
+		{"expense without a category", TransactionTypeExpense, cash, primitive.NilObjectID, primitive.NilObjectID, suspense, account(cash)},
+		{"expense without an account", TransactionTypeExpense, primitive.NilObjectID, primitive.NilObjectID, category, JournalLine{Kind: LedgerKindCategory, RefID: category}, suspense},
+		{"transfer without a destination", TransactionTypeTransfer, cash, primitive.NilObjectID, primitive.NilObjectID, suspense, account(cash)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txn := NewTransaction(tt.txnType, 12_50, "USD", primitive.NewObjectID(), primitive.NewObjectID(), "Alice")
+			txn.ID = primitive.NewObjectID()
+			txn.FromAccountID, txn.ToAccountID, txn.CategoryID = tt.from, tt.to, tt.category
+
+			entry, err := NewJournalEntry(txn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.debit.Debit = 12_50
+			tt.credit.Credit = 12_50
+			if len(entry.Lines) != 2 || entry.Lines[0] != tt.debit || entry.Lines[1] != tt.credit {
+				t.Errorf("lines %+v, want debit %+v and credit %+v", entry.Lines, tt.debit, tt.credit)
+			}
+			if !entry.IsBalanced() {
+				t.Error("the entry does not balance")
+			}
+			if entry.TransactionID != txn.ID || entry.Currency != "USD" || !entry.Date.Equal(txn.TransactionDate) || entry.CompanyID != txn.CompanyID {
+				t.Errorf("entry %+v does not carry the transaction's ID, currency, date and company", entry)
+			}
+		})
+	}
+}
+
+func TestNewJournalEntryForReversal(t *testing.T) {
+	cash, bank, category := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	tests := []struct {
+		name     string
+		txnType  TransactionType
+		from, to primitive.ObjectID
+		category primitive.ObjectID
+	}{
+		{"income", TransactionTypeIncome, primitive.NilObjectID, bank, category},
+		{"expense", TransactionTypeExpense, cash, primitive.NilObjectID, category},
+		{"transfer", TransactionTypeTransfer, cash, bank, primitive.NilObjectID},
+		{"expense without a category", TransactionTypeExpense, cash, primitive.NilObjectID, primitive.NilObjectID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txn := NewTransaction(tt.txnType, 12_50, "USD", primitive.NewObjectID(), primitive.NewObjectID(), "Alice")
+			txn.ID = primitive.NewObjectID()
+			txn.FromAccountID, txn.ToAccountID, txn.CategoryID = tt.from, tt.to, tt.category
+			reversal := NewReversal(txn, primitive.NewObjectID(), "Bob")
+
+			original, err := NewJournalEntry(txn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			entry, err := NewJournalEntry(reversal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !entry.IsBalanced() {
+				t.Error("the reversal's entry does not balance")
+			}
+			if entry.TransactionID != reversal.ID {
+				t.Errorf("the reversal's entry is for %s, want the reversal %s", entry.TransactionID.Hex(), reversal.ID.Hex())
+			}
+
+			// The reversal debits what the original credited and credits what it debited
+			debit, credit := original.Lines[1], original.Lines[0]
+			debit.Debit, debit.Credit = debit.Credit, 0
+			credit.Credit, credit.Debit = credit.Debit, 0
+			if len(entry.Lines) != 2 || entry.Lines[0] != debit || entry.Lines[1] != credit {
+				t.Errorf("lines %+v, want debit %+v and credit %+v", entry.Lines, debit, credit)
+			}
+		})
+	}
+}
+
+func TestNewJournalEntryRefusesInvalidTransactions(t *testing.T) {
+	tests := []struct {
+		name    string
+		txnType TransactionType
+		amount  Money
+		want    error
+	}{
+		{"unknown type", TransactionType("gift"), 10_00, ErrInvalidTransaction},
+		{"zero amount", TransactionTypeExpense, 0, ErrInvalidAmount},
+		{"negative amount", TransactionTypeIncome, -10_00, ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		txn := NewTransaction(tt.txnType, tt.amount, "USD", primitive.NewObjectID(), primitive.NewObjectID(), "Alice")
+		if entry, err := NewJournalEntry(txn); !errors.Is(err, tt.want) {
+			t.Errorf("%s: NewJournalEntry returned %+v, %v; want %v", tt.name, entry, err, tt.want)
+		}
+	}
+}
+
+func TestJournalEntryIsBalanced(t *testing.T) {
+	debit := func(m Money) JournalLine { return JournalLine{Kind: LedgerKindSuspense, Debit: m} }
+	credit := func(m Money) JournalLine { return JournalLine{Kind: LedgerKindSuspense, Credit: m} }
+
+	tests := []struct {
+		name  string
+		lines []JournalLine
+		want  bool
+	}{
+		{"one debit, one credit", []JournalLine{debit(10_00), credit(10_00)}, true},
+		{"split across three lines", []JournalLine{debit(10_00), credit(4_00), credit(6_00)}, true},
+		{"no lines", nil, false},
+		{"a single line", []JournalLine{debit(0)}, false},
+		{"debits exceed credits", []JournalLine{debit(10_01), credit(10_00)}, false},
+		{"an empty line", []JournalLine{debit(10_00), credit(10_00), {Kind: LedgerKindSuspense}}, false},
+		{"a line that is both", []JournalLine{{Kind: LedgerKindSuspense, Debit: 5_00, Credit: 5_00}, debit(1_00), credit(1_00)}, false},
+		{"negative amounts", []JournalLine{debit(-10_00), credit(-10_00)}, false},
+	}
+	for _, tt := range tests {
+		entry := JournalEntry{Lines: tt.lines}
+		if got := entry.IsBalanced(); got != tt.want {
+			t.Errorf("%s: IsBalanced = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+// Package models defines MongoDB models for the application
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LoginAttempt counts recent failed attempts for one account or IP address and action.
+// Documents expire on their own once the counting window has passed.
+type LoginAttempt struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Key           string             `json:"key" bson:"key"`         // scope:action:subject
+	Scope         string             `json:"scope" bson:"scope"`     // account or ip
+	Action        string             `json:"action" bson:"action"`   // signin, 2fa, verify_email, password_reset, reset_token
+	Subject       string             `json:"subject" bson:"subject"` // Email or IP address
+	Failures      int                `json:"failures" bson:"failures"`
+	LastFailureAt time.Time          `json:"last_failure_at" bson:"last_failure_at"`
+	LockedUntil   time.Time          `json:"locked_until,omitempty" bson:"locked_until,omitempty"`
+	ExpiresAt     time.Time          `json:"expires_at" bson:"expires_at"`
+}
+
+// IsLocked checks if the attempt counter is currently locked out
+func (a *LoginAttempt) IsLocked(now time.Time) bool {
+	return now.Before(a.LockedUntil)
+}
@@ -0,0 +1,154 @@
+// Package models defines MongoDB models for the application
+package models
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in the smallest unit of its currency (cents for USD, dong for VND).
+// Amounts are stored as integers so that sums over many transactions stay exact.
+type Money int64
+
+// zeroDecimalCurrencies have no minor unit
+var zeroDecimalCurrencies = map[string]bool{
+	"VND": true,
+	"JPY": true,
+	"KRW": true,
+}
+
+// threeDecimalCurrencies have a minor unit of a thousandth
+var threeDecimalCurrencies = map[string]bool{
+	"BHD": true,
+	"JOD": true,
+	"KWD": true,
+	"OMR": true,
+	"TND": true,
+}
+
+// currencySymbols are shown in front of formatted amounts
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+}
+
+// CurrencyDecimals returns how many decimal places a currency uses
+func CurrencyDecimals(currency string) int {
+	switch {
+	case zeroDecimalCurrencies[currency]:
+		return 0
+	case threeDecimalCurrencies[currency]:
+		return 3
+	}
+	return 2
+}
+
+// CurrencyStep returns the smallest amount a form input should accept, e.g. "0.01"
+func CurrencyStep(currency string) string {
+	decimals := CurrencyDecimals(currency)
+	if decimals == 0 {
+		return "1"
+	}
+	return "0." + strings.Repeat("0", decimals-1) + "1"
+}
+
+// ParseMoney parses a decimal string such as "12.50" into minor units without
+// going through float64. More decimal places than the currency allows is an error.
+func ParseMoney(s, currency string) (Money, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", "")
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, frac, _ := strings.Cut(s, ".")
+	decimals := CurrencyDecimals(currency)
+	if whole == "" && frac == "" {
+		return 0, ErrInvalidAmount
+	}
+	if len(frac) > decimals {
+		// Trailing zeros beyond the precision carry no value
+		if strings.Trim(frac[decimals:], "0") != "" {
+			return 0, ErrInvalidAmount
+		}
+		frac = frac[:decimals]
+	}
+	frac += strings.Repeat("0", decimals-len(frac))
+
+	digits := whole + frac
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return 0, ErrInvalidAmount
+		}
+	}
+	if digits == "" {
+		return 0, ErrInvalidAmount
+	}
+
+	if negative {
+		// Parsed with its sign so the smallest Money is still in range
+		digits = "-" + digits
+	}
+	units, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidAmount
+	}
+	return Money(units), nil
+}
+
+// MoneyFromFloat converts a legacy floating-point amount, rounding to the currency's precision
+func MoneyFromFloat(amount float64, currency string) Money {
+	return Money(math.Round(amount * math.Pow10(CurrencyDecimals(currency))))
+}
+
+// Float returns the amount in major units; only use it for charts and ratios
+func (m Money) Float(currency string) float64 {
+	return float64(m) / math.Pow10(CurrencyDecimals(currency))
+}
+
+// Decimal renders the amount without symbol or grouping, e.g. "1234.50", for form values
+func (m Money) Decimal(currency string) string {
+	sign := ""
+	units := uint64(m) // Negated as unsigned, so the smallest Money does not overflow
+	if m < 0 {
+		sign = "-"
+		units = -units
+	}
+
+	decimals := CurrencyDecimals(currency)
+	s := strconv.FormatUint(units, 10)
+	if decimals == 0 {
+		return sign + s
+	}
+	if len(s) <= decimals {
+		s = strings.Repeat("0", decimals-len(s)+1) + s
+	}
+	return sign + s[:len(s)-decimals] + "." + s[len(s)-decimals:]
+}
+
+// Format renders the amount for display, e.g. "$1,234.50" or "1,250,000 VND"
+func (m Money) Format(currency string) string {
+	s := m.Decimal(currency)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign = "-"
+		s = s[1:]
+	}
+
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	var grouped strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(r)
+	}
+	s = grouped.String()
+	if hasFrac {
+		s += "." + frac
+	}
+
+	if symbol, ok := currencySymbols[currency]; ok {
+		return sign + symbol + s
+	}
+	return sign + s + " " + currency
+}
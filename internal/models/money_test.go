@@ -0,0 +1,145 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in       string
+		currency string
+		want     Money
+		err      error
+	}{
+		{"12.50", "USD", 12_50, nil},
+		{"12.5", "USD", 12_50, nil},
+		{"12", "USD", 12_00, nil},
+		{".5", "USD", 50, nil},
+		{"5.", "USD", 5_00, nil},
+		{" 1,234.56 ", "USD", 1_234_56, nil},
+		{"-3.07", "USD", -3_07, nil},
+		{"12.500", "USD", 12_50, nil},
+		{"12.501", "USD", 0, ErrInvalidAmount},
+		{"1250000", "VND", 1_250_000, nil},
+		{"1250000.00", "VND", 1_250_000, nil},
+		{"1250000.5", "VND", 0, ErrInvalidAmount},
+		{"100", "JPY", 100, nil},
+		{"1.234", "KWD", 1_234, nil},
+		{"1.5", "KWD", 1_500, nil},
+		{"1.2345", "KWD", 0, ErrInvalidAmount},
+		{"92233720368547758.07", "USD", math.MaxInt64, nil},
+		{"-92233720368547758.08", "USD", math.MinInt64, nil},
+		{"92233720368547758.08", "USD", 0, ErrInvalidAmount},
+		{"9223372036854775808", "VND", 0, ErrInvalidAmount},
+		{"", "USD", 0, ErrInvalidAmount},
+		{".", "USD", 0, ErrInvalidAmount},
+		{"-", "USD", 0, ErrInvalidAmount},
+		{"1e3", "USD", 0, ErrInvalidAmount},
+		{"1.2.3", "USD", 0, ErrInvalidAmount},
+		{"--1", "USD", 0, ErrInvalidAmount},
+		{"+1", "USD", 0, ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in, tt.currency)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("ParseMoney(%q, %s) = %d, %v; want %d, %v", tt.in, tt.currency, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestMoneyFromFloat(t *testing.T) {
+	tests := []struct {
+		in       float64
+		currency string
+		want     Money
+	}{
+		{19.99, "USD", 19_99},
+		{0.1 + 0.2, "USD", 30},
+		{0.004, "USD", 0},
+		{0.006, "USD", 1},
+		{-0.006, "USD", -1},
+		{0.5, "VND", 1},
+		{-0.5, "VND", -1},
+		{2.5, "JPY", 3},
+		{1.5, "KWD", 1_500},
+	}
+	for _, tt := range tests {
+		if got := MoneyFromFloat(tt.in, tt.currency); got != tt.want {
+			t.Errorf("MoneyFromFloat(%v, %s) = %d, want %d", tt.in, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyDecimal(t *testing.T) {
+	tests := []struct {
+		in       Money
+		currency string
+		want     string
+	}{
+		{0, "USD", "0.00"},
+		{5, "USD", "0.05"},
+		{50, "USD", "0.50"},
+		{1_234_50, "USD", "1234.50"},
+		{-5, "USD", "-0.05"},
+		{-1_00, "USD", "-1.00"},
+		{1_250_000, "VND", "1250000"},
+		{-7, "JPY", "-7"},
+		{1_234, "KWD", "1.234"},
+		{5, "KWD", "0.005"},
+		{math.MaxInt64, "USD", "92233720368547758.07"},
+		{math.MinInt64, "USD", "-92233720368547758.08"},
+		{math.MinInt64, "VND", "-9223372036854775808"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.Decimal(tt.currency); got != tt.want {
+			t.Errorf("Money(%d).Decimal(%s) = %q, want %q", tt.in, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyFormat(t *testing.T) {
+	tests := []struct {
+		in       Money
+		currency string
+		want     string
+	}{
+		{0, "USD", "$0.00"},
+		{99, "USD", "$0.99"},
+		{1_234_50, "USD", "$1,234.50"},
+		{123_456_789_00, "EUR", "€123,456,789.00"},
+		{-1_234_50, "USD", "-$1,234.50"},
+		{100_000_00, "USD", "$100,000.00"},
+		{1_250_000, "VND", "1,250,000 VND"},
+		{-999, "JPY", "-999 JPY"},
+		{1_000, "JPY", "1,000 JPY"},
+		{12_345_678, "KWD", "12,345.678 KWD"},
+		{math.MinInt64, "VND", "-9,223,372,036,854,775,808 VND"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.Format(tt.currency); got != tt.want {
+			t.Errorf("Money(%d).Format(%s) = %q, want %q", tt.in, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyRoundTrip(t *testing.T) {
+	for _, currency := range []string{"USD", "VND", "KWD"} {
+		for _, m := range []Money{0, 1, -1, 10, 999, 1_000, -123_456, math.MaxInt64, math.MinInt64} {
+			got, err := ParseMoney(m.Decimal(currency), currency)
+			if err != nil || got != m {
+				t.Errorf("ParseMoney(Money(%d).Decimal(%s)) = %d, %v; want it back unchanged", m, currency, got, err)
+			}
+		}
+	}
+}
+
+func TestCurrencyStep(t *testing.T) {
+	tests := map[string]string{"USD": "0.01", "VND": "1", "KWD": "0.001"}
+	for currency, want := range tests {
+		if got := CurrencyStep(currency); got != want {
+			t.Errorf("CurrencyStep(%s) = %q, want %q", currency, got, want)
+		}
+	}
+}
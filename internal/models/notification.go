@@ -0,0 +1,37 @@
+// Package models defines MongoDB models for the application
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Notification is an in-app alert for one member of a company, shown until they dismiss it
+type Notification struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CompanyID primitive.ObjectID `json:"company_id" bson:"company_id"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Title     string             `json:"title" bson:"title"`
+	Message   string             `json:"message" bson:"message"`
+	Link      string             `json:"link,omitempty" bson:"link,omitempty"` // Where to follow it up in the app
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	ReadAt    time.Time          `json:"read_at,omitempty" bson:"read_at,omitempty"`
+}
+
+// NewNotification creates an unread notification for userID
+func NewNotification(userID primitive.ObjectID, title, message, link string) *Notification {
+	return &Notification{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Title:     title,
+		Message:   message,
+		Link:      link,
+		CreatedAt: time.Now(),
+	}
+}
+
+// IsRead checks if the user has dismissed the notification
+func (n *Notification) IsRead() bool {
+	return !n.ReadAt.IsZero()
+}
@@ -0,0 +1,54 @@
+// Package models defines MongoDB models for the application
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session represents a server-side login session.
+// The browser only holds an opaque random token; the database stores its SHA-256 hash.
+type Session struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TokenHash  string             `json:"-" bson:"token_hash"`
+	UserID     primitive.ObjectID `json:"user_id" bson:"user_id"`
+	CompanyID  primitive.ObjectID `json:"company_id" bson:"company_id"`
+	IPAddress  string             `json:"ip_address" bson:"ip_address"`
+	UserAgent  string             `json:"user_agent" bson:"user_agent"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+	LastSeenAt time.Time          `json:"last_seen_at" bson:"last_seen_at"`
+	ExpiresAt  time.Time          `json:"expires_at" bson:"expires_at"`
+	RevokedAt  time.Time          `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	// MFAPending marks a half-finished sign-in waiting for the second factor
+	MFAPending bool `json:"mfa_pending" bson:"mfa_pending"`
+}
+
+// NewSession creates a new session for a user
+func NewSession(tokenHash string, user *User, ip, userAgent string, ttl time.Duration) *Session {
+	now := time.Now()
+	return &Session{
+		ID:         primitive.NewObjectID(),
+		TokenHash:  tokenHash,
+		UserID:     user.ID,
+		CompanyID:  user.CompanyID,
+		IPAddress:  ip,
+		UserAgent:  userAgent,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+}
+
+// IsRevoked checks if the session was revoked
+func (s *Session) IsRevoked() bool {
+	return !s.RevokedAt.IsZero()
+}
+
+// IsExpired checks if the session is past its absolute expiry or has been idle too long
+func (s *Session) IsExpired(now time.Time, idleTimeout time.Duration) bool {
+	if now.After(s.ExpiresAt) {
+		return true
+	}
+	return idleTimeout > 0 && now.Sub(s.LastSeenAt) > idleTimeout
+}
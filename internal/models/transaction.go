@@ -2,6 +2,7 @@
 package models
 
 import (
+	"slices"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -16,20 +17,28 @@ const (
 	TransactionTypeTransfer TransactionType = "transfer"
 )
 
-// TransactionStatus represents the approval status
+// TransactionStatus is a transaction's place in its lifecycle. The allowed
+// transitions between them are enforced by the lifecycle package.
 type TransactionStatus string
 
 const (
-	TransactionStatusPending  TransactionStatus = "pending"
-	TransactionStatusApproved TransactionStatus = "approved"
-	TransactionStatusRejected TransactionStatus = "rejected"
+	TransactionStatusDraft    TransactionStatus = "draft"    // Saved by its creator, not yet submitted
+	TransactionStatusPending  TransactionStatus = "pending"  // Submitted and awaiting approval
+	TransactionStatusApproved TransactionStatus = "approved" // Money has moved
+	TransactionStatusRejected TransactionStatus = "rejected" // Returned to its creator, who may edit and resubmit
+	TransactionStatusPaid     TransactionStatus = "paid"     // Approved and settled
+	TransactionStatusVoided   TransactionStatus = "voided"   // Approved, then undone by a reversal
 )
 
+// PostedStatuses are the statuses of transactions whose money has moved.
+// A voided transaction stays posted; its reversal cancels it out.
+var PostedStatuses = []TransactionStatus{TransactionStatusApproved, TransactionStatusPaid, TransactionStatusVoided}
+
 // Transaction represents a financial transaction
 type Transaction struct {
 	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	Type            TransactionType    `json:"type" bson:"type"`
-	Amount          float64            `json:"amount" bson:"amount"`
+	Amount          Money              `json:"amount" bson:"amount"` // In minor units of Currency
 	Currency        string             `json:"currency" bson:"currency"`
 	Description     string             `json:"description" bson:"description"`
 	FromAccountID   primitive.ObjectID `json:"from_account_id,omitempty" bson:"from_account_id,omitempty"`
@@ -46,14 +55,63 @@ type Transaction struct {
 	CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt       time.Time          `json:"updated_at" bson:"updated_at"`
 	ApprovedAt      time.Time          `json:"approved_at,omitempty" bson:"approved_at,omitempty"`
+	PaidByID        primitive.ObjectID `json:"paid_by_id,omitempty" bson:"paid_by_id,omitempty"`
+	PaidByName      string             `json:"paid_by_name,omitempty" bson:"paid_by_name,omitempty"`
+	PaidAt          time.Time          `json:"paid_at,omitempty" bson:"paid_at,omitempty"`
+	// Every approval decision in order. ApprovalStep counts the steps signed off
+	// since the transaction was last submitted; its last ApprovalStep records are
+	// those sign-offs.
+	ApprovalStep    int              `json:"approval_step,omitempty" bson:"approval_step,omitempty"`
+	ApprovalHistory []ApprovalRecord `json:"approval_history,omitempty" bson:"approval_history,omitempty"`
+	// When it was last submitted for approval; unset on transactions created pending
+	SubmittedAt time.Time `json:"submitted_at,omitempty" bson:"submitted_at,omitempty"`
+	// How many times the current approval step has been escalated past the company's SLA
+	EscalationLevel int       `json:"escalation_level,omitempty" bson:"escalation_level,omitempty"`
+	EscalatedAt     time.Time `json:"escalated_at,omitempty" bson:"escalated_at,omitempty"`
+	// Set when it was submitted over a budget that asks for an extra sign-off to go over
+	BudgetOverride bool `json:"budget_override,omitempty" bson:"budget_override,omitempty"`
+	// Who the expense is charged to, for budgets scoped to them: its submitter and
+	// their department when it was created. A correction keeps the original's.
+	EmployeeID primitive.ObjectID `json:"employee_id,omitempty" bson:"employee_id,omitempty"`
+	Department string             `json:"department,omitempty" bson:"department,omitempty"`
+	// Approved transactions are never changed in place. Correcting or voiding one
+	// posts a reversal that undoes it, and an edit also creates a pending replacement.
+	ReversesID   primitive.ObjectID `json:"reverses_id,omitempty" bson:"reverses_id,omitempty"`       // On a reversal: the transaction it undoes
+	ReversedByID primitive.ObjectID `json:"reversed_by_id,omitempty" bson:"reversed_by_id,omitempty"` // On the original: its reversal
+	ReplacesID   primitive.ObjectID `json:"replaces_id,omitempty" bson:"replaces_id,omitempty"`       // On a replacement: the transaction it corrects
+	ReplacedByID primitive.ObjectID `json:"replaced_by_id,omitempty" bson:"replaced_by_id,omitempty"` // On the original: its replacement
 	// Populated fields (not stored in DB)
 	FromAccountName string `json:"from_account_name,omitempty" bson:"-"`
 	ToAccountName   string `json:"to_account_name,omitempty" bson:"-"`
 	CategoryName    string `json:"category_name,omitempty" bson:"-"`
 }
 
+// ApprovalRecord is one approval decision on a transaction
+type ApprovalRecord struct {
+	Step         int                `json:"step" bson:"step"` // Which step it decided, from 1
+	StepName     string             `json:"step_name" bson:"step_name"`
+	Status       TransactionStatus  `json:"status" bson:"status"` // Approved, or rejected for a rejection
+	ApproverID   primitive.ObjectID `json:"approver_id" bson:"approver_id"`
+	ApproverName string             `json:"approver_name" bson:"approver_name"`
+	// Set when the approver decided with this user's delegated authority
+	OnBehalfOfID   primitive.ObjectID `json:"on_behalf_of_id,omitempty" bson:"on_behalf_of_id,omitempty"`
+	OnBehalfOfName string             `json:"on_behalf_of_name,omitempty" bson:"on_behalf_of_name,omitempty"`
+	Comment        string             `json:"comment,omitempty" bson:"comment,omitempty"`
+	// When the step started waiting on a decision, for turnaround reporting
+	WaitingSince time.Time `json:"waiting_since,omitempty" bson:"waiting_since,omitempty"`
+	At           time.Time `json:"at" bson:"at"`
+}
+
+// Turnaround is how long the step waited for this decision, or zero when unknown
+func (r ApprovalRecord) Turnaround() time.Duration {
+	if r.WaitingSince.IsZero() || r.At.Before(r.WaitingSince) {
+		return 0
+	}
+	return r.At.Sub(r.WaitingSince)
+}
+
 // NewTransaction creates a new transaction
-func NewTransaction(txType TransactionType, amount float64, currency string, companyID, createdByID primitive.ObjectID, createdByName string) *Transaction {
+func NewTransaction(txType TransactionType, amount Money, currency string, companyID, createdByID primitive.ObjectID, createdByName string) *Transaction {
 	now := time.Now()
 	return &Transaction{
 		Type:            txType,
@@ -87,6 +145,116 @@ func (t *Transaction) Reject(approverID primitive.ObjectID, approverName, reason
 	t.UpdatedAt = time.Now()
 }
 
+// NewReversal builds an approved transaction that undoes txn, posted now by approver
+func NewReversal(txn *Transaction, approverID primitive.ObjectID, approverName string) *Transaction {
+	now := time.Now()
+	return &Transaction{
+		ID:              primitive.NewObjectID(),
+		Type:            txn.Type,
+		Amount:          txn.Amount,
+		Currency:        txn.Currency,
+		Description:     "Reversal of " + txn.Description,
+		FromAccountID:   txn.FromAccountID,
+		ToAccountID:     txn.ToAccountID,
+		CategoryID:      txn.CategoryID,
+		Status:          TransactionStatusApproved,
+		CreatedByID:     approverID,
+		CreatedByName:   approverName,
+		ApprovedByID:    approverID,
+		ApprovedByName:  approverName,
+		CompanyID:       txn.CompanyID,
+		TransactionDate: now,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		ApprovedAt:      now,
+		ReversesID:      txn.ID,
+	}
+}
+
+// SignOffs returns the approval steps signed off since the transaction was last submitted
+func (t *Transaction) SignOffs() []ApprovalRecord {
+	if t.ApprovalStep <= 0 || t.ApprovalStep > len(t.ApprovalHistory) {
+		return nil
+	}
+	return t.ApprovalHistory[len(t.ApprovalHistory)-t.ApprovalStep:]
+}
+
+// WaitingSince is when the transaction's current approval step started waiting:
+// the last sign-off, or else its submission
+func (t *Transaction) WaitingSince() time.Time {
+	if signOffs := t.SignOffs(); len(signOffs) > 0 {
+		return signOffs[len(signOffs)-1].At
+	}
+	if !t.SubmittedAt.IsZero() {
+		return t.SubmittedAt
+	}
+	return t.CreatedAt
+}
+
+// Employee is who the transaction is charged to: EmployeeID, or its creator on
+// transactions from before that was recorded
+func (t *Transaction) Employee() primitive.ObjectID {
+	if t.EmployeeID.IsZero() {
+		return t.CreatedByID
+	}
+	return t.EmployeeID
+}
+
+// IsReversal checks if the transaction undoes another one
+func (t *Transaction) IsReversal() bool {
+	return !t.ReversesID.IsZero()
+}
+
+// IsReversed checks if the transaction has been undone by a reversal
+func (t *Transaction) IsReversed() bool {
+	return !t.ReversedByID.IsZero()
+}
+
+// IsLinkedTo checks if the transaction is id itself or its reversal, replacement or original
+func (t *Transaction) IsLinkedTo(id primitive.ObjectID) bool {
+	return t.ID == id || t.ReversesID == id || t.ReversedByID == id || t.ReplacesID == id || t.ReplacedByID == id
+}
+
+// SignedAmount is the amount as it counts toward totals: negative for a reversal
+func (t *Transaction) SignedAmount() Money {
+	if t.IsReversal() {
+		return -t.Amount
+	}
+	return t.Amount
+}
+
+// BalanceChange is the amount a transaction moves into (positive) or out of one account
+type BalanceChange struct {
+	AccountID primitive.ObjectID
+	Delta     Money
+}
+
+// BalanceChanges lists how approving the transaction changes account balances
+func (t *Transaction) BalanceChanges() []BalanceChange {
+	var changes []BalanceChange
+	add := func(accountID primitive.ObjectID, delta Money) {
+		if !accountID.IsZero() {
+			changes = append(changes, BalanceChange{AccountID: accountID, Delta: delta})
+		}
+	}
+
+	// A reversal moves the money back
+	amount := t.SignedAmount()
+	switch t.Type {
+	case TransactionTypeIncome:
+		// Add to destination account
+		add(t.ToAccountID, amount)
+	case TransactionTypeExpense:
+		// Subtract from source account
+		add(t.FromAccountID, -amount)
+	case TransactionTypeTransfer:
+		// Subtract from source, add to destination
+		add(t.FromAccountID, -amount)
+		add(t.ToAccountID, amount)
+	}
+	return changes
+}
+
 // IsPending checks if transaction is pending approval
 func (t *Transaction) IsPending() bool {
 	return t.Status == TransactionStatusPending
@@ -97,6 +265,11 @@ func (t *Transaction) IsApproved() bool {
 	return t.Status == TransactionStatusApproved
 }
 
+// IsPosted checks if the transaction's money has moved
+func (t *Transaction) IsPosted() bool {
+	return slices.Contains(PostedStatuses, t.Status)
+}
+
 // TransactionTypeDisplayName returns human-readable name
 func TransactionTypeDisplayName(t TransactionType) string {
 	switch t {
@@ -114,12 +287,18 @@ func TransactionTypeDisplayName(t TransactionType) string {
 // TransactionStatusDisplayName returns human-readable status
 func TransactionStatusDisplayName(s TransactionStatus) string {
 	switch s {
+	case TransactionStatusDraft:
+		return "Draft"
 	case TransactionStatusPending:
 		return "Pending"
 	case TransactionStatusApproved:
 		return "Approved"
 	case TransactionStatusRejected:
 		return "Rejected"
+	case TransactionStatusPaid:
+		return "Paid"
+	case TransactionStatusVoided:
+		return "Voided"
 	default:
 		return string(s)
 	}
@@ -137,7 +316,8 @@ func IsValidTransactionType(t string) bool {
 // IsValidTransactionStatus checks if the status is valid
 func IsValidTransactionStatus(s string) bool {
 	switch TransactionStatus(s) {
-	case TransactionStatusPending, TransactionStatusApproved, TransactionStatusRejected:
+	case TransactionStatusDraft, TransactionStatusPending, TransactionStatusApproved,
+		TransactionStatusRejected, TransactionStatusPaid, TransactionStatusVoided:
 		return true
 	}
 	return false
@@ -15,6 +15,7 @@ type User struct {
 	Name            string             `json:"name" bson:"name"`
 	Role            string             `json:"role" bson:"role"`                         // RBAC role
 	CompanyID       primitive.ObjectID `json:"company_id" bson:"company_id"`             // Company association
+	Department      string             `json:"department,omitempty" bson:"department,omitempty"` // Department or cost center their expenses are charged to
 	AvatarFileID    primitive.ObjectID `json:"avatar_file_id,omitempty" bson:"avatar_file_id,omitempty"`
 	CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt       time.Time          `json:"updated_at" bson:"updated_at"`
@@ -27,5 +28,12 @@ type User struct {
 	// Password reset
 	ResetToken      string             `json:"-" bson:"reset_token,omitempty"`
 	ResetExpiresAt  time.Time          `json:"-" bson:"reset_expires_at,omitempty"`
+	// Two-factor authentication
+	TOTPEnabled        bool      `json:"totp_enabled" bson:"totp_enabled"`
+	TOTPSecret         string    `json:"-" bson:"totp_secret,omitempty"`
+	TOTPPendingSecret  string    `json:"-" bson:"totp_pending_secret,omitempty"` // Awaiting confirmation code
+	TOTPLastStep       int64     `json:"-" bson:"totp_last_step,omitempty"`      // Last accepted time step, prevents code replay
+	TOTPEnabledAt      time.Time `json:"totp_enabled_at,omitempty" bson:"totp_enabled_at,omitempty"`
+	RecoveryCodeHashes []string  `json:"-" bson:"recovery_code_hashes,omitempty"`
 }
 
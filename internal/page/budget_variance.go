@@ -0,0 +1,187 @@
+package page
+
+import (
+	"cmp"
+	"encoding/csv"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minhtranin/ct/internal/auth"
+	"github.com/minhtranin/ct/internal/budgeting"
+	"github.com/minhtranin/ct/internal/handler"
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/render"
+	"github.com/minhtranin/ct/internal/repository"
+	view "github.com/minhtranin/ct/internal/view/components"
+	"github.com/minhtranin/ct/internal/view/layouts"
+)
+
+// How many periods the budget variance report looks back over, the last included
+const (
+	varianceMonths   = 6
+	varianceQuarters = 4
+)
+
+// BudgetVariancePage handles GET /reports/budgets
+func BudgetVariancePage(c *fiber.Ctx) error {
+	user, err := getUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	if !auth.CanGenerateReports(user.Role) {
+		return c.Redirect("/dashboard")
+	}
+
+	repos, err := handler.Repos(c)
+	if err != nil {
+		return c.Redirect("/dashboard")
+	}
+
+	data, transactions, err := budgetVariance(c, repos)
+	if err != nil {
+		return c.Redirect("/reports?error=Failed+to+load+budgets")
+	}
+
+	// Drill down into the expenses behind one line's actual spend in one period
+	for _, row := range data.Rows {
+		if row.Line.Key() != c.Query("line") {
+			continue
+		}
+		for _, v := range row.Line.Periods {
+			if v.Period.Start.Format("2006-01-02") == c.Query("period") {
+				data.Drill = &view.BudgetVarianceDrill{
+					Name:         row.Name,
+					Currency:     row.Line.Currency,
+					Variance:     v,
+					Transactions: budgeting.Contributing(transactions, row.Line, v.Period),
+				}
+			}
+		}
+	}
+
+	if isHTMXRequest(c) {
+		return render.HTML(c, view.BudgetVariancePage(data))
+	}
+
+	return render.HTML(c, layouts.Dashboard("Budget vs Actual", view.BudgetVariancePage(data), false, user.Email, user.Role, c.Path()))
+}
+
+// BudgetVarianceExport handles GET /reports/budgets/export, downloading the
+// report as CSV with a row per budget scope, currency and period
+func BudgetVarianceExport(c *fiber.Ctx) error {
+	user, err := getUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	if !auth.CanGenerateReports(user.Role) {
+		return c.Redirect("/dashboard")
+	}
+
+	repos, err := handler.Repos(c)
+	if err != nil {
+		return c.Redirect("/dashboard")
+	}
+
+	data, _, err := budgetVariance(c, repos)
+	if err != nil {
+		return c.Redirect("/reports/budgets?error=Failed+to+load+budgets")
+	}
+
+	c.Attachment(fmt.Sprintf("budget-vs-actual-%s-%s.csv", data.By, data.Through))
+	// The writer keeps the first error it hits and skips every later write, so
+	// checking w.Error once the rows are flushed covers each Write
+	w := csv.NewWriter(c)
+	w.Write([]string{"Budget Scope", "Currency", "Period", "Start", "End", "Budgeted", "Actual", "Variance", "Variance %"})
+	for _, row := range data.Rows {
+		currency := row.Line.Currency
+		for _, v := range row.Line.Periods {
+			percent := ""
+			if p, ok := v.Percent(); ok {
+				percent = fmt.Sprintf("%.1f", p)
+			}
+			w.Write([]string{
+				spreadsheetText(row.Name),
+				currency,
+				v.Period.Label(),
+				v.Period.Start.Format("2006-01-02"),
+				v.Period.End.AddDate(0, 0, -1).Format("2006-01-02"),
+				v.Budgeted.Decimal(currency),
+				v.Actual.Decimal(currency),
+				v.Amount().Decimal(currency),
+				percent,
+			})
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// spreadsheetText keeps a spreadsheet from running text as a formula, e.g. a
+// budget or department named "=HYPERLINK(...)", by quoting its first character
+func spreadsheetText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// budgetVariance builds the budget variance report the query asks for: by
+// month or quarter, through the period holding the given month. It also
+// returns the expenses it was built from.
+func budgetVariance(c *fiber.Ctx, repos *repository.Repositories) (view.BudgetVarianceData, []models.Transaction, error) {
+	data := view.BudgetVarianceData{
+		By:       string(budgeting.GranularityMonth),
+		Currency: handler.CompanyCurrency(c, repos),
+	}
+	count := varianceMonths
+	if by := c.Query("by"); budgeting.IsValidGranularity(by) {
+		data.By = by
+	}
+	if budgeting.Granularity(data.By) == budgeting.GranularityQuarter {
+		count = varianceQuarters
+	}
+	// Periods follow the calendar of the company's timezone, like budgets
+	loc := handler.CompanyLocation(c, repos)
+	through := time.Now().In(loc)
+	if month, err := time.ParseInLocation("2006-01", c.Query("through"), loc); err == nil {
+		through = month
+	}
+	data.Through = through.Format("2006-01")
+
+	periods := budgeting.Periods(budgeting.Granularity(data.By), through, count)
+	budgets, err := repos.Budgets.List(c.Context(), false)
+	if err != nil {
+		return data, nil, err
+	}
+	transactions, err := repos.Transactions.List(c.Context(), repository.TransactionFilter{
+		Type:   models.TransactionTypeExpense,
+		Posted: true,
+		From:   periods[0].Start,
+		Until:  periods[len(periods)-1].End,
+	}, repository.Page{})
+	if err != nil {
+		return data, nil, err
+	}
+	names, err := budgeting.LoadScopeNames(c.Context(), repos)
+	if err != nil {
+		return data, nil, err
+	}
+
+	data.Periods = periods
+	lines := budgeting.Variances(budgets, transactions, periods)
+	for _, line := range lines {
+		data.Rows = append(data.Rows, view.BudgetVarianceRow{Name: names.Describe(line.Scope), Line: line})
+	}
+	slices.SortFunc(data.Rows, func(a, b view.BudgetVarianceRow) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.Line.Currency, b.Line.Currency))
+	})
+	for _, total := range budgeting.VarianceTotals(lines, transactions) {
+		data.Totals = append(data.Totals, view.BudgetVarianceRow{Name: "Total", Line: total})
+	}
+	return data, transactions, nil
+}
@@ -5,29 +5,18 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	"github.com/minhtranin/ct/internal/handler"
 	"github.com/minhtranin/ct/internal/models"
 	"github.com/minhtranin/ct/internal/render"
+	"github.com/minhtranin/ct/internal/repository"
 	view "github.com/minhtranin/ct/internal/view/components"
 	"github.com/minhtranin/ct/internal/view/layouts"
-	"go.mongodb.org/mongo-driver/bson"
 )
 
 // getUser fetches user from session and database, returns user and role
 func getUser(f *fiber.Ctx) (*models.User, error) {
-	userID, err := handler.GetSession(f)
-	if err != nil {
-		return nil, err
-	}
-
-	db := handler.GetDB()
-	usersCollection := db.Database("ct").Collection("users")
-
-	var user models.User
-	objectID, _ := primitive.ObjectIDFromHex(userID)
-	err = usersCollection.FindOne(f.Context(), bson.M{"_id": objectID}).Decode(&user)
+	user, err := handler.CurrentUser(f)
 	if err != nil {
 		return nil, err
 	}
@@ -37,7 +26,7 @@ func getUser(f *fiber.Ctx) (*models.User, error) {
 		user.Role = "employee"
 	}
 
-	return &user, nil
+	return user, nil
 }
 
 // isHTMXRequest checks if the request is an HTMX request
@@ -90,38 +79,43 @@ func Dashboard(f *fiber.Ctx) error {
 		return f.Redirect("/signin")
 	}
 
-	db := handler.GetDB()
-
-	// Fetch accounts for the company
+	// Users without a company see an empty dashboard
 	var accounts []models.Account
-	accountsCursor, _ := db.Database("ct").Collection("accounts").Find(f.Context(), bson.M{
-		"company_id": user.CompanyID,
-		"is_active":  true,
-	})
-	if accountsCursor != nil {
-		accountsCursor.All(f.Context(), &accounts)
-	}
+	var budgets []models.Budget
+	var transactions []models.Transaction
+	var pendingCount int64
+	var notifications []models.Notification
+	currency := "USD"
+	sixMonthsAgo := time.Now().AddDate(0, -6, 0)
 
-	// Calculate total balance
-	var totalBalance float64
-	for _, acc := range accounts {
-		totalBalance += acc.Balance
-	}
+	if repos, err := handler.Repos(f); err == nil {
+		currency = handler.CompanyCurrency(f, repos)
 
-	// Count pending approvals
-	pendingCount, _ := db.Database("ct").Collection("transactions").CountDocuments(f.Context(), bson.M{
-		"company_id": user.CompanyID,
-		"status":     "pending",
-	})
+		// Fetch accounts and budgets for the company
+		accounts, _ = repos.Accounts.List(f.Context(), true)
+		budgets, _ = repos.Budgets.List(f.Context(), true)
 
-	// Fetch budgets for the company
-	var budgets []models.Budget
-	budgetsCursor, _ := db.Database("ct").Collection("budgets").Find(f.Context(), bson.M{
-		"company_id": user.CompanyID,
-		"is_active":  true,
-	})
-	if budgetsCursor != nil {
-		budgetsCursor.All(f.Context(), &budgets)
+		// Alerts the user has not dismissed yet
+		notifications, _ = repos.Notifications.List(f.Context(), user.ID, true)
+
+		// Count pending approvals
+		pendingCount, _ = repos.Transactions.Count(f.Context(), repository.TransactionFilter{
+			Status: models.TransactionStatusPending,
+		})
+
+		// Fetch posted transactions for last 6 months for chart
+		transactions, _ = repos.Transactions.List(f.Context(), repository.TransactionFilter{
+			Posted: true,
+			From:   sixMonthsAgo,
+		}, repository.Page{})
+	}
+
+	// Calculate total balance; accounts in other currencies cannot be added without a rate
+	var totalBalance models.Money
+	for _, acc := range accounts {
+		if acc.Currency == currency {
+			totalBalance += acc.Balance
+		}
 	}
 
 	// Build budget summaries (for now, show budget amount as limit, 0 spent)
@@ -129,40 +123,29 @@ func Dashboard(f *fiber.Ctx) error {
 	for _, budget := range budgets {
 		summary := view.BudgetSummary{
 			Name:        budget.Name,
+			Currency:    budget.Currency,
 			Spent:       budget.Spent,
-			Limit:       budget.Amount,
-			Utilization: 0,
+			Limit:       budget.Limit(),
+			Utilization: budget.Utilization(),
 			Color:       "#6366f1", // indigo
 		}
-		if budget.Amount > 0 {
-			summary.Utilization = (budget.Spent / budget.Amount) * 100
-		}
 		budgetSummaries = append(budgetSummaries, summary)
 	}
 
-	// Fetch approved transactions for last 6 months for chart
-	sixMonthsAgo := time.Now().AddDate(0, -6, 0)
-	var transactions []models.Transaction
-	txnCursor, _ := db.Database("ct").Collection("transactions").Find(f.Context(), bson.M{
-		"company_id":       user.CompanyID,
-		"status":           models.TransactionStatusApproved,
-		"transaction_date": bson.M{"$gte": sixMonthsAgo},
-	})
-	if txnCursor != nil {
-		txnCursor.All(f.Context(), &transactions)
-	}
-
 	// Build monthly chart data
 	monthlyData := make(map[string]*view.MonthlyChartPoint)
 	for _, txn := range transactions {
+		if txn.Currency != currency {
+			continue
+		}
 		monthKey := txn.TransactionDate.Format("Jan 2006")
 		if _, exists := monthlyData[monthKey]; !exists {
 			monthlyData[monthKey] = &view.MonthlyChartPoint{Label: txn.TransactionDate.Format("Jan")}
 		}
 		if txn.Type == models.TransactionTypeIncome {
-			monthlyData[monthKey].Income += txn.Amount
+			monthlyData[monthKey].Income += txn.SignedAmount()
 		} else if txn.Type == models.TransactionTypeExpense {
-			monthlyData[monthKey].Expense += txn.Amount
+			monthlyData[monthKey].Expense += txn.SignedAmount()
 		}
 	}
 
@@ -182,6 +165,7 @@ func Dashboard(f *fiber.Ctx) error {
 	// Build dashboard data
 	data := view.DashboardData{
 		User:             user,
+		Currency:         currency,
 		TotalBalance:     totalBalance,
 		MonthIncome:      0, // TODO: Calculate from transactions
 		MonthExpense:     0, // TODO: Calculate from transactions
@@ -189,6 +173,7 @@ func Dashboard(f *fiber.Ctx) error {
 		Accounts:         accounts,
 		BudgetSummaries:  budgetSummaries,
 		MonthlyChartData: monthlyChartData,
+		Notifications:    notifications,
 	}
 
 	// Check if HTMX request - return only content
@@ -234,11 +219,8 @@ func VerifyEmailPage(f *fiber.Ctx) error {
 	}
 
 	// Fetch user from database
-	db := handler.GetDB()
-	usersCollection := db.Database("ct").Collection("users")
-
-	var user models.User
-	err := usersCollection.FindOne(f.Context(), bson.M{"email": email}).Decode(&user)
+	identities := handler.Identities()
+	user, err := identities.FindByEmail(f.Context(), email)
 	if err != nil {
 		return f.Redirect("/signup")
 	}
@@ -263,11 +245,7 @@ func VerifyEmailPage(f *fiber.Ctx) error {
 		handler.SendVerificationEmail(email, user.VerifyToken)
 
 		// Update LastEmailSentAt
-		usersCollection.UpdateOne(f.Context(), bson.M{"_id": user.ID}, bson.M{
-			"$set": bson.M{
-				"last_email_sent_at": time.Now(),
-			},
-		})
+		identities.RecordEmailSent(f.Context(), user.ID, time.Now())
 	}
 
 	// Render page with LastEmailSentAt
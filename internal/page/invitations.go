@@ -0,0 +1,30 @@
+package page
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/minhtranin/ct/internal/auth"
+	"github.com/minhtranin/ct/internal/handler"
+	"github.com/minhtranin/ct/internal/render"
+	view "github.com/minhtranin/ct/internal/view/components"
+	"github.com/minhtranin/ct/internal/view/layouts"
+)
+
+// AcceptInvitation handles GET /invitations/accept
+func AcceptInvitation(f *fiber.Ctx) error {
+	token := f.Query("token")
+
+	data := view.AcceptInvitationData{Token: token}
+	if details, err := handler.FindInvitation(f, token); err == nil {
+		data.Valid = true
+		data.Email = details.Invitation.Email
+		data.RoleName = auth.RoleDisplayName(details.Invitation.Role)
+		data.CompanyName = details.CompanyName
+		data.InviterName = details.Invitation.InvitedByName
+		data.ExistingAccount = details.ExistingAccount
+	}
+
+	return render.HTML(
+		f,
+		layouts.Base("Accept Invitation", view.AcceptInvitationPage(data)),
+	)
+}
@@ -0,0 +1,160 @@
+package page
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minhtranin/ct/internal/auth"
+	"github.com/minhtranin/ct/internal/handler"
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/reconcile"
+	"github.com/minhtranin/ct/internal/render"
+	view "github.com/minhtranin/ct/internal/view/components"
+	"github.com/minhtranin/ct/internal/view/layouts"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TrialBalancePage handles GET /reports/trial-balance
+func TrialBalancePage(c *fiber.Ctx) error {
+	user, err := getUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	if !auth.CanGenerateReports(user.Role) {
+		return c.Redirect("/dashboard")
+	}
+
+	repos, err := handler.Repos(c)
+	if err != nil {
+		return c.Redirect("/dashboard")
+	}
+
+	// An as-of date includes that whole day in the company's timezone
+	var asOf time.Time
+	data := view.TrialBalanceData{}
+	if date := c.Query("date"); date != "" {
+		if t, err := time.ParseInLocation("2006-01-02", date, handler.CompanyLocation(c, repos)); err == nil {
+			asOf = t.AddDate(0, 0, 1)
+			data.AsOf = date
+		}
+	}
+
+	balances, _ := repos.Journal.Balances(c.Context(), asOf)
+	accounts, _ := repos.Accounts.List(c.Context(), false)
+	categories, _ := repos.Categories.List(c.Context(), false)
+
+	accountsByID := make(map[primitive.ObjectID]models.Account)
+	for _, acc := range accounts {
+		accountsByID[acc.ID] = acc
+	}
+	categoryNames := make(map[primitive.ObjectID]string)
+	for _, cat := range categories {
+		categoryNames[cat.ID] = cat.Name
+	}
+
+	// Stored balances are current, so they can only be checked on the all-time view
+	checkRecorded := asOf.IsZero()
+	posted := make(map[primitive.ObjectID]bool)
+	totals := make(map[string]*view.TrialBalanceTotal)
+	var currencies []string
+
+	addRow := func(row view.TrialBalanceRow) {
+		data.Rows = append(data.Rows, row)
+		total, ok := totals[row.Currency]
+		if !ok {
+			total = &view.TrialBalanceTotal{Currency: row.Currency}
+			totals[row.Currency] = total
+			currencies = append(currencies, row.Currency)
+		}
+		total.Debit += row.Debit
+		total.Credit += row.Credit
+	}
+
+	for _, balance := range balances {
+		row := view.TrialBalanceRow{
+			Kind:     balance.Kind,
+			Currency: balance.Currency,
+		}
+		if net := balance.Balance(); net >= 0 {
+			row.Debit = net
+		} else {
+			row.Credit = -net
+		}
+
+		switch balance.Kind {
+		case models.LedgerKindAccount:
+			acc := accountsByID[balance.RefID]
+			row.Name = acc.Name
+			if checkRecorded && acc.Currency == balance.Currency {
+				recorded := acc.Balance
+				row.Recorded = &recorded
+				posted[acc.ID] = true
+			}
+		case models.LedgerKindCategory:
+			row.Name = categoryNames[balance.RefID]
+		case models.LedgerKindSuspense:
+			row.Name = "Unassigned"
+		}
+		if row.Name == "" {
+			row.Name = "Unknown " + string(balance.Kind)
+		}
+		addRow(row)
+	}
+
+	// Accounts holding money that the ledger never saw are discrepancies too
+	if checkRecorded {
+		for _, acc := range accounts {
+			if acc.Balance == 0 || posted[acc.ID] {
+				continue
+			}
+			recorded := acc.Balance
+			addRow(view.TrialBalanceRow{
+				Name:     acc.Name,
+				Kind:     models.LedgerKindAccount,
+				Currency: acc.Currency,
+				Recorded: &recorded,
+			})
+		}
+	}
+
+	for _, currency := range currencies {
+		data.Totals = append(data.Totals, *totals[currency])
+	}
+
+	if isHTMXRequest(c) {
+		return render.HTML(c, view.TrialBalancePage(data))
+	}
+
+	return render.HTML(c, layouts.Dashboard("Trial Balance", view.TrialBalancePage(data), false, user.Email, user.Role, c.Path()))
+}
+
+// ReconcilePage handles GET /reconcile
+func ReconcilePage(c *fiber.Ctx) error {
+	user, err := getUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	if !auth.CanReconcile(user.Role) {
+		return c.Redirect("/dashboard")
+	}
+
+	repos, err := handler.Repos(c)
+	if err != nil {
+		return c.Redirect("/dashboard")
+	}
+
+	discrepancies, err := reconcile.Check(c.Context(), repos)
+	if err != nil {
+		return c.Redirect("/dashboard?error=Failed+to+reconcile")
+	}
+
+	data := view.ReconcileData{Discrepancies: discrepancies}
+
+	if isHTMXRequest(c) {
+		return render.HTML(c, view.ReconcilePage(data))
+	}
+
+	return render.HTML(c, layouts.Dashboard("Reconciliation", view.ReconcilePage(data), false, user.Email, user.Role, c.Path()))
+}
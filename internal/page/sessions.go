@@ -0,0 +1,72 @@
+package page
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/minhtranin/ct/internal/auth"
+	"github.com/minhtranin/ct/internal/handler"
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/render"
+	view "github.com/minhtranin/ct/internal/view/components"
+	"github.com/minhtranin/ct/internal/view/layouts"
+)
+
+// SessionsPage handles GET /sessions
+func SessionsPage(c *fiber.Ctx) error {
+	user, err := getUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	var currentSessionID string
+	if current, err := handler.CurrentSession(c); err == nil {
+		currentSessionID = current.ID.Hex()
+	}
+
+	mySessions, _ := handler.ActiveSessionsForUser(c, user.ID)
+
+	data := view.SessionsData{
+		CanManageTeam: auth.CanManageTeam(user.Role),
+	}
+	for _, session := range mySessions {
+		data.MySessions = append(data.MySessions, view.SessionRow{
+			Session:   session,
+			UserName:  user.Name,
+			UserEmail: user.Email,
+			Device:    auth.DescribeUserAgent(session.UserAgent),
+			IsCurrent: session.ID.Hex() == currentSessionID,
+		})
+	}
+
+	// Managers also see everyone else's sessions in the company
+	if data.CanManageTeam && !user.CompanyID.IsZero() {
+		companySessions, _ := handler.ActiveSessionsForCompany(c, user.CompanyID)
+
+		var users []models.User
+		if repos, err := handler.Repos(c); err == nil {
+			users, _ = repos.Users.List(c.Context())
+		}
+		usersByID := make(map[string]models.User)
+		for _, u := range users {
+			usersByID[u.ID.Hex()] = u
+		}
+
+		for _, session := range companySessions {
+			if session.UserID == user.ID {
+				continue
+			}
+			owner := usersByID[session.UserID.Hex()]
+			data.TeamSessions = append(data.TeamSessions, view.SessionRow{
+				Session:   session,
+				UserName:  owner.Name,
+				UserEmail: owner.Email,
+				Device:    auth.DescribeUserAgent(session.UserAgent),
+			})
+		}
+	}
+
+	if isHTMXRequest(c) {
+		return render.HTML(c, view.SessionsPage(data))
+	}
+
+	return render.HTML(c, layouts.Dashboard("Active Sessions", view.SessionsPage(data), false, user.Email, user.Role, c.Path()))
+}
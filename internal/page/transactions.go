@@ -1,19 +1,22 @@
 package page
 
 import (
+	"fmt"
+	"slices"
 	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/minhtranin/ct/internal/auth"
+	"github.com/minhtranin/ct/internal/budgeting"
 	"github.com/minhtranin/ct/internal/handler"
+	"github.com/minhtranin/ct/internal/lifecycle"
 	"github.com/minhtranin/ct/internal/models"
 	"github.com/minhtranin/ct/internal/render"
+	"github.com/minhtranin/ct/internal/repository"
 	view "github.com/minhtranin/ct/internal/view/components"
 	"github.com/minhtranin/ct/internal/view/layouts"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const pageSize = 20
@@ -25,53 +28,35 @@ func TransactionsPage(c *fiber.Ctx) error {
 		return c.Redirect("/signin")
 	}
 
-	db := handler.GetDB()
-
-	// Fetch accounts for dropdown
-	var accounts []models.Account
-	accountsCursor, _ := db.Database("ct").Collection("accounts").Find(c.Context(), bson.M{
-		"company_id": user.CompanyID,
-		"is_active":  true,
-	})
-	if accountsCursor != nil {
-		accountsCursor.All(c.Context(), &accounts)
+	repos, err := handler.Repos(c)
+	if err != nil {
+		return c.Redirect("/dashboard")
 	}
 
-	// Fetch categories for dropdown
-	var categories []models.Category
-	catCursor, _ := db.Database("ct").Collection("categories").Find(c.Context(), bson.M{
-		"company_id": user.CompanyID,
-		"is_active":  true,
-	})
-	if catCursor != nil {
-		catCursor.All(c.Context(), &categories)
-	}
+	// Fetch accounts and categories for dropdowns
+	accounts, _ := repos.Accounts.List(c.Context(), true)
+	categories, _ := repos.Categories.List(c.Context(), true)
 
 	// Fetch transactions with filters
-	var transactions []models.Transaction
-	filter := bson.M{"company_id": user.CompanyID}
-
-	if filterType := c.Query("type"); filterType != "" {
-		filter["type"] = filterType
+	filter := repository.TransactionFilter{
+		Type:   models.TransactionType(c.Query("type")),
+		Status: models.TransactionStatus(c.Query("status")),
 	}
-	if filterStatus := c.Query("status"); filterStatus != "" {
-		filter["status"] = filterStatus
+
+	// Show a transaction together with its reversal and replacement
+	if related, err := primitive.ObjectIDFromHex(c.Query("related")); err == nil {
+		filter.Related = related
 	}
 
 	// Date range filtering
 	if fromDate := c.Query("from"); fromDate != "" {
 		if t, err := time.Parse("2006-01-02", fromDate); err == nil {
-			filter["transaction_date"] = bson.M{"$gte": t}
+			filter.From = t
 		}
 	}
 	if toDate := c.Query("to"); toDate != "" {
 		if t, err := time.Parse("2006-01-02", toDate); err == nil {
-			t = t.Add(24 * time.Hour) // Include the entire day
-			if existing, ok := filter["transaction_date"].(bson.M); ok {
-				existing["$lt"] = t
-			} else {
-				filter["transaction_date"] = bson.M{"$lt": t}
-			}
+			filter.Until = t.Add(24 * time.Hour) // Include the entire day
 		}
 	}
 
@@ -85,7 +70,7 @@ func TransactionsPage(c *fiber.Ctx) error {
 	skip := int64((page - 1) * pageSize)
 
 	// Count total
-	totalCount, _ := db.Database("ct").Collection("transactions").CountDocuments(c.Context(), filter)
+	totalCount, _ := repos.Transactions.Count(c.Context(), filter)
 	totalPages := int(totalCount) / pageSize
 	if int(totalCount)%pageSize > 0 {
 		totalPages++
@@ -94,14 +79,28 @@ func TransactionsPage(c *fiber.Ctx) error {
 		totalPages = 1
 	}
 
-	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetSkip(skip).SetLimit(int64(pageSize))
-	txnCursor, _ := db.Database("ct").Collection("transactions").Find(c.Context(), filter, opts)
-	if txnCursor != nil {
-		txnCursor.All(c.Context(), &transactions)
+	transactions, _ := repos.Transactions.List(c.Context(), filter, repository.Page{Skip: skip, Limit: pageSize})
+
+	// What the user may do with each row follows the lifecycle rules and the
+	// company's approval policy
+	company, _ := repos.Company.Get(c.Context())
+	actions := make(map[primitive.ObjectID]view.TransactionActions, len(transactions))
+	for i := range transactions {
+		txn := &transactions[i]
+		actions[txn.ID] = view.TransactionActions{
+			Edit:     lifecycle.CanEdit(user, txn),
+			Delete:   lifecycle.CanDelete(user, txn),
+			Void:     lifecycle.Can(company, user, txn, lifecycle.EventVoid),
+			Submit:   lifecycle.Can(company, user, txn, lifecycle.EventSubmit),
+			Withdraw: lifecycle.Can(company, user, txn, lifecycle.EventWithdraw),
+			Resubmit: lifecycle.Can(company, user, txn, lifecycle.EventResubmit),
+			Pay:      lifecycle.Can(company, user, txn, lifecycle.EventPay),
+		}
 	}
 
 	data := view.TransactionsData{
 		Transactions: transactions,
+		Actions:      actions,
 		Accounts:     accounts,
 		Categories:   categories,
 		CurrentPage:  page,
@@ -111,6 +110,7 @@ func TransactionsPage(c *fiber.Ctx) error {
 		FilterStatus: c.Query("status"),
 		FilterFrom:   c.Query("from"),
 		FilterTo:     c.Query("to"),
+		FilterLinked: !filter.Related.IsZero(),
 		CanCreate:    auth.CanSubmitExpenses(user.Role),
 	}
 
@@ -121,6 +121,48 @@ func TransactionsPage(c *fiber.Ctx) error {
 	return render.HTML(c, layouts.Dashboard("Transactions", view.TransactionsPage(data), false, user.Email, user.Role, c.Path()))
 }
 
+// BudgetCheck handles GET /transactions/budget-check. It warns, as the new
+// transaction form is filled in, about the budgets the expense would take to a
+// threshold; the expense is dated today and charged to the user, as it will be
+// when created.
+func BudgetCheck(c *fiber.Ctx) error {
+	user, err := getUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	repos, err := handler.Repos(c)
+	if err != nil || c.Query("type") != string(models.TransactionTypeExpense) {
+		return render.HTML(c, view.BudgetWarnings(nil))
+	}
+
+	txn := &models.Transaction{
+		Type:            models.TransactionTypeExpense,
+		Status:          models.TransactionStatusPending,
+		CreatedByID:     user.ID,
+		EmployeeID:      user.ID,
+		Department:      user.Department,
+		TransactionDate: time.Now(),
+	}
+	txn.CategoryID, _ = primitive.ObjectIDFromHex(c.Query("category_id"))
+	if id, err := primitive.ObjectIDFromHex(c.Query("from_account_id")); err == nil {
+		if account, err := repos.Accounts.Get(c.Context(), id); err == nil {
+			txn.FromAccountID = account.ID
+			txn.Currency = account.Currency
+		}
+	}
+	if txn.Currency == "" {
+		txn.Currency = handler.CompanyCurrency(c, repos)
+	}
+	txn.Amount, err = models.ParseMoney(c.Query("amount"), txn.Currency)
+	if err != nil || txn.Amount <= 0 {
+		return render.HTML(c, view.BudgetWarnings(nil))
+	}
+
+	impacts, _ := budgeting.Assess(c.Context(), repos, txn)
+	return render.HTML(c, view.BudgetWarnings(impacts))
+}
+
 // AccountsPage handles GET /accounts
 func AccountsPage(c *fiber.Ctx) error {
 	user, err := getUser(c)
@@ -132,25 +174,24 @@ func AccountsPage(c *fiber.Ctx) error {
 		return c.Redirect("/dashboard")
 	}
 
-	db := handler.GetDB()
-
-	var accounts []models.Account
-	cursor, _ := db.Database("ct").Collection("accounts").Find(c.Context(), bson.M{
-		"company_id": user.CompanyID,
-	})
-	if cursor != nil {
-		cursor.All(c.Context(), &accounts)
+	repos, err := handler.Repos(c)
+	if err != nil {
+		return c.Redirect("/dashboard")
 	}
 
-	var totalBalance float64
+	accounts, _ := repos.Accounts.List(c.Context(), false)
+	currency := handler.CompanyCurrency(c, repos)
+
+	var totalBalance models.Money
 	for _, acc := range accounts {
-		if acc.IsActive {
+		if acc.IsActive && acc.Currency == currency {
 			totalBalance += acc.Balance
 		}
 	}
 
 	data := view.AccountsData{
 		Accounts:     accounts,
+		Currency:     currency,
 		TotalBalance: totalBalance,
 	}
 
@@ -172,24 +213,20 @@ func CategoriesPage(c *fiber.Ctx) error {
 		return c.Redirect("/dashboard")
 	}
 
-	db := handler.GetDB()
+	repos, err := handler.Repos(c)
+	if err != nil {
+		return c.Redirect("/dashboard")
+	}
 
 	var incomeCategories []models.Category
 	var expenseCategories []models.Category
 
-	cursor, _ := db.Database("ct").Collection("categories").Find(c.Context(), bson.M{
-		"company_id": user.CompanyID,
-		"is_active":  true,
-	})
-	if cursor != nil {
-		var allCategories []models.Category
-		cursor.All(c.Context(), &allCategories)
-		for _, cat := range allCategories {
-			if cat.Type == models.CategoryTypeIncome {
-				incomeCategories = append(incomeCategories, cat)
-			} else {
-				expenseCategories = append(expenseCategories, cat)
-			}
+	allCategories, _ := repos.Categories.List(c.Context(), true)
+	for _, cat := range allCategories {
+		if cat.Type == models.CategoryTypeIncome {
+			incomeCategories = append(incomeCategories, cat)
+		} else {
+			expenseCategories = append(expenseCategories, cat)
 		}
 	}
 
@@ -216,30 +253,47 @@ func BudgetsPage(c *fiber.Ctx) error {
 		return c.Redirect("/dashboard")
 	}
 
-	db := handler.GetDB()
-
-	var budgets []models.Budget
-	cursor, _ := db.Database("ct").Collection("budgets").Find(c.Context(), bson.M{
-		"company_id": user.CompanyID,
-		"is_active":  true,
-	})
-	if cursor != nil {
-		cursor.All(c.Context(), &budgets)
+	repos, err := handler.Repos(c)
+	if err != nil {
+		return c.Redirect("/dashboard")
 	}
 
-	var categories []models.Category
-	catCursor, _ := db.Database("ct").Collection("categories").Find(c.Context(), bson.M{
-		"company_id": user.CompanyID,
-		"is_active":  true,
-	})
-	if catCursor != nil {
-		catCursor.All(c.Context(), &categories)
-	}
+	budgets, _ := repos.Budgets.List(c.Context(), false)
+	categories, _ := repos.Categories.List(c.Context(), true)
+	accounts, _ := repos.Accounts.List(c.Context(), true)
+	names, _ := budgeting.LoadScopeNames(c.Context(), repos)
 
+	// Open budgets on top; ended periods are kept as history, latest first.
+	// Deleted budgets are neither.
+	members, _ := repos.Users.List(c.Context())
 	data := view.BudgetsData{
-		Budgets:    budgets,
 		Categories: categories,
+		Accounts:   accounts,
+		Members:    members,
+		Currency:   handler.CompanyCurrency(c, repos),
+		NewThresholds: models.BudgetThresholds{
+			WarnPercent: models.DefaultBudgetWarnPercent,
+			OwnerID:     user.ID,
+		},
+	}
+	for _, member := range members {
+		if member.Department != "" && !slices.Contains(data.Departments, member.Department) {
+			data.Departments = append(data.Departments, member.Department)
+		}
+	}
+	slices.Sort(data.Departments)
+	for _, budget := range budgets {
+		budget.ScopeName = names.Describe(budget.Scope())
+		switch {
+		case budget.IsActive:
+			data.Budgets = append(data.Budgets, budget)
+		case budget.IsClosed():
+			data.History = append(data.History, budget)
+		}
 	}
+	slices.SortFunc(data.History, func(a, b models.Budget) int {
+		return b.StartDate.Compare(a.StartDate)
+	})
 
 	if isHTMXRequest(c) {
 		return render.HTML(c, view.BudgetsPage(data))
@@ -259,26 +313,18 @@ func ReportsPage(c *fiber.Ctx) error {
 		return c.Redirect("/dashboard")
 	}
 
-	db := handler.GetDB()
-
-	// Fetch approved transactions
-	var transactions []models.Transaction
-	cursor, _ := db.Database("ct").Collection("transactions").Find(c.Context(), bson.M{
-		"company_id": user.CompanyID,
-		"status":     models.TransactionStatusApproved,
-	})
-	if cursor != nil {
-		cursor.All(c.Context(), &transactions)
+	repos, err := handler.Repos(c)
+	if err != nil {
+		return c.Redirect("/dashboard")
 	}
 
+	// Fetch posted transactions; voided ones are cancelled out by their reversals
+	transactions, _ := repos.Transactions.List(c.Context(), repository.TransactionFilter{
+		Posted: true,
+	}, repository.Page{})
+
 	// Fetch categories for mapping
-	var categories []models.Category
-	catCursor, _ := db.Database("ct").Collection("categories").Find(c.Context(), bson.M{
-		"company_id": user.CompanyID,
-	})
-	if catCursor != nil {
-		catCursor.All(c.Context(), &categories)
-	}
+	categories, _ := repos.Categories.List(c.Context(), false)
 
 	// Build category map
 	categoryMap := make(map[string]models.Category)
@@ -286,32 +332,38 @@ func ReportsPage(c *fiber.Ctx) error {
 		categoryMap[cat.ID.Hex()] = cat
 	}
 
-	var totalIncome, totalExpense float64
-	incomeByCategory := make(map[string]float64)
-	expenseByCategory := make(map[string]float64)
+	// Report in the base currency; amounts in other currencies cannot be added without a rate
+	currency := handler.CompanyCurrency(c, repos)
+
+	var totalIncome, totalExpense models.Money
+	incomeByCategory := make(map[string]models.Money)
+	expenseByCategory := make(map[string]models.Money)
 	monthlyData := make(map[string]view.MonthlyAmount)
 
 	for _, txn := range transactions {
+		if txn.Currency != currency {
+			continue
+		}
 		monthKey := txn.TransactionDate.Format("Jan 2006")
 		monthly := monthlyData[monthKey]
 		monthly.Month = monthKey
 
 		if txn.Type == models.TransactionTypeIncome {
-			totalIncome += txn.Amount
-			monthly.Income += txn.Amount
+			totalIncome += txn.SignedAmount()
+			monthly.Income += txn.SignedAmount()
 			catName := "Other"
 			if cat, ok := categoryMap[txn.CategoryID.Hex()]; ok {
 				catName = cat.Name
 			}
-			incomeByCategory[catName] += txn.Amount
+			incomeByCategory[catName] += txn.SignedAmount()
 		} else if txn.Type == models.TransactionTypeExpense {
-			totalExpense += txn.Amount
-			monthly.Expense += txn.Amount
+			totalExpense += txn.SignedAmount()
+			monthly.Expense += txn.SignedAmount()
 			catName := "Other"
 			if cat, ok := categoryMap[txn.CategoryID.Hex()]; ok {
 				catName = cat.Name
 			}
-			expenseByCategory[catName] += txn.Amount
+			expenseByCategory[catName] += txn.SignedAmount()
 		}
 
 		monthlyData[monthKey] = monthly
@@ -348,6 +400,7 @@ func ReportsPage(c *fiber.Ctx) error {
 	}
 
 	data := view.ReportsData{
+		Currency:          currency,
 		TotalIncome:       totalIncome,
 		TotalExpense:      totalExpense,
 		NetProfit:         totalIncome - totalExpense,
@@ -375,32 +428,25 @@ func AuditPage(c *fiber.Ctx) error {
 		return c.Redirect("/dashboard")
 	}
 
-	db := handler.GetDB()
-
-	var logs []models.AuditLog
-	filter := bson.M{"company_id": user.CompanyID}
-
-	if filterEntity := c.Query("entity"); filterEntity != "" {
-		filter["entity"] = filterEntity
+	repos, err := handler.Repos(c)
+	if err != nil {
+		return c.Redirect("/dashboard")
 	}
-	if filterAction := c.Query("action"); filterAction != "" {
-		filter["action"] = filterAction
+
+	filter := repository.AuditFilter{
+		Entity: models.AuditEntity(c.Query("entity")),
+		Action: models.AuditAction(c.Query("action")),
 	}
 
 	// Date range filtering
 	if fromDate := c.Query("from"); fromDate != "" {
 		if t, err := time.Parse("2006-01-02", fromDate); err == nil {
-			filter["created_at"] = bson.M{"$gte": t}
+			filter.From = t
 		}
 	}
 	if toDate := c.Query("to"); toDate != "" {
 		if t, err := time.Parse("2006-01-02", toDate); err == nil {
-			t = t.Add(24 * time.Hour)
-			if existing, ok := filter["created_at"].(bson.M); ok {
-				existing["$lt"] = t
-			} else {
-				filter["created_at"] = bson.M{"$lt": t}
-			}
+			filter.Until = t.Add(24 * time.Hour)
 		}
 	}
 
@@ -414,7 +460,7 @@ func AuditPage(c *fiber.Ctx) error {
 	skip := int64((page - 1) * pageSize)
 
 	// Count total
-	totalCount, _ := db.Database("ct").Collection("audit_logs").CountDocuments(c.Context(), filter)
+	totalCount, _ := repos.AuditLogs.Count(c.Context(), filter)
 	totalPages := int(totalCount) / pageSize
 	if int(totalCount)%pageSize > 0 {
 		totalPages++
@@ -423,11 +469,7 @@ func AuditPage(c *fiber.Ctx) error {
 		totalPages = 1
 	}
 
-	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetSkip(skip).SetLimit(int64(pageSize))
-	cursor, _ := db.Database("ct").Collection("audit_logs").Find(c.Context(), filter, opts)
-	if cursor != nil {
-		cursor.All(c.Context(), &logs)
-	}
+	logs, _ := repos.AuditLogs.List(c.Context(), filter, repository.Page{Skip: skip, Limit: pageSize})
 
 	data := view.AuditData{
 		Logs:         logs,
@@ -454,35 +496,80 @@ func ApprovalsPage(c *fiber.Ctx) error {
 		return c.Redirect("/signin")
 	}
 
-	if !auth.CanApprove(user.Role) {
+	repos, err := handler.Repos(c)
+	if err != nil {
 		return c.Redirect("/dashboard")
 	}
 
-	db := handler.GetDB()
+	// Approvers, and anyone approving for an approver who is away
+	delegators, _ := lifecycle.Delegators(c.Context(), repos, user)
+	if !auth.CanApprove(user.Role) && len(delegators) == 0 {
+		return c.Redirect("/dashboard")
+	}
 
 	// Fetch pending transactions
-	var pendingTransactions []models.Transaction
-	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
-	cursor, _ := db.Database("ct").Collection("transactions").Find(c.Context(), bson.M{
-		"company_id": user.CompanyID,
-		"status":     models.TransactionStatusPending,
-	}, opts)
-	if cursor != nil {
-		cursor.All(c.Context(), &pendingTransactions)
-	}
+	pendingTransactions, _ := repos.Transactions.List(c.Context(), repository.TransactionFilter{
+		Status: models.TransactionStatusPending,
+	}, repository.Page{})
 
 	// Fetch accounts
-	var accounts []models.Account
-	accCursor, _ := db.Database("ct").Collection("accounts").Find(c.Context(), bson.M{
-		"company_id": user.CompanyID,
-	})
-	if accCursor != nil {
-		accCursor.All(c.Context(), &accounts)
+	accounts, _ := repos.Accounts.List(c.Context(), false)
+
+	// Only transactions waiting on a step this user may sign off are listed,
+	// with the budgets each would take to a threshold
+	company, _ := repos.Company.Get(c.Context())
+	budgets, _ := repos.Budgets.List(c.Context(), true)
+	var awaiting []models.Transaction
+	steps := make(map[primitive.ObjectID]string)
+	onBehalfOf := make(map[primitive.ObjectID]string)
+	impacts := make(map[primitive.ObjectID][]models.BudgetImpact)
+	for i := range pendingTransactions {
+		txn := &pendingTransactions[i]
+		principal, err := lifecycle.Authority(company, user, delegators, txn, lifecycle.EventApprove)
+		if err != nil {
+			continue
+		}
+		awaiting = append(awaiting, *txn)
+		if txn.Type == models.TransactionTypeExpense {
+			var original *models.Transaction
+			if !txn.ReplacesID.IsZero() {
+				original, _ = repos.Transactions.Get(c.Context(), txn.ReplacesID)
+			}
+			impacts[txn.ID] = budgeting.Impacts(budgets, txn, original)
+		}
+		if step := lifecycle.CurrentStep(company, txn); step.Of > 1 {
+			steps[txn.ID] = fmt.Sprintf("Step %d of %d: %s", step.Number, step.Of, step.Name)
+		}
+		if principal.ID != user.ID {
+			onBehalfOf[txn.ID] = principal.Name
+		}
 	}
 
 	data := view.ApprovalsData{
-		PendingTransactions: pendingTransactions,
+		PendingTransactions: awaiting,
 		Accounts:            accounts,
+		Steps:               steps,
+		OnBehalfOf:          onBehalfOf,
+		Budgets:             impacts,
+		WaitingOnOthers:     len(pendingTransactions) - len(awaiting),
+		Delegators:          delegators,
+		Now:                 time.Now(),
+	}
+	if company != nil {
+		data.SLA = company.Approvals.SLA()
+	}
+
+	// Approvers may hand their authority to anyone else in the company while away
+	if auth.CanApprove(user.Role) {
+		data.UserID = user.ID
+		data.CanDelegate = true
+		data.Delegations, _ = repos.Delegations.List(c.Context(), user.ID)
+		users, _ := repos.Users.List(c.Context())
+		for _, u := range users {
+			if u.ID != user.ID {
+				data.Delegates = append(data.Delegates, u)
+			}
+		}
 	}
 
 	if isHTMXRequest(c) {
@@ -503,7 +590,31 @@ func SettingsPage(c *fiber.Ctx) error {
 		return c.Redirect("/dashboard")
 	}
 
-	content := view.PlaceholderPage("Settings", "Configure company and system settings")
+	data := view.SettingsData{}
+	if repos, err := handler.Repos(c); err == nil {
+		company, err := repos.Company.Get(c.Context())
+		if err != nil {
+			return c.Redirect("/dashboard?error=Failed+to+load+settings")
+		}
+		data.Company = company
+		data.Currency = company.Currency
+		if data.Currency == "" {
+			data.Currency = "USD"
+		}
+
+		// Anyone who can approve may be given their own approval limit, and
+		// workflows may be limited to a category or account
+		users, _ := repos.Users.List(c.Context())
+		for _, u := range users {
+			if auth.CanApprove(u.Role) {
+				data.Approvers = append(data.Approvers, u)
+			}
+		}
+		data.Categories, _ = repos.Categories.List(c.Context(), true)
+		data.Accounts, _ = repos.Accounts.List(c.Context(), true)
+	}
+
+	content := view.SettingsPage(data)
 
 	if isHTMXRequest(c) {
 		return render.HTML(c, content)
@@ -523,39 +634,50 @@ func TeamPage(c *fiber.Ctx) error {
 		return c.Redirect("/dashboard")
 	}
 
-	db := handler.GetDB()
+	repos, err := handler.Repos(c)
+	if err != nil {
+		return c.Redirect("/dashboard")
+	}
 
 	// Fetch all users in company
-	var users []models.User
-	cursor, _ := db.Database("ct").Collection("users").Find(c.Context(), bson.M{
-		"company_id": user.CompanyID,
-	})
-	if cursor != nil {
-		cursor.All(c.Context(), &users)
+	users, _ := repos.Users.List(c.Context())
+
+	emails := make([]string, len(users))
+	for i, u := range users {
+		emails[i] = u.Email
 	}
 
 	data := view.TeamData{
-		Users:        users,
-		CurrentUser:  user,
-		IsSuperAdmin: user.Role == string(auth.RoleSuperAdmin),
+		Users:         users,
+		CurrentUser:   user,
+		IsSuperAdmin:  user.Role == string(auth.RoleSuperAdmin),
+		CanManageTeam: auth.CanManageTeam(user.Role),
+		CanUnlock:     auth.CanManageAccounts(user.Role),
+		LockedUntil:   handler.LockedAccounts(c, emails),
 	}
 
-	if isHTMXRequest(c) {
-		return render.HTML(c, view.TeamPage(data))
+	// Pending invitations, newest first
+	data.Invitations, err = repos.Invitations.ListPending(c.Context())
+	if err != nil {
+		return c.Redirect("/dashboard?error=Failed+to+load+invitations")
 	}
 
-	return render.HTML(c, layouts.Dashboard("Team", view.TeamPage(data), false, user.Email, user.Role, c.Path()))
-}
+	for _, u := range users {
+		if u.Department != "" && !slices.Contains(data.Departments, u.Department) {
+			data.Departments = append(data.Departments, u.Department)
+		}
+	}
+	slices.Sort(data.Departments)
 
-// Helper to get user by ID
-func getUserByID(c *fiber.Ctx, id string) (*models.User, error) {
-	db := handler.GetDB()
-	objectID, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		return nil, err
+	for _, role := range view.RoleOptions {
+		if auth.CanAssignRole(user.Role, role) {
+			data.InviteRoles = append(data.InviteRoles, role)
+		}
+	}
+
+	if isHTMXRequest(c) {
+		return render.HTML(c, view.TeamPage(data))
 	}
 
-	var user models.User
-	err = db.Database("ct").Collection("users").FindOne(c.Context(), bson.M{"_id": objectID}).Decode(&user)
-	return &user, err
+	return render.HTML(c, layouts.Dashboard("Team", view.TeamPage(data), false, user.Email, user.Role, c.Path()))
 }
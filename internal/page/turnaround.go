@@ -0,0 +1,124 @@
+package page
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minhtranin/ct/internal/auth"
+	"github.com/minhtranin/ct/internal/handler"
+	"github.com/minhtranin/ct/internal/lifecycle"
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/render"
+	"github.com/minhtranin/ct/internal/repository"
+	view "github.com/minhtranin/ct/internal/view/components"
+	"github.com/minhtranin/ct/internal/view/layouts"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ApprovalTurnaroundPage handles GET /reports/approvals
+func ApprovalTurnaroundPage(c *fiber.Ctx) error {
+	user, err := getUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	if !auth.CanGenerateReports(user.Role) {
+		return c.Redirect("/dashboard")
+	}
+
+	repos, err := handler.Repos(c)
+	if err != nil {
+		return c.Redirect("/dashboard")
+	}
+
+	// A from date includes that whole day
+	data := view.ApprovalTurnaroundData{}
+	var from time.Time
+	if date := c.Query("from"); date != "" {
+		if t, err := time.Parse("2006-01-02", date); err == nil {
+			from = t
+			data.From = date
+		}
+	}
+
+	company, _ := repos.Company.Get(c.Context())
+	if company != nil {
+		data.SLA = company.Approvals.SLA()
+	}
+	transactions, _ := repos.Transactions.List(c.Context(), repository.TransactionFilter{}, repository.Page{})
+
+	// Every decision counts toward whoever made it, delegated or not. Decisions
+	// from before turnaround was recorded have no wait to measure.
+	rows := make(map[primitive.ObjectID]*view.ApproverTurnaround)
+	waits := make(map[primitive.ObjectID][]time.Duration)
+	var order []primitive.ObjectID
+	var all []time.Duration
+	now := time.Now()
+	for i := range transactions {
+		txn := &transactions[i]
+		if lifecycle.Overdue(company, txn, now) > 0 {
+			data.OverdueNow++
+		}
+		for _, record := range txn.ApprovalHistory {
+			if record.At.Before(from) {
+				continue
+			}
+			row, ok := rows[record.ApproverID]
+			if !ok {
+				row = &view.ApproverTurnaround{Name: record.ApproverName}
+				rows[record.ApproverID] = row
+				order = append(order, record.ApproverID)
+			}
+			row.Decisions++
+			if record.Status == models.TransactionStatusRejected {
+				row.Rejections++
+			}
+			if record.WaitingSince.IsZero() {
+				continue
+			}
+			wait := record.Turnaround()
+			waits[record.ApproverID] = append(waits[record.ApproverID], wait)
+			all = append(all, wait)
+			if data.SLA > 0 && wait > data.SLA {
+				row.Breaches++
+				data.Breaches++
+			}
+		}
+	}
+
+	for _, id := range order {
+		row := rows[id]
+		row.Measured = len(waits[id])
+		row.Median = medianDuration(waits[id])
+		data.Decisions += row.Decisions
+		data.Approvers = append(data.Approvers, *row)
+	}
+	data.Median = medianDuration(all)
+	data.Measured = len(all)
+
+	// Slowest first, with unmeasured approvers last
+	slices.SortStableFunc(data.Approvers, func(a, b view.ApproverTurnaround) int {
+		return cmp.Compare(b.Median, a.Median)
+	})
+
+	if isHTMXRequest(c) {
+		return render.HTML(c, view.ApprovalTurnaroundPage(data))
+	}
+
+	return render.HTML(c, layouts.Dashboard("Approval Turnaround", view.ApprovalTurnaroundPage(data), false, user.Email, user.Role, c.Path()))
+}
+
+// medianDuration returns the middle of durations, or zero when there are none
+func medianDuration(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := slices.Sorted(slices.Values(durations))
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
@@ -0,0 +1,61 @@
+package page
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/minhtranin/ct/internal/auth"
+	"github.com/minhtranin/ct/internal/handler"
+	"github.com/minhtranin/ct/internal/render"
+	view "github.com/minhtranin/ct/internal/view/components"
+	"github.com/minhtranin/ct/internal/view/layouts"
+)
+
+// totpIssuer is the name authenticator apps show next to the account
+const totpIssuer = "Finance Manager"
+
+// TwoFactorChallenge handles GET /signin/2fa
+func TwoFactorChallenge(f *fiber.Ctx) error {
+	if !handler.HasPendingSignIn(f) {
+		return f.Redirect("/signin")
+	}
+	return render.HTML(
+		f,
+		layouts.Base("Two-Factor Authentication", view.TwoFactorChallengePage()),
+	)
+}
+
+// TwoFactorPage handles GET /account/2fa
+func TwoFactorPage(c *fiber.Ctx) error {
+	user, err := getUser(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+
+	data := view.TwoFactorData{
+		Enabled:           user.TOTPEnabled,
+		EnabledAt:         user.TOTPEnabledAt,
+		Required:          auth.RequiresTwoFactor(user.Role) && handler.CompanyRequiresTwoFactor(c, user.CompanyID),
+		RecoveryCodesLeft: len(user.RecoveryCodeHashes),
+	}
+
+	// Keep the same pending secret across reloads until setup is confirmed
+	if !user.TOTPEnabled {
+		secret := user.TOTPPendingSecret
+		if secret == "" {
+			secret, err = auth.GenerateTOTPSecret()
+			if err != nil {
+				return c.Redirect("/dashboard?error=Failed+to+start+two-factor+setup")
+			}
+			if err := handler.Identities().SetPendingTOTPSecret(c.Context(), user.ID, secret); err != nil {
+				return c.Redirect("/dashboard?error=Failed+to+start+two-factor+setup")
+			}
+		}
+		data.Secret = secret
+		data.OTPAuthURI = auth.TOTPURI(totpIssuer, user.Email, secret)
+	}
+
+	if isHTMXRequest(c) {
+		return render.HTML(c, view.TwoFactorPage(data))
+	}
+
+	return render.HTML(c, layouts.Dashboard("Two-Factor Authentication", view.TwoFactorPage(data), false, user.Email, user.Role, c.Path()))
+}
@@ -0,0 +1,132 @@
+// Package reconcile recomputes stored running totals from the posted transaction history.
+//
+// Account balances are kept as running totals that approvals increment, and
+// budget spend as a cache recomputed on every approval, void or correction.
+// Writes made outside the approval path, or data that predates it, can leave
+// them out of step with the history; Check finds those differences and Repair
+// overwrites the stored figures with the recomputed ones.
+package reconcile
+
+import (
+	"context"
+
+	"github.com/minhtranin/ct/internal/budgeting"
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Discrepancy is a stored figure that differs from what the posted transactions add up to
+type Discrepancy struct {
+	Entity   models.AuditEntity // Account or budget
+	ID       primitive.ObjectID
+	Name     string
+	Field    string // "balance" or "spent"
+	Currency string
+	Recorded models.Money
+	Expected models.Money
+}
+
+// Difference is how far the stored figure is off; positive when it is too high
+func (d Discrepancy) Difference() models.Money {
+	return d.Recorded - d.Expected
+}
+
+// Check recomputes every account balance and the spend of every open or closed
+// budget for the repositories' company and returns the ones that do not match
+func Check(ctx context.Context, repos *repository.Repositories) ([]Discrepancy, error) {
+	transactions, err := repos.Transactions.List(ctx, repository.TransactionFilter{
+		Posted: true,
+	}, repository.Page{})
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := repos.Accounts.List(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	budgets, err := repos.Budgets.List(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var discrepancies []Discrepancy
+
+	// Transactions are always in their accounts' currency, so deltas can be summed per account
+	expectedBalances := make(map[primitive.ObjectID]models.Money)
+	for i := range transactions {
+		for _, change := range transactions[i].BalanceChanges() {
+			expectedBalances[change.AccountID] += change.Delta
+		}
+	}
+	for _, acc := range accounts {
+		if expected := expectedBalances[acc.ID]; expected != acc.Balance {
+			discrepancies = append(discrepancies, Discrepancy{
+				Entity:   models.AuditEntityAccount,
+				ID:       acc.ID,
+				Name:     acc.Name,
+				Field:    "balance",
+				Currency: acc.Currency,
+				Recorded: acc.Balance,
+				Expected: expected,
+			})
+		}
+	}
+
+	for _, budget := range budgets {
+		// Deleted budgets keep the spend they were deleted with
+		if !budget.IsActive && !budget.IsClosed() {
+			continue
+		}
+		if expected := budgeting.SpentFrom(&budget, transactions); expected != budget.Spent {
+			discrepancies = append(discrepancies, Discrepancy{
+				Entity:   models.AuditEntityBudget,
+				ID:       budget.ID,
+				Name:     budget.Name,
+				Field:    "spent",
+				Currency: budget.Currency,
+				Recorded: budget.Spent,
+				Expected: expected,
+			})
+		}
+	}
+
+	return discrepancies, nil
+}
+
+// Repair runs Check and overwrites every mismatched figure in one atomic write,
+// recording an audit entry per correction on behalf of actor
+func Repair(ctx context.Context, repos *repository.Repositories, actor *models.User) ([]Discrepancy, error) {
+	var fixed []Discrepancy
+	err := repos.Atomic(ctx, func(ctx context.Context) error {
+		discrepancies, err := Check(ctx, repos)
+		if err != nil {
+			return err
+		}
+		for _, d := range discrepancies {
+			switch d.Entity {
+			case models.AuditEntityAccount:
+				err = repos.Accounts.SetBalance(ctx, d.ID, d.Expected)
+			case models.AuditEntityBudget:
+				err = repos.Budgets.SetSpent(ctx, d.ID, d.Expected)
+			}
+			if err != nil {
+				return err
+			}
+
+			log := models.NewAuditLog(models.AuditActionReconcile, d.Entity, d.ID, actor.ID, repos.Scope.CompanyID(), actor.Name, actor.Email)
+			log.WithChanges(map[string]interface{}{
+				"name":  d.Name,
+				"field": d.Field,
+				"from":  d.Recorded.Format(d.Currency),
+				"to":    d.Expected.Format(d.Currency),
+			})
+			if err := repos.AuditLogs.Insert(ctx, log); err != nil {
+				return err
+			}
+		}
+		fixed = discrepancies
+		return nil
+	})
+	return fixed, err
+}
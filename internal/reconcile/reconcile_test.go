@@ -0,0 +1,206 @@
+package reconcile
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/minhtranin/ct/internal/models"
+	"github.com/minhtranin/ct/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type fixture struct {
+	repos   *repository.Repositories
+	cash    *models.Account
+	savings *models.Account
+	budget  *models.Budget
+	travel  primitive.ObjectID // The budget's category
+}
+
+// newFixture stores two accounts and a monthly budget, and approved history of
+// 200.00 income into cash, a 50.00 transfer to savings and a 30.00 expense
+// against the budget; the stored figures match it unless a test changes them
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	ctx := context.Background()
+	_, repos := repository.NewTestRepos(t, models.Company{})
+	f := &fixture{repos: repos}
+
+	f.cash = models.NewAccount("Cash", models.AccountTypeCash, "USD", repos.Scope.CompanyID())
+	f.cash.ID = primitive.NewObjectID()
+	f.cash.Balance = 120_00
+	f.savings = models.NewAccount("Savings", models.AccountTypeBank, "USD", repos.Scope.CompanyID())
+	f.savings.ID = primitive.NewObjectID()
+	f.savings.Balance = 50_00
+	for _, acc := range []*models.Account{f.cash, f.savings} {
+		if err := repos.Accounts.Create(ctx, acc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f.travel = primitive.NewObjectID()
+	f.budget = models.NewBudget("Travel", f.travel, 500_00, "USD", models.BudgetPeriodMonthly, repos.Scope.CompanyID())
+	f.budget.ID = primitive.NewObjectID()
+	f.budget.Spent = 30_00
+	if err := repos.Budgets.Create(ctx, f.budget); err != nil {
+		t.Fatal(err)
+	}
+
+	income := f.approved(t, models.TransactionTypeIncome, 200_00)
+	income.ToAccountID = f.cash.ID
+	transfer := f.approved(t, models.TransactionTypeTransfer, 50_00)
+	transfer.FromAccountID = f.cash.ID
+	transfer.ToAccountID = f.savings.ID
+	expense := f.approved(t, models.TransactionTypeExpense, 30_00)
+	expense.FromAccountID = f.cash.ID
+	expense.CategoryID = f.travel
+	for _, txn := range []*models.Transaction{income, transfer, expense} {
+		f.store(t, txn)
+	}
+	return f
+}
+
+// approved returns an approved transaction dated now, not yet stored
+func (f *fixture) approved(t *testing.T, txnType models.TransactionType, amount models.Money) *models.Transaction {
+	t.Helper()
+	txn := models.NewTransaction(txnType, amount, "USD", f.repos.Scope.CompanyID(), primitive.NewObjectID(), "Alice")
+	txn.ID = primitive.NewObjectID()
+	txn.Status = models.TransactionStatusApproved
+	return txn
+}
+
+func (f *fixture) store(t *testing.T, txn *models.Transaction) {
+	t.Helper()
+	if err := f.repos.Transactions.Create(context.Background(), txn); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckFindsNothingWhenTotalsMatch(t *testing.T) {
+	f := newFixture(t)
+	discrepancies, err := Check(context.Background(), f.repos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(discrepancies) != 0 {
+		t.Errorf("Check found %+v, want no discrepancies", discrepancies)
+	}
+}
+
+func TestCheckFindsDiscrepancies(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	if err := f.repos.Accounts.SetBalance(ctx, f.cash.ID, 125_00); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.repos.Budgets.SetSpent(ctx, f.budget.ID, 10_00); err != nil {
+		t.Fatal(err)
+	}
+
+	discrepancies, err := Check(ctx, f.repos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(discrepancies) != 2 {
+		t.Fatalf("Check found %+v, want the cash balance and the budget spend", discrepancies)
+	}
+	for _, d := range discrepancies {
+		switch d.ID {
+		case f.cash.ID:
+			if d.Field != "balance" || d.Recorded != 125_00 || d.Expected != 120_00 || d.Difference() != 5_00 {
+				t.Errorf("cash discrepancy = %+v, want balance recorded 125.00, expected 120.00", d)
+			}
+		case f.budget.ID:
+			if d.Field != "spent" || d.Recorded != 10_00 || d.Expected != 30_00 || d.Difference() != -20_00 {
+				t.Errorf("budget discrepancy = %+v, want spent recorded 10.00, expected 30.00", d)
+			}
+		default:
+			t.Errorf("unexpected discrepancy %+v", d)
+		}
+	}
+}
+
+func TestCheckIgnoresPendingAndOutOfBudgetTransactions(t *testing.T) {
+	f := newFixture(t)
+
+	pending := f.approved(t, models.TransactionTypeExpense, 40_00)
+	pending.Status = models.TransactionStatusPending
+	pending.FromAccountID = f.cash.ID
+	pending.CategoryID = f.travel
+	f.store(t, pending)
+
+	// Approved before the budget's period: counts toward the balance, not the spend
+	earlier := f.approved(t, models.TransactionTypeExpense, 20_00)
+	earlier.CategoryID = f.travel
+	earlier.TransactionDate = f.budget.StartDate.Add(-time.Hour)
+	f.store(t, earlier)
+
+	otherCurrency := f.approved(t, models.TransactionTypeExpense, 15_00)
+	otherCurrency.Currency = "EUR"
+	otherCurrency.CategoryID = f.travel
+	f.store(t, otherCurrency)
+
+	discrepancies, err := Check(context.Background(), f.repos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(discrepancies) != 0 {
+		t.Errorf("Check found %+v, want no discrepancies", discrepancies)
+	}
+}
+
+func TestCheckNetsReversals(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+
+	// A 20.00 expense that was approved and then reversed leaves the totals as they were
+	expense := f.approved(t, models.TransactionTypeExpense, 20_00)
+	expense.FromAccountID = f.cash.ID
+	expense.CategoryID = f.travel
+	reversal := models.NewReversal(expense, primitive.NewObjectID(), "Bob")
+	expense.ReversedByID = reversal.ID
+	f.store(t, expense)
+	f.store(t, reversal)
+
+	discrepancies, err := Check(ctx, f.repos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(discrepancies) != 0 {
+		t.Errorf("Check found %+v, want no discrepancies", discrepancies)
+	}
+}
+
+func TestRepairOverwritesDiscrepancies(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	if err := f.repos.Accounts.SetBalance(ctx, f.savings.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.repos.Budgets.SetSpent(ctx, f.budget.ID, 99_00); err != nil {
+		t.Fatal(err)
+	}
+	actor := &models.User{ID: primitive.NewObjectID(), Name: "Bob", Email: "bob@example.com"}
+
+	fixed, err := Repair(ctx, f.repos, actor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixed) != 2 {
+		t.Errorf("Repair fixed %+v, want the savings balance and the budget spend", fixed)
+	}
+	if got, _ := f.repos.Accounts.Get(ctx, f.savings.ID); got.Balance != 50_00 {
+		t.Errorf("savings balance after repair = %d, want %d", got.Balance, 50_00)
+	}
+	if got, _ := f.repos.Budgets.Get(ctx, f.budget.ID); got.Spent != 30_00 {
+		t.Errorf("budget spend after repair = %d, want %d", got.Spent, 30_00)
+	}
+	if n, err := f.repos.AuditLogs.Count(ctx, repository.AuditFilter{}); err != nil || n != 2 {
+		t.Errorf("Repair recorded %d audit entries (%v), want one per correction", n, err)
+	}
+
+	if again, err := Check(ctx, f.repos); err != nil || len(again) != 0 {
+		t.Errorf("Check after Repair found %+v, %v; want nothing", again, err)
+	}
+}
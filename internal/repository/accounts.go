@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// mongoAccounts reads and writes the company's financial accounts in MongoDB
+type mongoAccounts struct {
+	collection *mongo.Collection
+	scope      Scope
+}
+
+// List returns the company's accounts, optionally only the active ones
+func (r *mongoAccounts) List(ctx context.Context, activeOnly bool) ([]models.Account, error) {
+	filter := bson.M{}
+	if activeOnly {
+		filter["is_active"] = true
+	}
+	var accounts []models.Account
+	err := findAll(ctx, r.collection, r.scope.filter(filter), &accounts)
+	return accounts, err
+}
+
+// Get returns a single account
+func (r *mongoAccounts) Get(ctx context.Context, id primitive.ObjectID) (*models.Account, error) {
+	var account models.Account
+	if err := findOne(ctx, r.collection, r.scope.filter(bson.M{"_id": id}), &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// Create stores a new account under the company
+func (r *mongoAccounts) Create(ctx context.Context, account *models.Account) error {
+	account.CompanyID = r.scope.companyID
+	_, err := r.collection.InsertOne(ctx, account)
+	return err
+}
+
+// Update changes an account's name, type and currency
+func (r *mongoAccounts) Update(ctx context.Context, id primitive.ObjectID, name, accountType, currency string) error {
+	return updateOne(ctx, r.collection, r.scope.filter(bson.M{"_id": id}), bson.M{
+		"$set": bson.M{
+			"name":       name,
+			"type":       accountType,
+			"currency":   currency,
+			"updated_at": time.Now(),
+		},
+	})
+}
+
+// Deactivate soft-deletes an account
+func (r *mongoAccounts) Deactivate(ctx context.Context, id primitive.ObjectID) error {
+	return updateOne(ctx, r.collection, r.scope.filter(bson.M{"_id": id}), bson.M{
+		"$set": bson.M{
+			"is_active":  false,
+			"updated_at": time.Now(),
+		},
+	})
+}
+
+// AdjustBalance adds delta (which may be negative) to an account's balance
+func (r *mongoAccounts) AdjustBalance(ctx context.Context, id primitive.ObjectID, delta models.Money) error {
+	return updateOne(ctx, r.collection, r.scope.filter(bson.M{"_id": id}), bson.M{
+		"$inc": bson.M{"balance": delta},
+	})
+}
+
+// SetBalance overwrites an account's balance, e.g. with a reconciled figure
+func (r *mongoAccounts) SetBalance(ctx context.Context, id primitive.ObjectID, balance models.Money) error {
+	return updateOne(ctx, r.collection, r.scope.filter(bson.M{"_id": id}), bson.M{
+		"$set": bson.M{
+			"balance":    balance,
+			"updated_at": time.Now(),
+		},
+	})
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/minhtranin/ct/internal/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Atomic runs fn so that every write it makes through these repositories, using
+// the ctx it is given, commits together or not at all
+func (r *Repositories) Atomic(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.atomic(ctx, fn)
+}
+
+// inTransaction runs fn inside a MongoDB session transaction. Transactions need a
+// replica set or sharded cluster; on a standalone server fn runs without one.
+func (s *MongoStore) inTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	transactions, err := s.supportsTransactions(ctx)
+	if err != nil {
+		return err
+	}
+	if !transactions {
+		return fn(ctx)
+	}
+
+	session, err := s.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	// WithTransaction retries fn on transient errors, such as a write conflict with another approver
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// DetectTopology asks the server whether it is a replica set member or mongos,
+// and so whether Atomic can use transactions. Called once at startup; until it
+// succeeds, every Atomic call asks again.
+func (s *MongoStore) DetectTopology(ctx context.Context) error {
+	_, err := s.supportsTransactions(ctx)
+	return err
+}
+
+// supportsTransactions reports whether the server supports multi-document
+// transactions. Only a successful answer is kept, so a failed check is retried
+// rather than leaving every later write non-atomic.
+func (s *MongoStore) supportsTransactions(ctx context.Context) (bool, error) {
+	s.topologyMu.Lock()
+	defer s.topologyMu.Unlock()
+	if s.topologyKnown {
+		return s.transactions, nil
+	}
+
+	var hello bson.M
+	err := s.client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		return false, fmt.Errorf("detect server topology: %w", err)
+	}
+	_, replicaSet := hello["setName"]
+	s.transactions = replicaSet || hello["msg"] == "isdbgrid"
+	s.topologyKnown = true
+	if !s.transactions {
+		logger.Warn("Repository", "Standalone MongoDB server, multi-document writes will not be atomic")
+	}
+	return s.transactions, nil
+}
+
+// inTransaction runs fn and restores every collection if it fails
+func (s *MemoryStore) inTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	s.mu.Lock()
+	snapshot := s.snapshot()
+	s.mu.Unlock()
+
+	if err := fn(ctx); err != nil {
+		s.mu.Lock()
+		s.restore(snapshot)
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
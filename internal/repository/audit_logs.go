@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// AuditFilter narrows an audit log listing; zero fields match everything
+type AuditFilter struct {
+	Entity models.AuditEntity
+	Action models.AuditAction
+	From   time.Time // Inclusive lower bound on created_at
+	Until  time.Time // Exclusive upper bound on created_at
+}
+
+func (f AuditFilter) bson() bson.M {
+	filter := bson.M{}
+	if f.Entity != "" {
+		filter["entity"] = f.Entity
+	}
+	if f.Action != "" {
+		filter["action"] = f.Action
+	}
+	if cond := dateRange(f.From, f.Until); cond != nil {
+		filter["created_at"] = cond
+	}
+	return filter
+}
+
+// mongoAuditLogs records and reads the company's audit trail in MongoDB
+type mongoAuditLogs struct {
+	collection *mongo.Collection
+	scope      Scope
+}
+
+// Insert records an entry under the company
+func (r *mongoAuditLogs) Insert(ctx context.Context, log *models.AuditLog) error {
+	log.CompanyID = r.scope.companyID
+	_, err := r.collection.InsertOne(ctx, log)
+	return err
+}
+
+// List returns matching entries, newest first
+func (r *mongoAuditLogs) List(ctx context.Context, filter AuditFilter, page Page) ([]models.AuditLog, error) {
+	var logs []models.AuditLog
+	err := findAll(ctx, r.collection, r.scope.filter(filter.bson()), &logs, newestFirst(page))
+	return logs, err
+}
+
+// Count returns how many entries match
+func (r *mongoAuditLogs) Count(ctx context.Context, filter AuditFilter) (int64, error) {
+	return r.collection.CountDocuments(ctx, r.scope.filter(filter.bson()))
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoBudgets reads and writes the company's spending limits in MongoDB
+type mongoBudgets struct {
+	collection *mongo.Collection
+	scope      Scope
+}
+
+// List returns the company's budgets, optionally only the active ones
+func (r *mongoBudgets) List(ctx context.Context, activeOnly bool) ([]models.Budget, error) {
+	filter := bson.M{}
+	if activeOnly {
+		filter["is_active"] = true
+	}
+	var budgets []models.Budget
+	err := findAll(ctx, r.collection, r.scope.filter(filter), &budgets)
+	return budgets, err
+}
+
+// Get returns a single budget
+func (r *mongoBudgets) Get(ctx context.Context, id primitive.ObjectID) (*models.Budget, error) {
+	var budget models.Budget
+	if err := findOne(ctx, r.collection, r.scope.filter(bson.M{"_id": id}), &budget); err != nil {
+		return nil, err
+	}
+	return &budget, nil
+}
+
+// Create stores a new budget under the company
+func (r *mongoBudgets) Create(ctx context.Context, budget *models.Budget) error {
+	budget.CompanyID = r.scope.companyID
+	_, err := r.collection.InsertOne(ctx, budget)
+	return err
+}
+
+// Update changes a budget's name and limit
+func (r *mongoBudgets) Update(ctx context.Context, id primitive.ObjectID, name string, amount models.Money) error {
+	return updateOne(ctx, r.collection, r.scope.filter(bson.M{"_id": id}), bson.M{
+		"$set": bson.M{
+			"name":       name,
+			"amount":     amount,
+			"updated_at": time.Now(),
+		},
+	})
+}
+
+// SetThresholds replaces when a budget alerts its owner, what it does over its limit and who owns it
+func (r *mongoBudgets) SetThresholds(ctx context.Context, id primitive.ObjectID, thresholds models.BudgetThresholds) error {
+	return updateOne(ctx, r.collection, r.scope.filter(bson.M{"_id": id}), bson.M{
+		"$set": bson.M{
+			"warn_percent": thresholds.WarnPercent,
+			"enforcement":  thresholds.Enforcement,
+			"owner_id":     thresholds.OwnerID,
+			"owner_name":   thresholds.OwnerName,
+			"updated_at":   time.Now(),
+		},
+	})
+}
+
+// Deactivate soft-deletes a budget
+func (r *mongoBudgets) Deactivate(ctx context.Context, id primitive.ObjectID) error {
+	return updateOne(ctx, r.collection, r.scope.filter(bson.M{"_id": id}), bson.M{
+		"$set": bson.M{
+			"is_active":  false,
+			"updated_at": time.Now(),
+		},
+	})
+}
+
+// SetSpent overwrites a budget's cached spend with a recomputed figure
+func (r *mongoBudgets) SetSpent(ctx context.Context, id primitive.ObjectID, spent models.Money) error {
+	return updateOne(ctx, r.collection, r.scope.filter(bson.M{"_id": id}), bson.M{
+		"$set": bson.M{
+			"spent":      spent,
+			"updated_at": time.Now(),
+		},
+	})
+}
+
+// Close ends an open budget period at t and returns it as closed. Only the first
+// of two racing closes succeeds; the other, like a deleted budget, gets ErrNotFound.
+func (r *mongoBudgets) Close(ctx context.Context, id primitive.ObjectID, t time.Time) (*models.Budget, error) {
+	var budget models.Budget
+	err := r.collection.FindOneAndUpdate(ctx,
+		r.scope.filter(bson.M{"_id": id, "is_active": true}),
+		bson.M{"$set": bson.M{
+			"is_active":  false,
+			"closed_at":  t,
+			"updated_at": t,
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&budget)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &budget, nil
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// mongoCategories reads and writes the company's income and expense categories in MongoDB
+type mongoCategories struct {
+	collection *mongo.Collection
+	scope      Scope
+}
+
+// List returns the company's categories, optionally only the active ones
+func (r *mongoCategories) List(ctx context.Context, activeOnly bool) ([]models.Category, error) {
+	filter := bson.M{}
+	if activeOnly {
+		filter["is_active"] = true
+	}
+	var categories []models.Category
+	err := findAll(ctx, r.collection, r.scope.filter(filter), &categories)
+	return categories, err
+}
+
+// Get returns a single category
+func (r *mongoCategories) Get(ctx context.Context, id primitive.ObjectID) (*models.Category, error) {
+	var category models.Category
+	if err := findOne(ctx, r.collection, r.scope.filter(bson.M{"_id": id}), &category); err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// Create stores a new category under the company
+func (r *mongoCategories) Create(ctx context.Context, category *models.Category) error {
+	category.CompanyID = r.scope.companyID
+	_, err := r.collection.InsertOne(ctx, category)
+	return err
+}
+
+// Update changes a category's name, type and color
+func (r *mongoCategories) Update(ctx context.Context, id primitive.ObjectID, name, categoryType, color string) error {
+	return updateOne(ctx, r.collection, r.scope.filter(bson.M{"_id": id}), bson.M{
+		"$set": bson.M{
+			"name":       name,
+			"type":       categoryType,
+			"color":      color,
+			"updated_at": time.Now(),
+		},
+	})
+}
+
+// Deactivate soft-deletes a category
+func (r *mongoCategories) Deactivate(ctx context.Context, id primitive.ObjectID) error {
+	return updateOne(ctx, r.collection, r.scope.filter(bson.M{"_id": id}), bson.M{
+		"$set": bson.M{
+			"is_active":  false,
+			"updated_at": time.Now(),
+		},
+	})
+}
+
+// DeleteAll removes every category of the company, to undo a sign-up that failed partway
+func (r *mongoCategories) DeleteAll(ctx context.Context) error {
+	_, err := r.collection.DeleteMany(ctx, r.scope.filter(bson.M{}))
+	return err
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// mongoCompanies reads the scoped company's settings in MongoDB
+type mongoCompanies struct {
+	collection *mongo.Collection
+	scope      Scope
+}
+
+// Get returns the company the scope is pinned to
+func (r *mongoCompanies) Get(ctx context.Context) (*models.Company, error) {
+	var company models.Company
+	if err := findOne(ctx, r.collection, bson.M{"_id": r.scope.companyID}, &company); err != nil {
+		return nil, err
+	}
+	return &company, nil
+}
+
+// SetApprovalPolicy replaces the company's approval policy
+func (r *mongoCompanies) SetApprovalPolicy(ctx context.Context, policy models.ApprovalPolicy) error {
+	return updateOne(ctx, r.collection, bson.M{"_id": r.scope.companyID}, bson.M{
+		"$set": bson.M{
+			"approvals":  policy,
+			"updated_at": time.Now(),
+		},
+	})
+}
+
+// Create stores the company the scope is pinned to, e.g. at sign-up
+func (r *mongoCompanies) Create(ctx context.Context, company *models.Company) error {
+	company.ID = r.scope.companyID
+	_, err := r.collection.InsertOne(ctx, company)
+	return err
+}
+
+// Delete removes the company, to undo a sign-up that failed before anyone joined it
+func (r *mongoCompanies) Delete(ctx context.Context) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": r.scope.companyID})
+	return err
+}
+
+// SetRequire2FA turns mandatory two-factor authentication for approvers and admins on or off
+func (r *mongoCompanies) SetRequire2FA(ctx context.Context, require bool) error {
+	return updateOne(ctx, r.collection, bson.M{"_id": r.scope.companyID}, bson.M{
+		"$set": bson.M{
+			"require_2fa": require,
+			"updated_at":  time.Now(),
+		},
+	})
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// mongoDelegations reads and writes the company's approval delegations in MongoDB
+type mongoDelegations struct {
+	collection *mongo.Collection
+	scope      Scope
+}
+
+// List returns the delegations given by or to userID, newest first
+func (r *mongoDelegations) List(ctx context.Context, userID primitive.ObjectID) ([]models.Delegation, error) {
+	var delegations []models.Delegation
+	err := findAll(ctx, r.collection, r.scope.filter(bson.M{
+		"$or": bson.A{bson.M{"from_user_id": userID}, bson.M{"to_user_id": userID}},
+	}), &delegations, newestFirst(Page{}))
+	return delegations, err
+}
+
+// ActiveFor returns the delegations to userID that apply at t
+func (r *mongoDelegations) ActiveFor(ctx context.Context, userID primitive.ObjectID, t time.Time) ([]models.Delegation, error) {
+	var delegations []models.Delegation
+	err := findAll(ctx, r.collection, r.scope.filter(bson.M{
+		"to_user_id": userID,
+		"starts_at":  bson.M{"$lte": t},
+		"ends_at":    bson.M{"$gt": t},
+		"revoked_at": bson.M{"$exists": false},
+	}), &delegations, newestFirst(Page{}))
+	return delegations, err
+}
+
+// Create stores a new delegation under the company
+func (r *mongoDelegations) Create(ctx context.Context, delegation *models.Delegation) error {
+	delegation.CompanyID = r.scope.companyID
+	_, err := r.collection.InsertOne(ctx, delegation)
+	return err
+}
+
+// Revoke ends fromUserID's delegation id at t, unless it was already revoked
+func (r *mongoDelegations) Revoke(ctx context.Context, id, fromUserID primitive.ObjectID, t time.Time) error {
+	return updateOne(ctx, r.collection, r.scope.filter(bson.M{
+		"_id":          id,
+		"from_user_id": fromUserID,
+		"revoked_at":   bson.M{"$exists": false},
+	}), bson.M{"$set": bson.M{"revoked_at": t}})
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// mongoDirectory looks across companies in MongoDB
+type mongoDirectory struct {
+	companies   *mongo.Collection
+	invitations *mongo.Collection
+}
+
+// Companies returns every company
+func (r *mongoDirectory) Companies(ctx context.Context) ([]models.Company, error) {
+	var companies []models.Company
+	err := findAll(ctx, r.companies, bson.M{}, &companies)
+	return companies, err
+}
+
+// InvitationByToken returns the invitation whose token hashes to tokenHash,
+// whatever its status; the caller checks it can still be accepted
+func (r *mongoDirectory) InvitationByToken(ctx context.Context, tokenHash string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	if err := findOne(ctx, r.invitations, bson.M{"token_hash": tokenHash}, &invitation); err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// mongoIdentities looks users up by credentials in MongoDB
+type mongoIdentities struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoIdentities) findUser(ctx context.Context, filter bson.M) (*models.User, error) {
+	var user models.User
+	if err := findOne(ctx, r.collection, filter, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *mongoIdentities) set(ctx context.Context, id primitive.ObjectID, fields bson.M) error {
+	return updateOne(ctx, r.collection, bson.M{"_id": id}, bson.M{"$set": fields})
+}
+
+// FindByID returns the user with the given ID
+func (r *mongoIdentities) FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	return r.findUser(ctx, bson.M{"_id": id})
+}
+
+// FindByEmail returns the user with the given email
+func (r *mongoIdentities) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.findUser(ctx, bson.M{"email": email})
+}
+
+// FindByVerifyCode returns the user whose unexpired verification code matches
+func (r *mongoIdentities) FindByVerifyCode(ctx context.Context, email, code string, now time.Time) (*models.User, error) {
+	return r.findUser(ctx, bson.M{
+		"email":             email,
+		"verify_token":      code,
+		"verify_expires_at": bson.M{"$gt": now},
+	})
+}
+
+// FindByVerifyToken returns the user whose unexpired verification token matches
+func (r *mongoIdentities) FindByVerifyToken(ctx context.Context, token string, now time.Time) (*models.User, error) {
+	return r.findUser(ctx, bson.M{
+		"verify_token":      token,
+		"verify_expires_at": bson.M{"$gt": now},
+	})
+}
+
+// FindByResetToken returns the user whose unexpired password reset token matches
+func (r *mongoIdentities) FindByResetToken(ctx context.Context, token string, now time.Time) (*models.User, error) {
+	return r.findUser(ctx, bson.M{
+		"reset_token":      token,
+		"reset_expires_at": bson.M{"$gt": now},
+	})
+}
+
+// Create stores a new user
+func (r *mongoIdentities) Create(ctx context.Context, user *models.User) error {
+	_, err := r.collection.InsertOne(ctx, user)
+	return err
+}
+
+// RecordLogin stamps the last successful sign-in
+func (r *mongoIdentities) RecordLogin(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	return r.set(ctx, id, bson.M{"last_login_at": at})
+}
+
+// RecordEmailSent stamps when a verification email last went out
+func (r *mongoIdentities) RecordEmailSent(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	return r.set(ctx, id, bson.M{"last_email_sent_at": at})
+}
+
+// SetVerifyCode replaces the email verification code
+func (r *mongoIdentities) SetVerifyCode(ctx context.Context, id primitive.ObjectID, code string, expiresAt, sentAt time.Time) error {
+	return r.set(ctx, id, bson.M{
+		"verify_token":       code,
+		"verify_expires_at":  expiresAt,
+		"last_email_sent_at": sentAt,
+	})
+}
+
+// MarkEmailVerified verifies the email and clears the verification code
+func (r *mongoIdentities) MarkEmailVerified(ctx context.Context, id primitive.ObjectID) error {
+	return r.set(ctx, id, bson.M{
+		"email_verified":    true,
+		"verify_token":      "",
+		"verify_expires_at": time.Time{},
+		"updated_at":        time.Now(),
+	})
+}
+
+// SetResetToken stores a password reset token
+func (r *mongoIdentities) SetResetToken(ctx context.Context, id primitive.ObjectID, token string, expiresAt time.Time) error {
+	return r.set(ctx, id, bson.M{
+		"reset_token":      token,
+		"reset_expires_at": expiresAt,
+	})
+}
+
+// SetPassword replaces the password hash and clears any reset token
+func (r *mongoIdentities) SetPassword(ctx context.Context, id primitive.ObjectID, passwordHash string) error {
+	return r.set(ctx, id, bson.M{
+		"password_hash":    passwordHash,
+		"reset_token":      "",
+		"reset_expires_at": time.Time{},
+		"updated_at":       time.Now(),
+	})
+}
+
+// JoinCompany moves the user into a company with the given role. Following an
+// invitation link verifies the email it was sent to.
+func (r *mongoIdentities) JoinCompany(ctx context.Context, id, companyID primitive.ObjectID, role string) error {
+	return r.set(ctx, id, bson.M{
+		"company_id":     companyID,
+		"role":           role,
+		"email_verified": true,
+		"updated_at":     time.Now(),
+	})
+}
+
+// SetPendingTOTPSecret stores a two-factor secret awaiting its first code
+func (r *mongoIdentities) SetPendingTOTPSecret(ctx context.Context, id primitive.ObjectID, secret string) error {
+	return r.set(ctx, id, bson.M{
+		"totp_pending_secret": secret,
+		"updated_at":          time.Now(),
+	})
+}
+
+// EnableTOTP turns two-factor authentication on with a confirmed secret, the
+// time step of the code that confirmed it and fresh recovery codes
+func (r *mongoIdentities) EnableTOTP(ctx context.Context, id primitive.ObjectID, secret string, step int64, recoveryCodeHashes []string, at time.Time) error {
+	return updateOne(ctx, r.collection, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{
+			"totp_enabled":         true,
+			"totp_secret":          secret,
+			"totp_last_step":       step,
+			"totp_enabled_at":      at,
+			"recovery_code_hashes": recoveryCodeHashes,
+			"updated_at":           at,
+		},
+		"$unset": bson.M{"totp_pending_secret": ""},
+	})
+}
+
+// DisableTOTP turns two-factor authentication off and forgets its secret and recovery codes
+func (r *mongoIdentities) DisableTOTP(ctx context.Context, id primitive.ObjectID) error {
+	return updateOne(ctx, r.collection, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{
+			"totp_enabled": false,
+			"updated_at":   time.Now(),
+		},
+		"$unset": bson.M{
+			"totp_secret":          "",
+			"totp_last_step":       "",
+			"totp_enabled_at":      "",
+			"recovery_code_hashes": "",
+		},
+	})
+}
+
+// SetRecoveryCodes replaces the user's recovery codes
+func (r *mongoIdentities) SetRecoveryCodes(ctx context.Context, id primitive.ObjectID, recoveryCodeHashes []string) error {
+	return r.set(ctx, id, bson.M{
+		"recovery_code_hashes": recoveryCodeHashes,
+		"updated_at":           time.Now(),
+	})
+}
+
+// UseRecoveryCode consumes one of the user's recovery codes; ErrNotFound when
+// it is not one of them, or was already used
+func (r *mongoIdentities) UseRecoveryCode(ctx context.Context, id primitive.ObjectID, hash string) error {
+	return updateOne(ctx, r.collection, bson.M{
+		"_id":                  id,
+		"recovery_code_hashes": hash,
+	}, bson.M{
+		"$pull": bson.M{"recovery_code_hashes": hash},
+	})
+}
+
+// UseTOTPStep records the time step of an accepted code; ErrNotFound when that
+// step or a later one was already used, so two requests cannot both use a code
+func (r *mongoIdentities) UseTOTPStep(ctx context.Context, id primitive.ObjectID, step int64) error {
+	return updateOne(ctx, r.collection, bson.M{
+		"_id": id,
+		"$or": bson.A{
+			bson.M{"totp_last_step": bson.M{"$lt": step}},
+			bson.M{"totp_last_step": bson.M{"$exists": false}},
+		},
+	}, bson.M{
+		"$set": bson.M{"totp_last_step": step},
+	})
+}
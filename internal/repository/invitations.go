@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoInvitations reads and writes the company's team invitations in MongoDB
+type mongoInvitations struct {
+	collection *mongo.Collection
+	scope      Scope
+}
+
+// ensureInvitationIndexes creates the token lookup index for invitations
+func ensureInvitationIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "status", Value: 1}}},
+	})
+	return err
+}
+
+// ListPending returns the company's open invitations, newest first
+func (r *mongoInvitations) ListPending(ctx context.Context) ([]models.Invitation, error) {
+	var invitations []models.Invitation
+	err := findAll(ctx, r.collection, r.scope.filter(bson.M{"status": models.InvitationStatusPending}), &invitations, newestFirst(Page{}))
+	return invitations, err
+}
+
+// Get returns a single invitation
+func (r *mongoInvitations) Get(ctx context.Context, id primitive.ObjectID) (*models.Invitation, error) {
+	var invitation models.Invitation
+	if err := findOne(ctx, r.collection, r.scope.filter(bson.M{"_id": id}), &invitation); err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// FindPending returns the open invitation for email
+func (r *mongoInvitations) FindPending(ctx context.Context, email string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := findOne(ctx, r.collection, r.scope.filter(bson.M{
+		"email":  email,
+		"status": models.InvitationStatusPending,
+	}), &invitation)
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// Create stores a new invitation under the company
+func (r *mongoInvitations) Create(ctx context.Context, invitation *models.Invitation) error {
+	invitation.CompanyID = r.scope.companyID
+	_, err := r.collection.InsertOne(ctx, invitation)
+	return err
+}
+
+// Resend replaces a pending invitation's token, which invalidates the previous
+// link, and restarts its expiry
+func (r *mongoInvitations) Resend(ctx context.Context, id primitive.ObjectID, tokenHash string, sentAt, expiresAt time.Time) error {
+	return updateOne(ctx, r.collection, r.scope.filter(bson.M{
+		"_id":    id,
+		"status": models.InvitationStatusPending,
+	}), bson.M{
+		"$set": bson.M{
+			"token_hash":   tokenHash,
+			"last_sent_at": sentAt,
+			"expires_at":   expiresAt,
+			"updated_at":   sentAt,
+		},
+		"$inc": bson.M{"send_count": 1},
+	})
+}
+
+// Revoke cancels a pending invitation; ErrNotFound when it is no longer pending
+func (r *mongoInvitations) Revoke(ctx context.Context, id primitive.ObjectID, t time.Time) error {
+	return updateOne(ctx, r.collection, r.scope.filter(bson.M{
+		"_id":    id,
+		"status": models.InvitationStatusPending,
+	}), bson.M{
+		"$set": bson.M{
+			"status":     models.InvitationStatusRevoked,
+			"updated_at": t,
+		},
+	})
+}
+
+// Claim marks a pending, unexpired invitation with the given token as accepted
+// by userID, so the token cannot be used twice; ErrNotFound when it cannot be
+func (r *mongoInvitations) Claim(ctx context.Context, id primitive.ObjectID, tokenHash string, userID primitive.ObjectID, t time.Time) error {
+	return updateOne(ctx, r.collection, r.scope.filter(bson.M{
+		"_id":        id,
+		"token_hash": tokenHash,
+		"status":     models.InvitationStatusPending,
+		"expires_at": bson.M{"$gt": t},
+	}), bson.M{
+		"$set": bson.M{
+			"status":      models.InvitationStatusAccepted,
+			"accepted_at": t,
+			"accepted_by": userID,
+			"updated_at":  t,
+		},
+	})
+}
+
+// Release puts a claimed invitation back to pending when joining failed
+func (r *mongoInvitations) Release(ctx context.Context, id primitive.ObjectID) error {
+	return updateOne(ctx, r.collection, r.scope.filter(bson.M{"_id": id}), bson.M{
+		"$set":   bson.M{"status": models.InvitationStatusPending, "updated_at": time.Now()},
+		"$unset": bson.M{"accepted_at": "", "accepted_by": ""},
+	})
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoJournal posts and totals the company's double-entry ledger in MongoDB
+type mongoJournal struct {
+	collection *mongo.Collection
+	scope      Scope
+}
+
+// ensureJournalIndexes makes a second posting for the same transaction fail
+// and keeps as-of totals from scanning other companies' entries
+func ensureJournalIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "transaction_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "date", Value: 1}}},
+	})
+	return err
+}
+
+// Post records a balanced entry under the company
+func (r *mongoJournal) Post(ctx context.Context, entry *models.JournalEntry) error {
+	if !entry.IsBalanced() {
+		return models.ErrUnbalancedEntry
+	}
+	entry.CompanyID = r.scope.companyID
+	_, err := r.collection.InsertOne(ctx, entry)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAlreadyPosted
+	}
+	return err
+}
+
+// ForTransaction returns the entry posted for a transaction
+func (r *mongoJournal) ForTransaction(ctx context.Context, transactionID primitive.ObjectID) (*models.JournalEntry, error) {
+	var entry models.JournalEntry
+	if err := findOne(ctx, r.collection, r.scope.filter(bson.M{"transaction_id": transactionID}), &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Balances totals every ledger account over entries dated before asOf; a zero asOf includes everything
+func (r *mongoJournal) Balances(ctx context.Context, asOf time.Time) ([]models.LedgerBalance, error) {
+	match := bson.M{}
+	if cond := dateRange(time.Time{}, asOf); cond != nil {
+		match["date"] = cond
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: r.scope.filter(match)}},
+		{{Key: "$unwind", Value: "$lines"}},
+		{{Key: "$group", Value: bson.M{
+			"_id":    bson.M{"kind": "$lines.kind", "ref_id": "$lines.ref_id", "currency": "$currency"},
+			"debit":  bson.M{"$sum": "$lines.debit"},
+			"credit": bson.M{"$sum": "$lines.credit"},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":      0,
+			"kind":     "$_id.kind",
+			"ref_id":   "$_id.ref_id",
+			"currency": "$_id.currency",
+			"debit":    1,
+			"credit":   1,
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "kind", Value: 1}, {Key: "currency", Value: 1}, {Key: "ref_id", Value: 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var balances []models.LedgerBalance
+	err = cursor.All(ctx, &balances)
+	return balances, err
+}
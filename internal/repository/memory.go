@@ -0,0 +1,1305 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// errDuplicateID mirrors MongoDB's duplicate key error on _id
+var errDuplicateID = errors.New("repository: duplicate _id")
+
+// MemoryStore is an in-process Store for handler tests. It keeps the same
+// company scoping, not-found errors and ordering as the MongoDB store.
+type MemoryStore struct {
+	txMu          sync.Mutex // Serialises Atomic calls
+	mu            sync.Mutex
+	companies     memoryCollection[models.Company]
+	accounts      memoryCollection[models.Account]
+	transactions  memoryCollection[models.Transaction]
+	categories    memoryCollection[models.Category]
+	budgets       memoryCollection[models.Budget]
+	users         memoryCollection[models.User]
+	auditLogs     memoryCollection[models.AuditLog]
+	journal       memoryCollection[models.JournalEntry]
+	delegations   memoryCollection[models.Delegation]
+	notifications memoryCollection[models.Notification]
+	invitations   memoryCollection[models.Invitation]
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		companies: memoryCollection[models.Company]{
+			id:      func(d *models.Company) *primitive.ObjectID { return &d.ID },
+			company: func(d *models.Company) primitive.ObjectID { return d.ID },
+			clone:   cloneCompany,
+		},
+		accounts: memoryCollection[models.Account]{
+			id:      func(d *models.Account) *primitive.ObjectID { return &d.ID },
+			company: func(d *models.Account) primitive.ObjectID { return d.CompanyID },
+		},
+		transactions: memoryCollection[models.Transaction]{
+			id:      func(d *models.Transaction) *primitive.ObjectID { return &d.ID },
+			company: func(d *models.Transaction) primitive.ObjectID { return d.CompanyID },
+			clone:   cloneTransaction,
+		},
+		categories: memoryCollection[models.Category]{
+			id:      func(d *models.Category) *primitive.ObjectID { return &d.ID },
+			company: func(d *models.Category) primitive.ObjectID { return d.CompanyID },
+		},
+		budgets: memoryCollection[models.Budget]{
+			id:      func(d *models.Budget) *primitive.ObjectID { return &d.ID },
+			company: func(d *models.Budget) primitive.ObjectID { return d.CompanyID },
+			clone:   cloneBudget,
+		},
+		users: memoryCollection[models.User]{
+			id:      func(d *models.User) *primitive.ObjectID { return &d.ID },
+			company: func(d *models.User) primitive.ObjectID { return d.CompanyID },
+			clone:   cloneUser,
+		},
+		auditLogs: memoryCollection[models.AuditLog]{
+			id:      func(d *models.AuditLog) *primitive.ObjectID { return &d.ID },
+			company: func(d *models.AuditLog) primitive.ObjectID { return d.CompanyID },
+			clone:   cloneAuditLog,
+		},
+		journal: memoryCollection[models.JournalEntry]{
+			id:      func(d *models.JournalEntry) *primitive.ObjectID { return &d.ID },
+			company: func(d *models.JournalEntry) primitive.ObjectID { return d.CompanyID },
+			clone:   cloneJournalEntry,
+		},
+		delegations: memoryCollection[models.Delegation]{
+			id:      func(d *models.Delegation) *primitive.ObjectID { return &d.ID },
+			company: func(d *models.Delegation) primitive.ObjectID { return d.CompanyID },
+		},
+		notifications: memoryCollection[models.Notification]{
+			id:      func(d *models.Notification) *primitive.ObjectID { return &d.ID },
+			company: func(d *models.Notification) primitive.ObjectID { return d.CompanyID },
+		},
+		invitations: memoryCollection[models.Invitation]{
+			id:      func(d *models.Invitation) *primitive.ObjectID { return &d.ID },
+			company: func(d *models.Invitation) primitive.ObjectID { return d.CompanyID },
+		},
+	}
+}
+
+// Scoped returns the repositories for an explicit scope
+func (s *MemoryStore) Scoped(scope Scope) *Repositories {
+	return &Repositories{
+		Scope:         scope,
+		Company:       &memoryCompanies{store: s, scope: scope},
+		Accounts:      &memoryAccounts{store: s, scope: scope},
+		Transactions:  &memoryTransactions{store: s, scope: scope},
+		Categories:    &memoryCategories{store: s, scope: scope},
+		Budgets:       &memoryBudgets{store: s, scope: scope},
+		Users:         &memoryUsers{store: s, scope: scope},
+		AuditLogs:     &memoryAuditLogs{store: s, scope: scope},
+		Journal:       &memoryJournal{store: s, scope: scope},
+		Delegations:   &memoryDelegations{store: s, scope: scope},
+		Notifications: &memoryNotifications{store: s, scope: scope},
+		Invitations:   &memoryInvitations{store: s, scope: scope},
+		atomic:        s.inTransaction,
+	}
+}
+
+// Identities returns the unscoped user lookups used by the sign-in flows
+func (s *MemoryStore) Identities() IdentityStore {
+	return &memoryIdentities{store: s}
+}
+
+// Directory returns the lookups across companies
+func (s *MemoryStore) Directory() Directory {
+	return &memoryDirectory{store: s}
+}
+
+// AddCompany seeds a company, which is otherwise created outside the repositories at sign-up
+func (s *MemoryStore) AddCompany(company models.Company) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.companies.insert(company)
+}
+
+// memorySnapshot holds copies of every collection for rolling back a failed Atomic call
+type memorySnapshot struct {
+	companies     []models.Company
+	accounts      []models.Account
+	transactions  []models.Transaction
+	categories    []models.Category
+	budgets       []models.Budget
+	users         []models.User
+	auditLogs     []models.AuditLog
+	journal       []models.JournalEntry
+	delegations   []models.Delegation
+	notifications []models.Notification
+	invitations   []models.Invitation
+}
+
+func (s *MemoryStore) snapshot() memorySnapshot {
+	return memorySnapshot{
+		companies:     s.companies.all(),
+		accounts:      s.accounts.all(),
+		transactions:  s.transactions.all(),
+		categories:    s.categories.all(),
+		budgets:       s.budgets.all(),
+		users:         s.users.all(),
+		auditLogs:     s.auditLogs.all(),
+		journal:       s.journal.all(),
+		delegations:   s.delegations.all(),
+		notifications: s.notifications.all(),
+		invitations:   s.invitations.all(),
+	}
+}
+
+func (s *MemoryStore) restore(snapshot memorySnapshot) {
+	s.companies.docs = snapshot.companies
+	s.accounts.docs = snapshot.accounts
+	s.transactions.docs = snapshot.transactions
+	s.categories.docs = snapshot.categories
+	s.budgets.docs = snapshot.budgets
+	s.users.docs = snapshot.users
+	s.auditLogs.docs = snapshot.auditLogs
+	s.journal.docs = snapshot.journal
+	s.delegations.docs = snapshot.delegations
+	s.notifications.docs = snapshot.notifications
+	s.invitations.docs = snapshot.invitations
+}
+
+// memoryCollection keeps documents in insertion order, like an unsorted MongoDB find
+type memoryCollection[T any] struct {
+	docs    []T
+	id      func(*T) *primitive.ObjectID
+	company func(*T) primitive.ObjectID
+	clone   func(T) T // Copies the slices and maps of a document; nil when it has none
+}
+
+// copyOf returns doc sharing no slices or maps with the original, so that
+// neither callers nor a rollback snapshot can change a stored document
+func (m *memoryCollection[T]) copyOf(doc T) T {
+	if m.clone == nil {
+		return doc
+	}
+	return m.clone(doc)
+}
+
+// all returns copies of every document, for a snapshot
+func (m *memoryCollection[T]) all() []T {
+	docs := make([]T, len(m.docs))
+	for i := range m.docs {
+		docs[i] = m.copyOf(m.docs[i])
+	}
+	return docs
+}
+
+// insert stores a copy of doc, assigning an ID when it has none
+func (m *memoryCollection[T]) insert(doc T) error {
+	id := m.id(&doc)
+	if id.IsZero() {
+		*id = primitive.NewObjectID()
+	}
+	for i := range m.docs {
+		if *m.id(&m.docs[i]) == *id {
+			return errDuplicateID
+		}
+	}
+	m.docs = append(m.docs, m.copyOf(doc))
+	return nil
+}
+
+// find returns copies of the documents in scope that match
+func (m *memoryCollection[T]) find(scope Scope, match func(*T) bool) []T {
+	var out []T
+	for i := range m.docs {
+		if m.company(&m.docs[i]) == scope.companyID && match(&m.docs[i]) {
+			out = append(out, m.copyOf(m.docs[i]))
+		}
+	}
+	return out
+}
+
+// get returns a copy of the document in scope with the given ID
+func (m *memoryCollection[T]) get(scope Scope, id primitive.ObjectID) (*T, error) {
+	docs := m.find(scope, func(d *T) bool { return *m.id(d) == id })
+	if len(docs) == 0 {
+		return nil, ErrNotFound
+	}
+	return &docs[0], nil
+}
+
+// update applies change to every document in scope that matches and reports how many matched
+func (m *memoryCollection[T]) update(scope Scope, match func(*T) bool, change func(*T)) int {
+	matched := 0
+	for i := range m.docs {
+		if m.company(&m.docs[i]) == scope.companyID && match(&m.docs[i]) {
+			change(&m.docs[i])
+			matched++
+		}
+	}
+	return matched
+}
+
+// remove deletes every document in scope that matches and reports how many there were
+func (m *memoryCollection[T]) remove(scope Scope, match func(*T) bool) int {
+	kept := m.docs[:0:0]
+	for i := range m.docs {
+		if m.company(&m.docs[i]) != scope.companyID || !match(&m.docs[i]) {
+			kept = append(kept, m.docs[i])
+		}
+	}
+	removed := len(m.docs) - len(kept)
+	m.docs = kept
+	return removed
+}
+
+// updateByID changes one document in scope, returning ErrNotFound on a miss
+func (m *memoryCollection[T]) updateByID(scope Scope, id primitive.ObjectID, change func(*T)) error {
+	if m.update(scope, func(d *T) bool { return *m.id(d) == id }, change) == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// inRange reports whether t falls within [from, until); zero bounds are open
+func inRange(t, from, until time.Time) bool {
+	if !from.IsZero() && t.Before(from) {
+		return false
+	}
+	if !until.IsZero() && !t.Before(until) {
+		return false
+	}
+	return true
+}
+
+// paginate sorts newest first by createdAt and applies the page window
+func paginate[T any](docs []T, createdAt func(*T) time.Time, page Page) []T {
+	sort.SliceStable(docs, func(i, j int) bool {
+		return createdAt(&docs[i]).After(createdAt(&docs[j]))
+	})
+	if page.Skip > 0 {
+		if page.Skip >= int64(len(docs)) {
+			return nil
+		}
+		docs = docs[page.Skip:]
+	}
+	if page.Limit > 0 && page.Limit < int64(len(docs)) {
+		docs = docs[:page.Limit]
+	}
+	return docs
+}
+
+// cloneCompany copies the limits and workflows of a company's approval policy
+func cloneCompany(c models.Company) models.Company {
+	c.Approvals.RoleLimits = maps.Clone(c.Approvals.RoleLimits)
+	c.Approvals.UserLimits = maps.Clone(c.Approvals.UserLimits)
+	c.Approvals.Workflows = slices.Clone(c.Approvals.Workflows)
+	for i := range c.Approvals.Workflows {
+		c.Approvals.Workflows[i].Steps = slices.Clone(c.Approvals.Workflows[i].Steps)
+	}
+	return c
+}
+
+// cloneTransaction copies a transaction's approval history
+func cloneTransaction(t models.Transaction) models.Transaction {
+	t.ApprovalHistory = slices.Clone(t.ApprovalHistory)
+	return t
+}
+
+// cloneBudget copies the categories of a budget's scope
+func cloneBudget(b models.Budget) models.Budget {
+	b.CategoryIDs = slices.Clone(b.CategoryIDs)
+	return b
+}
+
+// cloneUser copies a user's recovery code hashes
+func cloneUser(u models.User) models.User {
+	u.RecoveryCodeHashes = slices.Clone(u.RecoveryCodeHashes)
+	return u
+}
+
+// cloneAuditLog copies the top level of an entry's changes, which are never modified in place
+func cloneAuditLog(l models.AuditLog) models.AuditLog {
+	l.Changes = maps.Clone(l.Changes)
+	return l
+}
+
+// cloneJournalEntry copies an entry's lines
+func cloneJournalEntry(e models.JournalEntry) models.JournalEntry {
+	e.Lines = slices.Clone(e.Lines)
+	return e
+}
+
+// memoryCompanies is the in-memory CompanyStore
+type memoryCompanies struct {
+	store *MemoryStore
+	scope Scope
+}
+
+func (r *memoryCompanies) Get(ctx context.Context) (*models.Company, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.companies.get(r.scope, r.scope.companyID)
+}
+
+func (r *memoryCompanies) Create(ctx context.Context, company *models.Company) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	company.ID = r.scope.companyID
+	return r.store.companies.insert(*company)
+}
+
+func (r *memoryCompanies) Delete(ctx context.Context) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	r.store.companies.remove(r.scope, func(*models.Company) bool { return true })
+	return nil
+}
+
+func (r *memoryCompanies) SetRequire2FA(ctx context.Context, require bool) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.companies.updateByID(r.scope, r.scope.companyID, func(c *models.Company) {
+		c.Require2FA = require
+		c.UpdatedAt = time.Now()
+	})
+}
+
+func (r *memoryCompanies) SetApprovalPolicy(ctx context.Context, policy models.ApprovalPolicy) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.companies.updateByID(r.scope, r.scope.companyID, func(c *models.Company) {
+		c.Approvals = policy
+		c.UpdatedAt = time.Now()
+	})
+}
+
+// memoryAccounts is the in-memory AccountStore
+type memoryAccounts struct {
+	store *MemoryStore
+	scope Scope
+}
+
+func (r *memoryAccounts) List(ctx context.Context, activeOnly bool) ([]models.Account, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.accounts.find(r.scope, func(a *models.Account) bool {
+		return !activeOnly || a.IsActive
+	}), nil
+}
+
+func (r *memoryAccounts) Get(ctx context.Context, id primitive.ObjectID) (*models.Account, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.accounts.get(r.scope, id)
+}
+
+func (r *memoryAccounts) Create(ctx context.Context, account *models.Account) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	account.CompanyID = r.scope.companyID
+	return r.store.accounts.insert(*account)
+}
+
+func (r *memoryAccounts) Update(ctx context.Context, id primitive.ObjectID, name, accountType, currency string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.accounts.updateByID(r.scope, id, func(a *models.Account) {
+		a.Name = name
+		a.Type = models.AccountType(accountType)
+		a.Currency = currency
+		a.UpdatedAt = time.Now()
+	})
+}
+
+func (r *memoryAccounts) Deactivate(ctx context.Context, id primitive.ObjectID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.accounts.updateByID(r.scope, id, func(a *models.Account) {
+		a.IsActive = false
+		a.UpdatedAt = time.Now()
+	})
+}
+
+func (r *memoryAccounts) AdjustBalance(ctx context.Context, id primitive.ObjectID, delta models.Money) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.accounts.updateByID(r.scope, id, func(a *models.Account) {
+		a.Balance += delta
+	})
+}
+
+func (r *memoryAccounts) SetBalance(ctx context.Context, id primitive.ObjectID, balance models.Money) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.accounts.updateByID(r.scope, id, func(a *models.Account) {
+		a.Balance = balance
+		a.UpdatedAt = time.Now()
+	})
+}
+
+// memoryTransactions is the in-memory TransactionStore
+type memoryTransactions struct {
+	store *MemoryStore
+	scope Scope
+}
+
+func (r *memoryTransactions) matching(filter TransactionFilter) []models.Transaction {
+	return r.store.transactions.find(r.scope, func(t *models.Transaction) bool {
+		return (filter.Type == "" || t.Type == filter.Type) &&
+			(filter.Status == "" || t.Status == filter.Status) &&
+			(filter.Status != "" || !filter.Posted || t.IsPosted()) &&
+			inRange(t.TransactionDate, filter.From, filter.Until) &&
+			(filter.Related.IsZero() || t.IsLinkedTo(filter.Related))
+	})
+}
+
+func (r *memoryTransactions) List(ctx context.Context, filter TransactionFilter, page Page) ([]models.Transaction, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return paginate(r.matching(filter), func(t *models.Transaction) time.Time { return t.CreatedAt }, page), nil
+}
+
+func (r *memoryTransactions) Count(ctx context.Context, filter TransactionFilter) (int64, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return int64(len(r.matching(filter))), nil
+}
+
+func (r *memoryTransactions) Get(ctx context.Context, id primitive.ObjectID) (*models.Transaction, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.transactions.get(r.scope, id)
+}
+
+func (r *memoryTransactions) Create(ctx context.Context, txn *models.Transaction) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	txn.CompanyID = r.scope.companyID
+	return r.store.transactions.insert(*txn)
+}
+
+func (r *memoryTransactions) Update(ctx context.Context, id primitive.ObjectID, description string, amount models.Money, categoryID primitive.ObjectID, transactionDate time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	if err := r.notPosted(id); err != nil {
+		return err
+	}
+	return r.store.transactions.updateByID(r.scope, id, func(t *models.Transaction) {
+		t.Description = description
+		t.Amount = amount
+		if !categoryID.IsZero() {
+			t.CategoryID = categoryID
+		}
+		if !transactionDate.IsZero() {
+			t.TransactionDate = transactionDate
+		}
+		t.UpdatedAt = time.Now()
+	})
+}
+
+func (r *memoryTransactions) Delete(ctx context.Context, id primitive.ObjectID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	if err := r.notPosted(id); err != nil {
+		return err
+	}
+	docs := r.store.transactions.docs
+	for i := range docs {
+		if docs[i].ID == id && docs[i].CompanyID == r.scope.companyID {
+			r.store.transactions.docs = append(docs[:i:i], docs[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryTransactions) ChangeStatus(ctx context.Context, id primitive.ObjectID, change StatusChange) (*models.Transaction, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	now := time.Now()
+	matched := r.store.transactions.update(r.scope, func(t *models.Transaction) bool {
+		return t.ID == id && t.Status == change.From
+	}, func(t *models.Transaction) {
+		t.Status = change.To
+		t.UpdatedAt = now
+		if change.Record != nil {
+			t.ApprovalHistory = append(slices.Clip(t.ApprovalHistory), *change.Record)
+		}
+		if change.To == models.TransactionStatusApproved {
+			t.ApprovalStep++
+		} else {
+			t.ApprovalStep = 0
+		}
+		t.EscalationLevel = 0
+		t.EscalatedAt = time.Time{}
+		switch change.To {
+		case models.TransactionStatusApproved, models.TransactionStatusRejected:
+			t.ApprovedByID = change.Actor.ID
+			t.ApprovedByName = change.Actor.Name
+			t.ApprovedAt = now
+			if change.To == models.TransactionStatusRejected {
+				t.RejectionReason = change.Reason
+			}
+		case models.TransactionStatusPaid:
+			t.PaidByID = change.Actor.ID
+			t.PaidByName = change.Actor.Name
+			t.PaidAt = now
+		case models.TransactionStatusDraft, models.TransactionStatusPending:
+			t.ApprovedByID = primitive.NilObjectID
+			t.ApprovedByName = ""
+			t.ApprovedAt = time.Time{}
+			t.RejectionReason = ""
+			if change.To == models.TransactionStatusPending {
+				t.SubmittedAt = now
+			}
+			t.BudgetOverride = change.BudgetOverride
+		}
+	})
+	txn, err := r.store.transactions.get(r.scope, id)
+	if err != nil {
+		return nil, err
+	}
+	if matched == 0 {
+		return nil, ErrStatusChanged
+	}
+	return txn, nil
+}
+
+func (r *memoryTransactions) SignOff(ctx context.Context, id primitive.ObjectID, step int, record models.ApprovalRecord) (*models.Transaction, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	matched := r.store.transactions.update(r.scope, func(t *models.Transaction) bool {
+		return t.ID == id && t.Status == models.TransactionStatusPending && t.ApprovalStep == step
+	}, func(t *models.Transaction) {
+		t.ApprovalHistory = append(slices.Clip(t.ApprovalHistory), record)
+		t.ApprovalStep++
+		t.EscalationLevel = 0
+		t.EscalatedAt = time.Time{}
+		t.UpdatedAt = time.Now()
+	})
+	txn, err := r.store.transactions.get(r.scope, id)
+	if err != nil {
+		return nil, err
+	}
+	if matched == 0 {
+		return nil, ErrStatusChanged
+	}
+	return txn, nil
+}
+
+func (r *memoryTransactions) Escalate(ctx context.Context, id primitive.ObjectID, step, level int, at time.Time) (*models.Transaction, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	matched := r.store.transactions.update(r.scope, func(t *models.Transaction) bool {
+		return t.ID == id && t.Status == models.TransactionStatusPending && t.ApprovalStep == step && t.EscalationLevel < level
+	}, func(t *models.Transaction) {
+		t.EscalationLevel = level
+		t.EscalatedAt = at
+	})
+	txn, err := r.store.transactions.get(r.scope, id)
+	if err != nil {
+		return nil, err
+	}
+	if matched == 0 {
+		return nil, ErrStatusChanged
+	}
+	return txn, nil
+}
+
+// notPosted returns ErrPosted for a posted transaction, like the MongoDB store's filter
+func (r *memoryTransactions) notPosted(id primitive.ObjectID) error {
+	txn, err := r.store.transactions.get(r.scope, id)
+	if err != nil {
+		return err
+	}
+	if txn.IsPosted() {
+		return ErrPosted
+	}
+	return nil
+}
+
+func (r *memoryTransactions) MarkReversed(ctx context.Context, id, reversalID, replacementID primitive.ObjectID) (*models.Transaction, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	matched := r.store.transactions.update(r.scope, func(t *models.Transaction) bool {
+		return t.ID == id && t.Status == models.TransactionStatusVoided && !t.IsReversal() && !t.IsReversed()
+	}, func(t *models.Transaction) {
+		t.ReversedByID = reversalID
+		if !replacementID.IsZero() {
+			t.ReplacedByID = replacementID
+		}
+		t.UpdatedAt = time.Now()
+	})
+	txn, err := r.store.transactions.get(r.scope, id)
+	if err != nil {
+		return nil, err
+	}
+	if matched == 0 {
+		return nil, ErrAlreadyReversed
+	}
+	return txn, nil
+}
+
+// memoryCategories is the in-memory CategoryStore
+type memoryCategories struct {
+	store *MemoryStore
+	scope Scope
+}
+
+func (r *memoryCategories) List(ctx context.Context, activeOnly bool) ([]models.Category, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.categories.find(r.scope, func(c *models.Category) bool {
+		return !activeOnly || c.IsActive
+	}), nil
+}
+
+func (r *memoryCategories) Get(ctx context.Context, id primitive.ObjectID) (*models.Category, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.categories.get(r.scope, id)
+}
+
+func (r *memoryCategories) Create(ctx context.Context, category *models.Category) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	category.CompanyID = r.scope.companyID
+	return r.store.categories.insert(*category)
+}
+
+func (r *memoryCategories) Update(ctx context.Context, id primitive.ObjectID, name, categoryType, color string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.categories.updateByID(r.scope, id, func(c *models.Category) {
+		c.Name = name
+		c.Type = models.CategoryType(categoryType)
+		c.Color = color
+		c.UpdatedAt = time.Now()
+	})
+}
+
+func (r *memoryCategories) Deactivate(ctx context.Context, id primitive.ObjectID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.categories.updateByID(r.scope, id, func(c *models.Category) {
+		c.IsActive = false
+		c.UpdatedAt = time.Now()
+	})
+}
+
+func (r *memoryCategories) DeleteAll(ctx context.Context) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	r.store.categories.remove(r.scope, func(*models.Category) bool { return true })
+	return nil
+}
+
+// memoryBudgets is the in-memory BudgetStore
+type memoryBudgets struct {
+	store *MemoryStore
+	scope Scope
+}
+
+func (r *memoryBudgets) List(ctx context.Context, activeOnly bool) ([]models.Budget, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.budgets.find(r.scope, func(b *models.Budget) bool {
+		return !activeOnly || b.IsActive
+	}), nil
+}
+
+func (r *memoryBudgets) Get(ctx context.Context, id primitive.ObjectID) (*models.Budget, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.budgets.get(r.scope, id)
+}
+
+func (r *memoryBudgets) Create(ctx context.Context, budget *models.Budget) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	budget.CompanyID = r.scope.companyID
+	return r.store.budgets.insert(*budget)
+}
+
+func (r *memoryBudgets) Update(ctx context.Context, id primitive.ObjectID, name string, amount models.Money) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.budgets.updateByID(r.scope, id, func(b *models.Budget) {
+		b.Name = name
+		b.Amount = amount
+		b.UpdatedAt = time.Now()
+	})
+}
+
+func (r *memoryBudgets) SetThresholds(ctx context.Context, id primitive.ObjectID, thresholds models.BudgetThresholds) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.budgets.updateByID(r.scope, id, func(b *models.Budget) {
+		b.BudgetThresholds = thresholds
+		b.UpdatedAt = time.Now()
+	})
+}
+
+func (r *memoryBudgets) Deactivate(ctx context.Context, id primitive.ObjectID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.budgets.updateByID(r.scope, id, func(b *models.Budget) {
+		b.IsActive = false
+		b.UpdatedAt = time.Now()
+	})
+}
+
+func (r *memoryBudgets) SetSpent(ctx context.Context, id primitive.ObjectID, spent models.Money) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.budgets.updateByID(r.scope, id, func(b *models.Budget) {
+		b.Spent = spent
+		b.UpdatedAt = time.Now()
+	})
+}
+
+func (r *memoryBudgets) Close(ctx context.Context, id primitive.ObjectID, t time.Time) (*models.Budget, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	matched := r.store.budgets.update(r.scope, func(b *models.Budget) bool {
+		return b.ID == id && b.IsActive
+	}, func(b *models.Budget) {
+		b.IsActive = false
+		b.ClosedAt = t
+		b.UpdatedAt = t
+	})
+	if matched == 0 {
+		return nil, ErrNotFound
+	}
+	return r.store.budgets.get(r.scope, id)
+}
+
+// memoryUsers is the in-memory UserStore
+type memoryUsers struct {
+	store *MemoryStore
+	scope Scope
+}
+
+func (r *memoryUsers) List(ctx context.Context) ([]models.User, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.users.find(r.scope, func(*models.User) bool { return true }), nil
+}
+
+func (r *memoryUsers) Get(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.users.get(r.scope, id)
+}
+
+func (r *memoryUsers) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	users := r.store.users.find(r.scope, func(u *models.User) bool { return u.Email == email })
+	if len(users) == 0 {
+		return nil, ErrNotFound
+	}
+	return &users[0], nil
+}
+
+func (r *memoryUsers) UpdateRole(ctx context.Context, id primitive.ObjectID, role string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.users.updateByID(r.scope, id, func(u *models.User) {
+		u.Role = role
+		u.UpdatedAt = time.Now()
+	})
+}
+
+func (r *memoryUsers) UpdateDepartment(ctx context.Context, id primitive.ObjectID, department string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.users.updateByID(r.scope, id, func(u *models.User) {
+		u.Department = department
+		u.UpdatedAt = time.Now()
+	})
+}
+
+// memoryAuditLogs is the in-memory AuditLogStore
+type memoryAuditLogs struct {
+	store *MemoryStore
+	scope Scope
+}
+
+func (r *memoryAuditLogs) matching(filter AuditFilter) []models.AuditLog {
+	return r.store.auditLogs.find(r.scope, func(l *models.AuditLog) bool {
+		return (filter.Entity == "" || l.Entity == filter.Entity) &&
+			(filter.Action == "" || l.Action == filter.Action) &&
+			inRange(l.CreatedAt, filter.From, filter.Until)
+	})
+}
+
+func (r *memoryAuditLogs) Insert(ctx context.Context, log *models.AuditLog) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	log.CompanyID = r.scope.companyID
+	return r.store.auditLogs.insert(*log)
+}
+
+func (r *memoryAuditLogs) List(ctx context.Context, filter AuditFilter, page Page) ([]models.AuditLog, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return paginate(r.matching(filter), func(l *models.AuditLog) time.Time { return l.CreatedAt }, page), nil
+}
+
+func (r *memoryAuditLogs) Count(ctx context.Context, filter AuditFilter) (int64, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return int64(len(r.matching(filter))), nil
+}
+
+// memoryJournal is the in-memory JournalStore
+type memoryJournal struct {
+	store *MemoryStore
+	scope Scope
+}
+
+func (r *memoryJournal) Post(ctx context.Context, entry *models.JournalEntry) error {
+	if !entry.IsBalanced() {
+		return models.ErrUnbalancedEntry
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	// The transaction_id index is unique across companies
+	for _, posted := range r.store.journal.docs {
+		if posted.TransactionID == entry.TransactionID {
+			return ErrAlreadyPosted
+		}
+	}
+	entry.CompanyID = r.scope.companyID
+	return r.store.journal.insert(*entry)
+}
+
+func (r *memoryJournal) ForTransaction(ctx context.Context, transactionID primitive.ObjectID) (*models.JournalEntry, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	entries := r.store.journal.find(r.scope, func(e *models.JournalEntry) bool {
+		return e.TransactionID == transactionID
+	})
+	if len(entries) == 0 {
+		return nil, ErrNotFound
+	}
+	return &entries[0], nil
+}
+
+func (r *memoryJournal) Balances(ctx context.Context, asOf time.Time) ([]models.LedgerBalance, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	entries := r.store.journal.find(r.scope, func(e *models.JournalEntry) bool {
+		return inRange(e.Date, time.Time{}, asOf)
+	})
+
+	type key struct {
+		kind     models.LedgerKind
+		refID    primitive.ObjectID
+		currency string
+	}
+	totals := make(map[key]*models.LedgerBalance)
+	var balances []*models.LedgerBalance
+	for _, entry := range entries {
+		for _, line := range entry.Lines {
+			k := key{line.Kind, line.RefID, entry.Currency}
+			balance, ok := totals[k]
+			if !ok {
+				balance = &models.LedgerBalance{Kind: line.Kind, RefID: line.RefID, Currency: entry.Currency}
+				totals[k] = balance
+				balances = append(balances, balance)
+			}
+			balance.Debit += line.Debit
+			balance.Credit += line.Credit
+		}
+	}
+
+	// Same order as the MongoDB pipeline: kind, currency, then ID
+	sort.Slice(balances, func(i, j int) bool {
+		a, b := balances[i], balances[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Currency != b.Currency {
+			return a.Currency < b.Currency
+		}
+		return a.RefID.Hex() < b.RefID.Hex()
+	})
+	out := make([]models.LedgerBalance, len(balances))
+	for i, balance := range balances {
+		out[i] = *balance
+	}
+	return out, nil
+}
+
+// memoryIdentities is the in-memory IdentityStore; it sees users of every company
+type memoryIdentities struct {
+	store *MemoryStore
+}
+
+func (r *memoryIdentities) findUser(match func(*models.User) bool) (*models.User, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	for i := range r.store.users.docs {
+		if match(&r.store.users.docs[i]) {
+			user := r.store.users.copyOf(r.store.users.docs[i])
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryIdentities) set(id primitive.ObjectID, change func(*models.User)) error {
+	return r.setIf(id, func(*models.User) bool { return true }, change)
+}
+
+// setIf changes the user with the given ID only if match holds, returning ErrNotFound otherwise
+func (r *memoryIdentities) setIf(id primitive.ObjectID, match func(*models.User) bool, change func(*models.User)) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	for i := range r.store.users.docs {
+		if r.store.users.docs[i].ID == id && match(&r.store.users.docs[i]) {
+			change(&r.store.users.docs[i])
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryIdentities) FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	return r.findUser(func(u *models.User) bool { return u.ID == id })
+}
+
+func (r *memoryIdentities) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.findUser(func(u *models.User) bool { return u.Email == email })
+}
+
+func (r *memoryIdentities) FindByVerifyCode(ctx context.Context, email, code string, now time.Time) (*models.User, error) {
+	return r.findUser(func(u *models.User) bool {
+		return u.Email == email && u.VerifyToken == code && u.VerifyExpiresAt.After(now)
+	})
+}
+
+func (r *memoryIdentities) FindByVerifyToken(ctx context.Context, token string, now time.Time) (*models.User, error) {
+	return r.findUser(func(u *models.User) bool {
+		return u.VerifyToken == token && u.VerifyExpiresAt.After(now)
+	})
+}
+
+func (r *memoryIdentities) FindByResetToken(ctx context.Context, token string, now time.Time) (*models.User, error) {
+	return r.findUser(func(u *models.User) bool {
+		return u.ResetToken == token && u.ResetExpiresAt.After(now)
+	})
+}
+
+func (r *memoryIdentities) Create(ctx context.Context, user *models.User) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.users.insert(*user)
+}
+
+func (r *memoryIdentities) RecordLogin(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	return r.set(id, func(u *models.User) { u.LastLoginAt = at })
+}
+
+func (r *memoryIdentities) RecordEmailSent(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	return r.set(id, func(u *models.User) { u.LastEmailSentAt = at })
+}
+
+func (r *memoryIdentities) SetVerifyCode(ctx context.Context, id primitive.ObjectID, code string, expiresAt, sentAt time.Time) error {
+	return r.set(id, func(u *models.User) {
+		u.VerifyToken = code
+		u.VerifyExpiresAt = expiresAt
+		u.LastEmailSentAt = sentAt
+	})
+}
+
+func (r *memoryIdentities) MarkEmailVerified(ctx context.Context, id primitive.ObjectID) error {
+	return r.set(id, func(u *models.User) {
+		u.EmailVerified = true
+		u.VerifyToken = ""
+		u.VerifyExpiresAt = time.Time{}
+		u.UpdatedAt = time.Now()
+	})
+}
+
+func (r *memoryIdentities) SetResetToken(ctx context.Context, id primitive.ObjectID, token string, expiresAt time.Time) error {
+	return r.set(id, func(u *models.User) {
+		u.ResetToken = token
+		u.ResetExpiresAt = expiresAt
+	})
+}
+
+func (r *memoryIdentities) SetPassword(ctx context.Context, id primitive.ObjectID, passwordHash string) error {
+	return r.set(id, func(u *models.User) {
+		u.PasswordHash = passwordHash
+		u.ResetToken = ""
+		u.ResetExpiresAt = time.Time{}
+		u.UpdatedAt = time.Now()
+	})
+}
+
+func (r *memoryIdentities) JoinCompany(ctx context.Context, id, companyID primitive.ObjectID, role string) error {
+	return r.set(id, func(u *models.User) {
+		u.CompanyID = companyID
+		u.Role = role
+		u.EmailVerified = true
+		u.UpdatedAt = time.Now()
+	})
+}
+
+func (r *memoryIdentities) SetPendingTOTPSecret(ctx context.Context, id primitive.ObjectID, secret string) error {
+	return r.set(id, func(u *models.User) {
+		u.TOTPPendingSecret = secret
+		u.UpdatedAt = time.Now()
+	})
+}
+
+func (r *memoryIdentities) EnableTOTP(ctx context.Context, id primitive.ObjectID, secret string, step int64, recoveryCodeHashes []string, at time.Time) error {
+	return r.set(id, func(u *models.User) {
+		u.TOTPEnabled = true
+		u.TOTPSecret = secret
+		u.TOTPLastStep = step
+		u.TOTPEnabledAt = at
+		u.RecoveryCodeHashes = slices.Clone(recoveryCodeHashes)
+		u.TOTPPendingSecret = ""
+		u.UpdatedAt = at
+	})
+}
+
+func (r *memoryIdentities) DisableTOTP(ctx context.Context, id primitive.ObjectID) error {
+	return r.set(id, func(u *models.User) {
+		u.TOTPEnabled = false
+		u.TOTPSecret = ""
+		u.TOTPLastStep = 0
+		u.TOTPEnabledAt = time.Time{}
+		u.RecoveryCodeHashes = nil
+		u.UpdatedAt = time.Now()
+	})
+}
+
+func (r *memoryIdentities) SetRecoveryCodes(ctx context.Context, id primitive.ObjectID, recoveryCodeHashes []string) error {
+	return r.set(id, func(u *models.User) {
+		u.RecoveryCodeHashes = slices.Clone(recoveryCodeHashes)
+		u.UpdatedAt = time.Now()
+	})
+}
+
+func (r *memoryIdentities) UseRecoveryCode(ctx context.Context, id primitive.ObjectID, hash string) error {
+	return r.setIf(id, func(u *models.User) bool {
+		return slices.Contains(u.RecoveryCodeHashes, hash)
+	}, func(u *models.User) {
+		u.RecoveryCodeHashes = slices.DeleteFunc(u.RecoveryCodeHashes, func(h string) bool { return h == hash })
+	})
+}
+
+func (r *memoryIdentities) UseTOTPStep(ctx context.Context, id primitive.ObjectID, step int64) error {
+	return r.setIf(id, func(u *models.User) bool {
+		return u.TOTPLastStep < step
+	}, func(u *models.User) {
+		u.TOTPLastStep = step
+	})
+}
+
+// memoryDelegations is the in-memory DelegationStore
+type memoryDelegations struct {
+	store *MemoryStore
+	scope Scope
+}
+
+func (r *memoryDelegations) List(ctx context.Context, userID primitive.ObjectID) ([]models.Delegation, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	delegations := r.store.delegations.find(r.scope, func(d *models.Delegation) bool {
+		return d.FromUserID == userID || d.ToUserID == userID
+	})
+	return paginate(delegations, func(d *models.Delegation) time.Time { return d.CreatedAt }, Page{}), nil
+}
+
+func (r *memoryDelegations) ActiveFor(ctx context.Context, userID primitive.ObjectID, t time.Time) ([]models.Delegation, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	delegations := r.store.delegations.find(r.scope, func(d *models.Delegation) bool {
+		return d.ToUserID == userID && d.IsActive(t)
+	})
+	return paginate(delegations, func(d *models.Delegation) time.Time { return d.CreatedAt }, Page{}), nil
+}
+
+func (r *memoryDelegations) Create(ctx context.Context, delegation *models.Delegation) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	delegation.CompanyID = r.scope.companyID
+	return r.store.delegations.insert(*delegation)
+}
+
+func (r *memoryDelegations) Revoke(ctx context.Context, id, fromUserID primitive.ObjectID, t time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	matched := r.store.delegations.update(r.scope, func(d *models.Delegation) bool {
+		return d.ID == id && d.FromUserID == fromUserID && d.RevokedAt.IsZero()
+	}, func(d *models.Delegation) {
+		d.RevokedAt = t
+	})
+	if matched == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// memoryNotifications is the in-memory NotificationStore
+type memoryNotifications struct {
+	store *MemoryStore
+	scope Scope
+}
+
+func (r *memoryNotifications) List(ctx context.Context, userID primitive.ObjectID, unreadOnly bool) ([]models.Notification, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	notifications := r.store.notifications.find(r.scope, func(n *models.Notification) bool {
+		return n.UserID == userID && (!unreadOnly || !n.IsRead())
+	})
+	return paginate(notifications, func(n *models.Notification) time.Time { return n.CreatedAt }, Page{}), nil
+}
+
+func (r *memoryNotifications) Create(ctx context.Context, notification *models.Notification) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	notification.CompanyID = r.scope.companyID
+	return r.store.notifications.insert(*notification)
+}
+
+func (r *memoryNotifications) MarkRead(ctx context.Context, id, userID primitive.ObjectID, t time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	matched := r.store.notifications.update(r.scope, func(n *models.Notification) bool {
+		return n.ID == id && n.UserID == userID
+	}, func(n *models.Notification) {
+		if !n.IsRead() {
+			n.ReadAt = t
+		}
+	})
+	if matched == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// memoryInvitations is the in-memory InvitationStore
+type memoryInvitations struct {
+	store *MemoryStore
+	scope Scope
+}
+
+func (r *memoryInvitations) ListPending(ctx context.Context) ([]models.Invitation, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	invitations := r.store.invitations.find(r.scope, func(i *models.Invitation) bool {
+		return i.Status == models.InvitationStatusPending
+	})
+	return paginate(invitations, func(i *models.Invitation) time.Time { return i.CreatedAt }, Page{}), nil
+}
+
+func (r *memoryInvitations) Get(ctx context.Context, id primitive.ObjectID) (*models.Invitation, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.invitations.get(r.scope, id)
+}
+
+func (r *memoryInvitations) FindPending(ctx context.Context, email string) (*models.Invitation, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	invitations := r.store.invitations.find(r.scope, func(i *models.Invitation) bool {
+		return i.Email == email && i.Status == models.InvitationStatusPending
+	})
+	if len(invitations) == 0 {
+		return nil, ErrNotFound
+	}
+	return &invitations[0], nil
+}
+
+func (r *memoryInvitations) Create(ctx context.Context, invitation *models.Invitation) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	invitation.CompanyID = r.scope.companyID
+	return r.store.invitations.insert(*invitation)
+}
+
+func (r *memoryInvitations) Resend(ctx context.Context, id primitive.ObjectID, tokenHash string, sentAt, expiresAt time.Time) error {
+	return r.updatePending(id, func(i *models.Invitation) bool { return true }, func(i *models.Invitation) {
+		i.TokenHash = tokenHash
+		i.LastSentAt = sentAt
+		i.ExpiresAt = expiresAt
+		i.SendCount++
+		i.UpdatedAt = sentAt
+	})
+}
+
+func (r *memoryInvitations) Revoke(ctx context.Context, id primitive.ObjectID, t time.Time) error {
+	return r.updatePending(id, func(i *models.Invitation) bool { return true }, func(i *models.Invitation) {
+		i.Status = models.InvitationStatusRevoked
+		i.UpdatedAt = t
+	})
+}
+
+func (r *memoryInvitations) Claim(ctx context.Context, id primitive.ObjectID, tokenHash string, userID primitive.ObjectID, t time.Time) error {
+	return r.updatePending(id, func(i *models.Invitation) bool {
+		return i.TokenHash == tokenHash && i.ExpiresAt.After(t)
+	}, func(i *models.Invitation) {
+		i.Status = models.InvitationStatusAccepted
+		i.AcceptedAt = t
+		i.AcceptedBy = userID
+		i.UpdatedAt = t
+	})
+}
+
+func (r *memoryInvitations) Release(ctx context.Context, id primitive.ObjectID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.invitations.updateByID(r.scope, id, func(i *models.Invitation) {
+		i.Status = models.InvitationStatusPending
+		i.AcceptedAt = time.Time{}
+		i.AcceptedBy = primitive.NilObjectID
+		i.UpdatedAt = time.Now()
+	})
+}
+
+// updatePending changes a pending invitation that also matches, returning ErrNotFound otherwise
+func (r *memoryInvitations) updatePending(id primitive.ObjectID, match func(*models.Invitation) bool, change func(*models.Invitation)) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	matched := r.store.invitations.update(r.scope, func(i *models.Invitation) bool {
+		return i.ID == id && i.Status == models.InvitationStatusPending && match(i)
+	}, change)
+	if matched == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// memoryDirectory is the in-memory Directory; it sees every company
+type memoryDirectory struct {
+	store *MemoryStore
+}
+
+func (r *memoryDirectory) Companies(ctx context.Context) ([]models.Company, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.companies.all(), nil
+}
+
+func (r *memoryDirectory) InvitationByToken(ctx context.Context, tokenHash string) (*models.Invitation, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	for _, invitation := range r.store.invitations.docs {
+		if invitation.TokenHash == tokenHash {
+			return &invitation, nil
+		}
+	}
+	return nil, ErrNotFound
+}
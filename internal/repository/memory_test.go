@@ -0,0 +1,256 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var errRollback = errors.New("rollback")
+
+// approvalFixture stores an account holding 100.00, a budget and a pending expense of 30.00 against them
+func approvalFixture(t *testing.T, repos *Repositories) (*models.Account, *models.Budget, *models.Transaction) {
+	t.Helper()
+	ctx := context.Background()
+	account := &models.Account{ID: primitive.NewObjectID(), Name: "Cash", Type: models.AccountTypeCash, Currency: "USD", Balance: 100_00, IsActive: true}
+	if err := repos.Accounts.Create(ctx, account); err != nil {
+		t.Fatal(err)
+	}
+	category := primitive.NewObjectID()
+	budget := models.NewBudget("Travel", category, 500_00, "USD", models.BudgetPeriodMonthly, repos.Scope.CompanyID())
+	budget.ID = primitive.NewObjectID()
+	if err := repos.Budgets.Create(ctx, budget); err != nil {
+		t.Fatal(err)
+	}
+	txn := models.NewTransaction(models.TransactionTypeExpense, 30_00, "USD", repos.Scope.CompanyID(), primitive.NewObjectID(), "Alice")
+	txn.ID = primitive.NewObjectID()
+	txn.FromAccountID = account.ID
+	txn.CategoryID = category
+	if err := repos.Transactions.Create(ctx, txn); err != nil {
+		t.Fatal(err)
+	}
+	return account, budget, txn
+}
+
+func TestMemoryAtomicRollsBackApproval(t *testing.T) {
+	ctx := context.Background()
+	_, repos := NewTestRepos(t, models.Company{})
+	account, budget, txn := approvalFixture(t, repos)
+	approver := &models.User{ID: primitive.NewObjectID(), Name: "Bob"}
+
+	err := repos.Atomic(ctx, func(ctx context.Context) error {
+		approved, err := repos.Transactions.ChangeStatus(ctx, txn.ID, StatusChange{
+			From:  models.TransactionStatusPending,
+			To:    models.TransactionStatusApproved,
+			Actor: approver,
+		})
+		if err != nil {
+			return err
+		}
+		entry, err := models.NewJournalEntry(approved)
+		if err != nil {
+			return err
+		}
+		if err := repos.Journal.Post(ctx, entry); err != nil {
+			return err
+		}
+		if err := repos.Accounts.AdjustBalance(ctx, account.ID, -txn.Amount); err != nil {
+			return err
+		}
+		if err := repos.Budgets.SetSpent(ctx, budget.ID, txn.Amount); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("Atomic returned %v, want the callback's error", err)
+	}
+
+	if got, _ := repos.Transactions.Get(ctx, txn.ID); got.Status != models.TransactionStatusPending {
+		t.Errorf("after rollback the transaction is %s, want pending", got.Status)
+	}
+	if got, _ := repos.Accounts.Get(ctx, account.ID); got.Balance != 100_00 {
+		t.Errorf("after rollback the balance is %d, want %d", got.Balance, 100_00)
+	}
+	if got, _ := repos.Budgets.Get(ctx, budget.ID); got.Spent != 0 {
+		t.Errorf("after rollback the budget has spent %d, want 0", got.Spent)
+	}
+	if entry, err := repos.Journal.ForTransaction(ctx, txn.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("after rollback the ledger has %+v (%v), want no entry", entry, err)
+	}
+}
+
+func TestMemoryChangeStatusExpectsCurrentStatus(t *testing.T) {
+	ctx := context.Background()
+	_, repos := NewTestRepos(t, models.Company{})
+	_, _, txn := approvalFixture(t, repos)
+	approver := &models.User{ID: primitive.NewObjectID(), Name: "Bob"}
+	approve := StatusChange{From: models.TransactionStatusPending, To: models.TransactionStatusApproved, Actor: approver}
+
+	if _, err := repos.Transactions.ChangeStatus(ctx, txn.ID, approve); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repos.Transactions.ChangeStatus(ctx, txn.ID, approve); !errors.Is(err, ErrStatusChanged) {
+		t.Errorf("approving twice returned %v, want ErrStatusChanged", err)
+	}
+	reject := StatusChange{From: models.TransactionStatusPending, To: models.TransactionStatusRejected, Actor: approver, Reason: "Too late"}
+	if _, err := repos.Transactions.ChangeStatus(ctx, txn.ID, reject); !errors.Is(err, ErrStatusChanged) {
+		t.Errorf("rejecting an approved transaction returned %v, want ErrStatusChanged", err)
+	}
+	if got, _ := repos.Transactions.Get(ctx, txn.ID); got.Status != models.TransactionStatusApproved || got.RejectionReason != "" {
+		t.Errorf("stored as %s with reason %q, want it left approved", got.Status, got.RejectionReason)
+	}
+}
+
+func TestMemoryAtomicRollsBackNestedSlices(t *testing.T) {
+	ctx := context.Background()
+	_, repos := NewTestRepos(t, models.Company{})
+
+	txn := models.NewTransaction(models.TransactionTypeExpense, 1000, "USD", repos.Scope.CompanyID(), primitive.NewObjectID(), "Alice")
+	txn.ID = primitive.NewObjectID()
+	txn.Status = models.TransactionStatusPending
+	txn.ApprovalHistory = make([]models.ApprovalRecord, 1, 4) // Spare capacity, so an append would not reallocate
+	txn.ApprovalHistory[0] = models.ApprovalRecord{Step: 1, StepName: "Manager", Status: models.TransactionStatusApproved, At: time.Now()}
+	txn.ApprovalStep = 1
+	if err := repos.Transactions.Create(ctx, txn); err != nil {
+		t.Fatal(err)
+	}
+
+	budget := models.NewBudget("Travel", primitive.NewObjectID(), 5000, "USD", models.BudgetPeriodMonthly, repos.Scope.CompanyID())
+	budget.ID = primitive.NewObjectID()
+	if err := repos.Budgets.Create(ctx, budget); err != nil {
+		t.Fatal(err)
+	}
+
+	err := repos.Atomic(ctx, func(ctx context.Context) error {
+		record := models.ApprovalRecord{Step: 2, StepName: "Finance", Status: models.TransactionStatusApproved, At: time.Now()}
+		signed, err := repos.Transactions.SignOff(ctx, txn.ID, 1, record)
+		if err != nil {
+			return err
+		}
+		// A caller changing what it was handed must not reach the store either
+		signed.ApprovalHistory[0].Comment = "changed"
+
+		if err := repos.Budgets.SetSpent(ctx, budget.ID, 4000); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("Atomic returned %v, want the callback's error", err)
+	}
+
+	got, err := repos.Transactions.Get(ctx, txn.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.ApprovalHistory) != 1 || got.ApprovalStep != 1 || got.ApprovalHistory[0].Comment != "" {
+		t.Errorf("after rollback the transaction has %d sign-offs at step %d, want the one it had at step 1", len(got.ApprovalHistory), got.ApprovalStep)
+	}
+	gotBudget, err := repos.Budgets.Get(ctx, budget.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotBudget.Spent != 0 {
+		t.Errorf("after rollback the budget has spent %d, want 0", gotBudget.Spent)
+	}
+}
+
+func TestMemoryReturnsCopies(t *testing.T) {
+	ctx := context.Background()
+	_, repos := NewTestRepos(t, models.Company{})
+
+	categoryID := primitive.NewObjectID()
+	budget := models.NewBudget("Travel", categoryID, 5000, "USD", models.BudgetPeriodMonthly, repos.Scope.CompanyID())
+	budget.ID = primitive.NewObjectID()
+	if err := repos.Budgets.Create(ctx, budget); err != nil {
+		t.Fatal(err)
+	}
+	// Changing the caller's value after it was stored must not reach the store
+	budget.CategoryIDs[0] = primitive.NewObjectID()
+
+	got, err := repos.Budgets.Get(ctx, budget.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.CategoryIDs[0] != categoryID {
+		t.Fatal("the stored budget shares its categories with the caller's value")
+	}
+	got.CategoryIDs[0] = primitive.NewObjectID()
+
+	again, err := repos.Budgets.Get(ctx, budget.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.CategoryIDs[0] != categoryID {
+		t.Fatal("a budget returned by Get shares its categories with the stored one")
+	}
+}
+
+func TestMemoryScopeIsolation(t *testing.T) {
+	ctx := context.Background()
+	store, acme := NewTestRepos(t, models.Company{})
+	globex := AddTestCompany(t, store, models.Company{})
+
+	account := &models.Account{ID: primitive.NewObjectID(), Name: "Cash", Type: models.AccountTypeCash, Currency: "USD", IsActive: true}
+	if err := acme.Accounts.Create(ctx, account); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := globex.Accounts.Get(ctx, account.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get across companies returned %v, want ErrNotFound", err)
+	}
+	if accounts, _ := globex.Accounts.List(ctx, false); len(accounts) != 0 {
+		t.Errorf("List across companies returned %d accounts, want none", len(accounts))
+	}
+	if err := globex.Accounts.AdjustBalance(ctx, account.ID, 500); !errors.Is(err, ErrNotFound) {
+		t.Errorf("AdjustBalance across companies returned %v, want ErrNotFound", err)
+	}
+	if company, err := globex.Company.Get(ctx); err != nil || company.ID != globex.Scope.CompanyID() {
+		t.Errorf("Company.Get returned %v, %v; want the scope's own company", company, err)
+	}
+
+	// Creating through a scope pins the document to it, whatever the caller set
+	foreign := &models.Account{ID: primitive.NewObjectID(), Name: "Petty cash", Type: models.AccountTypeCash, Currency: "USD", CompanyID: globex.Scope.CompanyID()}
+	if err := acme.Accounts.Create(ctx, foreign); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := globex.Accounts.Get(ctx, foreign.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("an account created in one company is visible to another: %v", err)
+	}
+}
+
+func TestForCompanyRejectsZeroID(t *testing.T) {
+	if _, err := ForCompany(primitive.NilObjectID); !errors.Is(err, ErrNoScope) {
+		t.Errorf("ForCompany(zero) returned %v, want ErrNoScope", err)
+	}
+}
+
+func TestMemoryUseTOTPStepRefusesReplays(t *testing.T) {
+	ctx := context.Background()
+	store, repos := NewTestRepos(t, models.Company{})
+
+	user := &models.User{ID: primitive.NewObjectID(), Email: "alice@example.com", CompanyID: repos.Scope.CompanyID()}
+	if err := store.Identities().Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		step int64
+		err  error
+	}{
+		{100, nil},
+		{100, ErrNotFound}, // The same code again
+		{99, ErrNotFound},  // An older code still within the skew
+		{101, nil},
+	}
+	for _, tt := range tests {
+		if err := store.Identities().UseTOTPStep(ctx, user.ID, tt.step); !errors.Is(err, tt.err) {
+			t.Errorf("UseTOTPStep(%d) returned %v, want %v", tt.step, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// mongoNotifications reads and writes the company's in-app alerts in MongoDB
+type mongoNotifications struct {
+	collection *mongo.Collection
+	scope      Scope
+}
+
+// List returns userID's notifications, newest first, optionally only the unread ones
+func (r *mongoNotifications) List(ctx context.Context, userID primitive.ObjectID, unreadOnly bool) ([]models.Notification, error) {
+	filter := bson.M{"user_id": userID}
+	if unreadOnly {
+		filter["read_at"] = bson.M{"$exists": false}
+	}
+	var notifications []models.Notification
+	err := findAll(ctx, r.collection, r.scope.filter(filter), &notifications, newestFirst(Page{}))
+	return notifications, err
+}
+
+// Create stores a new notification under the company
+func (r *mongoNotifications) Create(ctx context.Context, notification *models.Notification) error {
+	notification.CompanyID = r.scope.companyID
+	_, err := r.collection.InsertOne(ctx, notification)
+	return err
+}
+
+// MarkRead dismisses userID's notification id at t; dismissing it again keeps the first time
+func (r *mongoNotifications) MarkRead(ctx context.Context, id, userID primitive.ObjectID, t time.Time) error {
+	return updateOne(ctx, r.collection, r.scope.filter(bson.M{
+		"_id":     id,
+		"user_id": userID,
+	}), bson.M{"$min": bson.M{"read_at": t}})
+}
@@ -0,0 +1,309 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Page selects a window of a sorted result set; a zero Limit means no limit
+type Page struct {
+	Skip  int64
+	Limit int64
+}
+
+// CompanyStore reads and writes the company a scope is pinned to
+type CompanyStore interface {
+	Get(ctx context.Context) (*models.Company, error)
+	Create(ctx context.Context, company *models.Company) error
+	Delete(ctx context.Context) error
+	SetApprovalPolicy(ctx context.Context, policy models.ApprovalPolicy) error
+	SetRequire2FA(ctx context.Context, require bool) error
+}
+
+// AccountStore reads and writes the company's financial accounts
+type AccountStore interface {
+	List(ctx context.Context, activeOnly bool) ([]models.Account, error)
+	Get(ctx context.Context, id primitive.ObjectID) (*models.Account, error)
+	Create(ctx context.Context, account *models.Account) error
+	Update(ctx context.Context, id primitive.ObjectID, name, accountType, currency string) error
+	Deactivate(ctx context.Context, id primitive.ObjectID) error
+	AdjustBalance(ctx context.Context, id primitive.ObjectID, delta models.Money) error
+	SetBalance(ctx context.Context, id primitive.ObjectID, balance models.Money) error
+}
+
+// TransactionStore reads and writes the company's transactions
+type TransactionStore interface {
+	List(ctx context.Context, filter TransactionFilter, page Page) ([]models.Transaction, error)
+	Count(ctx context.Context, filter TransactionFilter) (int64, error)
+	Get(ctx context.Context, id primitive.ObjectID) (*models.Transaction, error)
+	Create(ctx context.Context, txn *models.Transaction) error
+	Update(ctx context.Context, id primitive.ObjectID, description string, amount models.Money, categoryID primitive.ObjectID, transactionDate time.Time) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	ChangeStatus(ctx context.Context, id primitive.ObjectID, change StatusChange) (*models.Transaction, error)
+	MarkReversed(ctx context.Context, id, reversalID, replacementID primitive.ObjectID) (*models.Transaction, error)
+	SignOff(ctx context.Context, id primitive.ObjectID, step int, record models.ApprovalRecord) (*models.Transaction, error)
+	Escalate(ctx context.Context, id primitive.ObjectID, step, level int, t time.Time) (*models.Transaction, error)
+}
+
+// CategoryStore reads and writes the company's income and expense categories
+type CategoryStore interface {
+	List(ctx context.Context, activeOnly bool) ([]models.Category, error)
+	Get(ctx context.Context, id primitive.ObjectID) (*models.Category, error)
+	Create(ctx context.Context, category *models.Category) error
+	Update(ctx context.Context, id primitive.ObjectID, name, categoryType, color string) error
+	Deactivate(ctx context.Context, id primitive.ObjectID) error
+	DeleteAll(ctx context.Context) error
+}
+
+// BudgetStore reads and writes the company's spending limits
+type BudgetStore interface {
+	List(ctx context.Context, activeOnly bool) ([]models.Budget, error)
+	Get(ctx context.Context, id primitive.ObjectID) (*models.Budget, error)
+	Create(ctx context.Context, budget *models.Budget) error
+	Update(ctx context.Context, id primitive.ObjectID, name string, amount models.Money) error
+	SetThresholds(ctx context.Context, id primitive.ObjectID, thresholds models.BudgetThresholds) error
+	Deactivate(ctx context.Context, id primitive.ObjectID) error
+	SetSpent(ctx context.Context, id primitive.ObjectID, spent models.Money) error
+	Close(ctx context.Context, id primitive.ObjectID, t time.Time) (*models.Budget, error)
+}
+
+// UserStore reads and manages the company's members
+type UserStore interface {
+	List(ctx context.Context) ([]models.User, error)
+	Get(ctx context.Context, id primitive.ObjectID) (*models.User, error)
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	UpdateRole(ctx context.Context, id primitive.ObjectID, role string) error
+	UpdateDepartment(ctx context.Context, id primitive.ObjectID, department string) error
+}
+
+// InvitationStore reads and writes the company's team invitations
+type InvitationStore interface {
+	ListPending(ctx context.Context) ([]models.Invitation, error)
+	Get(ctx context.Context, id primitive.ObjectID) (*models.Invitation, error)
+	FindPending(ctx context.Context, email string) (*models.Invitation, error)
+	Create(ctx context.Context, invitation *models.Invitation) error
+	Resend(ctx context.Context, id primitive.ObjectID, tokenHash string, sentAt, expiresAt time.Time) error
+	Revoke(ctx context.Context, id primitive.ObjectID, t time.Time) error
+	Claim(ctx context.Context, id primitive.ObjectID, tokenHash string, userID primitive.ObjectID, t time.Time) error
+	Release(ctx context.Context, id primitive.ObjectID) error
+}
+
+// DelegationStore reads and writes the company's approval delegations
+type DelegationStore interface {
+	List(ctx context.Context, userID primitive.ObjectID) ([]models.Delegation, error)
+	ActiveFor(ctx context.Context, userID primitive.ObjectID, t time.Time) ([]models.Delegation, error)
+	Create(ctx context.Context, delegation *models.Delegation) error
+	Revoke(ctx context.Context, id, fromUserID primitive.ObjectID, t time.Time) error
+}
+
+// NotificationStore delivers and dismisses in-app alerts for the company's members
+type NotificationStore interface {
+	List(ctx context.Context, userID primitive.ObjectID, unreadOnly bool) ([]models.Notification, error)
+	Create(ctx context.Context, notification *models.Notification) error
+	MarkRead(ctx context.Context, id, userID primitive.ObjectID, t time.Time) error
+}
+
+// AuditLogStore records and reads the company's audit trail
+type AuditLogStore interface {
+	Insert(ctx context.Context, log *models.AuditLog) error
+	List(ctx context.Context, filter AuditFilter, page Page) ([]models.AuditLog, error)
+	Count(ctx context.Context, filter AuditFilter) (int64, error)
+}
+
+// JournalStore posts and totals the company's double-entry ledger
+type JournalStore interface {
+	Post(ctx context.Context, entry *models.JournalEntry) error
+	ForTransaction(ctx context.Context, transactionID primitive.ObjectID) (*models.JournalEntry, error)
+	Balances(ctx context.Context, asOf time.Time) ([]models.LedgerBalance, error)
+}
+
+// IdentityStore looks users up by their credentials before a company scope exists.
+// It only ever reads or changes the record of the person signing in.
+type IdentityStore interface {
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error)
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	FindByVerifyCode(ctx context.Context, email, code string, now time.Time) (*models.User, error)
+	FindByVerifyToken(ctx context.Context, token string, now time.Time) (*models.User, error)
+	FindByResetToken(ctx context.Context, token string, now time.Time) (*models.User, error)
+	Create(ctx context.Context, user *models.User) error
+	RecordLogin(ctx context.Context, id primitive.ObjectID, at time.Time) error
+	RecordEmailSent(ctx context.Context, id primitive.ObjectID, at time.Time) error
+	SetVerifyCode(ctx context.Context, id primitive.ObjectID, code string, expiresAt, sentAt time.Time) error
+	MarkEmailVerified(ctx context.Context, id primitive.ObjectID) error
+	SetResetToken(ctx context.Context, id primitive.ObjectID, token string, expiresAt time.Time) error
+	SetPassword(ctx context.Context, id primitive.ObjectID, passwordHash string) error
+	JoinCompany(ctx context.Context, id, companyID primitive.ObjectID, role string) error
+	SetPendingTOTPSecret(ctx context.Context, id primitive.ObjectID, secret string) error
+	EnableTOTP(ctx context.Context, id primitive.ObjectID, secret string, step int64, recoveryCodeHashes []string, at time.Time) error
+	DisableTOTP(ctx context.Context, id primitive.ObjectID) error
+	SetRecoveryCodes(ctx context.Context, id primitive.ObjectID, recoveryCodeHashes []string) error
+	UseRecoveryCode(ctx context.Context, id primitive.ObjectID, hash string) error
+	UseTOTPStep(ctx context.Context, id primitive.ObjectID, step int64) error
+}
+
+// Directory looks across companies: for background work that visits every
+// company, and for invitation links followed before the invitee has a scope
+type Directory interface {
+	Companies(ctx context.Context) ([]models.Company, error)
+	InvitationByToken(ctx context.Context, tokenHash string) (*models.Invitation, error)
+}
+
+// Repositories groups the company-scoped repositories for one request
+type Repositories struct {
+	Scope         Scope
+	Company       CompanyStore
+	Accounts      AccountStore
+	Transactions  TransactionStore
+	Categories    CategoryStore
+	Budgets       BudgetStore
+	Users         UserStore
+	AuditLogs     AuditLogStore
+	Journal       JournalStore
+	Delegations   DelegationStore
+	Notifications NotificationStore
+	Invitations   InvitationStore
+
+	atomic func(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// Store hands out repositories bound to a single company
+type Store interface {
+	Scoped(scope Scope) *Repositories
+	Identities() IdentityStore
+	Directory() Directory
+}
+
+var (
+	_ Store = (*MongoStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
+
+// ForRequest returns the repositories for the company bound to the request
+func ForRequest(store Store, c *fiber.Ctx) (*Repositories, error) {
+	scope, err := FromRequest(c)
+	if err != nil {
+		return nil, err
+	}
+	return store.Scoped(scope), nil
+}
+
+// MongoStore is the Store backed by the application database
+type MongoStore struct {
+	client   *mongo.Client
+	database *mongo.Database
+
+	topologyMu    sync.Mutex
+	topologyKnown bool
+	transactions  bool // Whether the server supports multi-document transactions
+}
+
+// NewMongoStore creates a store over the application database
+func NewMongoStore(client *mongo.Client) *MongoStore {
+	return &MongoStore{client: client, database: client.Database("ct")}
+}
+
+// Scoped returns the repositories for an explicit scope
+func (s *MongoStore) Scoped(scope Scope) *Repositories {
+	return &Repositories{
+		Scope:         scope,
+		Company:       &mongoCompanies{collection: s.database.Collection("companies"), scope: scope},
+		Accounts:      &mongoAccounts{collection: s.database.Collection("accounts"), scope: scope},
+		Transactions:  &mongoTransactions{collection: s.database.Collection("transactions"), scope: scope},
+		Categories:    &mongoCategories{collection: s.database.Collection("categories"), scope: scope},
+		Budgets:       &mongoBudgets{collection: s.database.Collection("budgets"), scope: scope},
+		Users:         &mongoUsers{collection: s.database.Collection("users"), scope: scope},
+		AuditLogs:     &mongoAuditLogs{collection: s.database.Collection("audit_logs"), scope: scope},
+		Journal:       &mongoJournal{collection: s.database.Collection("journal_entries"), scope: scope},
+		Delegations:   &mongoDelegations{collection: s.database.Collection("delegations"), scope: scope},
+		Notifications: &mongoNotifications{collection: s.database.Collection("notifications"), scope: scope},
+		Invitations:   &mongoInvitations{collection: s.database.Collection("invitations"), scope: scope},
+		atomic:        s.inTransaction,
+	}
+}
+
+// EnsureIndexes creates the indexes the repositories rely on
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	if err := ensureJournalIndexes(ctx, s.database.Collection("journal_entries")); err != nil {
+		return err
+	}
+	return ensureInvitationIndexes(ctx, s.database.Collection("invitations"))
+}
+
+// Identities returns the unscoped user lookups used by the sign-in flows
+func (s *MongoStore) Identities() IdentityStore {
+	return &mongoIdentities{collection: s.database.Collection("users")}
+}
+
+// Directory returns the lookups across companies
+func (s *MongoStore) Directory() Directory {
+	return &mongoDirectory{
+		companies:   s.database.Collection("companies"),
+		invitations: s.database.Collection("invitations"),
+	}
+}
+
+// findAll decodes every document matching filter into out
+func findAll(ctx context.Context, collection *mongo.Collection, filter bson.M, out interface{}, opts ...*options.FindOptions) error {
+	cursor, err := collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, out)
+}
+
+// findOne decodes a single document, mapping a miss to ErrNotFound
+func findOne(ctx context.Context, collection *mongo.Collection, filter bson.M, out interface{}) error {
+	err := collection.FindOne(ctx, filter).Decode(out)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// updateOne applies update to a single document, mapping a miss to ErrNotFound
+func updateOne(ctx context.Context, collection *mongo.Collection, filter, update bson.M) error {
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// newestFirst sorts by creation time descending and applies the page window
+func newestFirst(page Page) *options.FindOptions {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	if page.Skip > 0 {
+		opts.SetSkip(page.Skip)
+	}
+	if page.Limit > 0 {
+		opts.SetLimit(page.Limit)
+	}
+	return opts
+}
+
+// dateRange builds a [from, until) condition; zero bounds are left open
+func dateRange(from, until time.Time) bson.M {
+	cond := bson.M{}
+	if !from.IsZero() {
+		cond["$gte"] = from
+	}
+	if !until.IsZero() {
+		cond["$lt"] = until
+	}
+	if len(cond) == 0 {
+		return nil
+	}
+	return cond
+}
@@ -0,0 +1,76 @@
+// Package repository provides company-scoped access to the application's collections.
+//
+// Every query adds the scope's company_id, so a document from another company
+// is indistinguishable from one that does not exist. Sign-in, verification and
+// two-factor flows go through the unscoped IdentityStore instead, because they
+// run before a company is known and only touch the caller's own record.
+package repository
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrNoScope is returned when a request has no company to scope queries to
+	ErrNoScope = errors.New("repository: no company scope")
+	// ErrNotFound is returned when a document does not exist within the scope
+	ErrNotFound = errors.New("repository: not found")
+	// ErrStatusChanged is returned when a transaction is no longer in the status a change expected
+	ErrStatusChanged = errors.New("repository: transaction status changed")
+	// ErrAlreadyPosted is returned when a transaction already has a journal entry
+	ErrAlreadyPosted = errors.New("repository: transaction already posted")
+	// ErrPosted is returned when editing or deleting a transaction whose money has moved
+	ErrPosted = errors.New("repository: transaction is posted")
+	// ErrAlreadyReversed is returned when reversing a transaction that is not approved or was already reversed
+	ErrAlreadyReversed = errors.New("repository: transaction already reversed")
+)
+
+// scopeKey is unexported so only this package can bind a scope to a request
+type scopeKey struct{}
+
+// Scope pins every query to a single company
+type Scope struct {
+	companyID primitive.ObjectID
+}
+
+// Bind records the signed-in user's company on the request; called by the auth middleware
+func Bind(c *fiber.Ctx, companyID primitive.ObjectID) {
+	c.Locals(scopeKey{}, Scope{companyID: companyID})
+}
+
+// FromRequest returns the scope bound by the auth middleware
+func FromRequest(c *fiber.Ctx) (Scope, error) {
+	scope, ok := c.Locals(scopeKey{}).(Scope)
+	if !ok || scope.companyID.IsZero() {
+		return Scope{}, ErrNoScope
+	}
+	return scope, nil
+}
+
+// ForCompany scopes to a company resolved outside the auth middleware,
+// such as the user who just signed in or accepted an invitation
+func ForCompany(companyID primitive.ObjectID) (Scope, error) {
+	if companyID.IsZero() {
+		return Scope{}, ErrNoScope
+	}
+	return Scope{companyID: companyID}, nil
+}
+
+// CompanyID returns the company this scope is pinned to
+func (s Scope) CompanyID() primitive.ObjectID {
+	return s.companyID
+}
+
+// filter copies f and forces its company_id to the scope's company
+func (s Scope) filter(f bson.M) bson.M {
+	scoped := bson.M{}
+	for key, value := range f {
+		scoped[key] = value
+	}
+	scoped["company_id"] = s.companyID
+	return scoped
+}
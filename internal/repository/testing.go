@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NewTestRepos returns a new MemoryStore holding company and the company's
+// repositories, for tests. A zero ID, name or currency is filled in.
+func NewTestRepos(t testing.TB, company models.Company) (*MemoryStore, *Repositories) {
+	t.Helper()
+	store := NewMemoryStore()
+	return store, AddTestCompany(t, store, company)
+}
+
+// AddTestCompany adds another company to store and returns its repositories,
+// for tests that need more than one. A zero ID, name or currency is filled in.
+func AddTestCompany(t testing.TB, store *MemoryStore, company models.Company) *Repositories {
+	t.Helper()
+	if company.ID.IsZero() {
+		company.ID = primitive.NewObjectID()
+	}
+	if company.Name == "" {
+		company.Name = "Acme"
+	}
+	if company.Currency == "" {
+		company.Currency = "USD"
+	}
+	if err := store.AddCompany(company); err != nil {
+		t.Fatal(err)
+	}
+	scope, err := ForCompany(company.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store.Scoped(scope)
+}
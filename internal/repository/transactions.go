@@ -0,0 +1,315 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// StatusChange moves a transaction between lifecycle statuses on behalf of Actor
+type StatusChange struct {
+	From   models.TransactionStatus
+	To     models.TransactionStatus
+	Actor  *models.User
+	Reason string // Why it was rejected
+	// The approval decision to add to the history; approving also counts its step
+	Record *models.ApprovalRecord
+	// Submitting: whether it goes over a budget that needs an extra sign-off
+	BudgetOverride bool
+}
+
+// TransactionFilter narrows a transaction listing; zero fields match everything
+type TransactionFilter struct {
+	Type   models.TransactionType
+	Status models.TransactionStatus
+	Posted bool      // Only transactions whose money has moved; ignored when Status is set
+	From   time.Time // Inclusive lower bound on transaction_date
+	Until  time.Time // Exclusive upper bound on transaction_date
+	// Related matches the transaction with this ID and every reversal or replacement linked to it
+	Related primitive.ObjectID
+}
+
+func (f TransactionFilter) bson() bson.M {
+	filter := bson.M{}
+	if f.Type != "" {
+		filter["type"] = f.Type
+	}
+	if f.Status != "" {
+		filter["status"] = f.Status
+	} else if f.Posted {
+		filter["status"] = bson.M{"$in": models.PostedStatuses}
+	}
+	if cond := dateRange(f.From, f.Until); cond != nil {
+		filter["transaction_date"] = cond
+	}
+	if !f.Related.IsZero() {
+		filter["$or"] = bson.A{
+			bson.M{"_id": f.Related},
+			bson.M{"reverses_id": f.Related},
+			bson.M{"reversed_by_id": f.Related},
+			bson.M{"replaces_id": f.Related},
+			bson.M{"replaced_by_id": f.Related},
+		}
+	}
+	return filter
+}
+
+// mongoTransactions reads and writes the company's transactions in MongoDB
+type mongoTransactions struct {
+	collection *mongo.Collection
+	scope      Scope
+}
+
+// List returns matching transactions, newest first
+func (r *mongoTransactions) List(ctx context.Context, filter TransactionFilter, page Page) ([]models.Transaction, error) {
+	var transactions []models.Transaction
+	err := findAll(ctx, r.collection, r.scope.filter(filter.bson()), &transactions, newestFirst(page))
+	return transactions, err
+}
+
+// Count returns how many transactions match
+func (r *mongoTransactions) Count(ctx context.Context, filter TransactionFilter) (int64, error) {
+	return r.collection.CountDocuments(ctx, r.scope.filter(filter.bson()))
+}
+
+// Get returns a single transaction
+func (r *mongoTransactions) Get(ctx context.Context, id primitive.ObjectID) (*models.Transaction, error) {
+	var txn models.Transaction
+	if err := findOne(ctx, r.collection, r.scope.filter(bson.M{"_id": id}), &txn); err != nil {
+		return nil, err
+	}
+	return &txn, nil
+}
+
+// Create stores a new transaction under the company
+func (r *mongoTransactions) Create(ctx context.Context, txn *models.Transaction) error {
+	txn.CompanyID = r.scope.companyID
+	_, err := r.collection.InsertOne(ctx, txn)
+	return err
+}
+
+// Update changes a transaction's description and amount, and its category and date when set.
+// Posted transactions are left alone and give ErrPosted.
+func (r *mongoTransactions) Update(ctx context.Context, id primitive.ObjectID, description string, amount models.Money, categoryID primitive.ObjectID, transactionDate time.Time) error {
+	fields := bson.M{
+		"description": description,
+		"amount":      amount,
+		"updated_at":  time.Now(),
+	}
+	if !categoryID.IsZero() {
+		fields["category_id"] = categoryID
+	}
+	if !transactionDate.IsZero() {
+		fields["transaction_date"] = transactionDate
+	}
+	err := updateOne(ctx, r.collection, r.notPosted(id), bson.M{"$set": fields})
+	if errors.Is(err, ErrNotFound) {
+		return r.postedOrMissing(ctx, id)
+	}
+	return err
+}
+
+// Delete removes a transaction that is not posted, or returns ErrPosted
+func (r *mongoTransactions) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, r.notPosted(id))
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return r.postedOrMissing(ctx, id)
+	}
+	return nil
+}
+
+// notPosted matches the transaction only while its money has not moved, so an
+// edit racing an approval cannot change a posted amount
+func (r *mongoTransactions) notPosted(id primitive.ObjectID) bson.M {
+	return r.scope.filter(bson.M{"_id": id, "status": bson.M{"$nin": models.PostedStatuses}})
+}
+
+// postedOrMissing explains why notPosted matched nothing
+func (r *mongoTransactions) postedOrMissing(ctx context.Context, id primitive.ObjectID) error {
+	if _, err := r.Get(ctx, id); err != nil {
+		return err
+	}
+	return ErrPosted
+}
+
+// MarkReversed links a voided transaction to its reversal and, for a correction,
+// its replacement. Only the first reversal of a transaction succeeds; later ones
+// get ErrAlreadyReversed.
+func (r *mongoTransactions) MarkReversed(ctx context.Context, id, reversalID, replacementID primitive.ObjectID) (*models.Transaction, error) {
+	fields := bson.M{
+		"reversed_by_id": reversalID,
+		"updated_at":     time.Now(),
+	}
+	if !replacementID.IsZero() {
+		fields["replaced_by_id"] = replacementID
+	}
+
+	var txn models.Transaction
+	err := r.collection.FindOneAndUpdate(ctx,
+		r.scope.filter(bson.M{
+			"_id":            id,
+			"status":         models.TransactionStatusVoided,
+			"reverses_id":    bson.M{"$exists": false},
+			"reversed_by_id": bson.M{"$exists": false},
+		}),
+		bson.M{"$set": fields},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&txn)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if _, err := r.Get(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrAlreadyReversed
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &txn, nil
+}
+
+// ChangeStatus moves a transaction from change.From to change.To and records who
+// did it. It only matches while the transaction is still in change.From, so of
+// two racing changes only the first succeeds and the other gets ErrStatusChanged.
+func (r *mongoTransactions) ChangeStatus(ctx context.Context, id primitive.ObjectID, change StatusChange) (*models.Transaction, error) {
+	now := time.Now()
+	set := bson.M{
+		"status":     change.To,
+		"updated_at": now,
+	}
+	update := bson.M{"$set": set}
+	unset := bson.M{}
+	if change.Record != nil {
+		update["$push"] = bson.M{"approval_history": change.Record}
+	}
+	if change.To == models.TransactionStatusApproved {
+		update["$inc"] = bson.M{"approval_step": 1}
+	} else {
+		// Any other move ends the current round of sign-offs
+		unset["approval_step"] = ""
+	}
+	// The wait for a decision starts over, if there is one
+	unset["escalation_level"] = ""
+	unset["escalated_at"] = ""
+	switch change.To {
+	case models.TransactionStatusApproved, models.TransactionStatusRejected:
+		set["approved_by_id"] = change.Actor.ID
+		set["approved_by_name"] = change.Actor.Name
+		set["approved_at"] = now
+		if change.To == models.TransactionStatusRejected {
+			set["rejection_reason"] = change.Reason
+		}
+	case models.TransactionStatusPaid:
+		set["paid_by_id"] = change.Actor.ID
+		set["paid_by_name"] = change.Actor.Name
+		set["paid_at"] = now
+	case models.TransactionStatusDraft, models.TransactionStatusPending:
+		// Back with its creator; a previous decision no longer applies
+		unset["approved_by_id"] = ""
+		unset["approved_by_name"] = ""
+		unset["approved_at"] = ""
+		unset["rejection_reason"] = ""
+		if change.To == models.TransactionStatusPending {
+			set["submitted_at"] = now
+		}
+		if change.BudgetOverride {
+			set["budget_override"] = true
+		} else {
+			unset["budget_override"] = ""
+		}
+	}
+	update["$unset"] = unset
+
+	var txn models.Transaction
+	err := r.collection.FindOneAndUpdate(ctx,
+		r.scope.filter(bson.M{"_id": id, "status": change.From}),
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&txn)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if _, err := r.Get(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrStatusChanged
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &txn, nil
+}
+
+// SignOff records record against step, the number of steps already signed off,
+// without changing the status. It only matches a pending transaction still at
+// step, so of two racing sign-offs only the first succeeds and the other gets
+// ErrStatusChanged.
+func (r *mongoTransactions) SignOff(ctx context.Context, id primitive.ObjectID, step int, record models.ApprovalRecord) (*models.Transaction, error) {
+	filter := bson.M{"_id": id, "status": models.TransactionStatusPending, "approval_step": step}
+	if step == 0 {
+		// Never signed off: the field is not stored
+		filter["approval_step"] = bson.M{"$in": bson.A{0, nil}}
+	}
+
+	var txn models.Transaction
+	err := r.collection.FindOneAndUpdate(ctx,
+		r.scope.filter(filter),
+		bson.M{
+			"$set":  bson.M{"updated_at": time.Now()},
+			"$inc":  bson.M{"approval_step": 1},
+			"$push": bson.M{"approval_history": record},
+			// The next step's wait starts now
+			"$unset": bson.M{"escalation_level": "", "escalated_at": ""},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&txn)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if _, err := r.Get(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrStatusChanged
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &txn, nil
+}
+
+// Escalate raises a pending transaction's escalation level to level at t. It only
+// matches while the transaction is still waiting on step, the number of steps
+// already signed off, below level, so each level is escalated once; otherwise
+// it returns ErrStatusChanged.
+func (r *mongoTransactions) Escalate(ctx context.Context, id primitive.ObjectID, step, level int, t time.Time) (*models.Transaction, error) {
+	filter := bson.M{
+		"_id":              id,
+		"status":           models.TransactionStatusPending,
+		"approval_step":    step,
+		"escalation_level": bson.M{"$not": bson.M{"$gte": level}},
+	}
+	if step == 0 {
+		filter["approval_step"] = bson.M{"$in": bson.A{0, nil}}
+	}
+
+	var txn models.Transaction
+	err := r.collection.FindOneAndUpdate(ctx,
+		r.scope.filter(filter),
+		bson.M{"$set": bson.M{"escalation_level": level, "escalated_at": t}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&txn)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if _, err := r.Get(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrStatusChanged
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &txn, nil
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/minhtranin/ct/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// mongoUsers reads and manages the company's members in MongoDB
+type mongoUsers struct {
+	collection *mongo.Collection
+	scope      Scope
+}
+
+// List returns every member of the company
+func (r *mongoUsers) List(ctx context.Context) ([]models.User, error) {
+	var users []models.User
+	err := findAll(ctx, r.collection, r.scope.filter(bson.M{}), &users)
+	return users, err
+}
+
+// Get returns a single member
+func (r *mongoUsers) Get(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	var user models.User
+	if err := findOne(ctx, r.collection, r.scope.filter(bson.M{"_id": id}), &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// FindByEmail returns the member with the given email
+func (r *mongoUsers) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	if err := findOne(ctx, r.collection, r.scope.filter(bson.M{"email": email}), &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpdateRole changes a member's role
+func (r *mongoUsers) UpdateRole(ctx context.Context, id primitive.ObjectID, role string) error {
+	return updateOne(ctx, r.collection, r.scope.filter(bson.M{"_id": id}), bson.M{
+		"$set": bson.M{
+			"role":       role,
+			"updated_at": time.Now(),
+		},
+	})
+}
+
+// UpdateDepartment changes the department or cost center a member's expenses are charged to
+func (r *mongoUsers) UpdateDepartment(ctx context.Context, id primitive.ObjectID, department string) error {
+	return updateOne(ctx, r.collection, r.scope.filter(bson.M{"_id": id}), bson.M{
+		"$set": bson.M{
+			"department": department,
+			"updated_at": time.Now(),
+		},
+	})
+}
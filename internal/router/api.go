@@ -12,6 +12,8 @@ func registerAPI(app *fiber.App) {
 	// Public routes - NO auth middleware
 	app.Post("/api/auth/signup", handler.SignUp)
 	app.Post("/api/auth/signin", handler.SignIn)
+	app.Post("/api/auth/2fa", handler.VerifyTwoFactor)
+	app.Post("/api/invitations/accept", handler.AcceptInvitation)
 	app.Post("/api/auth/verify-code", handler.VerifyCode)
 	app.Post("/api/auth/resend-verification", handler.ResendVerification)
 	app.Post("/api/auth/forgot-password", handler.ForgotPassword)
@@ -25,10 +27,18 @@ func registerAPI(app *fiber.App) {
 	app.Post("/api/transactions", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleEmployee]), handler.CreateTransaction)
 	app.Post("/api/transactions/:id", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleEmployee]), handler.UpdateTransaction)
 	app.Post("/api/transactions/:id/delete", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleEmployee]), handler.DeleteTransaction)
+	app.Post("/api/transactions/:id/submit", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleEmployee]), handler.SubmitTransaction)
+	app.Post("/api/transactions/:id/withdraw", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleEmployee]), handler.WithdrawTransaction)
+	app.Post("/api/transactions/:id/resubmit", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleEmployee]), handler.ResubmitTransaction)
 
-	// Approval routes - holder+
-	app.Post("/api/transactions/:id/approve", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleHolder]), handler.ApproveTransaction)
-	app.Post("/api/transactions/:id/reject", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleHolder]), handler.RejectTransaction)
+	// Approval routes - holder+, or anyone holding delegated approval authority,
+	// which the lifecycle checks
+	app.Post("/api/transactions/:id/approve", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleEmployee]), handler.ApproveTransaction)
+	app.Post("/api/transactions/:id/reject", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleEmployee]), handler.RejectTransaction)
+	app.Post("/api/approvals/bulk", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleEmployee]), handler.DecideTransactions)
+
+	// Settlement routes - accountant+
+	app.Post("/api/transactions/:id/pay", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleAccountant]), handler.PayTransaction)
 
 	// Account routes - admin+
 	app.Post("/api/accounts", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleAdmin]), handler.CreateAccount)
@@ -47,4 +57,37 @@ func registerAPI(app *fiber.App) {
 
 	// User management routes - manager+
 	app.Post("/api/users/:id/role", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleManager]), handler.UpdateUserRole)
+	app.Post("/api/users/:id/department", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleManager]), handler.UpdateUserDepartment)
+	app.Post("/api/users/:id/sessions/revoke", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleManager]), handler.RevokeUserSessions)
+	app.Post("/api/users/:id/unlock", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleAdmin]), handler.UnlockUser)
+
+	// Invitation routes - manager+
+	app.Post("/api/invitations", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleManager]), handler.CreateInvitation)
+	app.Post("/api/invitations/:id/resend", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleManager]), handler.ResendInvitation)
+	app.Post("/api/invitations/:id/revoke", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleManager]), handler.RevokeInvitation)
+
+	// Session routes - any authenticated user
+	app.Post("/api/sessions/revoke-all", middleware.RequireAuth(), handler.SignOutEverywhere)
+	app.Post("/api/sessions/:id/revoke", middleware.RequireAuth(), handler.RevokeSession)
+
+	// Notification routes - any authenticated user
+	app.Post("/api/notifications/:id/read", middleware.RequireAuth(), handler.DismissNotification)
+
+	// Two-factor routes - any authenticated user
+	app.Post("/api/account/2fa/enable", middleware.RequireAuth(), handler.EnableTwoFactor)
+	app.Post("/api/account/2fa/disable", middleware.RequireAuth(), handler.DisableTwoFactor)
+	app.Post("/api/account/2fa/recovery-codes", middleware.RequireAuth(), handler.RegenerateRecoveryCodes)
+
+	// Approval delegation - holder+
+	app.Post("/api/delegations", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleHolder]), handler.CreateDelegation)
+	app.Post("/api/delegations/:id/revoke", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleHolder]), handler.RevokeDelegation)
+
+	// Reconciliation - admin+
+	app.Post("/api/reconcile", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleAdmin]), handler.Reconcile)
+
+	// Settings routes - admin+
+	app.Post("/api/settings/security", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleAdmin]), handler.UpdateSecuritySettings)
+	app.Post("/api/settings/approvals", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleAdmin]), handler.UpdateApprovalPolicy)
+	app.Post("/api/settings/workflows", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleAdmin]), handler.CreateApprovalWorkflow)
+	app.Post("/api/settings/workflows/:id/delete", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleAdmin]), handler.DeleteApprovalWorkflow)
 }
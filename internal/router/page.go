@@ -11,10 +11,12 @@ func registerPages(r fiber.Router) {
 	// Public pages - NO auth middleware
 	r.Get("/", page.Home)
 	r.Get("/signin", page.SignIn)
+	r.Get("/signin/2fa", page.TwoFactorChallenge)
 	r.Get("/signup", page.SignUp)
 	r.Get("/verify-email", page.VerifyEmailPage)
 	r.Get("/forgot-password", page.ForgotPassword)
 	r.Get("/reset-password", page.ResetPassword)
+	r.Get("/invitations/accept", page.AcceptInvitation)
 	r.Get("/logout", page.Logout)
 
 	// Protected pages - apply RequireAuth individually to avoid catching API routes
@@ -29,12 +31,17 @@ func registerPages(r fiber.Router) {
 
 	// Income & Expense Management pages
 	r.Get("/transactions", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleEmployee]), page.TransactionsPage)
+	r.Get("/transactions/budget-check", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleEmployee]), page.BudgetCheck)
 
-	// Approval pages (holder+)
-	r.Get("/approvals", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleHolder]), page.ApprovalsPage)
+	// Approval pages (holder+, or anyone holding delegated approval authority)
+	r.Get("/approvals", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleEmployee]), page.ApprovalsPage)
 
 	// Reporting pages (accountant+)
 	r.Get("/reports", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleAccountant]), page.ReportsPage)
+	r.Get("/reports/trial-balance", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleAccountant]), page.TrialBalancePage)
+	r.Get("/reports/approvals", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleAccountant]), page.ApprovalTurnaroundPage)
+	r.Get("/reports/budgets", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleAccountant]), page.BudgetVariancePage)
+	r.Get("/reports/budgets/export", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleAccountant]), page.BudgetVarianceExport)
 	r.Get("/audit", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleAccountant]), page.AuditPage)
 
 	// Management pages (admin+)
@@ -42,7 +49,14 @@ func registerPages(r fiber.Router) {
 	r.Get("/categories", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleAdmin]), page.CategoriesPage)
 	r.Get("/budgets", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleAdmin]), page.BudgetsPage)
 	r.Get("/settings", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleAdmin]), page.SettingsPage)
+	r.Get("/reconcile", middleware.RequireAuth(), middleware.RequireRole(auth.RoleLevel[auth.RoleAdmin]), page.ReconcilePage)
 
 	// Team page - employee+
 	r.Get("/team", middleware.RequireAuth(), page.TeamPage)
+
+	// Active sessions (all authenticated users)
+	r.Get("/sessions", middleware.RequireAuth(), page.SessionsPage)
+
+	// Two-factor authentication (all authenticated users)
+	r.Get("/account/2fa", middleware.RequireAuth(), page.TwoFactorPage)
 }
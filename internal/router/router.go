@@ -1,8 +1,14 @@
 package router
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/minhtranin/ct/internal/middleware"
+)
 
 func Register(app *fiber.App) {
+	// Every state-changing request must carry the CSRF token
+	app.Use(middleware.CSRF())
+
 	registerPages(app)
 	registerAPI(app)
 }